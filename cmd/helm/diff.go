@@ -0,0 +1,92 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+var diffHelp = `
+This command consists of multiple subcommands which can be used to preview
+the changes an operation would make to a release, including:
+
+- The changes an upgrade to a new chart or new values would apply
+- The changes a rollback to a previous revision would apply
+- The changes between two revisions of a release
+
+By default, the rendered manifest is compared with the manifest recorded for
+the release. Use '--live' to compare against the objects in the cluster instead.
+The data of Secrets is masked unless '--show-secrets' is set.
+`
+
+func newDiffCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "preview the changes to a release",
+		Long:  diffHelp,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(newDiffUpgradeCmd(cfg, out))
+	cmd.AddCommand(newDiffRollbackCmd(cfg, out))
+	cmd.AddCommand(newDiffRevisionCmd(cfg, out))
+
+	return cmd
+}
+
+func addDiffFlags(f *pflag.FlagSet, client *action.Diff) {
+	f.IntVarP(&client.Context, "context", "C", 3, "number of unchanged lines to show around each change")
+	f.BoolVar(&client.ShowSecrets, "show-secrets", false, "do not mask the data of Secrets in the output")
+	f.BoolVar(&client.Live, "live", false, "compare against the objects in the cluster instead of the recorded release manifest")
+}
+
+type diffWriter struct {
+	diffs []*action.ResourceDiff
+}
+
+func (w *diffWriter) WriteTable(out io.Writer) error {
+	if len(w.diffs) == 0 {
+		_, err := fmt.Fprintln(out, "No changes.")
+		return err
+	}
+	for _, d := range w.diffs {
+		name := d.Name
+		if d.Namespace != "" {
+			name = d.Namespace + "/" + d.Name
+		}
+		if _, err := fmt.Fprintf(out, "%s %s (%s) %s:\n%s\n", d.Kind, name, d.APIVersion, d.Change, d.Diff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *diffWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, w.diffs)
+}
+
+func (w *diffWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, w.diffs)
+}
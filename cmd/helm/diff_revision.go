@@ -0,0 +1,85 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+const diffRevisionHelp = `
+This command shows the changes between two revisions of a release.
+
+If only one revision is given, it is compared with the latest revision.
+
+    $ helm diff revision angry-bird 2 4
+`
+
+func newDiffRevisionCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewDiff(cfg)
+	var outfmt output.Format
+
+	cmd := &cobra.Command{
+		Use:   "revision <RELEASE> REVISION1 [REVISION2]",
+		Short: "show the changes between two revisions of a release",
+		Long:  diffRevisionHelp,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := require.MinimumNArgs(2)(cmd, args); err != nil {
+				return err
+			}
+			return require.MaximumNArgs(3)(cmd, args)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return compListReleases(toComplete, cfg)
+			}
+			if len(args) < 3 {
+				return compListRevisions(toComplete, cfg, args[0])
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// A revision of 0 refers to the latest revision of the release.
+			revisions := make([]int, 2)
+			for i, arg := range args[1:] {
+				rev, err := strconv.Atoi(arg)
+				if err != nil {
+					return fmt.Errorf("could not convert revision to a number: %v", err)
+				}
+				revisions[i] = rev
+			}
+
+			diffs, err := client.Revisions(args[0], revisions[0], revisions[1])
+			if err != nil {
+				return err
+			}
+			return outfmt.Write(out, &diffWriter{diffs})
+		},
+	}
+
+	addDiffFlags(cmd.Flags(), client)
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
@@ -0,0 +1,83 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+const diffRollbackHelp = `
+This command shows the changes a rollback of a release would apply.
+
+The first argument is the name of a release, and the second is the revision
+to roll back to. If the revision is omitted, the previous revision is used.
+`
+
+func newDiffRollbackCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewDiff(cfg)
+	var outfmt output.Format
+
+	cmd := &cobra.Command{
+		Use:   "rollback <RELEASE> [REVISION]",
+		Short: "show the changes a rollback would apply",
+		Long:  diffRollbackHelp,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := require.MinimumNArgs(1)(cmd, args); err != nil {
+				return err
+			}
+			return require.MaximumNArgs(2)(cmd, args)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return compListReleases(toComplete, cfg)
+			}
+			if len(args) == 1 {
+				return compListRevisions(toComplete, cfg, args[0])
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var version int
+			if len(args) > 1 {
+				ver, err := strconv.Atoi(args[1])
+				if err != nil {
+					return fmt.Errorf("could not convert revision to a number: %v", err)
+				}
+				version = ver
+			}
+
+			diffs, err := client.Rollback(args[0], version)
+			if err != nil {
+				return err
+			}
+			return outfmt.Write(out, &diffWriter{diffs})
+		},
+	}
+
+	addDiffFlags(cmd.Flags(), client)
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
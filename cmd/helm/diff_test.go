@@ -0,0 +1,107 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/internal/test/ensure"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestDiffCmd(t *testing.T) {
+	tmpChart := ensure.TempDir(t)
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV1,
+			Name:       "diffchart",
+			Version:    "0.1.0",
+		},
+		Values: map[string]interface{}{"drink": "tea"},
+		Templates: []*chart.File{
+			{Name: "templates/configmap.yaml", Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: drinks\ndata:\n  drink: {{ .Values.drink }}\n")},
+		},
+	}
+	if err := chartutil.SaveDir(ch, tmpChart); err != nil {
+		t.Fatalf("Error creating chart for diff: %v", err)
+	}
+	chartPath := filepath.Join(tmpChart, ch.Metadata.Name)
+
+	relWithManifest := func(v int, status release.Status, manifest string) *release.Release {
+		rel := release.Mock(&release.MockReleaseOptions{Name: "funny-bunny", Version: v, Chart: ch, Status: status})
+		rel.Manifest = manifest
+		return rel
+	}
+	teaManifest := "---\n# Source: diffchart/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: drinks\ndata:\n  drink: tea\n"
+	coffeeManifest := "---\n# Source: diffchart/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: drinks\ndata:\n  drink: coffee\n"
+	rels := []*release.Release{
+		relWithManifest(1, release.StatusSuperseded, teaManifest),
+		relWithManifest(2, release.StatusDeployed, coffeeManifest),
+	}
+
+	tests := []cmdTestCase{{
+		name:   "diff upgrade",
+		cmd:    fmt.Sprintf("diff upgrade funny-bunny '%s' --set drink=water", chartPath),
+		golden: "output/diff-upgrade.txt",
+		rels:   rels,
+	}, {
+		name:   "diff upgrade without changes",
+		cmd:    fmt.Sprintf("diff upgrade funny-bunny '%s' --set drink=coffee", chartPath),
+		golden: "output/diff-no-changes.txt",
+		rels:   rels,
+	}, {
+		name:   "diff rollback",
+		cmd:    "diff rollback funny-bunny",
+		golden: "output/diff-rollback.txt",
+		rels:   rels,
+	}, {
+		name:      "diff rollback with too many arguments",
+		cmd:       "diff rollback funny-bunny 1 2",
+		golden:    "output/diff-rollback-too-many-args.txt",
+		rels:      rels,
+		wantError: true,
+	}, {
+		name:   "diff revisions as json",
+		cmd:    "diff revision funny-bunny 1 2 -o json",
+		golden: "output/diff-revision.json",
+		rels:   rels,
+	}, {
+		name:      "diff revision with invalid revision",
+		cmd:       "diff revision funny-bunny one",
+		golden:    "output/diff-revision-invalid.txt",
+		rels:      rels,
+		wantError: true,
+	}, {
+		name:      "diff revision with too many arguments",
+		cmd:       "diff revision funny-bunny 1 2 3",
+		golden:    "output/diff-revision-too-many-args.txt",
+		rels:      rels,
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestDiffFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "diff", false)
+	checkFileCompletion(t, "diff rollback", false)
+	checkFileCompletion(t, "diff rollback myrelease", false)
+	checkFileCompletion(t, "diff revision myrelease", false)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli/output"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+const diffUpgradeHelp = `
+This command shows the changes an upgrade of a release would apply.
+
+It accepts the same arguments as 'helm upgrade'. The chart is rendered the
+same way an upgrade would render it and compared with the deployed release.
+Nothing is changed in the cluster.
+
+    $ helm diff upgrade -f myvalues.yaml redis ./redis
+`
+
+func newDiffUpgradeCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewDiff(cfg)
+	upgrade := action.NewUpgrade(cfg)
+	valueOpts := &values.Options{}
+	var outfmt output.Format
+
+	cmd := &cobra.Command{
+		Use:   "upgrade [RELEASE] [CHART]",
+		Short: "show the changes an upgrade would apply",
+		Long:  diffUpgradeHelp,
+		Args:  require.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return compListReleases(toComplete, cfg)
+			}
+			if len(args) == 1 {
+				return compListCharts(toComplete, true)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upgrade.Namespace = settings.Namespace()
+
+			if upgrade.Version == "" && upgrade.Devel {
+				debug("setting version to >0.0.0-0")
+				upgrade.Version = ">0.0.0-0"
+			}
+
+			chartPath, err := upgrade.ChartPathOptions.LocateChart(args[1], settings)
+			if err != nil {
+				return err
+			}
+
+			vals, err := valueOpts.MergeValues(getter.All(settings))
+			if err != nil {
+				return err
+			}
+
+			ch, err := loader.Load(chartPath)
+			if err != nil {
+				return err
+			}
+			if req := ch.Metadata.Dependencies; req != nil {
+				if err := action.CheckDependencies(ch, req); err != nil {
+					return err
+				}
+			}
+
+			diffs, err := client.Upgrade(upgrade, args[0], ch, vals)
+			if err != nil {
+				return err
+			}
+			return outfmt.Write(out, &diffWriter{diffs})
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&upgrade.Devel, "devel", false, "use development versions, too. Equivalent to version '>0.0.0-0'. If --version is set, this is ignored")
+	f.BoolVar(&upgrade.DisableOpenAPIValidation, "disable-openapi-validation", false, "if set, the rendered templates are not validated against the Kubernetes OpenAPI Schema")
+	f.BoolVar(&upgrade.ResetValues, "reset-values", false, "when upgrading, reset the values to the ones built into the chart")
+	f.BoolVar(&upgrade.ReuseValues, "reuse-values", false, "when upgrading, reuse the last release's values and merge in any overrides from the command line via --set and -f. If '--reset-values' is specified, this is ignored")
+	f.BoolVar(&upgrade.SubNotes, "render-subchart-notes", false, "if set, render subchart notes along with the parent")
+	addDiffFlags(f, client)
+	addChartPathOptionsFlags(f, &upgrade.ChartPathOptions)
+	addValueOptionsFlags(f, valueOpts)
+	bindOutputFlag(cmd, &outfmt)
+	bindPostRenderFlag(cmd, &upgrade.PostRenderer)
+
+	err := cmd.RegisterFlagCompletionFunc("version", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 2 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return compVersionFlag(args[1], toComplete)
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return cmd
+}
@@ -0,0 +1,136 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+const outputEventsFlag = "output-events"
+
+var eventFormats = []string{"text", "json"}
+
+// bindOutputEventsFlag adds the output-events flag to the given command. When
+// it is set, the progress events of the actions run with cfg are printed to
+// the error stream of the command.
+func bindOutputEventsFlag(cmd *cobra.Command, cfg *action.Configuration) {
+	cmd.Flags().Var(&outputEventsValue{cfg: cfg, out: cmd.ErrOrStderr}, outputEventsFlag,
+		fmt.Sprintf("print progress events to stderr in the specified format. Allowed values: %s", strings.Join(eventFormats, ", ")))
+
+	err := cmd.RegisterFlagCompletionFunc(outputEventsFlag, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var formatNames []string
+		for _, format := range eventFormats {
+			if strings.HasPrefix(format, toComplete) {
+				formatNames = append(formatNames, format)
+			}
+		}
+		return formatNames, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type outputEventsValue struct {
+	cfg    *action.Configuration
+	out    func() io.Writer
+	format string
+}
+
+func (o *outputEventsValue) String() string {
+	return o.format
+}
+
+func (o *outputEventsValue) Type() string {
+	return "format"
+}
+
+func (o *outputEventsValue) Set(s string) error {
+	p := &eventPrinter{out: o.out}
+	switch s {
+	case "text":
+	case "json":
+		p.json = true
+	default:
+		return errors.Errorf("invalid format %q, must be one of: %s", s, strings.Join(eventFormats, ", "))
+	}
+	o.format = s
+	o.cfg.Observer = p
+	return nil
+}
+
+// eventPrinter prints progress events, one per line, either as text meant to
+// be read by people or as JSON objects meant to be parsed.
+type eventPrinter struct {
+	out  func() io.Writer
+	json bool
+
+	mu sync.Mutex
+}
+
+func (p *eventPrinter) OnEvent(e action.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := p.out()
+	if p.json {
+		if err := json.NewEncoder(out).Encode(e); err != nil {
+			log.Printf("failed to print event: %s", err)
+		}
+		return
+	}
+	fmt.Fprintln(out, formatEvent(e))
+}
+
+// formatEvent describes the event in a single line of text.
+func formatEvent(e action.Event) string {
+	var line string
+	switch e.Type {
+	case action.EventResourceCreated:
+		line = fmt.Sprintf("created %s", e.Resource)
+	case action.EventResourceUpdated:
+		line = fmt.Sprintf("updated %s", e.Resource)
+	case action.EventResourceDeleted:
+		line = fmt.Sprintf("deleted %s", e.Resource)
+	case action.EventResourceWaiting:
+		line = fmt.Sprintf("waiting for %s", e.Resource)
+		if e.Message != "" {
+			line += ": " + e.Message
+		}
+	case action.EventResourceReady:
+		line = fmt.Sprintf("%s is ready", e.Resource)
+	case action.EventHookStarted, action.EventHookFinished:
+		line = fmt.Sprintf("%s hook %s %s: %s", e.Hook.Event, e.Hook.Kind, e.Hook.Name, strings.ToLower(e.Hook.Phase.String()))
+	default:
+		line = e.Message
+	}
+	if e.Error != "" {
+		line += ": " + e.Error
+	}
+	return line
+}
@@ -0,0 +1,86 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestOutputEvents(t *testing.T) {
+	tests := []cmdTestCase{{
+		name:   "install with text events",
+		cmd:    "install aeneas testdata/testcharts/object-order --namespace default --output-events text",
+		golden: "output/install-output-events.txt",
+	}, {
+		name:      "install with invalid events format",
+		cmd:       "install aeneas testdata/testcharts/empty --output-events yaml",
+		golden:    "output/install-output-events-invalid.txt",
+		wantError: true,
+	}, {
+		name:   "completion for output-events flag",
+		cmd:    "__complete upgrade aeneas testdata/testcharts/empty --output-events ''",
+		golden: "output/output-events-comp.txt",
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestEventPrinter(t *testing.T) {
+	deployment := &action.EventResource{Kind: "Deployment", Name: "web", Namespace: "default"}
+	hook := &action.EventHook{Name: "migrate", Kind: "Job", Event: release.HookPreUpgrade, Phase: release.HookPhaseFailed}
+	events := []action.Event{
+		{Type: action.EventRendered, Message: "rendered chart web with 1 hooks"},
+		{Type: action.EventHookFinished, Hook: hook, Error: "job failed: BackoffLimitExceeded"},
+		{Type: action.EventResourceUpdated, Resource: deployment},
+		{Type: action.EventResourceWaiting, Resource: deployment, Message: "Deployment is not ready: default/web. 0 out of 1 expected pods are ready"},
+		{Type: action.EventResourceReady, Resource: deployment},
+		{Type: action.EventResourceDeleted, Resource: &action.EventResource{Kind: "ClusterRole", Name: "web"}},
+	}
+
+	var text bytes.Buffer
+	p := &eventPrinter{out: func() io.Writer { return &text }}
+	for _, e := range events {
+		p.OnEvent(e)
+	}
+	expected := `rendered chart web with 1 hooks
+pre-upgrade hook Job migrate: failed: job failed: BackoffLimitExceeded
+updated Deployment default/web
+waiting for Deployment default/web: Deployment is not ready: default/web. 0 out of 1 expected pods are ready
+Deployment default/web is ready
+deleted ClusterRole web
+`
+	if text.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, text.String())
+	}
+
+	var js bytes.Buffer
+	p = &eventPrinter{out: func() io.Writer { return &js }, json: true}
+	p.OnEvent(action.Event{
+		Type:     action.EventResourceReady,
+		Time:     time.Date(2021, time.March, 4, 10, 30, 0, 0, time.UTC),
+		Resource: deployment,
+	})
+	expected = `{"type":"resource-ready","time":"2021-03-04T10:30:00Z","resource":{"kind":"Deployment","name":"web","namespace":"default"}}` + "\n"
+	if js.String() != expected {
+		t.Errorf("expected %s, got %s", expected, js.String())
+	}
+}
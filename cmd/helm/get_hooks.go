@@ -20,21 +20,30 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
 )
 
 const getHooksHelp = `
 This command downloads hooks for a given release.
 
 Hooks are formatted in YAML and separated by the YAML '---\n' separator.
+
+With the '--logs' flag, each hook is followed by its last run as YAML comments:
+its phase, how many times it was attempted if it was retried, when it started
+and completed, and, if it failed, why its Jobs and Pods failed and the end of
+the logs of their containers.
 `
 
 func newGetHooksCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	client := action.NewGet(cfg)
+	var logs bool
 
 	cmd := &cobra.Command{
 		Use:   "hooks RELEASE_NAME",
@@ -54,12 +63,16 @@ func newGetHooksCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 			}
 			for _, hook := range res.Hooks {
 				fmt.Fprintf(out, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+				if logs {
+					writeHookExecution(out, hook.LastRun)
+				}
 			}
 			return nil
 		},
 	}
 
 	cmd.Flags().IntVar(&client.Version, "revision", 0, "get the named release with revision")
+	cmd.Flags().BoolVar(&logs, "logs", false, "show the last run of each hook, with the logs of the failed ones")
 	err := cmd.RegisterFlagCompletionFunc("revision", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		if len(args) == 1 {
 			return compListRevisions(toComplete, cfg, args[0])
@@ -73,3 +86,34 @@ func newGetHooksCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 
 	return cmd
 }
+
+// writeHookExecution writes the last run of a hook as YAML comments.
+func writeHookExecution(out io.Writer, run release.HookExecution) {
+	if run.StartedAt.IsZero() {
+		fmt.Fprintln(out, "# Phase: not run")
+		return
+	}
+	fmt.Fprintf(out, "# Phase: %s\n", run.Phase)
+	if run.Attempts > 1 {
+		fmt.Fprintf(out, "# Attempts: %d\n", run.Attempts)
+	}
+	fmt.Fprintf(out, "# Started: %s\n", run.StartedAt.Format(time.ANSIC))
+	if !run.CompletedAt.IsZero() {
+		fmt.Fprintf(out, "# Completed: %s\n", run.CompletedAt.Format(time.ANSIC))
+	}
+	if run.Reason != "" {
+		fmt.Fprintln(out, "# Reason:")
+		writeComment(out, run.Reason)
+	}
+	if run.Logs != "" {
+		fmt.Fprintln(out, "# Logs:")
+		writeComment(out, run.Logs)
+	}
+}
+
+// writeComment writes the lines of s as YAML comments.
+func writeComment(out io.Writer, s string) {
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		fmt.Fprintf(out, "#   %s\n", line)
+	}
+}
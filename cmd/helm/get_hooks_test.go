@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
 )
 
 func TestGetHooks(t *testing.T) {
@@ -28,6 +29,11 @@ func TestGetHooks(t *testing.T) {
 		cmd:    "get hooks aeneas",
 		golden: "output/get-hooks.txt",
 		rels:   []*release.Release{release.Mock(&release.MockReleaseOptions{Name: "aeneas"})},
+	}, {
+		name:   "get hooks with logs",
+		cmd:    "get hooks aeneas --logs",
+		golden: "output/get-hooks-logs.txt",
+		rels:   []*release.Release{releaseWithFailedHook()},
 	}, {
 		name:      "get hooks without args",
 		cmd:       "get hooks",
@@ -37,6 +43,26 @@ func TestGetHooks(t *testing.T) {
 	runTestCmd(t, tests)
 }
 
+func releaseWithFailedHook() *release.Release {
+	rel := release.Mock(&release.MockReleaseOptions{Name: "aeneas"})
+	rel.Hooks = append(rel.Hooks, &release.Hook{
+		Name:     "migrate",
+		Kind:     "Job",
+		Path:     "migrate.yaml",
+		Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate",
+		Events:   []release.HookEvent{release.HookPreInstall},
+		LastRun: release.HookExecution{
+			StartedAt:   helmtime.Unix(242085845, 0).UTC(),
+			CompletedAt: helmtime.Unix(242085905, 0).UTC(),
+			Phase:       release.HookPhaseFailed,
+			Attempts:    2,
+			Reason:      "job/migrate: BackoffLimitExceeded: Job has reached the specified backoff limit\npod/migrate-abcde container migrate: Error (exit code 2)",
+			Logs:        "==> pod/migrate-abcde container migrate <==\nmigrating users\nrelation \"users\" already exists\n",
+		},
+	})
+	return rel
+}
+
 func TestGetHooksRevisionCompletion(t *testing.T) {
 	revisionFlagCompletionTest(t, "get hooks")
 }
@@ -0,0 +1,132 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+var getMetadataHelp = `
+This command shows the metadata of a named release: its namespace, revision,
+status and deployment date, the name, version and app version of its chart,
+its labels, the dependencies of its chart as resolved in its Chart.lock, and
+who performed the revision.
+
+Use '--output json' or '--output yaml' to read the metadata from scripts.
+`
+
+type metadataWriter struct {
+	metadata *action.Metadata
+}
+
+func newGetMetadataCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	var outfmt output.Format
+	client := action.NewGetMetadata(cfg)
+
+	cmd := &cobra.Command{
+		Use:   "metadata RELEASE_NAME",
+		Short: "download the metadata for a named release",
+		Long:  getMetadataHelp,
+		Args:  require.ExactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return compListReleases(toComplete, cfg)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			metadata, err := client.Run(args[0])
+			if err != nil {
+				return err
+			}
+			return outfmt.Write(out, &metadataWriter{metadata})
+		},
+	}
+
+	f := cmd.Flags()
+	f.IntVar(&client.Version, "revision", 0, "get the named release with revision")
+	err := cmd.RegisterFlagCompletionFunc("revision", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 1 {
+			return compListRevisions(toComplete, cfg, args[0])
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
+
+func (w metadataWriter) WriteTable(out io.Writer) error {
+	m := w.metadata
+	fmt.Fprintf(out, "NAME: %s\n", m.Name)
+	fmt.Fprintf(out, "NAMESPACE: %s\n", m.Namespace)
+	fmt.Fprintf(out, "REVISION: %d\n", m.Revision)
+	fmt.Fprintf(out, "STATUS: %s\n", m.Status)
+	fmt.Fprintf(out, "DEPLOYED_AT: %s\n", m.DeployedAt.Format(time.RFC3339))
+	fmt.Fprintf(out, "CHART: %s\n", m.Chart)
+	fmt.Fprintf(out, "VERSION: %s\n", m.Version)
+	fmt.Fprintf(out, "APP_VERSION: %s\n", m.AppVersion)
+	if len(m.Labels) > 0 {
+		labels := make([]string, 0, len(m.Labels))
+		for k, v := range m.Labels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(out, "LABELS: %s\n", strings.Join(labels, ","))
+	}
+	if a := m.Audit; a != nil {
+		fmt.Fprintf(out, "USER: %s\n", a.User)
+		fmt.Fprintf(out, "HOSTNAME: %s\n", a.Hostname)
+		fmt.Fprintf(out, "HELM_VERSION: %s\n", a.HelmVersion)
+		fmt.Fprintf(out, "COMMAND: %s\n", strings.Join(a.Command, " "))
+	}
+	if len(m.Dependencies) > 0 {
+		fmt.Fprintln(out, "DEPENDENCIES:")
+		tbl := uitable.New()
+		tbl.AddRow("NAME", "VERSION", "REPOSITORY")
+		for _, dep := range m.Dependencies {
+			tbl.AddRow(dep.Name, dep.Version, dep.Repository)
+		}
+		return output.EncodeTable(out, tbl)
+	}
+	return nil
+}
+
+func (w metadataWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, w.metadata)
+}
+
+func (w metadataWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, w.metadata)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestGetMetadataCmd(t *testing.T) {
+	locked := release.Mock(&release.MockReleaseOptions{Name: "thomas-guide"})
+	locked.Labels = map[string]string{"owner": "helm", "team": "guides"}
+	locked.Chart.Metadata.Dependencies = []*chart.Dependency{
+		{Name: "mariadb", Version: "^7.0.0", Repository: "https://charts.example.com"},
+	}
+	locked.Chart.Lock = &chart.Lock{
+		Dependencies: []*chart.Dependency{
+			{Name: "mariadb", Version: "7.3.14", Repository: "https://charts.example.com"},
+		},
+	}
+	locked.Info.Audit = &release.Audit{
+		User:        "alice",
+		HelmVersion: "v3.5.0",
+		Hostname:    "laptop",
+		Command:     []string{"helm", "install", "thomas-guide", "./foo"},
+	}
+
+	unlocked := release.Mock(&release.MockReleaseOptions{Name: "atlas-guide"})
+	unlocked.Chart.Metadata.Dependencies = []*chart.Dependency{
+		{Name: "mariadb", Version: "^7.0.0", Repository: "https://charts.example.com"},
+	}
+
+	rels := []*release.Release{locked, unlocked}
+	tests := []cmdTestCase{{
+		name:   "get metadata with a Chart.lock",
+		cmd:    "get metadata thomas-guide",
+		golden: "output/get-metadata.txt",
+		rels:   rels,
+	}, {
+		name:   "get metadata without a Chart.lock",
+		cmd:    "get metadata atlas-guide",
+		golden: "output/get-metadata-unlocked.txt",
+		rels:   rels,
+	}, {
+		name:   "get metadata with json output format",
+		cmd:    "get metadata thomas-guide --output json",
+		golden: "output/get-metadata.json",
+		rels:   rels,
+	}, {
+		name:   "get metadata with yaml output format",
+		cmd:    "get metadata thomas-guide --output yaml",
+		golden: "output/get-metadata.yaml",
+		rels:   rels,
+	}, {
+		name:      "get metadata without args",
+		cmd:       "get metadata",
+		golden:    "output/get-metadata-no-args.txt",
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestGetMetadataRevisionCompletion(t *testing.T) {
+	revisionFlagCompletionTest(t, "get metadata")
+}
+
+func TestGetMetadataOutputCompletion(t *testing.T) {
+	outputFlagCompletionTest(t, "get metadata")
+}
+
+func TestGetMetadataFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "get metadata", false)
+	checkFileCompletion(t, "get metadata myrelease", false)
+}
@@ -34,6 +34,7 @@ import (
 	"helm.sh/helm/v3/pkg/gates"
 	kubefake "helm.sh/helm/v3/pkg/kube/fake"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
@@ -72,6 +73,11 @@ func main() {
 		if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), helmDriver, debug); err != nil {
 			log.Fatal(err)
 		}
+		retention, err := storage.ParseRetentionPolicy(settings.HistoryRetention)
+		if err != nil {
+			log.Fatalf("invalid $HELM_HISTORY_RETENTION: %s", err)
+		}
+		actionConfig.Releases.Retention = retention
 		if helmDriver == "memory" {
 			loadReleasesInMemory(actionConfig)
 		}
@@ -49,11 +49,22 @@ The historical release set is printed as a formatted table, e.g:
     2           Mon Oct 3 10:15:13 2016     superseded      alpine-0.1.0      1.0             Upgraded successfully
     3           Mon Oct 3 10:15:13 2016     superseded      alpine-0.1.0      1.0             Rolled back to 2
     4           Mon Oct 3 10:15:13 2016     deployed        alpine-0.1.0      1.0             Upgraded successfully
+
+The '--audit' flag prints who performed each revision instead: the Kubernetes
+user, the host and the Helm version of the operation, and its command line with
+the secrets redacted. The JSON and YAML outputs also include the values files of
+the operations, and the environment of the CI jobs that performed them.
+
+    $ helm history angry-bird --audit
+    REVISION    UPDATED                     STATUS          USER     HOSTNAME    HELM VERSION    COMMAND
+    1           Mon Oct 3 10:15:13 2016     superseded      alice    laptop      v3.5.0          helm install angry-bird ./alpine
+    2           Mon Oct 3 10:15:13 2016     deployed        ci       runner-1    v3.5.0          helm upgrade angry-bird ./alpine --set password=REDACTED
 `
 
 func newHistoryCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	client := action.NewHistory(cfg)
 	var outfmt output.Format
+	var audit bool
 
 	cmd := &cobra.Command{
 		Use:     "history RELEASE_NAME",
@@ -68,29 +79,36 @@ func newHistoryCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 			return compListReleases(toComplete, cfg)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			history, err := getHistory(client, args[0])
+			history, err := getHistory(client, args[0], audit)
 			if err != nil {
 				return err
 			}
 
+			if audit {
+				return outfmt.Write(out, releaseAuditHistory(history))
+			}
 			return outfmt.Write(out, history)
 		},
 	}
 
+	cmd.AddCommand(newHistoryPruneCmd(cfg, out))
+
 	f := cmd.Flags()
 	f.IntVar(&client.Max, "max", 256, "maximum number of revision to include in history")
+	f.BoolVar(&audit, "audit", false, "show who performed each revision")
 	bindOutputFlag(cmd, &outfmt)
 
 	return cmd
 }
 
 type releaseInfo struct {
-	Revision    int           `json:"revision"`
-	Updated     helmtime.Time `json:"updated"`
-	Status      string        `json:"status"`
-	Chart       string        `json:"chart"`
-	AppVersion  string        `json:"app_version"`
-	Description string        `json:"description"`
+	Revision    int            `json:"revision"`
+	Updated     helmtime.Time  `json:"updated"`
+	Status      string         `json:"status"`
+	Chart       string         `json:"chart"`
+	AppVersion  string         `json:"app_version"`
+	Description string         `json:"description"`
+	Audit       *release.Audit `json:"audit,omitempty"`
 }
 
 type releaseHistory []releaseInfo
@@ -112,7 +130,33 @@ func (r releaseHistory) WriteTable(out io.Writer) error {
 	return output.EncodeTable(out, tbl)
 }
 
-func getHistory(client *action.History, name string) (releaseHistory, error) {
+// releaseAuditHistory is a releaseHistory including the audit records of the
+// revisions.
+type releaseAuditHistory releaseHistory
+
+func (r releaseAuditHistory) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, r)
+}
+
+func (r releaseAuditHistory) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, r)
+}
+
+func (r releaseAuditHistory) WriteTable(out io.Writer) error {
+	tbl := uitable.New()
+	tbl.AddRow("REVISION", "UPDATED", "STATUS", "USER", "HOSTNAME", "HELM VERSION", "COMMAND")
+	for _, item := range r {
+		a := item.Audit
+		if a == nil {
+			// revisions from before the audit records
+			a = &release.Audit{}
+		}
+		tbl.AddRow(item.Revision, item.Updated.Format(time.ANSIC), item.Status, a.User, a.Hostname, a.HelmVersion, strings.Join(a.Command, " "))
+	}
+	return output.EncodeTable(out, tbl)
+}
+
+func getHistory(client *action.History, name string, audit bool) (releaseHistory, error) {
 	hist, err := client.Run(name)
 	if err != nil {
 		return nil, err
@@ -129,12 +173,12 @@ func getHistory(client *action.History, name string) (releaseHistory, error) {
 		return releaseHistory{}, nil
 	}
 
-	releaseHistory := getReleaseHistory(rels)
+	releaseHistory := getReleaseHistory(rels, audit)
 
 	return releaseHistory, nil
 }
 
-func getReleaseHistory(rls []*release.Release) (history releaseHistory) {
+func getReleaseHistory(rls []*release.Release, audit bool) (history releaseHistory) {
 	for i := len(rls) - 1; i >= 0; i-- {
 		r := rls[i]
 		c := formatChartname(r.Chart)
@@ -154,6 +198,9 @@ func getReleaseHistory(rls []*release.Release) (history releaseHistory) {
 			rInfo.Updated = r.Info.LastDeployed
 
 		}
+		if audit {
+			rInfo.Audit = r.Info.Audit
+		}
 		history = append(history, rInfo)
 	}
 
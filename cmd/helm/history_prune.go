@@ -0,0 +1,115 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/storage"
+)
+
+const historyPruneHelp = `
+This command removes the revisions of releases that a retention policy does
+not keep, for the given releases or for every release of the namespace.
+
+The policy is read from $HELM_HISTORY_RETENTION, e.g.
+"max-revisions=10,max-age=30d,keep-successful=3,failed-ttl=1d", and the flags
+of this command override its fields:
+
+- --max-revisions keeps at most that many revisions of each release.
+- --max-age removes the revisions deployed longer ago than the duration.
+- --keep-successful always keeps that many last successfully deployed
+  revisions.
+- --failed-ttl removes the failed revisions deployed longer ago than the
+  duration.
+
+The last revision and the deployed revision of a release are always kept. The
+labels of the last revision of a release override the policy for that release:
+helm.sh/history-max-revisions, helm.sh/history-max-age,
+helm.sh/history-keep-successful and helm.sh/history-failed-ttl. The history
+of a release left without a policy, by the environment, the flags and its
+labels, is kept.
+
+Durations are like 90m, 12h or 30d. Use --dry-run to list the revisions that
+would be removed:
+
+    $ helm history prune --max-age 30d --keep-successful 3 --dry-run
+`
+
+func newHistoryPruneCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewHistoryPrune(cfg)
+
+	cmd := &cobra.Command{
+		Use:   "prune [RELEASE_NAME...]",
+		Short: "remove the revisions that the retention policy does not keep",
+		Long:  historyPruneHelp,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return compListReleases(toComplete, cfg)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policy, err := storage.ParseRetentionPolicy(settings.HistoryRetention)
+			if err != nil {
+				return errors.Wrap(err, "invalid $HELM_HISTORY_RETENTION")
+			}
+			for _, flag := range []string{"max-revisions", "max-age", "keep-successful", "failed-ttl"} {
+				if f := cmd.Flags().Lookup(flag); f.Changed {
+					if err := policy.Set(flag, f.Value.String()); err != nil {
+						return err
+					}
+				}
+			}
+			client.Policy = policy
+
+			pruned, err := client.Run(args...)
+			if len(pruned) > 0 {
+				tbl := uitable.New()
+				tbl.AddRow("NAME", "REVISION", "UPDATED", "STATUS", "CHART", "DESCRIPTION")
+				for _, rls := range pruned {
+					tbl.AddRow(rls.Name, rls.Version, rls.Info.LastDeployed.Format(time.ANSIC), rls.Info.Status, formatChartname(rls.Chart), rls.Info.Description)
+				}
+				fmt.Fprintln(out, tbl)
+			}
+			if err != nil {
+				return err
+			}
+
+			if client.DryRun {
+				fmt.Fprintf(out, "%d revisions would be pruned\n", len(pruned))
+			} else {
+				fmt.Fprintf(out, "%d revisions pruned\n", len(pruned))
+			}
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	// the flags override the fields of $HELM_HISTORY_RETENTION in RunE
+	f.Int("max-revisions", 0, "maximum number of revisions kept per release. Use 0 for no limit")
+	f.String("max-age", "", "remove the revisions deployed longer ago than this duration")
+	f.Int("keep-successful", 0, "number of last successfully deployed revisions always kept")
+	f.String("failed-ttl", "", "remove the failed revisions deployed longer ago than this duration")
+	f.BoolVar(&client.DryRun, "dry-run", false, "list the revisions that would be removed without removing them")
+
+	return cmd
+}
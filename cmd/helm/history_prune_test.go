@@ -0,0 +1,110 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+)
+
+func historyPruneFixture(t *testing.T) *storage.Storage {
+	store := storageFixture()
+	for _, opts := range []*release.MockReleaseOptions{
+		{Name: "angry-bird", Version: 1, Status: release.StatusSuperseded},
+		{Name: "angry-bird", Version: 2, Status: release.StatusFailed},
+		{Name: "angry-bird", Version: 3, Status: release.StatusSuperseded},
+		{Name: "angry-bird", Version: 4},
+		{Name: "blue-bird", Version: 1},
+	} {
+		if err := store.Create(release.Mock(opts)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestHistoryPrune(t *testing.T) {
+	store := historyPruneFixture(t)
+
+	_, out, err := executeActionCommandC(store, "history prune --max-revisions 2 --dry-run")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "NAME      \tREVISION\tUPDATED                 \tSTATUS    \tCHART           \tDESCRIPTION \n" +
+		"angry-bird\t1       \tFri Sep  2 22:04:05 1977\tsuperseded\tfoo-0.1.0-beta.1\tRelease mock\n" +
+		"angry-bird\t2       \tFri Sep  2 22:04:05 1977\tfailed    \tfoo-0.1.0-beta.1\tRelease mock\n" +
+		"2 revisions would be pruned\n"
+	if out != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, out)
+	}
+	if h, _ := store.History("angry-bird"); len(h) != 4 {
+		t.Errorf("expected a dry run to keep the history, got %d revisions", len(h))
+	}
+
+	_, out, err = executeActionCommandC(store, "history prune angry-bird --max-age 30d --keep-successful 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasSuffix(out, "2 revisions pruned\n") {
+		t.Errorf("unexpected output: %s", out)
+	}
+	if h, _ := store.History("angry-bird"); len(h) != 2 {
+		t.Errorf("expected 2 revisions to be kept, got %d", len(h))
+	}
+
+	_, _, err = executeActionCommandC(store, "history prune --max-age soon")
+	if err == nil || !strings.Contains(err.Error(), `invalid max-age "soon"`) {
+		t.Errorf("expected an invalid duration error, got %v", err)
+	}
+}
+
+func TestHistoryPruneLabelPolicy(t *testing.T) {
+	store := historyPruneFixture(t)
+	var rls *release.Release
+	for i := 1; i <= 3; i++ {
+		rls = release.Mock(&release.MockReleaseOptions{Name: "red-bird", Version: i, Status: release.StatusSuperseded})
+		if err := store.Create(rls); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rls.Labels = map[string]string{storage.RetentionMaxRevisionsLabel: "1"}
+	if err := store.Update(rls); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a policy, only the releases with retention labels are pruned
+	_, out, err := executeActionCommandC(store, "history prune")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasSuffix(out, "2 revisions pruned\n") {
+		t.Errorf("unexpected output: %s", out)
+	}
+	if h, _ := store.History("red-bird"); len(h) != 1 {
+		t.Errorf("expected 1 revision of red-bird to be kept, got %d", len(h))
+	}
+	if h, _ := store.History("angry-bird"); len(h) != 4 {
+		t.Errorf("expected the history of angry-bird to be kept, got %d revisions", len(h))
+	}
+}
+
+func TestHistoryPruneCompletion(t *testing.T) {
+	checkFileCompletion(t, "history prune", false)
+}
@@ -70,6 +70,48 @@ func TestHistoryCmd(t *testing.T) {
 	runTestCmd(t, tests)
 }
 
+func TestHistoryAuditCmd(t *testing.T) {
+	mk := func(name string, vers int, status release.Status, audit *release.Audit) *release.Release {
+		rls := release.Mock(&release.MockReleaseOptions{
+			Name:    name,
+			Version: vers,
+			Status:  status,
+		})
+		rls.Info.Audit = audit
+		return rls
+	}
+	rels := []*release.Release{
+		mk("angry-bird", 3, release.StatusDeployed, &release.Audit{
+			User:        "system:serviceaccount:ci:deployer",
+			HelmVersion: "v3.5.0",
+			Hostname:    "runner-1",
+			Command:     []string{"helm", "upgrade", "angry-bird", "./alpine", "--set", "password=REDACTED"},
+			ValuesFiles: []string{"prod.yaml"},
+			CI:          map[string]string{"CI": "true", "GITHUB_RUN_ID": "42"},
+		}),
+		mk("angry-bird", 2, release.StatusSuperseded, &release.Audit{
+			User:        "alice",
+			HelmVersion: "v3.5.0",
+			Hostname:    "laptop",
+			Command:     []string{"helm", "install", "angry-bird", "./alpine"},
+		}),
+		mk("angry-bird", 1, release.StatusSuperseded, nil),
+	}
+
+	tests := []cmdTestCase{{
+		name:   "get audit history for release",
+		cmd:    "history angry-bird --audit",
+		rels:   rels,
+		golden: "output/history-audit.txt",
+	}, {
+		name:   "get audit history with json output format",
+		cmd:    "history angry-bird --audit --output json",
+		rels:   rels,
+		golden: "output/history-audit.json",
+	}}
+	runTestCmd(t, tests)
+}
+
 func TestHistoryOutputCompletion(t *testing.T) {
 	outputFlagCompletionTest(t, "history")
 }
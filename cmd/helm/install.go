@@ -78,6 +78,17 @@ set for a key called 'foo', the 'newbar' value would take precedence:
 To check the generated manifests of a release without installing the chart,
 the '--debug' and '--dry-run' flags can be combined.
 
+If the install fails, including when its hooks fail, the hooks of the
+'post-install-failure' event are run once the release is marked as failed, and
+before it is uninstalled with '--atomic'. Their own failure is logged, without
+changing the result of the install.
+
+The '--labels' flag labels the release, for 'helm list --selector' to select it.
+The labels are kept by the upgrades and rollbacks of the release. The labels
+managed by Helm, such as 'name', 'owner', 'status' and 'version', cannot be set:
+
+    $ helm install --labels team=payments,tier=prod myredis ./redis
+
 If --verify is set, the chart MUST have a provenance file, and the provenance
 file MUST pass all verification steps.
 
@@ -129,6 +140,7 @@ func newInstallCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	addInstallFlags(cmd, cmd.Flags(), client, valueOpts)
 	bindOutputFlag(cmd, &outfmt)
 	bindPostRenderFlag(cmd, &client.PostRenderer)
+	bindOutputEventsFlag(cmd, cfg)
 
 	return cmd
 }
@@ -144,12 +156,15 @@ func addInstallFlags(cmd *cobra.Command, f *pflag.FlagSet, client *action.Instal
 	f.BoolVarP(&client.GenerateName, "generate-name", "g", false, "generate the name (and omit the NAME parameter)")
 	f.StringVar(&client.NameTemplate, "name-template", "", "specify template used to name the release")
 	f.StringVar(&client.Description, "description", "", "add a custom description")
+	f.StringToStringVar(&client.Labels, "labels", nil, "labels to add to the release, which 'helm list' can select (e.g. --labels team=payments,tier=prod)")
 	f.BoolVar(&client.Devel, "devel", false, "use development versions, too. Equivalent to version '>0.0.0-0'. If --version is set, this is ignored")
 	f.BoolVar(&client.DependencyUpdate, "dependency-update", false, "run helm dependency update before installing the chart")
 	f.BoolVar(&client.DisableOpenAPIValidation, "disable-openapi-validation", false, "if set, the installation process will not validate rendered templates against the Kubernetes OpenAPI Schema")
 	f.BoolVar(&client.Atomic, "atomic", false, "if set, the installation process deletes the installation on failure. The --wait flag will be set automatically if --atomic is used")
 	f.BoolVar(&client.SkipCRDs, "skip-crds", false, "if set, no CRDs will be installed. By default, CRDs are installed if not already present")
 	f.BoolVar(&client.SubNotes, "render-subchart-notes", false, "if set, render subchart notes along with the parent")
+	f.BoolVar(&client.ServerSide, "server-side", false, "if set, resources are sent to the cluster with server-side apply using the \"helm\" field manager")
+	f.BoolVar(&client.ForceConflicts, "force-conflicts", false, "if set and --server-side enabled, take ownership of fields managed by other field managers instead of failing")
 	addValueOptionsFlags(f, valueOpts)
 	addChartPathOptionsFlags(f, &client.ChartPathOptions)
 
@@ -194,6 +209,7 @@ func runInstall(args []string, client *action.Install, valueOpts *values.Options
 	if err != nil {
 		return nil, err
 	}
+	client.ValuesFiles = valueOpts.ValueFiles
 
 	// Check chart dependencies to make sure all are present in /charts
 	chartRequested, err := loader.Load(cp)
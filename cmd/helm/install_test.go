@@ -48,6 +48,19 @@ func TestInstall(t *testing.T) {
 			cmd:    "install virgil testdata/testcharts/alpine -f testdata/testcharts/alpine/extra_values.yaml",
 			golden: "output/install-with-values-file.txt",
 		},
+		// Install, with labels
+		{
+			name:   "install with labels",
+			cmd:    "install virgil testdata/testcharts/alpine --labels team=payments,tier=prod",
+			golden: "output/install-with-labels.txt",
+		},
+		// Install, with a system label
+		{
+			name:      "install with a system label",
+			cmd:       "install virgil testdata/testcharts/alpine --labels owner=me",
+			golden:    "output/install-with-system-label.txt",
+			wantError: true,
+		},
 		// Install, no hooks
 		{
 			name:   "install without hooks",
@@ -17,10 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/gosuri/uitable"
 	"github.com/spf13/cobra"
@@ -29,6 +32,7 @@ import (
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/cli/output"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
 var listHelp = `
@@ -49,6 +53,12 @@ Only items that match the filter will be returned.
     NAME                UPDATED                                  CHART
     maudlin-arachnid    2020-06-18 14:17:46.125134977 +0000 UTC  alpine-0.1.0
 
+If the --selector flag is provided, only the releases whose labels match the
+label selector are listed: the labels set with 'helm install --labels' and
+'helm upgrade --labels', and the ones managed by Helm, such as 'status'.
+
+    $ helm list --selector 'team=payments,tier!=dev'
+
 If no results are found, 'helm list' will exit 0, but with no output (or in
 the case of no '-q' flag, only headers).
 
@@ -56,11 +66,18 @@ By default, up to 256 items may be returned. To limit this, use the '--max' flag
 Setting '--max' to 0 will not return all results. Rather, it will return the
 server's default, which may be much higher than 256. Pairing the '--max'
 flag with the '--offset' flag allows you to page through results.
+
+With the '--watch' flag, the releases are listed and then their changes are
+printed as they happen, until the command is interrupted. Each change is
+prefixed with its event: CREATED, UPDATED or DELETED. In JSON, the events are
+written one object per line, and in YAML as separate documents. Watching is
+supported by the secret, configmap, sql and memory drivers.
 `
 
 func newListCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	client := action.NewList(cfg)
 	var outfmt output.Format
+	var watch bool
 
 	cmd := &cobra.Command{
 		Use:               "list",
@@ -77,38 +94,30 @@ func newListCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 			}
 			client.SetStateMask()
 
+			var events <-chan driver.Event
+			if watch {
+				ctx, cancel := listWatchContext()
+				defer cancel()
+				var err error
+				if events, err = client.Watch(ctx); err != nil {
+					return err
+				}
+			}
+
 			results, err := client.Run()
 			if err != nil {
 				return err
 			}
+			if err := writeReleaseList(out, outfmt, client.Short, results, client.TimeFormat); err != nil || !watch {
+				return err
+			}
 
-			if client.Short {
-
-				names := make([]string, 0)
-				for _, res := range results {
-					names = append(names, res.Name)
-				}
-
-				outputFlag := cmd.Flag("output")
-
-				switch outputFlag.Value.String() {
-				case "json":
-					output.EncodeJSON(out, names)
-					return nil
-				case "yaml":
-					output.EncodeYAML(out, names)
-					return nil
-				case "table":
-					for _, res := range results {
-						fmt.Fprintln(out, res.Name)
-					}
-					return nil
-				default:
-					return outfmt.Write(out, newReleaseListWriter(results, client.TimeFormat))
+			for ev := range events {
+				if err := writeReleaseEvent(out, outfmt, client.Short, ev, client.TimeFormat); err != nil {
+					return err
 				}
 			}
-
-			return outfmt.Write(out, newReleaseListWriter(results, client.TimeFormat))
+			return nil
 		},
 	}
 
@@ -128,12 +137,83 @@ func newListCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	f.IntVarP(&client.Limit, "max", "m", 256, "maximum number of releases to fetch")
 	f.IntVar(&client.Offset, "offset", 0, "next release name in the list, used to offset from start value")
 	f.StringVarP(&client.Filter, "filter", "f", "", "a regular expression (Perl compatible). Any releases that match the expression will be included in the results")
-	f.StringVarP(&client.Selector, "selector", "l", "", "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2). Works only for secret(default) and configmap storage backends.")
+	f.StringVarP(&client.Selector, "selector", "l", "", "Selector (label query) to filter on, supports '=', '==', '!=', 'in', 'notin' and existence (e.g. -l key1=value1,key2!=value2). Works only for the secret (default), configmap, file and memory storage backends.")
+	f.BoolVarP(&watch, "watch", "w", false, "after listing the releases, watch for their changes until interrupted")
 	bindOutputFlag(cmd, &outfmt)
 
 	return cmd
 }
 
+// listWatchContext returns the context of 'helm list --watch', done once the
+// command is interrupted.
+var listWatchContext = func() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+	}()
+	return ctx, cancel
+}
+
+func writeReleaseList(out io.Writer, outfmt output.Format, short bool, results []*release.Release, timeFormat string) error {
+	if !short {
+		return outfmt.Write(out, newReleaseListWriter(results, timeFormat))
+	}
+
+	names := make([]string, 0)
+	for _, res := range results {
+		names = append(names, res.Name)
+	}
+
+	switch outfmt {
+	case output.JSON:
+		return output.EncodeJSON(out, names)
+	case output.YAML:
+		return output.EncodeYAML(out, names)
+	default:
+		for _, res := range results {
+			fmt.Fprintln(out, res.Name)
+		}
+		return nil
+	}
+}
+
+type releaseEventElement struct {
+	Event          string `json:"event"`
+	releaseElement `json:",inline"`
+}
+
+// writeReleaseEvent writes an event of 'helm list --watch': a row led by the
+// type of the event with the table output, or an object per line with the
+// JSON output and a document with the YAML output.
+func writeReleaseEvent(out io.Writer, outfmt output.Format, short bool, ev driver.Event, timeFormat string) error {
+	element := releaseEventElement{
+		Event:          string(ev.Type),
+		releaseElement: newReleaseListWriter([]*release.Release{ev.Release}, timeFormat).releases[0],
+	}
+	switch outfmt {
+	case output.JSON:
+		return output.EncodeJSON(out, element)
+	case output.YAML:
+		fmt.Fprintln(out, "---")
+		return output.EncodeYAML(out, element)
+	}
+
+	table := uitable.New()
+	if short {
+		table.AddRow(element.Event, element.Name)
+	} else {
+		table.AddRow(element.Event, element.Name, element.Namespace, element.Revision, element.Updated, element.Status, element.Chart, element.AppVersion)
+	}
+	return output.EncodeTable(out, table)
+}
+
 type releaseElement struct {
 	Name       string `json:"name"`
 	Namespace  string `json:"namespace"`
@@ -153,12 +233,15 @@ func newReleaseListWriter(releases []*release.Release, timeFormat string) *relea
 	elements := make([]releaseElement, 0, len(releases))
 	for _, r := range releases {
 		element := releaseElement{
-			Name:       r.Name,
-			Namespace:  r.Namespace,
-			Revision:   strconv.Itoa(r.Version),
-			Status:     r.Info.Status.String(),
-			Chart:      fmt.Sprintf("%s-%s", r.Chart.Metadata.Name, r.Chart.Metadata.Version),
-			AppVersion: r.Chart.Metadata.AppVersion,
+			Name:      r.Name,
+			Namespace: r.Namespace,
+			Revision:  strconv.Itoa(r.Version),
+			Status:    r.Info.Status.String(),
+		}
+		// the chart of a deleted release may be unknown
+		if r.Chart != nil && r.Chart.Metadata != nil {
+			element.Chart = fmt.Sprintf("%s-%s", r.Chart.Metadata.Name, r.Chart.Metadata.Version)
+			element.AppVersion = r.Chart.Metadata.AppVersion
 		}
 
 		t := "-"
@@ -17,7 +17,9 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"testing"
+	gostd "time"
 
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/release"
@@ -239,3 +241,39 @@ func TestListOutputCompletion(t *testing.T) {
 func TestListFileCompletion(t *testing.T) {
 	checkFileCompletion(t, "list", false)
 }
+
+func TestListWatch(t *testing.T) {
+	defer func(f func() (context.Context, context.CancelFunc)) { listWatchContext = f }(listWatchContext)
+
+	store := storageFixture()
+	if err := store.Create(release.Mock(&release.MockReleaseOptions{Name: "thomas-guide"})); err != nil {
+		t.Fatal(err)
+	}
+	// the changes are made once the command watches the releases, then the
+	// command is interrupted
+	listWatchContext = func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			gostd.Sleep(100 * gostd.Millisecond)
+			atlas := release.Mock(&release.MockReleaseOptions{Name: "atlas-guide"})
+			store.Create(atlas)
+			store.Create(release.Mock(&release.MockReleaseOptions{Name: "atlas-guide", Version: 2, Status: release.StatusSuperseded}))
+			store.Delete(atlas.Name, atlas.Version)
+			gostd.Sleep(400 * gostd.Millisecond)
+			cancel()
+		}()
+		return ctx, cancel
+	}
+
+	_, out, err := executeActionCommandC(store, "list --watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "NAME        \tNAMESPACE\tREVISION\tUPDATED                      \tSTATUS  \tCHART           \tAPP VERSION\n" +
+		"thomas-guide\tdefault  \t1       \t1977-09-02 22:04:05 +0000 UTC\tdeployed\tfoo-0.1.0-beta.1\t1.0        \n" +
+		"CREATED\tatlas-guide\tdefault\t1\t1977-09-02 22:04:05 +0000 UTC\tdeployed\tfoo-0.1.0-beta.1\t1.0\n" +
+		"DELETED\tatlas-guide\tdefault\t1\t1977-09-02 22:04:05 +0000 UTC\tdeployed\tfoo-0.1.0-beta.1\t1.0\n"
+	if out != expected {
+		t.Errorf("expected output:\n%q\ngot:\n%q", expected, out)
+	}
+}
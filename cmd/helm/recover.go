@@ -0,0 +1,122 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+const recoverDesc = `
+This command recovers a release left in a pending state.
+
+A release stays in the pending-install, pending-upgrade or pending-rollback
+state when the Helm process operating on it is interrupted, which prevents any
+further operation on the release. This command compares the pending revision
+with the resources in the cluster and recovers the release with one of the
+following strategies:
+
+- resume: apply the pending revision again and mark it as deployed
+- rollback: mark the pending revision as failed and roll back to the last
+  deployed revision
+- fail: mark the pending revision as failed without changing the cluster
+- auto: resume if every resource of the pending revision exists in the cluster,
+  otherwise roll back, or mark the revision as failed if the release was never
+  deployed
+
+The strategy that was applied is recorded in the description of the pending
+revision, as shown by 'helm history RELEASE'.
+`
+
+func newRecoverCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewRecover(cfg)
+	var strategy string
+
+	cmd := &cobra.Command{
+		Use:   "recover RELEASE_NAME",
+		Short: "recover a release stuck in a pending state",
+		Long:  recoverDesc,
+		Args:  require.ExactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return compListReleases(toComplete, cfg)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := parseRecoverStrategy(strategy)
+			if err != nil {
+				return err
+			}
+			client.Strategy = s
+
+			rel, err := client.Run(args[0])
+			if err != nil {
+				return err
+			}
+			if client.DryRun {
+				fmt.Fprintf(out, "Release %q would be recovered. Revision %d: %s\n", rel.Name, rel.Version, rel.Info.Description)
+				return nil
+			}
+			fmt.Fprintf(out, "Release %q has been recovered. Revision %d: %s\n", rel.Name, rel.Version, rel.Info.Description)
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&strategy, "strategy", string(action.RecoverAuto), fmt.Sprintf("how to recover the release. Allowed values: %s", recoverStrategyNames()))
+	f.BoolVar(&client.DryRun, "dry-run", false, "show how the release would be recovered without changing it")
+	f.BoolVar(&client.DisableHooks, "no-hooks", false, "prevent hooks from running when rolling back")
+	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.BoolVar(&client.Wait, "wait", false, "if set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as --timeout")
+	f.BoolVar(&client.WaitForJobs, "wait-for-jobs", false, "if set and --wait enabled, will wait until all Jobs have been completed before marking the release as successful. It will wait for as long as --timeout")
+
+	err := cmd.RegisterFlagCompletionFunc("strategy", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return strings.Split(recoverStrategyNames(), ", "), cobra.ShellCompDirectiveNoFileComp
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return cmd
+}
+
+func parseRecoverStrategy(s string) (action.RecoverStrategy, error) {
+	for _, strategy := range action.RecoverStrategies {
+		if string(strategy) == s {
+			return strategy, nil
+		}
+	}
+	return "", errors.Errorf("invalid strategy %q, must be one of: %s", s, recoverStrategyNames())
+}
+
+func recoverStrategyNames() string {
+	var names []string
+	for _, s := range action.RecoverStrategies {
+		names = append(names, string(s))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestRecoverCmd(t *testing.T) {
+	rels := func(statuses ...release.Status) []*release.Release {
+		var rels []*release.Release
+		for i, status := range statuses {
+			rels = append(rels, release.Mock(&release.MockReleaseOptions{Name: "funny-honey", Version: i + 1, Status: status}))
+		}
+		return rels
+	}
+
+	tests := []cmdTestCase{{
+		name:   "recover a release",
+		cmd:    "recover funny-honey",
+		golden: "output/recover.txt",
+		rels:   rels(release.StatusDeployed, release.StatusPendingUpgrade),
+	}, {
+		name:   "recover a release with dry-run",
+		cmd:    "recover funny-honey --strategy rollback --dry-run",
+		golden: "output/recover-dry-run.txt",
+		rels:   rels(release.StatusDeployed, release.StatusPendingUpgrade),
+	}, {
+		name:      "recover a release that is not pending",
+		cmd:       "recover funny-honey",
+		golden:    "output/recover-not-pending.txt",
+		rels:      rels(release.StatusDeployed),
+		wantError: true,
+	}, {
+		name:      "recover with an invalid strategy",
+		cmd:       "recover funny-honey --strategy retry",
+		golden:    "output/recover-invalid-strategy.txt",
+		rels:      rels(release.StatusDeployed, release.StatusPendingUpgrade),
+		wantError: true,
+	}, {
+		name:      "recover without a release name",
+		cmd:       "recover",
+		golden:    "output/recover-no-args.txt",
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestRecoverCompletion(t *testing.T) {
+	tests := []cmdTestCase{{
+		name:   "completion for recover strategy flag",
+		cmd:    "__complete recover funny-honey --strategy ''",
+		golden: "output/recover-strategy-comp.txt",
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestRecoverFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "recover", false)
+	checkFileCompletion(t, "recover myrelease", false)
+}
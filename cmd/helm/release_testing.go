@@ -17,17 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"encoding/xml"
 	"fmt"
 	"io"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/cli/output"
+	"helm.sh/helm/v3/pkg/release"
 )
 
 const releaseTestHelp = `
@@ -35,13 +42,29 @@ The test command runs the tests for a release.
 
 The argument this command takes is the name of a deployed release.
 The tests to be run are defined in the chart that was installed.
+
+The hooks of the 'pre-test' event are run before the tests, which are not run
+if one of them fails. The hooks of the 'post-test' event are run after the
+tests, whether they passed or not. The '--filter' flag only selects tests.
+
+The tests are run in the order of their weights, the ones of equal weight
+concurrently. With the '--parallel' flag, all of them are run concurrently.
+With the '--rerun-failed' flag, only the tests that did not succeed in their
+last run are run again.
+
+The result of each test is reported: its phase, how long it ran, and the exit
+code and the end of the logs of its containers. With the '--junit' flag, the
+results are also written to a JUnit XML report:
+
+    $ helm test --junit report.xml myrelease
 `
 
 func newReleaseTestCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	client := action.NewReleaseTesting(cfg)
-	var outfmt = output.Table
+	var outfmt output.Format
 	var outputLogs bool
 	var filter []string
+	var junit string
 
 	cmd := &cobra.Command{
 		Use:   "test [RELEASE]",
@@ -72,7 +95,14 @@ func newReleaseTestCmd(cfg *action.Configuration, out io.Writer) *cobra.Command
 				return runErr
 			}
 
-			if err := outfmt.Write(out, &statusPrinter{rel, settings.Debug, false}); err != nil {
+			results := client.Results()
+			if junit != "" {
+				if err := writeJUnitFile(junit, rel, results); err != nil {
+					return err
+				}
+			}
+
+			if err := outfmt.Write(out, &releaseTestWriter{rel, results, settings.Debug}); err != nil {
 				return err
 			}
 
@@ -92,6 +122,202 @@ func newReleaseTestCmd(cfg *action.Configuration, out io.Writer) *cobra.Command
 	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
 	f.BoolVar(&outputLogs, "logs", false, "dump the logs from test pods (this runs after all tests are complete, but before any cleanup)")
 	f.StringSliceVar(&filter, "filter", []string{}, "specify tests by attribute (currently \"name\") using attribute=value syntax or '!attribute=value' to exclude a test (can specify multiple or separate values with commas: name=test1,name=test2)")
+	f.BoolVar(&client.Parallel, "parallel", false, "run all of the tests concurrently, regardless of their weights")
+	f.BoolVar(&client.OnlyFailed, "rerun-failed", false, "only run the tests that did not succeed in their last run")
+	f.StringVar(&junit, "junit", "", "write the results of the tests to the given file as a JUnit XML report")
+	bindOutputFlag(cmd, &outfmt)
 
 	return cmd
 }
+
+// releaseTestWriter writes the status of a tested release, followed by the
+// results of its tests.
+type releaseTestWriter struct {
+	release *release.Release
+	results []*action.TestResult
+	debug   bool
+}
+
+type testResultElement struct {
+	*action.TestResult
+	Duration string `json:"duration,omitempty"`
+}
+
+type releaseTestElement struct {
+	Name      string              `json:"name"`
+	Namespace string              `json:"namespace"`
+	Revision  int                 `json:"revision"`
+	Status    release.Status      `json:"status"`
+	Tests     []testResultElement `json:"tests"`
+}
+
+func (w *releaseTestWriter) element() releaseTestElement {
+	// Initialize the array so no results returns an empty array instead of null
+	tests := make([]testResultElement, 0, len(w.results))
+	for _, r := range w.results {
+		e := testResultElement{TestResult: r}
+		if d := r.Duration(); d > 0 {
+			e.Duration = d.String()
+		}
+		tests = append(tests, e)
+	}
+	return releaseTestElement{
+		Name:      w.release.Name,
+		Namespace: w.release.Namespace,
+		Revision:  w.release.Version,
+		Status:    w.release.Info.Status,
+		Tests:     tests,
+	}
+}
+
+func (w *releaseTestWriter) WriteTable(out io.Writer) error {
+	if err := (statusPrinter{w.release, w.debug, false}).WriteTable(out); err != nil {
+		return err
+	}
+	if len(w.results) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(out, "TEST RESULTS:")
+	table := uitable.New()
+	table.AddRow("NAME", "PHASE", "DURATION", "EXIT CODE")
+	for _, r := range w.results {
+		phase, duration, exitCode := r.Phase.String(), "-", "-"
+		if r.Skipped {
+			phase = "Skipped"
+		} else if d := r.Duration(); d > 0 {
+			duration = d.String()
+		}
+		if !r.Skipped && r.ExitCode != nil {
+			exitCode = strconv.Itoa(int(*r.ExitCode))
+		}
+		table.AddRow(r.Name, phase, duration, exitCode)
+	}
+	return output.EncodeTable(out, table)
+}
+
+func (w *releaseTestWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, w.element())
+}
+
+func (w *releaseTestWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, w.element())
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// writeJUnitFile writes the results of the tests of a release to a JUnit XML
+// report, with a test suite named after the release.
+func writeJUnitFile(filename string, rel *release.Release, results []*action.TestResult) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to create the JUnit report")
+	}
+	defer f.Close()
+	if err := writeJUnit(f, rel, results); err != nil {
+		return errors.Wrap(err, "unable to write the JUnit report")
+	}
+	return nil
+}
+
+func writeJUnit(out io.Writer, rel *release.Release, results []*action.TestResult) error {
+	suite := junitTestSuite{Name: rel.Name, Tests: len(results), Cases: []junitTestCase{}}
+	var total time.Duration
+	for _, r := range results {
+		c := junitTestCase{
+			Name:      r.Name,
+			Classname: rel.Name,
+			Time:      junitSeconds(r.Duration()),
+		}
+		switch {
+		case r.Skipped:
+			suite.Skipped++
+			c.Skipped = &junitSkipped{Message: "not selected, or a pre-test hook failed"}
+			c.Time = junitSeconds(0)
+		case r.Phase != release.HookPhaseSucceeded:
+			suite.Failures++
+			message := fmt.Sprintf("test %s", strings.ToLower(r.Phase.String()))
+			if r.ExitCode != nil {
+				message += fmt.Sprintf(" with exit code %d", *r.ExitCode)
+			}
+			c.Failure = &junitFailure{Message: message, Text: junitCDATA(r.Reason)}
+		}
+		if !r.Skipped {
+			if r.Logs != "" {
+				c.SystemOut = &junitOutput{Text: junitCDATA(r.Logs)}
+			}
+			total += r.Duration()
+			// the suite started with its first test
+			if started := r.StartedAt.UTC().Format(time.RFC3339); suite.Timestamp == "" || started < suite.Timestamp {
+				suite.Timestamp = started
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// junitCDATA replaces the characters that are not allowed in XML, like the
+// escape sequences coloring the logs, which are not escaped in CDATA sections.
+func junitCDATA(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r',
+			r >= 0x20 && r <= 0xD7FF,
+			r >= 0xE000 && r <= 0xFFFD,
+			r >= 0x10000 && r <= unicode.MaxRune:
+			return r
+		}
+		return unicode.ReplacementChar
+	}, s)
+}
+
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
@@ -17,9 +17,108 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"encoding/xml"
 	"testing"
+
+	"helm.sh/helm/v3/internal/test"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
 )
 
+func testedRelease() *release.Release {
+	rel := release.Mock(&release.MockReleaseOptions{Name: "tested"})
+	passed, failed := int32(0), int32(1)
+	rel.Hooks = append(rel.Hooks, &release.Hook{
+		Name:   "passing-test",
+		Kind:   "Pod",
+		Path:   "tests/passing-test.yaml",
+		Events: []release.HookEvent{release.HookTest},
+		LastRun: release.HookExecution{
+			StartedAt:   helmtime.Unix(242085845, 0).UTC(),
+			CompletedAt: helmtime.Unix(242085847, 500000000).UTC(),
+			Phase:       release.HookPhaseSucceeded,
+			Logs:        "==> pod/passing-test container test <==\nok\n",
+			ExitCode:    &passed,
+		},
+	}, &release.Hook{
+		Name:   "failing-test",
+		Kind:   "Pod",
+		Path:   "tests/failing-test.yaml",
+		Weight: 1,
+		Events: []release.HookEvent{release.HookTest},
+		LastRun: release.HookExecution{
+			StartedAt:   helmtime.Unix(242085848, 0).UTC(),
+			CompletedAt: helmtime.Unix(242085858, 0).UTC(),
+			Phase:       release.HookPhaseFailed,
+			Reason:      "pod/failing-test container test: Error (exit code 1)",
+			Logs:        "==> pod/failing-test container test <==\nconnection refused\n",
+			ExitCode:    &failed,
+		},
+	})
+	return rel
+}
+
+func TestReleaseTestingCmd(t *testing.T) {
+	// none of the tests are run, to keep the times of their last runs
+	tests := []cmdTestCase{{
+		name:   "test results",
+		cmd:    "test tested --rerun-failed --filter name=passing-test",
+		golden: "output/test-results.txt",
+		rels:   []*release.Release{testedRelease()},
+	}, {
+		name:   "test results as json",
+		cmd:    "test tested --rerun-failed --filter name=passing-test -o json",
+		golden: "output/test-results.json",
+		rels:   []*release.Release{testedRelease()},
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	rel := testedRelease()
+	var results []*action.TestResult
+	for _, h := range rel.Hooks[1:] {
+		results = append(results, &action.TestResult{Name: h.Name, HookExecution: h.LastRun})
+	}
+	results = append(results, &action.TestResult{Name: "skipped-test", Skipped: true})
+
+	var out bytes.Buffer
+	if err := writeJUnit(&out, rel, results); err != nil {
+		t.Fatal(err)
+	}
+	test.AssertGoldenString(t, out.String(), "output/test-results-junit.xml")
+}
+
+func TestWriteJUnitControlCharacters(t *testing.T) {
+	rel := testedRelease()
+	exec := rel.Hooks[len(rel.Hooks)-1].LastRun
+	exec.Reason = "exit code 1\x00"
+	exec.Logs = "\x1b[31mconnection refused\x1b[0m\n"
+	results := []*action.TestResult{{Name: "failing-test", HookExecution: exec}}
+
+	var out bytes.Buffer
+	if err := writeJUnit(&out, rel, results); err != nil {
+		t.Fatal(err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("expected a valid XML report, got %s\n%s", err, out.String())
+	}
+	c := report.Suites[0].Cases[0]
+	if expected := "\uFFFD[31mconnection refused\uFFFD[0m\n"; c.SystemOut == nil || c.SystemOut.Text != expected {
+		t.Errorf("expected the logs %q, got %+v", expected, c.SystemOut)
+	}
+	if expected := "exit code 1\uFFFD"; c.Failure == nil || c.Failure.Text != expected {
+		t.Errorf("expected the failure %q, got %+v", expected, c.Failure)
+	}
+}
+
+func TestReleaseTestingOutputCompletion(t *testing.T) {
+	outputFlagCompletionTest(t, "test")
+}
+
 func TestReleaseTestingFileCompletion(t *testing.T) {
 	checkFileCompletion(t, "test", false)
 	checkFileCompletion(t, "test myrelease", false)
@@ -0,0 +1,68 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+const releaseUnlockHelp = `
+This command removes the lock held on a release.
+
+Helm locks a release while it is being installed, upgraded, rolled back or
+uninstalled so that concurrent operations cannot corrupt its history. Locks
+are renewed while the operation runs and expire on their own shortly after
+the process holding them exits. Use this command to remove a lock left behind
+by a process that cannot release it anymore.
+
+Removing a lock held by an operation that is still running allows another
+operation on the same release to start concurrently.
+`
+
+func newReleaseUnlockCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewReleaseUnlock(cfg)
+
+	cmd := &cobra.Command{
+		Use:   "unlock RELEASE_NAME",
+		Short: "remove the lock held on a release",
+		Long:  releaseUnlockHelp,
+		Args:  require.ExactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return compListReleases(toComplete, cfg)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lock, err := client.Run(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "release %q unlocked (was held by %q since %s)\n", args[0], lock.Holder, lock.AcquiredAt.Format(time.ANSIC))
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,62 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestReleaseUnlock(t *testing.T) {
+	store := storageFixture()
+	rel := release.Mock(&release.MockReleaseOptions{Name: "aeneas"})
+	if err := store.Create(rel); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Locker.AcquireLock("sh.helm.release.v1.aeneas.lock", "ci-runner/42", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	_, out, err := executeActionCommandC(store, "release unlock aeneas")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(out, `release "aeneas" unlocked (was held by "ci-runner/42" since `) {
+		t.Errorf("unexpected output: %s", out)
+	}
+	if _, err := store.GetReleaseLock("aeneas"); err != driver.ErrLockNotFound {
+		t.Errorf("expected release to be unlocked, got %v", err)
+	}
+
+	_, out, err = executeActionCommandC(store, "release unlock aeneas")
+	if err == nil {
+		t.Fatalf("expected an error unlocking a release that is not locked, got %q", out)
+	}
+	if !strings.Contains(err.Error(), `release "aeneas" is not locked`) {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestReleaseUnlockFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "release", false)
+	checkFileCompletion(t, "release unlock", false)
+	checkFileCompletion(t, "release unlock myrelease", false)
+}
@@ -51,8 +51,13 @@ Environment variables:
 | $HELM_CONFIG_HOME                  | set an alternative location for storing Helm configuration.                       |
 | $HELM_DATA_HOME                    | set an alternative location for storing Helm data.                                |
 | $HELM_DEBUG                        | indicate whether or not Helm is running in Debug mode                             |
-| $HELM_DRIVER                       | set the backend storage driver. Values are: configmap, secret, memory, postgres   |
+| $HELM_DRIVER                       | set the backend storage driver. Values are: configmap, secret, memory, sql, file  |
+| $HELM_DRIVER_ENCRYPTION_COMMAND    | set the key management command encrypting the releases, see 'helm storage rekey'. |
+| $HELM_DRIVER_ENCRYPTION_KEYFILE    | set the file of the keys encrypting the releases, see 'helm storage rekey'.       |
+| $HELM_DRIVER_FILE_PATH             | set the directory the file storage driver should use.                             |
+| $HELM_DRIVER_SHARED_CHARTS         | store each chart once, apart from the releases using it. Defaults to false.       |
 | $HELM_DRIVER_SQL_CONNECTION_STRING | set the connection string the SQL storage driver should use.                      |
+| $HELM_HISTORY_RETENTION            | set the retention policy of the release history, e.g. "max-age=30d,failed-ttl=1d" |
 | $HELM_MAX_HISTORY                  | set the maximum number of helm release history.                                   |
 | $HELM_NAMESPACE                    | set the namespace used for the helm operations.                                   |
 | $HELM_NO_PLUGINS                   | disable plugins. Set HELM_NO_PLUGINS=1 to disable plugins.                        |
@@ -171,19 +176,25 @@ func newRootCmd(actionConfig *action.Configuration, out io.Writer, args []string
 		newPullCmd(actionConfig, out),
 		newShowCmd(out),
 		newLintCmd(out),
+		newUnitTestCmd(out),
 		newPackageCmd(out),
 		newRepoCmd(out),
 		newSearchCmd(out),
+		newSnapshotCmd(actionConfig, out),
 		newVerifyCmd(out),
 
 		// release commands
+		newDiffCmd(actionConfig, out),
 		newGetCmd(actionConfig, out),
 		newHistoryCmd(actionConfig, out),
 		newInstallCmd(actionConfig, out),
 		newListCmd(actionConfig, out),
+		newReleaseCmd(actionConfig, out),
 		newReleaseTestCmd(actionConfig, out),
+		newRecoverCmd(actionConfig, out),
 		newRollbackCmd(actionConfig, out),
 		newStatusCmd(actionConfig, out),
+		newStorageCmd(actionConfig, out),
 		newTemplateCmd(actionConfig, out),
 		newUninstallCmd(actionConfig, out),
 		newUpgradeCmd(actionConfig, out),
@@ -0,0 +1,175 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// defaultSnapshotDir is the directory of the snapshots of a chart, relative to
+// the chart directory, unless --snapshot-dir is set.
+const defaultSnapshotDir = "snapshots"
+
+var snapshotHelp = `
+This command consists of multiple subcommands to compare the manifests rendered
+by a chart against snapshots of them.
+
+A chart is rendered for each of its scenarios: the 'default' scenario, with the
+values of the chart, and a scenario for each values file matching
+ci/NAME-values.yaml in the chart, named NAME. The snapshots of a scenario are
+the files 'helm template --output-dir' would write, in a directory named after
+the scenario, which also holds a .snapshot-index file listing them.
+
+Use 'helm template --snapshot-dir' to write the snapshots. It never removes
+any file; the snapshots no longer rendered are removed by
+'helm snapshot verify --update'.
+`
+
+var snapshotVerifyHelp = `
+This command renders a chart for each of its scenarios and compares the
+rendered files with their snapshots, printing the differences. It fails if any
+file differs from its snapshot, has no snapshot, or is no longer rendered.
+
+The snapshots are read from the 'snapshots' directory of the chart, unless
+--snapshot-dir is set. Use '--update' to rewrite the snapshots that differ and
+to remove the ones no longer rendered. Only the files listed in the
+.snapshot-index file of a scenario, which Helm wrote, are ever removed.
+`
+
+func newSnapshotCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "compare rendered manifests against snapshots",
+		Long:  snapshotHelp,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newSnapshotVerifyCmd(cfg, out),
+	)
+
+	return cmd
+}
+
+func newSnapshotVerifyCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewSnapshot(cfg)
+	valueOpts := &values.Options{}
+	var extraAPIs []string
+
+	cmd := &cobra.Command{
+		Use:   "verify [NAME] [CHART]",
+		Short: "verify the rendered manifests of a chart against snapshots",
+		Long:  snapshotVerifyHelp,
+		Args:  require.MinimumNArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return compInstall(args, toComplete, client.Install)
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			client.Install.APIVersions = chartutil.VersionSet(extraAPIs)
+			client.Prune = client.Update
+			results, err := runSnapshot(args, client, valueOpts)
+			if err != nil {
+				return err
+			}
+
+			differ := 0
+			for _, r := range results {
+				fmt.Fprintf(out, "==> Scenario %s: %d file(s) unchanged, %d file(s) differ\n", r.Scenario, r.Unchanged, len(r.Files))
+				for _, f := range r.Files {
+					fmt.Fprintf(out, "%s %s\n%s", f.Status, f.Path, f.Diff)
+				}
+				differ += len(r.Files)
+			}
+
+			summary := fmt.Sprintf("%d scenario(s) verified, %d file(s) differ", len(results), differ)
+			if client.Update {
+				summary += fmt.Sprintf(", %d snapshot(s) updated", differ)
+			} else if differ > 0 {
+				return errors.New(summary)
+			}
+			fmt.Fprintln(out, summary)
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&client.Dir, "snapshot-dir", "", "the directory of the snapshots. Defaults to the 'snapshots' directory of the chart")
+	f.BoolVar(&client.Update, "update", false, "rewrite the snapshots that differ and remove the ones no longer rendered")
+	f.BoolVar(&client.Install.IncludeCRDs, "include-crds", false, "include CRDs in the rendered manifests")
+	f.StringArrayVarP(&extraAPIs, "api-versions", "a", []string{}, "Kubernetes api versions used for Capabilities.APIVersions")
+	addValueOptionsFlags(f, valueOpts)
+	addChartPathOptionsFlags(f, &client.Install.ChartPathOptions)
+
+	return cmd
+}
+
+// runSnapshot renders the chart given as arguments, like 'helm template', for
+// each of its scenarios, and compares the rendered files with their
+// snapshots.
+func runSnapshot(args []string, client *action.Snapshot, valueOpts *values.Options) ([]*action.SnapshotResult, error) {
+	client.Install.ReleaseName = "RELEASE-NAME"
+	name, chart, err := client.Install.NameAndChart(args)
+	if err != nil {
+		return nil, err
+	}
+	client.Install.ReleaseName = name
+
+	cp, err := client.Install.ChartPathOptions.LocateChart(chart, settings)
+	if err != nil {
+		return nil, err
+	}
+	if client.Dir == "" {
+		if fi, err := os.Stat(cp); err != nil || !fi.IsDir() {
+			return nil, errors.Errorf("--snapshot-dir is required for the chart %s, which is not a directory", chart)
+		}
+		client.Dir = filepath.Join(cp, defaultSnapshotDir)
+	}
+
+	vals, err := valueOpts.MergeValues(getter.All(settings))
+	if err != nil {
+		return nil, err
+	}
+	client.Install.Namespace = settings.Namespace()
+	return client.Run(cp, vals)
+}
+
+// writeSnapshotResults reports the snapshots written by 'helm template
+// --snapshot-dir', which leaves the ones no longer rendered to
+// 'helm snapshot verify --update'.
+func writeSnapshotResults(out io.Writer, dir string, results []*action.SnapshotResult) {
+	for _, r := range results {
+		for _, f := range r.Files {
+			if f.Status == action.SnapshotRemoved {
+				continue
+			}
+			fmt.Fprintf(out, "wrote %s\n", filepath.Join(dir, filepath.FromSlash(path.Join(r.Scenario, f.Path))))
+		}
+	}
+}
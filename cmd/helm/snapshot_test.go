@@ -0,0 +1,122 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+var chartWithSnapshots = "testdata/testcharts/chart-with-snapshots"
+
+func TestSnapshotVerifyCmd(t *testing.T) {
+	tests := []cmdTestCase{{
+		name:   "verify snapshots",
+		cmd:    fmt.Sprintf("snapshot verify %s", chartWithSnapshots),
+		golden: "output/snapshot-verify.txt",
+	}, {
+		name:      "verify changed snapshots",
+		cmd:       fmt.Sprintf("snapshot verify %s --set replicaCount=2", chartWithSnapshots),
+		golden:    "output/snapshot-verify-changed.txt",
+		wantError: true,
+	}, {
+		name:      "verify snapshots of a chart archive without a snapshot dir",
+		cmd:       "snapshot verify testdata/testcharts/compressedchart-0.1.0.tgz",
+		golden:    "output/snapshot-verify-no-dir.txt",
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestTemplateSnapshotDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the files Helm did not write are never removed
+	unrelated := filepath.Join(dir, "important", "data.txt")
+	if err := os.MkdirAll(filepath.Dir(unrelated), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(unrelated, []byte("keep me\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dir, "staging", action.SnapshotIndexFile)
+	if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(stale, []byte("chart-with-snapshots/templates/deployment.yaml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, out, err := executeActionCommand(fmt.Sprintf("template %s --snapshot-dir %s", chartWithSnapshots, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{
+		"default/chart-with-snapshots/templates/configmap.yaml",
+		"default/chart-with-snapshots/templates/deployment.yaml",
+		"prod/chart-with-snapshots/templates/configmap.yaml",
+		"prod/chart-with-snapshots/templates/deployment.yaml",
+		"prod/chart-with-snapshots/templates/ingress.yaml",
+	} {
+		file := filepath.Join(dir, filepath.FromSlash(f))
+		if !strings.Contains(out, "wrote "+file+"\n") {
+			t.Errorf("expected %s to be reported, got\n%s", file, out)
+		}
+		written, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		committed, err := ioutil.ReadFile(filepath.Join(chartWithSnapshots, "snapshots", filepath.FromSlash(f)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != string(committed) {
+			t.Errorf("expected %s to match the committed snapshot, got\n%s", f, written)
+		}
+	}
+
+	// the snapshots are only written again if they change
+	_, out, err = executeActionCommand(fmt.Sprintf("template %s --snapshot-dir %s", chartWithSnapshots, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Errorf("expected no snapshots to be written, got\n%s", out)
+	}
+	for _, f := range []string{unrelated, stale} {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("expected %s to be kept, got %v", f, err)
+		}
+	}
+}
+
+func TestSnapshotVerifyFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "snapshot", false)
+	checkFileCompletion(t, "snapshot verify", false)
+	checkFileCompletion(t, "snapshot verify myname", true)
+	checkFileCompletion(t, "snapshot verify myname mychart", false)
+}
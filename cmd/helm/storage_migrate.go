@@ -0,0 +1,117 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+const storageMigrateHelp = `
+This command copies the release history from one storage driver to another.
+
+Every revision of the releases of the current namespace, or of all namespaces
+with --all-namespaces, is read from the source driver and written to the
+destination driver with the same version, status, labels and content.
+Revisions that were already migrated are skipped, so an interrupted migration
+can be run again. Each release is locked in the source driver while it is
+migrated, and with --cleanup until its revisions are deleted: the migration
+fails on a release locked by another operation.
+
+The drivers are named as with $HELM_DRIVER and configured by the same
+environment variables, for instance:
+
+    $ export HELM_DRIVER_SQL_CONNECTION_STRING=postgresql://...
+    $ helm storage migrate --from secret --to sql --all-namespaces --verify
+
+With --cleanup, the migrated revisions are deleted from the source driver once
+all of them have been written and verified. Remember to set $HELM_DRIVER to
+the destination driver afterwards.
+`
+
+var storageDrivers = []string{"secret", "configmap", "sql", "file"}
+
+func newStorageMigrateCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewStorageMigrate(cfg)
+	var allNamespaces bool
+
+	cmd := &cobra.Command{
+		Use:               "migrate --from DRIVER --to DRIVER",
+		Short:             "copy the release history from one storage driver to another",
+		Long:              storageMigrateHelp,
+		Args:              require.NoArgs,
+		ValidArgsFunction: noCompletions,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client.Namespace = settings.Namespace()
+			if allNamespaces {
+				client.Namespace = ""
+			}
+
+			migrated, err := client.Run()
+			if len(migrated) > 0 {
+				tbl := uitable.New()
+				tbl.AddRow("NAMESPACE", "NAME", "REVISION", "STATUS")
+				for _, rls := range migrated {
+					tbl.AddRow(rls.Namespace, rls.Name, rls.Version, rls.Info.Status)
+				}
+				fmt.Fprintln(out, tbl)
+			}
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case client.DryRun:
+				fmt.Fprintf(out, "%d revisions would be migrated from %s to %s\n", len(migrated), client.From, client.To)
+			case client.Cleanup:
+				fmt.Fprintf(out, "%d revisions migrated from %s to %s and removed from %s\n", len(migrated), client.From, client.To, client.From)
+			default:
+				fmt.Fprintf(out, "%d revisions migrated from %s to %s\n", len(migrated), client.From, client.To)
+			}
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&client.From, "from", "", "the storage driver to read the releases from")
+	f.StringVar(&client.To, "to", "", "the storage driver to write the releases to")
+	f.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "migrate the releases of all namespaces")
+	f.BoolVar(&client.DryRun, "dry-run", false, "list the revisions that would be migrated without writing them")
+	f.BoolVar(&client.Verify, "verify", false, "read every migrated revision back and compare it with the source")
+	f.BoolVar(&client.Cleanup, "cleanup", false, "delete the migrated revisions from the source driver once verified")
+
+	for _, name := range []string{"from", "to"} {
+		if err := cmd.MarkFlagRequired(name); err != nil {
+			log.Fatal(err)
+		}
+		err := cmd.RegisterFlagCompletionFunc(name, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return storageDrivers, cobra.ShellCompDirectiveNoFileComp
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return cmd
+}
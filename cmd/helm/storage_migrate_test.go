@@ -0,0 +1,83 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestStorageMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-storage-migrate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("HELM_DRIVER_FILE_PATH", os.Getenv("HELM_DRIVER_FILE_PATH"))
+	os.Setenv("HELM_DRIVER_FILE_PATH", dir)
+
+	d, err := driver.NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := storage.Init(d)
+	for _, opts := range []*release.MockReleaseOptions{
+		{Name: "aeneas", Version: 1, Namespace: "default", Status: release.StatusSuperseded},
+		{Name: "aeneas", Version: 2, Namespace: "default"},
+		{Name: "dido", Version: 1, Namespace: "carthage"},
+	} {
+		if err := src.Create(release.Mock(opts)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, out, err := executeActionCommandC(storageFixture(), "storage migrate --from file --to memory --verify")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "NAMESPACE\tNAME  \tREVISION\tSTATUS    \n" +
+		"default  \taeneas\t1       \tsuperseded\n" +
+		"default  \taeneas\t2       \tdeployed  \n" +
+		"2 revisions migrated from file to memory\n"
+	if out != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, out)
+	}
+
+	_, out, err = executeActionCommandC(storageFixture(), "storage migrate --from file --to memory --all-namespaces --dry-run")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out, "carthage \tdido  \t1       \tdeployed") || !strings.HasSuffix(out, "3 revisions would be migrated from file to memory\n") {
+		t.Errorf("unexpected output: %s", out)
+	}
+
+	_, _, err = executeActionCommandC(storageFixture(), "storage migrate --from file")
+	if err == nil || !strings.Contains(err.Error(), `required flag(s) "to" not set`) {
+		t.Errorf("expected the destination to be required, got %v", err)
+	}
+}
+
+func TestStorageMigrateFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "storage", false)
+	checkFileCompletion(t, "storage migrate", false)
+}
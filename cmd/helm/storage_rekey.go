@@ -0,0 +1,110 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+const storageRekeyHelp = `
+This command re-encrypts the release history with the current encryption key.
+
+The releases are encrypted at rest by the secret, configmap, sql and file
+drivers when a key is configured by one of these environment variables:
+
+- $HELM_DRIVER_ENCRYPTION_KEYFILE is the path of a YAML file holding AES keys:
+
+      keys:
+        - id: "2021-03"
+          secret: <base64 encoded 32 byte key>
+        - id: "2020-11"
+          secret: <base64 encoded 32 byte key>
+
+  The first key encrypts the releases, the others only decrypt the releases
+  encrypted before a rotation.
+
+- $HELM_DRIVER_ENCRYPTION_COMMAND is a command, typically a plugin, wrapping
+  the data keys with an external key management service. It is run with the
+  argument "wrap" or "unwrap", and exchanges {"kid": "...", "key": "..."} JSON
+  objects, with base64 encoded keys, on its standard input and output.
+
+Each revision records the ID of the key that encrypted it. To rotate a key,
+add the new key first, run this command, then remove the previous key:
+
+    $ helm storage rekey --all-namespaces
+
+Revisions stored before encryption was enabled are encrypted the same way, as
+are the charts stored apart from the releases with $HELM_DRIVER_SHARED_CHARTS.
+`
+
+func newStorageRekeyCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewStorageRekey(cfg)
+	var allNamespaces bool
+
+	cmd := &cobra.Command{
+		Use:               "rekey",
+		Short:             "re-encrypt the release history with the current encryption key",
+		Long:              storageRekeyHelp,
+		Args:              require.NoArgs,
+		ValidArgsFunction: noCompletions,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if os.Getenv("HELM_DRIVER_ENCRYPTION_KEYFILE") == "" && os.Getenv("HELM_DRIVER_ENCRYPTION_COMMAND") == "" {
+				return errors.New("no encryption key: set $HELM_DRIVER_ENCRYPTION_KEYFILE or $HELM_DRIVER_ENCRYPTION_COMMAND")
+			}
+			client.Driver = os.Getenv("HELM_DRIVER")
+			client.Namespace = settings.Namespace()
+			if allNamespaces {
+				client.Namespace = ""
+			}
+
+			rekeyed, err := client.Run()
+			if len(rekeyed) > 0 {
+				tbl := uitable.New()
+				tbl.AddRow("NAMESPACE", "NAME", "REVISION", "STATUS")
+				for _, rls := range rekeyed {
+					tbl.AddRow(rls.Namespace, rls.Name, rls.Version, rls.Info.Status)
+				}
+				fmt.Fprintln(out, tbl)
+			}
+			if err != nil {
+				return err
+			}
+
+			if client.DryRun {
+				fmt.Fprintf(out, "%d revisions would be re-encrypted\n", len(rekeyed))
+			} else {
+				fmt.Fprintf(out, "%d revisions re-encrypted\n", len(rekeyed))
+			}
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&allNamespaces, "all-namespaces", "A", false, "re-encrypt the releases of all namespaces")
+	f.BoolVar(&client.DryRun, "dry-run", false, "list the revisions that would be re-encrypted without writing them")
+
+	return cmd
+}
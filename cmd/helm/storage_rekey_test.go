@@ -0,0 +1,100 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestStorageRekey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-storage-rekey-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyfile := filepath.Join(dir, "keys.yaml")
+	secret := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	if err := ioutil.WriteFile(keyfile, []byte("keys:\n  - id: k1\n    secret: "+secret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	releases := filepath.Join(dir, "releases")
+	for name, value := range map[string]string{
+		"HELM_DRIVER":                    "file",
+		"HELM_DRIVER_FILE_PATH":          releases,
+		"HELM_DRIVER_ENCRYPTION_KEYFILE": "",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	d, err := driver.NewFile(releases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetNamespace("default")
+	store := storage.Init(d)
+	for _, opts := range []*release.MockReleaseOptions{
+		{Name: "aeneas", Version: 1, Namespace: "default", Status: release.StatusSuperseded},
+		{Name: "aeneas", Version: 2, Namespace: "default"},
+	} {
+		if err := store.Create(release.Mock(opts)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, _, err = executeActionCommandC(storageFixture(), "storage rekey")
+	if err == nil || !strings.Contains(err.Error(), "no encryption key") {
+		t.Errorf("expected an encryption key to be required, got %v", err)
+	}
+
+	os.Setenv("HELM_DRIVER_ENCRYPTION_KEYFILE", keyfile)
+	_, out, err := executeActionCommandC(storageFixture(), "storage rekey")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "NAMESPACE\tNAME  \tREVISION\tSTATUS    \n" +
+		"default  \taeneas\t1       \tsuperseded\n" +
+		"default  \taeneas\t2       \tdeployed  \n" +
+		"2 revisions re-encrypted\n"
+	if out != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, out)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(releases, "default", "sh.helm.release.v1.aeneas.v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"release":"sealed.v1:`) {
+		t.Errorf("expected the release to be encrypted, got %s", data)
+	}
+	if _, err := store.Get("aeneas", 1); err == nil {
+		t.Error("expected the release not to be read without the key")
+	}
+}
+
+func TestStorageRekeyFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "storage rekey", false)
+}
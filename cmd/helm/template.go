@@ -29,6 +29,7 @@ import (
 
 	"helm.sh/helm/v3/pkg/release"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"helm.sh/helm/v3/cmd/helm/require"
@@ -54,6 +55,7 @@ func newTemplateCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	valueOpts := &values.Options{}
 	var extraAPIs []string
 	var showFiles []string
+	var snapshotDir string
 
 	cmd := &cobra.Command{
 		Use:   "template [NAME] [CHART]",
@@ -70,6 +72,23 @@ func newTemplateCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 			client.ClientOnly = !validate
 			client.APIVersions = chartutil.VersionSet(extraAPIs)
 			client.IncludeCRDs = includeCrds
+
+			if snapshotDir != "" {
+				if client.OutputDir != "" {
+					return errors.New("cannot set --output-dir and also --snapshot-dir")
+				}
+				snapshot := action.NewSnapshot(cfg)
+				snapshot.Install = client
+				snapshot.Dir = snapshotDir
+				snapshot.Update = true
+				results, err := runSnapshot(args, snapshot, valueOpts)
+				if err != nil {
+					return err
+				}
+				writeSnapshotResults(out, snapshotDir, results)
+				return nil
+			}
+
 			rel, err := runInstall(args, client, valueOpts, out)
 
 			if err != nil && !settings.Debug {
@@ -167,6 +186,7 @@ func newTemplateCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	addInstallFlags(cmd, f, client, valueOpts)
 	f.StringArrayVarP(&showFiles, "show-only", "s", []string{}, "only show manifests rendered from the given templates")
 	f.StringVar(&client.OutputDir, "output-dir", "", "writes the executed templates to files in output-dir instead of stdout")
+	f.StringVar(&snapshotDir, "snapshot-dir", "", "writes the executed templates of each scenario of the chart to snapshots in snapshot-dir, for 'helm snapshot verify'")
 	f.BoolVar(&validate, "validate", false, "validate your manifests against the Kubernetes cluster you are currently pointing at. This is the same validation performed on an install")
 	f.BoolVar(&includeCrds, "include-crds", false, "include CRDs in the templated output")
 	f.BoolVar(&skipTests, "skip-tests", false, "skip tests from templated output")
@@ -178,9 +198,12 @@ func newTemplateCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	return cmd
 }
 
+// isTestHook returns whether a hook is part of the tests: a test hook, or a
+// hook run before or after them.
 func isTestHook(h *release.Hook) bool {
 	for _, e := range h.Events {
-		if e == release.HookTest {
+		switch e {
+		case release.HookPreTest, release.HookTest, release.HookPostTest:
 			return true
 		}
 	}
@@ -0,0 +1,147 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+var longUnitTestHelp = `
+This command runs the unit tests of the templates of a chart, without a
+cluster.
+
+The test suites of a chart are YAML files matching tests/*_test.yaml in the
+chart directory. Each test of a suite sets values, renders the templates of the
+chart, and asserts on the documents rendered by some of them:
+
+    suite: deployment
+    templates:
+      - templates/deployment.yaml
+    tests:
+      - it: sets the replicas
+        values:
+          - values-prod.yaml
+        set:
+          replicaCount: 3
+        asserts:
+          - hasDocuments:
+              count: 1
+          - equal:
+              path: .spec.replicas
+              value: 3
+          - matchRegex:
+              path: .spec.template.spec.containers[0].image
+              pattern: "^nginx:"
+          - matchSnapshot:
+              path: .spec
+
+The assertions are 'hasDocuments', 'equal', 'notEqual', 'matchRegex',
+'notMatchRegex', 'matchSnapshot' and 'failedTemplate', which expects the
+templates to fail to render. Paths are JSONPath expressions, and
+'documentIndex' restricts an assertion to a single document.
+
+The snapshots of a suite are written to the tests/__snapshot__ directory the
+first time they are matched. Use '--update-snapshot' to rewrite the snapshots
+that no longer match.
+`
+
+func newUnitTestCmd(out io.Writer) *cobra.Command {
+	client := action.NewUnitTest()
+
+	cmd := &cobra.Command{
+		Use:   "unittest [CHART...]",
+		Short: "run the unit tests of the templates of a chart",
+		Long:  longUnitTestHelp,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths := []string{"."}
+			if len(args) > 0 {
+				paths = args
+			}
+
+			var message strings.Builder
+			failedCharts, passed, failed, snapshots := 0, 0, 0, 0
+			for _, path := range paths {
+				fmt.Fprintf(&message, "==> Testing %s\n", path)
+
+				results, err := client.Run(path)
+				if err != nil {
+					fmt.Fprintf(&message, "Error %s\n\n", err)
+					failedCharts++
+					continue
+				}
+				chartFailed := false
+				for _, r := range results {
+					file, err := filepath.Rel(path, r.Suite.File())
+					if err != nil {
+						file = r.Suite.File()
+					}
+					status := "PASS"
+					if !r.Passed() {
+						status = "FAIL"
+						chartFailed = true
+					}
+					fmt.Fprintf(&message, "%s  %s\t%s\n", status, r.Suite.Name, filepath.ToSlash(file))
+					if r.Err != nil {
+						fmt.Fprintf(&message, "\tError %s\n", r.Err)
+					}
+					for _, t := range r.Tests {
+						if t.Passed() {
+							passed++
+							continue
+						}
+						failed++
+						fmt.Fprintf(&message, "\t- %s\n", t.Name)
+						for _, f := range t.Failures {
+							fmt.Fprintf(&message, "\t\t%s\n", strings.ReplaceAll(strings.TrimRight(f, "\n"), "\n", "\n\t\t"))
+						}
+					}
+					snapshots += r.SnapshotsWritten
+				}
+				if chartFailed {
+					failedCharts++
+				}
+				fmt.Fprint(&message, "\n")
+			}
+
+			fmt.Fprint(out, message.String())
+
+			summary := fmt.Sprintf("%d chart(s) tested, %d chart(s) failed, %d test(s) passed, %d test(s) failed",
+				len(paths), failedCharts, passed, failed)
+			if snapshots > 0 {
+				summary += fmt.Sprintf(", %d snapshot(s) written", snapshots)
+			}
+			if failedCharts > 0 {
+				return errors.New(summary)
+			}
+			fmt.Fprintln(out, summary)
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&client.UpdateSnapshots, "update-snapshot", "u", false, "rewrite the snapshots that do not match")
+
+	return cmd
+}
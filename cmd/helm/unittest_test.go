@@ -0,0 +1,40 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestUnitTestCmd(t *testing.T) {
+	tests := []cmdTestCase{{
+		name:   "unittest chart",
+		cmd:    "unittest testdata/testcharts/chart-with-unittests",
+		golden: "output/unittest.txt",
+	}, {
+		name:      "unittest charts with failing tests",
+		cmd:       "unittest testdata/testcharts/chart-with-failing-unittests testdata/testcharts/chart-with-unittests testdata/testcharts/empty",
+		golden:    "output/unittest-failed.txt",
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestUnitTestFileCompletion(t *testing.T) {
+	checkFileCompletion(t, "unittest", true)
+	checkFileCompletion(t, "unittest mypath", true) // Multiple paths can be given
+}
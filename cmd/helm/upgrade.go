@@ -59,6 +59,19 @@ last (right-most) set specified. For example, if both 'bar' and 'newbar' values
 set for a key called 'foo', the 'newbar' value would take precedence:
 
     $ helm upgrade --set foo=bar --set foo=newbar redis ./redis
+
+Once the upgraded resources are ready and the post-upgrade hooks have run, the
+health checks declared by the chart are run: hooks of the 'health-check' event,
+and resources annotated with 'helm.sh/health-check-http-path' and
+'helm.sh/health-check-http-port', or with 'helm.sh/health-check-jsonpath' and
+'helm.sh/health-check-value'. If they do not pass within '--health-check-timeout',
+the release is rolled back to its last successful revision. The hooks of the
+'health-check' event are not run with '--no-hooks'.
+
+If the upgrade fails, including when its hooks or health checks fail, the
+hooks of the 'post-upgrade-failure' event are run once the release is marked
+as failed, and before it is rolled back with '--atomic' or failed health checks.
+Their own failure is logged, without changing the result of the upgrade.
 `
 
 func newUpgradeCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
@@ -111,6 +124,9 @@ func newUpgradeCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 					instClient.DisableOpenAPIValidation = client.DisableOpenAPIValidation
 					instClient.SubNotes = client.SubNotes
 					instClient.Description = client.Description
+					instClient.Labels = client.Labels
+					instClient.ServerSide = client.ServerSide
+					instClient.ForceConflicts = client.ForceConflicts
 
 					rel, err := runInstall(args, instClient, valueOpts, out)
 					if err != nil {
@@ -136,6 +152,7 @@ func newUpgradeCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			client.ValuesFiles = valueOpts.ValueFiles
 
 			// Check chart dependencies to make sure all are present in /charts
 			ch, err := loader.Load(chartPath)
@@ -173,6 +190,8 @@ func newUpgradeCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	f.BoolVar(&client.Recreate, "recreate-pods", false, "performs pods restart for the resource if applicable")
 	f.MarkDeprecated("recreate-pods", "functionality will no longer be updated. Consult the documentation for other methods to recreate pods")
 	f.BoolVar(&client.Force, "force", false, "force resource updates through a replacement strategy")
+	f.BoolVar(&client.ServerSide, "server-side", false, "if set, resources are sent to the cluster with server-side apply using the \"helm\" field manager")
+	f.BoolVar(&client.ForceConflicts, "force-conflicts", false, "if set and --server-side enabled, take ownership of fields managed by other field managers instead of failing")
 	f.BoolVar(&client.DisableHooks, "no-hooks", false, "disable pre/post upgrade hooks")
 	f.BoolVar(&client.DisableOpenAPIValidation, "disable-openapi-validation", false, "if set, the upgrade process will not validate rendered templates against the Kubernetes OpenAPI Schema")
 	f.BoolVar(&client.SkipCRDs, "skip-crds", false, "if set, no CRDs will be installed when an upgrade is performed with install flag enabled. By default, CRDs are installed if not already present, when an upgrade is performed with install flag enabled")
@@ -183,13 +202,18 @@ func newUpgradeCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 	f.BoolVar(&client.WaitForJobs, "wait-for-jobs", false, "if set and --wait enabled, will wait until all Jobs have been completed before marking the release as successful. It will wait for as long as --timeout")
 	f.BoolVar(&client.Atomic, "atomic", false, "if set, upgrade process rolls back changes made in case of failed upgrade. The --wait flag will be set automatically if --atomic is used")
 	f.IntVar(&client.MaxHistory, "history-max", settings.MaxHistory, "limit the maximum number of revisions saved per release. Use 0 for no limit")
+	f.BoolVar(&client.SkipHealthChecks, "skip-health-checks", false, "if set, the health checks declared by the chart are not run after the upgrade. By default, the release is rolled back when they fail")
+	f.DurationVar(&client.HealthCheckTimeout, "health-check-timeout", 0, "time given to the health checks declared by the chart to pass. Defaults to --timeout")
 	f.BoolVar(&client.CleanupOnFail, "cleanup-on-fail", false, "allow deletion of new resources created in this upgrade when upgrade fails")
 	f.BoolVar(&client.SubNotes, "render-subchart-notes", false, "if set, render subchart notes along with the parent")
 	f.StringVar(&client.Description, "description", "", "add a custom description")
+	f.StringToStringVar(&client.Labels, "labels", nil, "labels to add to the release, which 'helm list' can select (e.g. --labels team=payments,tier=prod). The labels of the previous revision are kept, unless --reset-labels is set")
+	f.BoolVar(&client.ResetLabels, "reset-labels", false, "when upgrading, drop the labels of the previous revision and only keep the ones given with --labels")
 	addChartPathOptionsFlags(f, &client.ChartPathOptions)
 	addValueOptionsFlags(f, valueOpts)
 	bindOutputFlag(cmd, &outfmt)
 	bindPostRenderFlag(cmd, &client.PostRenderer)
+	bindOutputEventsFlag(cmd, cfg)
 
 	err := cmd.RegisterFlagCompletionFunc("version", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		if len(args) != 2 {
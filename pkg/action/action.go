@@ -23,8 +23,10 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
+	shellwords "github.com/mattn/go-shellwords"
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -36,12 +38,14 @@ import (
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/helmpath"
 	"helm.sh/helm/v3/pkg/kube"
 	"helm.sh/helm/v3/pkg/postrender"
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/releaseutil"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
+	"helm.sh/helm/v3/pkg/storage/encryption"
 	"helm.sh/helm/v3/pkg/time"
 )
 
@@ -95,6 +99,9 @@ type Configuration struct {
 	Capabilities *chartutil.Capabilities
 
 	Log func(string, ...interface{})
+
+	// Observer receives the progress events emitted by actions. It may be nil.
+	Observer Observer
 }
 
 // renderResources renders the templates in a chart
@@ -361,10 +368,90 @@ func (c *Configuration) recordRelease(r *release.Release) {
 	}
 }
 
+// lockRelease locks the named release in storage for the duration of an
+// operation. The returned function releases the lock.
+func (c *Configuration) lockRelease(name string) (func(), error) {
+	lock, err := c.Releases.LockRelease(name)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			c.Log("failed to unlock release %q: %s", name, err)
+		}
+	}, nil
+}
+
+// errServerSideWithForce is returned when a forced replacement is combined with server-side apply.
+var errServerSideWithForce = errors.New("force replacement cannot be used with server-side apply")
+
+// createResources creates the resources in the cluster, using server-side apply when opts is set.
+func (c *Configuration) createResources(resources kube.ResourceList, opts *kube.ApplyOptions) (*kube.Result, error) {
+	var result *kube.Result
+	var err error
+	if opts == nil {
+		result, err = c.KubeClient.Create(resources)
+	} else {
+		var ssa kube.InterfaceServerSideApply
+		if ssa, err = c.serverSideClient(); err != nil {
+			return nil, err
+		}
+		result, err = ssa.CreateServerSide(resources, *opts)
+	}
+	c.emitResult(result)
+	return result, err
+}
+
+// updateResources updates the resources in the cluster from current to target, using
+// server-side apply when opts is set.
+func (c *Configuration) updateResources(current, target kube.ResourceList, force bool, opts *kube.ApplyOptions) (*kube.Result, error) {
+	var result *kube.Result
+	var err error
+	if opts == nil {
+		result, err = c.KubeClient.Update(current, target, force)
+	} else {
+		if force {
+			return &kube.Result{}, errServerSideWithForce
+		}
+		var ssa kube.InterfaceServerSideApply
+		if ssa, err = c.serverSideClient(); err != nil {
+			return &kube.Result{}, err
+		}
+		result, err = ssa.UpdateServerSide(current, target, *opts)
+	}
+	c.emitResult(result)
+	return result, err
+}
+
+// deleteResources deletes the resources from the cluster.
+func (c *Configuration) deleteResources(resources kube.ResourceList) (*kube.Result, []error) {
+	result, errs := c.KubeClient.Delete(resources)
+	c.emitResult(result)
+	return result, errs
+}
+
+func (c *Configuration) serverSideClient() (kube.InterfaceServerSideApply, error) {
+	ssa, ok := c.KubeClient.(kube.InterfaceServerSideApply)
+	if !ok {
+		return nil, errors.Errorf("server-side apply is not supported by kubernetes client %T", c.KubeClient)
+	}
+	return ssa, nil
+}
+
+// applyOptions returns the server-side apply options for an action, or nil when
+// server-side apply was not requested.
+func applyOptions(serverSide, forceConflicts bool) *kube.ApplyOptions {
+	if !serverSide {
+		return nil
+	}
+	return &kube.ApplyOptions{FieldManager: kube.DefaultFieldManager, ForceConflicts: forceConflicts}
+}
+
 // Init initializes the action configuration
 func (c *Configuration) Init(getter genericclioptions.RESTClientGetter, namespace, helmDriver string, log DebugLog) error {
 	kc := kube.New(getter)
 	kc.Log = log
+	kc.ReadinessObserver = c.observeReadiness
 
 	lazyClient := &lazyClient{
 		namespace: namespace,
@@ -373,14 +460,6 @@ func (c *Configuration) Init(getter genericclioptions.RESTClientGetter, namespac
 
 	var store *storage.Storage
 	switch helmDriver {
-	case "secret", "secrets", "":
-		d := driver.NewSecrets(newSecretClient(lazyClient))
-		d.Log = log
-		store = storage.Init(d)
-	case "configmap", "configmaps":
-		d := driver.NewConfigMaps(newConfigMapClient(lazyClient))
-		d.Log = log
-		store = storage.Init(d)
 	case "memory":
 		var d *driver.Memory
 		if c.Releases != nil {
@@ -396,25 +475,168 @@ func (c *Configuration) Init(getter genericclioptions.RESTClientGetter, namespac
 		}
 		d.SetNamespace(namespace)
 		store = storage.Init(d)
+	default:
+		d, err := newStorageDriver(lazyClient, helmDriver, namespace, log)
+		if err != nil {
+			return errors.Wrap(err, "unable to initialize the storage driver")
+		}
+		store = storage.Init(d)
+		switch d.(type) {
+		case *driver.Secrets, *driver.ConfigMaps:
+			store.Locker = newLeases(lazyClient, log)
+		}
+	}
+
+	c.RESTClientGetter = getter
+	c.KubeClient = kc
+	c.Releases = store
+	c.Log = log
+
+	return nil
+}
+
+// StorageDriver returns a new storage driver of the given kind, as selected by
+// HELM_DRIVER, accessing the releases of namespace. An empty namespace gives
+// access to the releases of all namespaces for the list and query operations.
+func (c *Configuration) StorageDriver(helmDriver, namespace string) (driver.Driver, error) {
+	if helmDriver == "memory" {
+		d := driver.NewMemory()
+		d.SetNamespace(namespace)
+		return d, nil
+	}
+	return newStorageDriver(c.namespacedClient(namespace), helmDriver, namespace, c.Log)
+}
+
+// storageLocker returns the Locker of the releases stored by d in namespace,
+// for the drivers relying on Kubernetes leases to lock the releases, or nil.
+func (c *Configuration) storageLocker(d driver.Driver, namespace string) driver.Locker {
+	switch d.(type) {
+	case *driver.Secrets, *driver.ConfigMaps:
+		return newLeases(c.namespacedClient(namespace), c.Log)
+	}
+	return nil
+}
+
+// namespacedClient returns a lazy Kubernetes client for namespace.
+func (c *Configuration) namespacedClient(namespace string) *lazyClient {
+	return &lazyClient{
+		namespace: namespace,
+		clientFn: func() (*kubernetes.Clientset, error) {
+			conf, err := c.RESTClientGetter.ToRESTConfig()
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to generate config for kubernetes client")
+			}
+			return kubernetes.NewForConfig(conf)
+		},
+	}
+}
+
+// newStorageDriver returns the persistent storage driver named by helmDriver,
+// encrypting the releases if an encryption key is configured.
+func newStorageDriver(lc *lazyClient, helmDriver, namespace string, log DebugLog) (driver.Driver, error) {
+	var d driver.Driver
+	switch helmDriver {
+	case "secret", "secrets", "":
+		s := driver.NewSecrets(newSecretClient(lc))
+		s.Log = log
+		d = s
+	case "configmap", "configmaps":
+		c := driver.NewConfigMaps(newConfigMapClient(lc))
+		c.Log = log
+		d = c
 	case "sql":
-		d, err := driver.NewSQL(
+		s, err := driver.NewSQL(
 			os.Getenv("HELM_DRIVER_SQL_CONNECTION_STRING"),
 			log,
 			namespace,
 		)
 		if err != nil {
-			panic(fmt.Sprintf("Unable to instantiate SQL driver: %v", err))
+			return nil, errors.Errorf("Unable to instantiate SQL driver: %v", err)
 		}
-		store = storage.Init(d)
+		d = s
+	case "file":
+		dir := os.Getenv("HELM_DRIVER_FILE_PATH")
+		if dir == "" {
+			dir = helmpath.DataPath("releases")
+		}
+		f, err := driver.NewFile(dir)
+		if err != nil {
+			return nil, errors.Errorf("Unable to instantiate file driver: %v", err)
+		}
+		f.Log = log
+		f.SetNamespace(namespace)
+		d = f
 	default:
-		// Not sure what to do here.
-		panic("Unknown driver in HELM_DRIVER: " + helmDriver)
+		return nil, errors.New("Unknown driver in HELM_DRIVER: " + helmDriver)
 	}
 
-	c.RESTClientGetter = getter
-	c.KubeClient = kc
-	c.Releases = store
-	c.Log = log
+	if err := shareStorageCharts(d); err != nil {
+		return nil, err
+	}
 
+	e, err := storageEncrypter()
+	if err != nil || e == nil {
+		return d, err
+	}
+	encryptable, ok := d.(driver.Encryptable)
+	if !ok {
+		return nil, errors.Errorf("the %s driver does not support encryption", d.Name())
+	}
+	encryptable.SetEncrypter(e)
+	return d, nil
+}
+
+// shareStorageCharts stores the charts of the releases apart from them, once
+// per chart, when $HELM_DRIVER_SHARED_CHARTS is true. Helm versions reading
+// the releases without supporting this format see them without their chart.
+func shareStorageCharts(d driver.Driver) error {
+	v := os.Getenv("HELM_DRIVER_SHARED_CHARTS")
+	if v == "" {
+		return nil
+	}
+	share, err := strconv.ParseBool(v)
+	if err != nil {
+		return errors.Wrap(err, "invalid HELM_DRIVER_SHARED_CHARTS")
+	}
+	sharer, ok := d.(driver.ChartSharer)
+	if !ok {
+		if share {
+			return errors.Errorf("the %s driver does not support shared charts", d.Name())
+		}
+		return nil
+	}
+	sharer.ShareCharts(share)
 	return nil
 }
+
+// storageEncrypter returns the Encrypter of the releases configured by
+// $HELM_DRIVER_ENCRYPTION_KEYFILE or $HELM_DRIVER_ENCRYPTION_COMMAND, or nil
+// if the releases are not encrypted.
+func storageEncrypter() (driver.Encrypter, error) {
+	keyfile := os.Getenv("HELM_DRIVER_ENCRYPTION_KEYFILE")
+	command := os.Getenv("HELM_DRIVER_ENCRYPTION_COMMAND")
+	switch {
+	case keyfile != "" && command != "":
+		return nil, errors.New("HELM_DRIVER_ENCRYPTION_KEYFILE and HELM_DRIVER_ENCRYPTION_COMMAND are mutually exclusive")
+	case keyfile != "":
+		f, err := encryption.LoadKeyfile(keyfile)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid HELM_DRIVER_ENCRYPTION_KEYFILE")
+		}
+		return encryption.NewEnvelope(f), nil
+	case command != "":
+		args, err := shellwords.Parse(command)
+		if err != nil || len(args) == 0 {
+			return nil, errors.Errorf("invalid HELM_DRIVER_ENCRYPTION_COMMAND %q", command)
+		}
+		return encryption.NewEnvelope(encryption.NewExec(args[0], args[1:]...)), nil
+	}
+	return nil, nil
+}
+
+// newLeases returns the Locker used by the Kubernetes storage drivers.
+func newLeases(lc *lazyClient, log DebugLog) *driver.Leases {
+	l := driver.NewLeases(newLeaseClient(lc))
+	l.Log = log
+	return l
+}
@@ -22,9 +22,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	dockerauth "github.com/deislabs/oras/pkg/auth/docker"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
 
 	"helm.sh/helm/v3/internal/experimental/registry"
@@ -319,3 +321,31 @@ func TestGetVersionSet(t *testing.T) {
 		t.Error("Non-existent version is reported found.")
 	}
 }
+
+func TestInitStorageDriverError(t *testing.T) {
+	defer os.Setenv("HELM_DRIVER_ENCRYPTION_KEYFILE", os.Getenv("HELM_DRIVER_ENCRYPTION_KEYFILE"))
+	os.Setenv("HELM_DRIVER_ENCRYPTION_KEYFILE", filepath.Join("testdata", "missing-keys.yaml"))
+
+	cfg := new(Configuration)
+	err := cfg.Init(genericclioptions.NewConfigFlags(true), "default", "secret", t.Logf)
+	if err == nil || !strings.Contains(err.Error(), "unable to initialize the storage driver: invalid HELM_DRIVER_ENCRYPTION_KEYFILE") {
+		t.Errorf("expected the storage driver error, got %v", err)
+	}
+}
+
+func TestShareStorageCharts(t *testing.T) {
+	defer os.Setenv("HELM_DRIVER_SHARED_CHARTS", os.Getenv("HELM_DRIVER_SHARED_CHARTS"))
+
+	os.Setenv("HELM_DRIVER_SHARED_CHARTS", "maybe")
+	if err := shareStorageCharts(driver.NewMemory()); err == nil || !strings.Contains(err.Error(), "invalid HELM_DRIVER_SHARED_CHARTS") {
+		t.Errorf("expected an invalid value error, got %v", err)
+	}
+	os.Setenv("HELM_DRIVER_SHARED_CHARTS", "true")
+	if err := shareStorageCharts(driver.NewMemory()); err == nil {
+		t.Error("expected the memory driver to be refused")
+	}
+	os.Setenv("HELM_DRIVER_SHARED_CHARTS", "false")
+	if err := shareStorageCharts(driver.NewMemory()); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"helm.sh/helm/v3/internal/version"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// auditRedacted replaces the secrets of the command lines of the audit records.
+const auditRedacted = "REDACTED"
+
+// auditArgs returns the command line recorded in the audit records.
+var auditArgs = func() []string { return os.Args }
+
+// auditCIEnv are the environment variables describing the CI job performing
+// an operation, recorded in the audit records when they are set.
+var auditCIEnv = []string{
+	"CI",
+	// GitHub Actions
+	"GITHUB_ACTIONS", "GITHUB_REPOSITORY", "GITHUB_WORKFLOW", "GITHUB_RUN_ID", "GITHUB_SHA", "GITHUB_ACTOR",
+	// GitLab CI
+	"GITLAB_CI", "CI_PROJECT_PATH", "CI_PIPELINE_ID", "CI_JOB_ID", "CI_COMMIT_SHA", "GITLAB_USER_LOGIN",
+	// Jenkins
+	"JENKINS_URL", "JOB_NAME", "BUILD_NUMBER", "BUILD_URL", "GIT_COMMIT",
+	// Buildkite
+	"BUILDKITE", "BUILDKITE_PIPELINE_SLUG", "BUILDKITE_BUILD_NUMBER", "BUILDKITE_COMMIT",
+	// CircleCI
+	"CIRCLECI", "CIRCLE_PROJECT_REPONAME", "CIRCLE_BUILD_NUM", "CIRCLE_SHA1",
+	// Azure Pipelines
+	"TF_BUILD", "BUILD_REPOSITORY_NAME", "BUILD_BUILDID", "BUILD_SOURCEVERSION",
+}
+
+// audit returns the audit record of an operation using valuesFiles, whose
+// URLs are recorded without their passwords.
+func (c *Configuration) audit(valuesFiles []string) *release.Audit {
+	a := &release.Audit{
+		User:        c.auditUser(),
+		HelmVersion: version.GetVersion(),
+		Command:     redactArgs(auditArgs()),
+	}
+	for _, f := range valuesFiles {
+		a.ValuesFiles = append(a.ValuesFiles, redactURL(f))
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		a.Hostname = hostname
+	}
+	for _, name := range auditCIEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			if a.CI == nil {
+				a.CI = map[string]string{}
+			}
+			a.CI[name] = value
+		}
+	}
+	return a
+}
+
+// auditUser returns the Kubernetes user performing the operations: the
+// impersonated user, the user of a basic authentication, or else the name of
+// the user of the current kubeconfig context.
+func (c *Configuration) auditUser() string {
+	if c.RESTClientGetter == nil {
+		return ""
+	}
+	if conf, err := c.RESTClientGetter.ToRESTConfig(); err == nil {
+		if conf.Impersonate.UserName != "" {
+			return conf.Impersonate.UserName
+		}
+		if conf.Username != "" {
+			return conf.Username
+		}
+	}
+	if g, ok := c.RESTClientGetter.(interface {
+		ToRawKubeConfigLoader() clientcmd.ClientConfig
+	}); ok {
+		if raw, err := g.ToRawKubeConfigLoader().RawConfig(); err == nil {
+			if ctx, ok := raw.Contexts[raw.CurrentContext]; ok {
+				return ctx.AuthInfo
+			}
+		}
+	}
+	return ""
+}
+
+// redactArgs returns a command line without its secrets: the values of the
+// --set flags, keeping their keys, the values of the flags naming a password,
+// a token or a secret, and the passwords of the URLs.
+func redactArgs(args []string) []string {
+	redactedArgs := make([]string, len(args))
+	var redact func(string) string
+	for i, arg := range args {
+		if redact != nil {
+			redactedArgs[i], redact = redact(arg), nil
+			continue
+		}
+		redactedArgs[i] = redactURL(arg)
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		value := ""
+		hasValue := false
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value, hasValue = name[:i], name[i+1:], true
+		}
+		var r func(string) string
+		switch {
+		case strings.HasSuffix(name, "-stdin"):
+			continue
+		case name == "set" || name == "set-string":
+			r = redactSetValues
+		case strings.Contains(name, "password") || strings.Contains(name, "token") || strings.Contains(name, "secret"):
+			r = func(string) string { return auditRedacted }
+		default:
+			continue
+		}
+		if hasValue {
+			redactedArgs[i] = arg[:len(arg)-len(value)] + r(value)
+		} else {
+			redact = r
+		}
+	}
+	return redactedArgs
+}
+
+// redactSetValues redacts the values of the value of a --set flag, keeping
+// their keys. The value is split like strvals parses it: the commas of a list
+// in braces and the escaped commas do not end a value.
+func redactSetValues(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		// copy the key
+		j := i
+		for ; j < len(s) && s[j] != '=' && s[j] != ','; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j > len(s) {
+			j = len(s)
+		}
+		b.WriteString(s[i:j])
+		if j == len(s) {
+			break
+		}
+		if s[j] == ',' {
+			b.WriteByte(',')
+			i = j + 1
+			continue
+		}
+		b.WriteString("=" + auditRedacted)
+
+		// skip the value, up to the end of a list
+		j++
+		inList := j < len(s) && s[j] == '{'
+		for ; j < len(s) && (inList || s[j] != ','); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case '}':
+				inList = false
+			}
+		}
+		if j < len(s) {
+			b.WriteByte(',')
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// redactURL redacts the password of an URL.
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	u.User = url.UserPassword(u.User.Username(), auditRedacted)
+	return u.String()
+}
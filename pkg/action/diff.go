@@ -0,0 +1,491 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// ChangeType describes how a resource differs between two manifests.
+type ChangeType string
+
+const (
+	// ChangeAdded indicates that a resource only exists in the new manifest.
+	ChangeAdded ChangeType = "added"
+	// ChangeRemoved indicates that a resource only exists in the old manifest.
+	ChangeRemoved ChangeType = "removed"
+	// ChangeModified indicates that a resource exists in both manifests with different content.
+	ChangeModified ChangeType = "modified"
+)
+
+func (x ChangeType) String() string { return string(x) }
+
+// ResourceDiff describes the difference of a single resource between two manifests.
+type ResourceDiff struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+	Namespace  string     `json:"namespace,omitempty"`
+	Change     ChangeType `json:"change"`
+	// Diff is the unified diff of the resource.
+	Diff string `json:"diff"`
+}
+
+// Diff is the action for previewing the changes an operation would apply to a release.
+//
+// It provides the implementation of 'helm diff'.
+type Diff struct {
+	cfg *Configuration
+
+	// Context is the number of unchanged lines shown around each change.
+	Context int
+	// ShowSecrets disables the masking of Secret data in the output.
+	ShowSecrets bool
+	// Live compares against the objects currently in the cluster instead of
+	// the manifest recorded for the release.
+	Live bool
+}
+
+// NewDiff creates a new Diff object with the given configuration.
+func NewDiff(cfg *Configuration) *Diff {
+	return &Diff{
+		cfg:     cfg,
+		Context: 3,
+	}
+}
+
+// Upgrade renders the chart the way the given Upgrade would and returns the
+// changes compared to the currently deployed release.
+func (d *Diff) Upgrade(u *Upgrade, name string, chart *chart.Chart, vals map[string]interface{}) ([]*ResourceDiff, error) {
+	if err := d.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	if err := chartutil.ValidateReleaseName(name); err != nil {
+		return nil, errors.Errorf("release name is invalid: %s", name)
+	}
+
+	current, target, err := u.prepareUpgrade(name, chart, vals)
+	if err != nil {
+		return nil, err
+	}
+	return d.releases(current, target)
+}
+
+// Rollback returns the changes a rollback to the given revision would apply.
+// A version of 0 means the previous revision.
+func (d *Diff) Rollback(name string, version int) ([]*ResourceDiff, error) {
+	if err := d.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	r := NewRollback(d.cfg)
+	r.Version = version
+	current, target, err := r.prepareRollback(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.releases(current, target)
+}
+
+// Revisions returns the changes between two stored revisions of a release. A
+// version of 0 for to means the latest revision.
+func (d *Diff) Revisions(name string, from, to int) ([]*ResourceDiff, error) {
+	if err := d.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	if from <= 0 || to < 0 {
+		return nil, errInvalidRevision
+	}
+
+	oldRelease, err := d.cfg.releaseContent(name, from)
+	if err != nil {
+		return nil, err
+	}
+	newRelease, err := d.cfg.releaseContent(name, to)
+	if err != nil {
+		return nil, err
+	}
+	return d.manifests(oldRelease.Manifest, newRelease.Manifest, newRelease.Namespace)
+}
+
+func (d *Diff) releases(current, target *release.Release) ([]*ResourceDiff, error) {
+	if d.Live {
+		return d.live(current.Manifest, target.Manifest)
+	}
+	return d.manifests(current.Manifest, target.Manifest, target.Namespace)
+}
+
+// manifests compares two manifests as they were recorded or rendered.
+func (d *Diff) manifests(oldManifest, newManifest, namespace string) ([]*ResourceDiff, error) {
+	oldResources, err := parseDiffResources(oldManifest, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse current manifest")
+	}
+	newResources, err := parseDiffResources(newManifest, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse new manifest")
+	}
+	return d.compare(oldResources, newResources, "current", "target")
+}
+
+// live compares the objects in the cluster against the target manifest.
+//
+// Both sides are serialized from the objects built by the Kubernetes client
+// so that they are keyed and formatted the same way.
+func (d *Diff) live(currentManifest, targetManifest string) ([]*ResourceDiff, error) {
+	current, err := d.cfg.KubeClient.Build(bytes.NewBufferString(currentManifest), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build kubernetes objects from current release manifest")
+	}
+	target, err := d.cfg.KubeClient.Build(bytes.NewBufferString(targetManifest), false)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build kubernetes objects from new release manifest")
+	}
+
+	newResources := map[string]*diffResource{}
+	for _, info := range target {
+		r, err := newDiffResourceFromObject(info)
+		if err != nil {
+			return nil, err
+		}
+		newResources[r.key()] = r
+	}
+
+	liveResources := map[string]*diffResource{}
+	for _, info := range append(current, target...) {
+		helper := resource.NewHelper(info.Client, info.Mapping)
+		obj, err := helper.Get(info.Namespace, info.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "unable to get live state of %s %q", info.Mapping.GroupVersionKind.Kind, info.Name)
+		}
+		liveInfo := *info
+		liveInfo.Object = obj
+		r, err := newDiffResourceFromObject(&liveInfo)
+		if err != nil {
+			return nil, err
+		}
+		liveResources[r.key()] = r
+	}
+	return d.compare(liveResources, newResources, "live", "target")
+}
+
+func (d *Diff) compare(oldResources, newResources map[string]*diffResource, oldLabel, newLabel string) ([]*ResourceDiff, error) {
+	keys := make([]string, 0, len(oldResources)+len(newResources))
+	for k := range oldResources {
+		keys = append(keys, k)
+	}
+	for k := range newResources {
+		if _, ok := oldResources[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var diffs []*ResourceDiff
+	for _, k := range keys {
+		oldRes, newRes := oldResources[k], newResources[k]
+
+		ref := newRes
+		change := ChangeModified
+		switch {
+		case oldRes == nil:
+			change = ChangeAdded
+		case newRes == nil:
+			change = ChangeRemoved
+			ref = oldRes
+		}
+
+		var oldContent, newContent string
+		if oldRes != nil {
+			oldContent = oldRes.content
+		}
+		if newRes != nil {
+			newContent = newRes.content
+		}
+		if ref.Kind == "Secret" && !d.ShowSecrets {
+			var err error
+			if oldContent, newContent, err = maskSecrets(oldContent, newContent); err != nil {
+				return nil, errors.Wrapf(err, "unable to mask data of Secret %q", ref.Name)
+			}
+		}
+		if oldContent == newContent {
+			continue
+		}
+
+		text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(oldContent),
+			B:        splitLines(newContent),
+			FromFile: oldLabel + "/" + ref.path(),
+			ToFile:   newLabel + "/" + ref.path(),
+			Context:  d.Context,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, &ResourceDiff{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			Namespace:  ref.Namespace,
+			Change:     change,
+			Diff:       text,
+		})
+	}
+	return diffs, nil
+}
+
+// diffResource is a single resource of a manifest.
+type diffResource struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+
+	content string
+}
+
+func (r *diffResource) key() string {
+	return fmt.Sprintf("%s/%s/%s", r.Namespace, r.Kind, r.Name)
+}
+
+func (r *diffResource) path() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Namespace, r.Kind, r.Name)
+}
+
+// parseDiffResources splits a manifest into its resources, keeping the
+// content as it was rendered. Resources without a namespace are assumed to
+// live in the given namespace.
+func parseDiffResources(manifest, namespace string) (map[string]*diffResource, error) {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	resources := map[string]*diffResource{}
+	for _, k := range keys {
+		var head struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(manifests[k]), &head); err != nil {
+			return nil, err
+		}
+		// Skip documents that only contain comments.
+		if head.Kind == "" && head.Metadata.Name == "" {
+			continue
+		}
+		r := &diffResource{
+			APIVersion: head.APIVersion,
+			Kind:       head.Kind,
+			Name:       head.Metadata.Name,
+			Namespace:  head.Metadata.Namespace,
+			content:    manifests[k],
+		}
+		if r.Namespace == "" {
+			r.Namespace = namespace
+		}
+		resources[r.key()] = r
+	}
+	return resources, nil
+}
+
+// newDiffResourceFromObject serializes a resource built by the Kubernetes
+// client, dropping the fields maintained by the API server.
+func newDiffResourceFromObject(info *resource.Info) (*diffResource, error) {
+	u, err := runtimeToUnstructured(info)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range [][]string{
+		{"status"},
+		{"metadata", "managedFields"},
+		{"metadata", "resourceVersion"},
+		{"metadata", "uid"},
+		{"metadata", "selfLink"},
+		{"metadata", "generation"},
+		{"metadata", "creationTimestamp"},
+		{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+	} {
+		unstructured.RemoveNestedField(u.Object, f...)
+	}
+	if annotations := u.GetAnnotations(); annotations != nil && len(annotations) == 0 {
+		unstructured.RemoveNestedField(u.Object, "metadata", "annotations")
+	}
+	b, err := yaml.Marshal(u.Object)
+	if err != nil {
+		return nil, err
+	}
+	gvk := info.Mapping.GroupVersionKind
+	return &diffResource{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       info.Name,
+		Namespace:  info.Namespace,
+		content:    string(b),
+	}, nil
+}
+
+func runtimeToUnstructured(info *resource.Info) (*unstructured.Unstructured, error) {
+	if u, ok := info.Object.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+	obj := kube.AsVersioned(info)
+	m, err := runtimeToMap(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to convert %q", info.Name)
+	}
+	return &unstructured.Unstructured{Object: m}, nil
+}
+
+func runtimeToMap(obj interface{}) (map[string]interface{}, error) {
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	err = yaml.Unmarshal(b, &m)
+	return m, err
+}
+
+// maskSecrets replaces the values of the Secret data with placeholders. Values
+// that are identical on both sides get the same placeholder so that only keys
+// whose content changed show up in the diff.
+func maskSecrets(oldContent, newContent string) (string, string, error) {
+	oldSecret, err := parseSecretDoc(oldContent)
+	if err != nil {
+		return "", "", err
+	}
+	newSecret, err := parseSecretDoc(newContent)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		oldData := secretData(oldSecret, field)
+		newData := secretData(newSecret, field)
+		oldMasked := make(map[string]string, len(oldData))
+		newMasked := make(map[string]string, len(newData))
+		for k, v := range oldData {
+			if nv, ok := newData[k]; ok && nv == v {
+				oldMasked[k] = redacted(v, "*")
+			} else {
+				oldMasked[k] = redacted(v, "-")
+			}
+		}
+		for k, v := range newData {
+			if ov, ok := oldData[k]; ok && ov == v {
+				newMasked[k] = redacted(v, "*")
+			} else {
+				newMasked[k] = redacted(v, "+")
+			}
+		}
+		setSecretData(oldSecret, field, oldMasked)
+		setSecretData(newSecret, field, newMasked)
+	}
+
+	oldMasked, err := marshalSecretDoc(oldSecret)
+	if err != nil {
+		return "", "", err
+	}
+	newMasked, err := marshalSecretDoc(newSecret)
+	return oldMasked, newMasked, err
+}
+
+func redacted(value, symbol string) string {
+	return fmt.Sprintf("%s # (%d bytes)", strings.Repeat(symbol, 8), len(value))
+}
+
+func parseSecretDoc(content string) (map[string]interface{}, error) {
+	if content == "" {
+		return nil, nil
+	}
+	m := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(content), &m)
+	return m, err
+}
+
+func marshalSecretDoc(m map[string]interface{}) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	b, err := yaml.Marshal(m)
+	return string(b), err
+}
+
+func secretData(secret map[string]interface{}, field string) map[string]string {
+	data := map[string]string{}
+	if secret == nil {
+		return data
+	}
+	if m, ok := secret[field].(map[string]interface{}); ok {
+		for k, v := range m {
+			data[k] = fmt.Sprint(v)
+		}
+	}
+	return data
+}
+
+func setSecretData(secret map[string]interface{}, field string, data map[string]string) {
+	if secret == nil || len(data) == 0 {
+		return
+	}
+	m := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		m[k] = v
+	}
+	secret[field] = m
+}
+
+// splitLines splits content into lines for the diff, keeping the line
+// endings. Empty content yields no lines at all.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return difflib.SplitLines(strings.TrimSuffix(content, "\n"))
+}
@@ -0,0 +1,171 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+var diffConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  color: {{ .Values.color }}
+`
+
+var diffSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+stringData:
+  password: {{ .Values.password }}
+  user: admin
+`
+
+func diffChart() *chart.Chart {
+	return buildChart(func(opts *chartOptions) {
+		opts.Templates = []*chart.File{
+			{Name: "templates/configmap.yaml", Data: []byte(diffConfigMap)},
+			{Name: "templates/secret.yaml", Data: []byte(diffSecret)},
+		}
+	})
+}
+
+func diffReleaseStub(t *testing.T, d *Diff, vals map[string]interface{}) *release.Release {
+	t.Helper()
+	u := NewUpgrade(d.cfg)
+	u.Namespace = "spaced"
+
+	rel := releaseStub()
+	rel.Namespace = "spaced"
+	rel.Manifest = ""
+	if err := d.cfg.Releases.Create(rel); err != nil {
+		t.Fatal(err)
+	}
+	_, target, err := u.prepareUpgrade(rel.Name, diffChart(), vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel.Manifest = target.Manifest
+	if err := d.cfg.Releases.Update(rel); err != nil {
+		t.Fatal(err)
+	}
+	return rel
+}
+
+func TestDiffUpgrade(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	d := NewDiff(actionConfigFixture(t))
+	rel := diffReleaseStub(t, d, map[string]interface{}{"color": "blue", "password": "hunter2"})
+
+	u := NewUpgrade(d.cfg)
+	diffs, err := d.Upgrade(u, rel.Name, diffChart(), map[string]interface{}{"color": "red", "password": "hunter3"})
+	req.NoError(err)
+	req.Len(diffs, 2)
+
+	is.Equal("ConfigMap", diffs[0].Kind)
+	is.Equal("settings", diffs[0].Name)
+	is.Equal("spaced", diffs[0].Namespace)
+	is.Equal(ChangeModified, diffs[0].Change)
+	is.Contains(diffs[0].Diff, "-  color: blue")
+	is.Contains(diffs[0].Diff, "+  color: red")
+
+	is.Equal("Secret", diffs[1].Kind)
+	is.NotContains(diffs[1].Diff, "hunter")
+	is.Contains(diffs[1].Diff, "-  password: '-------- # (7 bytes)'")
+	is.Contains(diffs[1].Diff, "+  password: '++++++++ # (7 bytes)'")
+	is.Contains(diffs[1].Diff, "   user: '******** # (5 bytes)'")
+
+	d.ShowSecrets = true
+	diffs, err = d.Upgrade(u, rel.Name, diffChart(), map[string]interface{}{"color": "blue", "password": "hunter3"})
+	req.NoError(err)
+	req.Len(diffs, 1)
+	is.Contains(diffs[0].Diff, "+  password: hunter3")
+}
+
+func TestDiffUpgradeNoChanges(t *testing.T) {
+	d := NewDiff(actionConfigFixture(t))
+	vals := map[string]interface{}{"color": "blue", "password": "hunter2"}
+	rel := diffReleaseStub(t, d, vals)
+
+	diffs, err := d.Upgrade(NewUpgrade(d.cfg), rel.Name, diffChart(), vals)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestDiffRevisions(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	d := NewDiff(actionConfigFixture(t))
+
+	first := namedReleaseStub("mirror", release.StatusSuperseded)
+	first.Manifest = "---\n# Source: hello/templates/a.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n"
+	second := namedReleaseStub("mirror", release.StatusDeployed)
+	second.Version = 2
+	second.Manifest = "---\n# Source: hello/templates/b.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n  namespace: other\n"
+	req.NoError(d.cfg.Releases.Create(first))
+	req.NoError(d.cfg.Releases.Create(second))
+
+	diffs, err := d.Revisions("mirror", 1, 0)
+	req.NoError(err)
+	req.Len(diffs, 2)
+	is.Equal(ChangeRemoved, diffs[0].Change)
+	is.Equal("a", diffs[0].Name)
+	is.Equal(ChangeAdded, diffs[1].Change)
+	is.Equal("b", diffs[1].Name)
+	is.Equal("other", diffs[1].Namespace)
+	is.Contains(diffs[1].Diff, "+++ target/other/ConfigMap/b")
+
+	_, err = d.Revisions("mirror", 0, 2)
+	is.Equal(errInvalidRevision, err)
+}
+
+func TestDiffRollback(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	d := NewDiff(actionConfigFixture(t))
+
+	first := namedReleaseStub("mirror", release.StatusSuperseded)
+	first.Manifest = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\ndata:\n  key: old\n"
+	second := namedReleaseStub("mirror", release.StatusDeployed)
+	second.Version = 2
+	second.Manifest = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\ndata:\n  key: new\n"
+	req.NoError(d.cfg.Releases.Create(first))
+	req.NoError(d.cfg.Releases.Create(second))
+
+	diffs, err := d.Rollback("mirror", 0)
+	req.NoError(err)
+	req.Len(diffs, 1)
+	is.Contains(diffs[0].Diff, "-  key: new")
+	is.Contains(diffs[0].Diff, "+  key: old")
+
+	// Nothing must have been recorded.
+	last, err := d.cfg.Releases.Last("mirror")
+	req.NoError(err)
+	is.Equal(2, last.Version)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// EventType identifies what happened in an Event.
+type EventType string
+
+// Event types emitted by actions.
+const (
+	// EventRendered is emitted once the chart templates have been rendered.
+	EventRendered EventType = "rendered"
+	// EventCRDsInstalled is emitted once the CRDs of a chart have been installed.
+	EventCRDsInstalled EventType = "crds-installed"
+	// EventHookStarted is emitted when the resources of a hook have been created.
+	EventHookStarted EventType = "hook-started"
+	// EventHookFinished is emitted when a hook has succeeded or failed.
+	EventHookFinished EventType = "hook-finished"
+	// EventResourceCreated is emitted for each resource created in the cluster.
+	EventResourceCreated EventType = "resource-created"
+	// EventResourceUpdated is emitted for each resource updated in the cluster.
+	EventResourceUpdated EventType = "resource-updated"
+	// EventResourceDeleted is emitted for each resource deleted from the cluster.
+	EventResourceDeleted EventType = "resource-deleted"
+	// EventResourceWaiting is emitted while waiting for a resource that is not
+	// ready, whenever the reason it is not ready changes.
+	EventResourceWaiting EventType = "resource-waiting"
+	// EventResourceReady is emitted while waiting for resources when a resource
+	// becomes ready.
+	EventResourceReady EventType = "resource-ready"
+)
+
+// Event describes the progress of an action.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Resource is the resource the event is about, if any.
+	Resource *EventResource `json:"resource,omitempty"`
+	// Hook is the hook the event is about, if any.
+	Hook *EventHook `json:"hook,omitempty"`
+	// Message is a human readable description of the event.
+	Message string `json:"message,omitempty"`
+	// Error is set when the event reports a failure.
+	Error string `json:"error,omitempty"`
+}
+
+// EventResource identifies a Kubernetes resource.
+type EventResource struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (r *EventResource) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// EventHook identifies a hook and reports its phase.
+type EventHook struct {
+	Name  string            `json:"name"`
+	Kind  string            `json:"kind"`
+	Event release.HookEvent `json:"event"`
+	Phase release.HookPhase `json:"phase"`
+}
+
+// Observer receives the events emitted by actions.
+//
+// OnEvent is called synchronously from the goroutine running the action, so it
+// should return quickly.
+type Observer interface {
+	OnEvent(Event)
+}
+
+// ObserverFunc adapts an ordinary function to an Observer.
+type ObserverFunc func(Event)
+
+// OnEvent calls f(e).
+func (f ObserverFunc) OnEvent(e Event) { f(e) }
+
+// emit sends the event to the observer of the configuration, if any.
+func (c *Configuration) emit(e Event) {
+	if c.Observer == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = c.Now().Time
+	}
+	c.Observer.OnEvent(e)
+}
+
+// emitResources emits an event of the given type for each resource.
+func (c *Configuration) emitResources(t EventType, resources kube.ResourceList) {
+	if c.Observer == nil {
+		return
+	}
+	for _, info := range resources {
+		c.emit(Event{Type: t, Resource: eventResource(info)})
+	}
+}
+
+// emitResult emits an event for each resource created, updated or deleted.
+func (c *Configuration) emitResult(result *kube.Result) {
+	if result == nil {
+		return
+	}
+	c.emitResources(EventResourceCreated, result.Created)
+	c.emitResources(EventResourceUpdated, result.Updated)
+	c.emitResources(EventResourceDeleted, result.Deleted)
+}
+
+// observeReadiness turns the readiness reported by the Kubernetes client while
+// waiting for resources into events.
+func (c *Configuration) observeReadiness(r kube.ResourceReadiness) {
+	e := Event{
+		Type:     EventResourceWaiting,
+		Resource: &EventResource{Kind: r.Kind, Name: r.Name, Namespace: r.Namespace},
+		Message:  r.Reason,
+	}
+	if r.Ready {
+		e.Type = EventResourceReady
+	}
+	c.emit(e)
+}
+
+func eventResource(info *resource.Info) *EventResource {
+	r := &EventResource{Name: info.Name, Namespace: info.Namespace}
+	if info.Mapping != nil {
+		r.Kind = info.Mapping.GroupVersionKind.Kind
+	} else if info.Object != nil {
+		r.Kind = info.Object.GetObjectKind().GroupVersionKind().Kind
+	}
+	return r
+}
+
+func eventHook(h *release.Hook, event release.HookEvent) *EventHook {
+	return &EventHook{Name: h.Name, Kind: h.Kind, Event: event, Phase: h.LastRun.Phase}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+// GetMetadata is the action for checking a given release's metadata.
+//
+// It provides the implementation of 'helm get metadata'.
+type GetMetadata struct {
+	cfg *Configuration
+
+	// Initializing Version to 0 will get the latest revision of the release.
+	Version int
+}
+
+// Metadata describes a release revision and its chart.
+type Metadata struct {
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace"`
+	Revision   int               `json:"revision"`
+	Status     string            `json:"status"`
+	DeployedAt helmtime.Time     `json:"deployed_at"`
+	Chart      string            `json:"chart"`
+	Version    string            `json:"version"`
+	AppVersion string            `json:"app_version"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// Dependencies are the dependencies of the chart as resolved in its
+	// Chart.lock, or as declared in its Chart.yaml without a Chart.lock.
+	Dependencies []*chart.Dependency `json:"dependencies,omitempty"`
+	// Audit records who performed the revision.
+	Audit *release.Audit `json:"audit,omitempty"`
+}
+
+// NewGetMetadata creates a new GetMetadata object with the given configuration.
+func NewGetMetadata(cfg *Configuration) *GetMetadata {
+	return &GetMetadata{
+		cfg: cfg,
+	}
+}
+
+// Run executes 'helm get metadata' against the given release.
+func (g *GetMetadata) Run(name string) (*Metadata, error) {
+	if err := g.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	rel, err := g.cfg.releaseContent(name, g.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{
+		Name:      rel.Name,
+		Namespace: rel.Namespace,
+		Revision:  rel.Version,
+		Labels:    driver.FilterSystemLabels(rel.Labels),
+	}
+	if rel.Info != nil {
+		m.Status = rel.Info.Status.String()
+		m.DeployedAt = rel.Info.LastDeployed
+		m.Audit = rel.Info.Audit
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		m.Chart = rel.Chart.Metadata.Name
+		m.Version = rel.Chart.Metadata.Version
+		m.AppVersion = rel.Chart.Metadata.AppVersion
+		m.Dependencies = rel.Chart.Metadata.Dependencies
+		if rel.Chart.Lock != nil {
+			m.Dependencies = rel.Chart.Lock.Dependencies
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,180 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// Annotations declaring health checks on the resources of a chart. Health
+// checks run after an upgrade, once its resources are ready and its
+// post-upgrade hooks have run. Hooks annotated with the health-check event run
+// at the same time, and pass when they complete successfully.
+const (
+	// HealthCheckHTTPPathAnnotation declares an HTTP health check on a Pod or
+	// on a resource selecting pods, such as a Service or a Deployment. A GET
+	// request for the path is sent to a ready pod through a port-forward, and
+	// the check passes when the response status code is lower than 400.
+	HealthCheckHTTPPathAnnotation = "helm.sh/health-check-http-path"
+	// HealthCheckHTTPPortAnnotation is the pod port the HTTP health check is
+	// sent to. It is required with HealthCheckHTTPPathAnnotation.
+	HealthCheckHTTPPortAnnotation = "helm.sh/health-check-http-port"
+	// HealthCheckJSONPathAnnotation declares a health check passing when the
+	// JSONPath expression evaluated against the resource in the cluster is
+	// equal to the value of HealthCheckValueAnnotation.
+	HealthCheckJSONPathAnnotation = "helm.sh/health-check-jsonpath"
+	// HealthCheckValueAnnotation is the expected value of the expression of
+	// HealthCheckJSONPathAnnotation. Defaults to "True".
+	HealthCheckValueAnnotation = "helm.sh/health-check-value"
+)
+
+// healthCheckInterval is the time between two rounds of health checks.
+var healthCheckInterval = 2 * time.Second
+
+// healthCheck is a health check declared on a resource.
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// healthChecks returns the health checks declared by the annotations of the
+// resources.
+func (c *Configuration) healthChecks(resources kube.ResourceList) ([]healthCheck, error) {
+	var checks []healthCheck
+	for _, info := range resources {
+		accessor, err := meta.Accessor(info.Object)
+		if err != nil {
+			continue
+		}
+		annotations := accessor.GetAnnotations()
+
+		if path, ok := annotations[HealthCheckHTTPPathAnnotation]; ok {
+			check, err := c.httpHealthCheck(info, path, annotations[HealthCheckHTTPPortAnnotation])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid HTTP health check on %s", resourceString(info))
+			}
+			checks = append(checks, healthCheck{
+				name:  fmt.Sprintf("HTTP GET %s on %s", path, resourceString(info)),
+				check: check,
+			})
+		}
+
+		if expr, ok := annotations[HealthCheckJSONPathAnnotation]; ok {
+			checker, err := kube.JSONPathReadiness(expr, annotations[HealthCheckValueAnnotation])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid health check on %s", resourceString(info))
+			}
+			info := info
+			checks = append(checks, healthCheck{
+				name:  fmt.Sprintf("%s of %s", expr, resourceString(info)),
+				check: func() error { return conditionHealthCheck(info, checker) },
+			})
+		}
+	}
+	return checks, nil
+}
+
+func (c *Configuration) httpHealthCheck(info *resource.Info, path, port string) (func() error, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 {
+		return nil, errors.Errorf("%s must be a port number, got %q", HealthCheckHTTPPortAnnotation, port)
+	}
+	prober, ok := c.KubeClient.(kube.InterfaceHTTPProbe)
+	if !ok {
+		return nil, errors.New("the Kubernetes client does not support HTTP probes")
+	}
+	return func() error { return prober.ProbeHTTP(info, p, path) }, nil
+}
+
+// conditionHealthCheck evaluates the checker against the resource in the
+// cluster.
+func conditionHealthCheck(info *resource.Info, checker kube.ReadinessChecker) error {
+	obj, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, info.Name)
+	if err != nil {
+		return err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		u = &unstructured.Unstructured{Object: content}
+	}
+	ready, reason, err := checker.IsReady(u)
+	if err != nil || ready {
+		return err
+	}
+	return errors.New(reason)
+}
+
+// runHealthChecks runs the health-check hooks of the release, unless
+// disableHooks is set, then runs the health checks declared on the resources
+// until they all pass or the timeout expires.
+func (c *Configuration) runHealthChecks(rl *release.Release, resources kube.ResourceList, timeout time.Duration, disableHooks bool) error {
+	checks, err := c.healthChecks(resources)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if !disableHooks {
+		if err := c.execHook(rl, release.HookHealthCheck, timeout); err != nil {
+			return err
+		}
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	remaining := timeout - time.Since(start)
+	if remaining <= 0 {
+		remaining = healthCheckInterval
+	}
+	c.Log("running %d health checks for %s with timeout of %v", len(checks), rl.Name, remaining)
+
+	var failures []string
+	err = wait.PollImmediate(healthCheckInterval, remaining, func() (bool, error) {
+		failures = nil
+		for _, hc := range checks {
+			if err := hc.check(); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %s", hc.name, err))
+			}
+		}
+		if len(failures) > 0 {
+			c.Log("%d of %d health checks failed: %s", len(failures), len(checks), strings.Join(failures, "; "))
+		}
+		return len(failures) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("%d of %d health checks did not pass within %s: %s", len(failures), len(checks), timeout, strings.Join(failures, "; "))
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+)
+
+func serviceWithAnnotations(annotations map[string]string) *resource.Info {
+	svc := &unstructured.Unstructured{}
+	svc.SetAPIVersion("v1")
+	svc.SetKind("Service")
+	svc.SetName("web")
+	svc.SetNamespace("spaced")
+	svc.SetAnnotations(annotations)
+	return &resource.Info{
+		Name:      "web",
+		Namespace: "spaced",
+		Object:    svc,
+		Mapping:   &meta.RESTMapping{GroupVersionKind: svc.GroupVersionKind()},
+	}
+}
+
+func TestRunHealthChecks(t *testing.T) {
+	is := assert.New(t)
+	defer func(interval time.Duration) { healthCheckInterval = interval }(healthCheckInterval)
+	healthCheckInterval = time.Millisecond
+
+	rel := releaseStub()
+	probed := kube.ResourceList{serviceWithAnnotations(map[string]string{
+		HealthCheckHTTPPathAnnotation: "/healthz",
+		HealthCheckHTTPPortAnnotation: "8080",
+	})}
+
+	config := actionConfigFixture(t)
+	is.NoError(config.runHealthChecks(rel, probed, 10*time.Millisecond, false))
+
+	config.KubeClient.(*kubefake.FailingKubeClient).ProbeHTTPError = fmt.Errorf("503 Service Unavailable")
+	err := config.runHealthChecks(rel, probed, 10*time.Millisecond, false)
+	is.EqualError(err, "1 of 1 health checks did not pass within 10ms: HTTP GET /healthz on Service \"web\" in namespace \"spaced\": 503 Service Unavailable")
+	err = config.runHealthChecks(rel, probed, 10*time.Millisecond, true)
+	is.Error(err, "expected the health checks of the resources to run without hooks")
+
+	invalid := kube.ResourceList{serviceWithAnnotations(map[string]string{
+		HealthCheckHTTPPathAnnotation: "/healthz",
+	})}
+	err = config.runHealthChecks(rel, invalid, 10*time.Millisecond, false)
+	is.Error(err)
+	is.Contains(err.Error(), `helm.sh/health-check-http-port must be a port number, got ""`)
+
+	is.NoError(config.runHealthChecks(rel, kube.ResourceList{serviceWithAnnotations(nil)}, 10*time.Millisecond, false))
+}
@@ -0,0 +1,97 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+)
+
+// HistoryPrune is the action for removing the revisions of releases that a
+// retention policy does not keep.
+//
+// It provides the implementation of 'helm history prune'.
+type HistoryPrune struct {
+	cfg *Configuration
+
+	// Policy is the retention policy applied, overridden by the retention
+	// labels of each release.
+	Policy storage.RetentionPolicy
+	// DryRun lists the revisions that would be removed without removing them.
+	DryRun bool
+}
+
+// NewHistoryPrune creates a new HistoryPrune object with the given configuration.
+func NewHistoryPrune(cfg *Configuration) *HistoryPrune {
+	return &HistoryPrune{
+		cfg: cfg,
+	}
+}
+
+// Run prunes the history of the named releases, or of every release of the
+// namespace if no name is given. It returns the revisions that were removed,
+// or that would be with DryRun, ordered by release and revision.
+func (p *HistoryPrune) Run(names ...string) ([]*release.Release, error) {
+	if err := p.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		all, err := p.cfg.Releases.ListReleases()
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, rls := range all {
+			if !seen[rls.Name] {
+				seen[rls.Name] = true
+				names = append(names, rls.Name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	var pruned []*release.Release
+	for _, name := range names {
+		if err := chartutil.ValidateReleaseName(name); err != nil {
+			return pruned, errors.Errorf("release name is invalid: %s", name)
+		}
+		revisions, err := p.prune(name)
+		pruned = append(pruned, revisions...)
+		if err != nil {
+			return pruned, errors.Wrapf(err, "failed to prune the history of release %q", name)
+		}
+	}
+	return pruned, nil
+}
+
+func (p *HistoryPrune) prune(name string) ([]*release.Release, error) {
+	if !p.DryRun {
+		unlock, err := p.cfg.lockRelease(name)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	p.cfg.Log("pruning history for release %s", name)
+	return p.cfg.Releases.PruneHistory(name, p.Policy, p.DryRun)
+}
@@ -18,16 +18,44 @@ package action
 import (
 	"bytes"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"helm.sh/helm/v3/pkg/kube"
 	"helm.sh/helm/v3/pkg/release"
 	helmtime "helm.sh/helm/v3/pkg/time"
 )
 
-// execHook executes all of the hooks for the given hook event.
+// hookLogsTailLines is the number of lines of the logs of each container of
+// a failed hook or a test hook recorded in the release.
+const hookLogsTailLines = 100
+
+// hookLogsMaxSize bounds the size of the logs of a hook recorded in the
+// release, which keeps their end.
+const hookLogsMaxSize = 16 * 1024
+
+// defaultHookRetryBackoff is the time to wait before the first retry of a
+// failed hook without a retry backoff annotation.
+const defaultHookRetryBackoff = 10 * time.Second
+
+// maxHookRetryBackoff bounds the time to wait before retrying a failed hook,
+// which doubles after each retry.
+const maxHookRetryBackoff = 5 * time.Minute
+
+// execHook executes all of the hooks for the given hook event. The hooks of
+// equal weight run concurrently, each waited for until its own timeout if it
+// has one, or else the given timeout.
 func (cfg *Configuration) execHook(rl *release.Release, hook release.HookEvent, timeout time.Duration) error {
+	return cfg.execHookConcurrently(rl, hook, timeout, false)
+}
+
+// execHookConcurrently executes all of the hooks for the given hook event like
+// execHook, or all of them concurrently regardless of their weights if
+// ignoreWeights is set.
+func (cfg *Configuration) execHookConcurrently(rl *release.Release, hook release.HookEvent, timeout time.Duration, ignoreWeights bool) error {
 	executingHooks := []*release.Hook{}
 
 	for _, h := range rl.Hooks {
@@ -41,7 +69,46 @@ func (cfg *Configuration) execHook(rl *release.Release, hook release.HookEvent,
 	// hooke are pre-ordered by kind, so keep order stable
 	sort.Stable(hookByWeight(executingHooks))
 
+	for i := 0; i < len(executingHooks); {
+		j := i + 1
+		for j < len(executingHooks) && (ignoreWeights || executingHooks[j].Weight == executingHooks[i].Weight) {
+			j++
+		}
+		if err := cfg.execHooksOfWeight(rl, hook, executingHooks[i:j], timeout); err != nil {
+			return err
+		}
+		i = j
+	}
+
+	// If all hooks are successful, check the annotation of each hook to determine whether the hook should be deleted
+	// under succeeded condition. If so, then clear the corresponding resource object in each hook
 	for _, h := range executingHooks {
+		// the hooks allowed to fail may have failed
+		if h.LastRun.Phase != release.HookPhaseSucceeded {
+			continue
+		}
+		if err := cfg.deleteHookByPolicy(h, release.HookSucceeded); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execFailureHook executes the hooks for an event reporting the failure of an
+// operation. As the operation has already failed, the failure of a hook is
+// only logged.
+func (cfg *Configuration) execFailureHook(rl *release.Release, hook release.HookEvent, timeout time.Duration) {
+	if err := cfg.execHook(rl, hook, timeout); err != nil {
+		cfg.Log("warning: %s hooks failed: %s", hook, err)
+	}
+}
+
+// execHooksOfWeight creates hooks of equal weight together, and waits for all
+// of them to complete. It returns the error of the first failed hook.
+func (cfg *Configuration) execHooksOfWeight(rl *release.Release, hook release.HookEvent, hooks []*release.Hook, timeout time.Duration) error {
+	resources := make([]kube.ResourceList, len(hooks))
+	for i, h := range hooks {
 		// Set default delete policy to before-hook-creation
 		if h.DeletePolicies == nil || len(h.DeletePolicies) == 0 {
 			// TODO(jlegrone): Only apply before-hook-creation delete policy to run to completion
@@ -55,7 +122,8 @@ func (cfg *Configuration) execHook(rl *release.Release, hook release.HookEvent,
 			return err
 		}
 
-		resources, err := cfg.KubeClient.Build(bytes.NewBufferString(h.Manifest), true)
+		var err error
+		resources[i], err = cfg.KubeClient.Build(bytes.NewBufferString(h.Manifest), true)
 		if err != nil {
 			return errors.Wrapf(err, "unable to build kubernetes object for %s hook %s", hook, h.Path)
 		}
@@ -65,48 +133,154 @@ func (cfg *Configuration) execHook(rl *release.Release, hook release.HookEvent,
 			StartedAt: helmtime.Now(),
 			Phase:     release.HookPhaseRunning,
 		}
-		cfg.recordRelease(rl)
+	}
+	cfg.recordRelease(rl)
+	for _, h := range hooks {
+		cfg.emit(Event{Type: EventHookStarted, Hook: eventHook(h, hook)})
+	}
 
-		// As long as the implementation of WatchUntilReady does not panic, HookPhaseFailed or HookPhaseSucceeded
-		// should always be set by this function. If we fail to do that for any reason, then HookPhaseUnknown is
-		// the most appropriate value to surface.
-		h.LastRun.Phase = release.HookPhaseUnknown
+	// created records whether the resources of each hook were created, for
+	// the failed ones to be deleted by their policy.
+	created := make([]bool, len(hooks))
+	errs := make([]error, len(hooks))
+	var wg sync.WaitGroup
+	for i := range hooks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created[i], errs[i] = cfg.runHook(hooks[i], hook, resources[i], timeout)
+		}(i)
+	}
+	wg.Wait()
 
-		// Create hook resources
-		if _, err := cfg.KubeClient.Create(resources); err != nil {
-			h.LastRun.CompletedAt = helmtime.Now()
-			h.LastRun.Phase = release.HookPhaseFailed
-			return errors.Wrapf(err, "warning: Hook %s %s failed", hook, h.Path)
+	var failed error
+	for i, h := range hooks {
+		if errs[i] == nil {
+			cfg.emit(Event{Type: EventHookFinished, Hook: eventHook(h, hook)})
+			continue
 		}
+		cfg.emit(Event{Type: EventHookFinished, Hook: eventHook(h, hook), Error: errs[i].Error()})
+		if h.AllowFailure {
+			cfg.Log("warning: ignoring the failure of hook %s, which allows failure: %s", h.Name, errs[i])
+		} else if failed == nil {
+			failed = errs[i]
+		}
+	}
 
-		// Watch hook resources until they have completed
-		err = cfg.KubeClient.WatchUntilReady(resources, timeout)
-		// Note the time of success/failure
-		h.LastRun.CompletedAt = helmtime.Now()
-		// Mark hook as succeeded or failed
-		if err != nil {
-			h.LastRun.Phase = release.HookPhaseFailed
-			// If a hook is failed, check the annotation of the hook to determine whether the hook should be deleted
-			// under failed condition. If so, then clear the corresponding resource object in the hook
+	// If a hook is failed, check the annotation of the hook to determine whether the hook should be deleted
+	// under failed condition. If so, then clear the corresponding resource object in the hook
+	for i, h := range hooks {
+		if errs[i] != nil && created[i] {
 			if err := cfg.deleteHookByPolicy(h, release.HookFailed); err != nil {
 				return err
 			}
-			return err
 		}
-		h.LastRun.Phase = release.HookPhaseSucceeded
 	}
+	return failed
+}
 
-	// If all hooks are successful, check the annotation of each hook to determine whether the hook should be deleted
-	// under succeeded condition. If so, then clear the corresponding resource object in each hook
-	for _, h := range executingHooks {
-		if err := cfg.deleteHookByPolicy(h, release.HookSucceeded); err != nil {
-			return err
+// runHook runs a hook, retrying it as many times as its retries annotation
+// allows within its timeout, and records its execution. It reports whether the
+// resources of the hook were created by the last attempt.
+func (cfg *Configuration) runHook(h *release.Hook, hook release.HookEvent, resources kube.ResourceList, timeout time.Duration) (bool, error) {
+	if h.Timeout > 0 {
+		timeout = h.Timeout
+	}
+	deadline := time.Now().Add(timeout)
+	backoff := h.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultHookRetryBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		h.LastRun.Attempts = attempt
+		created, err := cfg.runHookOnce(h, hook, resources, time.Until(deadline))
+		retry := err != nil && attempt <= h.Retries
+		if retry && time.Until(deadline) <= backoff {
+			cfg.Log("hook %s failed, not retrying it as its timeout of %s would expire first: %s", h.Name, timeout, err)
+			retry = false
+		}
+		if !retry {
+			// the logs of the tests are recorded whether they passed or not
+			if created && (err != nil || hasHookEvent(h, release.HookTest)) {
+				cfg.recordHookLogs(h, resources)
+			}
+			return created, err
+		}
+
+		cfg.Log("hook %s failed, retrying in %s (retry %d of %d): %s", h.Name, backoff, attempt, h.Retries, err)
+		if created {
+			if err := cfg.deleteHookResources(resources, time.Until(deadline)); err != nil {
+				return true, errors.Wrapf(err, "unable to delete hook %s before retrying it", h.Path)
+			}
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxHookRetryBackoff {
+			backoff = maxHookRetryBackoff
 		}
 	}
+}
 
+// deleteHookResources deletes the resources of a hook, and waits for them to be
+// gone for them to be created again, if the Kubernetes client can tell.
+func (cfg *Configuration) deleteHookResources(resources kube.ResourceList, timeout time.Duration) error {
+	if _, errs := cfg.KubeClient.Delete(resources); len(errs) > 0 {
+		return errors.New(joinErrors(errs))
+	}
+	if kubeClient, ok := cfg.KubeClient.(kube.InterfaceWaitForDelete); ok {
+		return kubeClient.WaitForDelete(resources, timeout)
+	}
 	return nil
 }
 
+// runHookOnce creates the resources of a hook and watches them until they have
+// completed. It reports whether the resources were created.
+func (cfg *Configuration) runHookOnce(h *release.Hook, hook release.HookEvent, resources kube.ResourceList, timeout time.Duration) (bool, error) {
+	// As long as the implementation of WatchUntilReady does not panic, HookPhaseFailed or HookPhaseSucceeded
+	// should always be set by this function. If we fail to do that for any reason, then HookPhaseUnknown is
+	// the most appropriate value to surface.
+	h.LastRun.Phase = release.HookPhaseUnknown
+
+	// Create hook resources
+	if _, err := cfg.KubeClient.Create(resources); err != nil {
+		h.LastRun.CompletedAt = helmtime.Now()
+		h.LastRun.Phase = release.HookPhaseFailed
+		return false, errors.Wrapf(err, "warning: Hook %s %s failed", hook, h.Path)
+	}
+
+	// Watch hook resources until they have completed
+	err := cfg.KubeClient.WatchUntilReady(resources, timeout)
+	// Note the time of success/failure
+	h.LastRun.CompletedAt = helmtime.Now()
+	// Mark hook as succeeded or failed
+	if err != nil {
+		h.LastRun.Phase = release.HookPhaseFailed
+		return true, err
+	}
+	h.LastRun.Phase = release.HookPhaseSucceeded
+	return true, nil
+}
+
+// recordHookLogs records why a hook failed, the exit code and the end of the
+// logs of its containers, if the Kubernetes client can tell.
+func (cfg *Configuration) recordHookLogs(h *release.Hook, resources kube.ResourceList) {
+	kubeClient, ok := cfg.KubeClient.(kube.InterfaceFailureLogs)
+	if !ok {
+		return
+	}
+	fl, err := kubeClient.FailureLogs(resources, hookLogsTailLines)
+	if err != nil {
+		cfg.Log("unable to get the logs of the hook %s: %s", h.Name, err)
+		return
+	}
+	h.LastRun.Reason = strings.Join(fl.Reasons, "\n")
+	h.LastRun.Logs = fl.Logs
+	h.LastRun.ExitCode = fl.ExitCode
+	if len(h.LastRun.Logs) > hookLogsMaxSize {
+		h.LastRun.Logs = "[truncated]\n" + h.LastRun.Logs[len(h.LastRun.Logs)-hookLogsMaxSize:]
+	}
+}
+
 // hookByWeight is a sorter for hooks
 type hookByWeight []*release.Hook
 
@@ -0,0 +1,367 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// barrierKubeClient fails to watch hooks unless the first n of them are
+// watched concurrently.
+type barrierKubeClient struct {
+	kubefake.FailingKubeClient
+	n       int
+	mu      sync.Mutex
+	watched int
+	all     chan struct{}
+}
+
+func (c *barrierKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	c.mu.Lock()
+	c.watched++
+	watched := c.watched
+	if watched == c.n {
+		close(c.all)
+	}
+	c.mu.Unlock()
+	if watched > c.n {
+		return nil
+	}
+	select {
+	case <-c.all:
+		return nil
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("hooks of equal weight were not watched concurrently")
+	}
+}
+
+func hookStub(name string, weight int) *release.Hook {
+	return &release.Hook{
+		Name:     name,
+		Kind:     "Job",
+		Path:     "templates/" + name + ".yaml",
+		Manifest: "kind: Job\nmetadata:\n  name: " + name,
+		Weight:   weight,
+		Events:   []release.HookEvent{release.HookPreUpgrade},
+	}
+}
+
+func TestExecHook_EqualWeightsConcurrently(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = &barrierKubeClient{n: 3, all: make(chan struct{})}
+
+	rel := releaseStub()
+	rel.Hooks = []*release.Hook{hookStub("last", 1), hookStub("a", 0), hookStub("b", 0), hookStub("c", 0)}
+	is.NoError(cfg.Releases.Create(rel))
+
+	is.NoError(cfg.execHook(rel, release.HookPreUpgrade, time.Minute))
+	last := rel.Hooks[0]
+	for _, h := range rel.Hooks {
+		is.Equal(release.HookPhaseSucceeded, h.LastRun.Phase, h.Name)
+		if h != last {
+			is.False(last.LastRun.StartedAt.Before(h.LastRun.CompletedAt), "hook %s of weight 1 started before %s completed", last.Name, h.Name)
+		}
+	}
+}
+
+func TestExecHook_FailureLogs(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+	failer := cfg.KubeClient.(*kubefake.FailingKubeClient)
+	failer.WatchUntilReadyError = fmt.Errorf("job failed: BackoffLimitExceeded")
+	failer.FailedPodLogs = &kube.FailureLogs{
+		Reasons: []string{"job/migrate: BackoffLimitExceeded: Job has reached the specified backoff limit", "pod/migrate-abcde container migrate: Error (exit code 2)"},
+		Logs:    "==> pod/migrate-abcde container migrate <==\n" + strings.Repeat("x", hookLogsMaxSize),
+	}
+
+	rel := releaseStub()
+	rel.Hooks = []*release.Hook{hookStub("migrate", 0)}
+	is.NoError(cfg.Releases.Create(rel))
+
+	is.Error(cfg.execHook(rel, release.HookPreUpgrade, time.Minute))
+	run := rel.Hooks[0].LastRun
+	is.Equal(release.HookPhaseFailed, run.Phase)
+	is.Equal("job/migrate: BackoffLimitExceeded: Job has reached the specified backoff limit\npod/migrate-abcde container migrate: Error (exit code 2)", run.Reason)
+	is.True(strings.HasPrefix(run.Logs, "[truncated]\n"), "expected the logs to be truncated")
+	is.Equal(len("[truncated]\n")+hookLogsMaxSize, len(run.Logs))
+}
+
+// flakyKubeClient fails to watch hooks the given number of times, and records
+// the timeouts it is given.
+type flakyKubeClient struct {
+	kubefake.FailingKubeClient
+	mu       sync.Mutex
+	failures int
+	timeouts []time.Duration
+}
+
+func (c *flakyKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeouts = append(c.timeouts, timeout)
+	if c.failures > 0 {
+		c.failures--
+		return fmt.Errorf("job failed: BackoffLimitExceeded")
+	}
+	return nil
+}
+
+func TestExecHook_Retries(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+	client := &flakyKubeClient{failures: 2}
+	cfg.KubeClient = client
+
+	h := hookStub("migrate", 0)
+	h.Timeout = 3 * time.Second
+	h.Retries = 2
+	h.RetryBackoff = time.Millisecond
+	rel := releaseStub()
+	rel.Hooks = []*release.Hook{h}
+	is.NoError(cfg.Releases.Create(rel))
+
+	is.NoError(cfg.execHook(rel, release.HookPreUpgrade, time.Minute))
+	is.Equal(release.HookPhaseSucceeded, h.LastRun.Phase)
+	is.Equal(3, h.LastRun.Attempts)
+	// the attempts share the timeout of the hook
+	is.Len(client.timeouts, 3)
+	is.True(client.timeouts[0] <= 3*time.Second && client.timeouts[0] > 2*time.Second, "unexpected timeouts %v", client.timeouts)
+	is.True(client.timeouts[2] < client.timeouts[1] && client.timeouts[1] < client.timeouts[0], "unexpected timeouts %v", client.timeouts)
+
+	client.failures = 2
+	client.timeouts = nil
+	h.Retries = 1
+	h.Timeout = 0
+	is.Error(cfg.execHook(rel, release.HookPreUpgrade, time.Minute))
+	is.Equal(release.HookPhaseFailed, h.LastRun.Phase)
+	is.Equal(2, h.LastRun.Attempts)
+	is.Len(client.timeouts, 2)
+	is.True(client.timeouts[0] <= time.Minute && client.timeouts[0] > 59*time.Second, "unexpected timeouts %v", client.timeouts)
+
+	// a hook is not retried once its timeout would expire before the retry
+	client.failures = 2
+	client.timeouts = nil
+	h.Retries = 2
+	h.Timeout = 50 * time.Millisecond
+	h.RetryBackoff = time.Second
+	is.Error(cfg.execHook(rel, release.HookPreUpgrade, time.Minute))
+	is.Equal(1, h.LastRun.Attempts)
+
+	// a hook is only retried once its resources are deleted
+	client.failures = 2
+	client.WaitForDeleteError = fmt.Errorf("timed out waiting for the deletion of Job \"migrate\"")
+	h.Timeout = 3 * time.Second
+	h.RetryBackoff = time.Millisecond
+	err := cfg.execHook(rel, release.HookPreUpgrade, time.Minute)
+	is.Error(err)
+	is.Contains(err.Error(), `unable to delete hook templates/migrate.yaml before retrying it: timed out waiting for the deletion of Job "migrate"`)
+	is.Equal(1, h.LastRun.Attempts)
+}
+
+func TestExecHook_AllowFailure(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+	failer := cfg.KubeClient.(*kubefake.FailingKubeClient)
+	failer.WatchUntilReadyError = fmt.Errorf("job failed: BackoffLimitExceeded")
+	var events []Event
+	cfg.Observer = ObserverFunc(func(e Event) {
+		events = append(events, e)
+	})
+
+	optional := hookStub("optional", 0)
+	optional.AllowFailure = true
+	rel := releaseStub()
+	rel.Hooks = []*release.Hook{optional}
+	is.NoError(cfg.Releases.Create(rel))
+
+	is.NoError(cfg.execHook(rel, release.HookPreUpgrade, time.Minute))
+	is.Equal(release.HookPhaseFailed, optional.LastRun.Phase)
+	is.Equal(EventHookFinished, events[len(events)-1].Type)
+	is.Equal("job failed: BackoffLimitExceeded", events[len(events)-1].Error)
+
+	required := hookStub("required", 0)
+	rel.Hooks = append(rel.Hooks, required)
+	is.Error(cfg.execHook(rel, release.HookPreUpgrade, time.Minute))
+}
+
+// withHooks adds a hook for each of the events to the chart, named after it.
+func withHooks(events ...release.HookEvent) chartOption {
+	return func(opts *chartOptions) {
+		for _, e := range events {
+			opts.Templates = append(opts.Templates, &chart.File{
+				Name: "templates/" + string(e) + ".yaml",
+				Data: []byte("kind: ConfigMap\nmetadata:\n  name: " + string(e) + "\n  annotations:\n    \"helm.sh/hook\": " + string(e) + "\n"),
+			})
+		}
+	}
+}
+
+func findHook(rel *release.Release, name string) *release.Hook {
+	for _, h := range rel.Hooks {
+		if h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+func TestInstallRelease_FailureHooks(t *testing.T) {
+	is := assert.New(t)
+	instAction := installAction(t)
+	instAction.ReleaseName = "failure-hooks"
+	instAction.Wait = true
+	failer := instAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+	failer.WaitError = fmt.Errorf("I timed out")
+
+	res, err := instAction.Run(buildChart(withHooks(release.HookPostInstall, release.HookPostInstallFailure)), map[string]interface{}{})
+	is.Error(err)
+	is.Equal(release.StatusFailed, res.Info.Status)
+	is.True(findHook(res, string(release.HookPostInstall)).LastRun.StartedAt.IsZero(), "expected the post-install hook not to run")
+	is.Equal(release.HookPhaseSucceeded, findHook(res, string(release.HookPostInstallFailure)).LastRun.Phase)
+
+	instAction = installAction(t)
+	instAction.ReleaseName = "no-failure-hooks"
+	instAction.Wait = true
+	instAction.DisableHooks = true
+	failer = instAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+	failer.WaitError = fmt.Errorf("I timed out")
+
+	res, err = instAction.Run(buildChart(withHooks(release.HookPostInstallFailure)), map[string]interface{}{})
+	is.Error(err)
+	is.True(findHook(res, string(release.HookPostInstallFailure)).LastRun.StartedAt.IsZero(), "expected the post-install-failure hook not to run with hooks disabled")
+}
+
+func TestUpgradeRelease_FailureHooks(t *testing.T) {
+	is := assert.New(t)
+	upAction := upgradeAction(t)
+	rel := releaseStub()
+	rel.Name = "failure-hooks"
+	rel.Info.Status = release.StatusDeployed
+	is.NoError(upAction.cfg.Releases.Create(rel))
+
+	// one of the post-upgrade hooks fails
+	upAction.cfg.KubeClient = &flakyKubeClient{failures: 1}
+	upAction.Atomic = true
+	var started []string
+	upAction.cfg.Observer = ObserverFunc(func(e Event) {
+		if e.Type == EventHookStarted {
+			started = append(started, e.Hook.Name)
+		}
+	})
+
+	res, err := upAction.Run(rel.Name, buildChart(withHooks(release.HookPostUpgrade, release.HookPostUpgradeFailure)), map[string]interface{}{})
+	is.Error(err)
+	is.Contains(err.Error(), "has been rolled back")
+	is.Equal(release.HookPhaseSucceeded, findHook(res, string(release.HookPostUpgradeFailure)).LastRun.Phase)
+	// the failure hooks run after the post-upgrade hooks, and before the
+	// rollback to the revision without hooks
+	is.Equal([]string{string(release.HookPostUpgrade), "test-cm", string(release.HookPostUpgradeFailure)}, started)
+}
+
+func TestReleaseTesting_PreAndPostTestHooks(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+	client := &flakyKubeClient{}
+	cfg.KubeClient = client
+	var started []string
+	cfg.Observer = ObserverFunc(func(e Event) {
+		if e.Type == EventHookStarted {
+			started = append(started, e.Hook.Name)
+		}
+	})
+
+	rel := releaseStub()
+	rel.Name = "tested"
+	rel.Hooks = nil
+	for _, e := range []release.HookEvent{release.HookPostTest, release.HookTest, release.HookPreTest} {
+		rel.Hooks = append(rel.Hooks, &release.Hook{Name: string(e), Kind: "Pod", Path: "templates/" + string(e), Events: []release.HookEvent{e}})
+	}
+	is.NoError(cfg.Releases.Create(rel))
+
+	testAction := NewReleaseTesting(cfg)
+	testAction.Filters["name"] = []string{"other-test"}
+	_, err := testAction.Run(rel.Name)
+	is.NoError(err)
+	is.Equal([]string{"pre-test", "post-test"}, started, "expected the filters to only select tests")
+
+	started = nil
+	testAction.Filters = map[string][]string{}
+	_, err = testAction.Run(rel.Name)
+	is.NoError(err)
+	is.Equal([]string{"pre-test", "test", "post-test"}, started)
+
+	started = nil
+	client.failures = 1
+	_, err = testAction.Run(rel.Name)
+	is.Error(err)
+	is.Equal([]string{"pre-test"}, started, "expected the tests not to run once a pre-test hook failed")
+}
+
+func TestReleaseTesting_Results(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+	exitCode := int32(0)
+	cfg.KubeClient = &barrierKubeClient{
+		FailingKubeClient: kubefake.FailingKubeClient{FailedPodLogs: &kube.FailureLogs{Logs: "ok\n", ExitCode: &exitCode}},
+		n:                 2,
+		all:               make(chan struct{}),
+	}
+
+	rel := releaseStub()
+	rel.Name = "tested"
+	rel.Hooks = []*release.Hook{
+		{Name: "passed", Kind: "Pod", Weight: 0, Events: []release.HookEvent{release.HookTest},
+			LastRun: release.HookExecution{Phase: release.HookPhaseSucceeded, ExitCode: &exitCode}},
+		{Name: "failed", Kind: "Pod", Weight: 1, Events: []release.HookEvent{release.HookTest},
+			LastRun: release.HookExecution{Phase: release.HookPhaseFailed}},
+		{Name: "new", Kind: "Pod", Weight: 2, Events: []release.HookEvent{release.HookTest}},
+	}
+	is.NoError(cfg.Releases.Create(rel))
+
+	// the tests of different weights are only watched concurrently in parallel
+	testAction := NewReleaseTesting(cfg)
+	testAction.OnlyFailed = true
+	testAction.Parallel = true
+	_, err := testAction.Run(rel.Name)
+	is.NoError(err)
+
+	results := testAction.Results()
+	is.Len(results, 3)
+	is.Equal([]string{"passed", "failed", "new"}, []string{results[0].Name, results[1].Name, results[2].Name})
+	is.True(results[0].Skipped, "expected the test that succeeded not to run again")
+	is.Equal(&exitCode, results[0].ExitCode)
+	for _, r := range results[1:] {
+		is.False(r.Skipped, r.Name)
+		is.Equal(release.HookPhaseSucceeded, r.Phase, r.Name)
+		is.False(r.StartedAt.IsZero(), r.Name)
+		// the logs of the tests are recorded even though they passed
+		is.Equal("ok\n", r.Logs, r.Name)
+		is.Equal(&exitCode, r.ExitCode, r.Name)
+	}
+}
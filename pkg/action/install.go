@@ -92,6 +92,10 @@ type Install struct {
 	SubNotes                 bool
 	DisableOpenAPIValidation bool
 	IncludeCRDs              bool
+	// ServerSide sends resources to the cluster with server-side apply.
+	ServerSide bool
+	// ForceConflicts takes ownership of fields managed by others when using server-side apply.
+	ForceConflicts bool
 	// APIVersions allows a manual set of supported API Versions to be passed
 	// (for things like templating). These are ignored if ClientOnly is false
 	APIVersions chartutil.VersionSet
@@ -101,6 +105,11 @@ type Install struct {
 	// OutputDir/<ReleaseName>
 	UseReleaseName bool
 	PostRenderer   postrender.PostRenderer
+	// ValuesFiles are the sources of the values, recorded in the audit record
+	// of the release.
+	ValuesFiles []string
+	// Labels are the custom labels of the release.
+	Labels map[string]string
 }
 
 // ChartPathOptions captures common options used for controlling chart paths
@@ -135,7 +144,7 @@ func (i *Install) installCRDs(crds []chart.CRD) error {
 		}
 
 		// Send them to Kube
-		if _, err := i.cfg.KubeClient.Create(res); err != nil {
+		if _, err := i.cfg.createResources(res, nil); err != nil {
 			// If the error is CRD already exists, continue.
 			if apierrors.IsAlreadyExists(err) {
 				crdName := res[0].Name
@@ -163,6 +172,8 @@ func (i *Install) installCRDs(crds []chart.CRD) error {
 
 		// Make sure to force a rebuild of the cache.
 		discoveryClient.ServerGroups()
+
+		i.cfg.emit(Event{Type: EventCRDsInstalled, Message: fmt.Sprintf("installed %d CRDs", len(totalItems))})
 	}
 	return nil
 }
@@ -182,6 +193,22 @@ func (i *Install) Run(chrt *chart.Chart, vals map[string]interface{}) (*release.
 		return nil, err
 	}
 
+	if err := validateLabels(i.Labels); err != nil {
+		return nil, err
+	}
+
+	if !i.ClientOnly && !i.DryRun {
+		unlock, err := i.cfg.lockRelease(i.ReleaseName)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		// another operation may have taken the name before it was locked
+		if err := i.availableName(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Pre-install anything in the crd/ directory. We do this before Helm
 	// contacts the upstream server and builds the capabilities object.
 	if crds := chrt.CRDObjects(); !i.ClientOnly && !i.SkipCRDs && len(crds) > 0 {
@@ -248,6 +275,7 @@ func (i *Install) Run(chrt *chart.Chart, vals map[string]interface{}) (*release.
 		// Return a release with partial data so that the client can show debugging information.
 		return rel, err
 	}
+	i.cfg.emit(Event{Type: EventRendered, Message: fmt.Sprintf("rendered chart %s with %d hooks", chrt.Name(), len(rel.Hooks))})
 
 	// Mark this release as in-progress
 	rel.SetStatus(release.StatusPendingInstall, "Initial install underway")
@@ -335,12 +363,13 @@ func (i *Install) Run(chrt *chart.Chart, vals map[string]interface{}) (*release.
 	// At this point, we can do the install. Note that before we were detecting whether to
 	// do an update, but it's not clear whether we WANT to do an update if the re-use is set
 	// to true, since that is basically an upgrade operation.
+	opts := applyOptions(i.ServerSide, i.ForceConflicts)
 	if len(toBeAdopted) == 0 && len(resources) > 0 {
-		if _, err := i.cfg.KubeClient.Create(resources); err != nil {
+		if _, err := i.cfg.createResources(resources, opts); err != nil {
 			return i.failRelease(rel, err)
 		}
 	} else if len(resources) > 0 {
-		if _, err := i.cfg.KubeClient.Update(toBeAdopted, resources, false); err != nil {
+		if _, err := i.cfg.updateResources(toBeAdopted, resources, false, opts); err != nil {
 			return i.failRelease(rel, err)
 		}
 	}
@@ -385,12 +414,16 @@ func (i *Install) Run(chrt *chart.Chart, vals map[string]interface{}) (*release.
 
 func (i *Install) failRelease(rel *release.Release, err error) (*release.Release, error) {
 	rel.SetStatus(release.StatusFailed, fmt.Sprintf("Release %q failed: %s", i.ReleaseName, err.Error()))
+	if !i.DisableHooks {
+		i.cfg.execFailureHook(rel, release.HookPostInstallFailure, i.Timeout)
+	}
 	if i.Atomic {
 		i.cfg.Log("Install failed and atomic is set, uninstalling release")
 		uninstall := NewUninstall(i.cfg)
 		uninstall.DisableHooks = i.DisableHooks
 		uninstall.KeepHistory = false
 		uninstall.Timeout = i.Timeout
+		uninstall.lockHeld = true
 		if _, uninstallErr := uninstall.Run(i.ReleaseName); uninstallErr != nil {
 			return rel, errors.Wrapf(uninstallErr, "an error occurred while uninstalling the release. original install error: %s", err)
 		}
@@ -447,8 +480,10 @@ func (i *Install) createRelease(chrt *chart.Chart, rawVals map[string]interface{
 			FirstDeployed: ts,
 			LastDeployed:  ts,
 			Status:        release.StatusUnknown,
+			Audit:         i.cfg.audit(i.ValuesFiles),
 		},
 		Version: 1,
+		Labels:  i.Labels,
 	}
 }
 
@@ -25,6 +25,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	gotime "time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -33,6 +34,7 @@ import (
 	"helm.sh/helm/v3/pkg/chartutil"
 	kubefake "helm.sh/helm/v3/pkg/kube/fake"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 	"helm.sh/helm/v3/pkg/time"
 )
@@ -308,6 +310,49 @@ func TestInstallRelease_FailedHooks(t *testing.T) {
 	is.Equal(release.StatusFailed, res.Info.Status)
 }
 
+func TestInstallRelease_Events(t *testing.T) {
+	is := assert.New(t)
+	instAction := installAction(t)
+	instAction.ReleaseName = "eventful"
+	var events []Event
+	instAction.cfg.Observer = ObserverFunc(func(e Event) {
+		events = append(events, e)
+	})
+
+	_, err := instAction.Run(buildChart(), map[string]interface{}{})
+	is.NoError(err)
+
+	var types []EventType
+	for _, e := range events {
+		is.False(e.Time.IsZero())
+		types = append(types, e.Type)
+	}
+	is.Equal([]EventType{EventRendered, EventHookStarted, EventHookFinished}, types)
+	is.Equal("rendered chart hello with 1 hooks", events[0].Message)
+	is.Equal(&EventHook{Name: "test-cm", Kind: "ConfigMap", Event: release.HookPostInstall, Phase: release.HookPhaseRunning}, events[1].Hook)
+	is.Equal(release.HookPhaseSucceeded, events[2].Hook.Phase)
+	is.Empty(events[2].Error)
+}
+
+func TestInstallRelease_FailedHookEvents(t *testing.T) {
+	is := assert.New(t)
+	instAction := installAction(t)
+	instAction.ReleaseName = "failed-hook-events"
+	failer := instAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+	failer.WatchUntilReadyError = fmt.Errorf("Failed watch")
+	instAction.cfg.KubeClient = failer
+	var last Event
+	instAction.cfg.Observer = ObserverFunc(func(e Event) {
+		last = e
+	})
+
+	_, err := instAction.Run(buildChart(), map[string]interface{}{})
+	is.Error(err)
+	is.Equal(EventHookFinished, last.Type)
+	is.Equal(release.HookPhaseFailed, last.Hook.Phase)
+	is.Equal("Failed watch", last.Error)
+}
+
 func TestInstallRelease_ReplaceRelease(t *testing.T) {
 	is := assert.New(t)
 	instAction := installAction(t)
@@ -331,6 +376,39 @@ func TestInstallRelease_ReplaceRelease(t *testing.T) {
 	is.Equal(getres.Info.Status, release.StatusDeployed)
 }
 
+// racingLocker creates a release while a lock is acquired, as another
+// operation installing it would.
+type racingLocker struct {
+	driver.Locker
+	create func()
+}
+
+func (l *racingLocker) AcquireLock(key, holder string, ttl gotime.Duration) error {
+	if l.create != nil {
+		l.create()
+		l.create = nil
+	}
+	return l.Locker.AcquireLock(key, holder, ttl)
+}
+
+func TestInstallRelease_NameTakenWhileLocking(t *testing.T) {
+	is := assert.New(t)
+	instAction := installAction(t)
+	rel := releaseStub()
+	instAction.ReleaseName = rel.Name
+	instAction.cfg.Releases.Locker = &racingLocker{
+		Locker: instAction.cfg.Releases.Locker,
+		create: func() { storage.Init(instAction.cfg.Releases.Driver).Create(rel) },
+	}
+
+	_, err := instAction.Run(buildChart(), map[string]interface{}{})
+	is.Error(err)
+	is.Contains(err.Error(), "cannot re-use a name that is still in use")
+	history, err := instAction.cfg.Releases.History(rel.Name)
+	is.NoError(err)
+	is.Len(history, 1)
+}
+
 func TestInstallRelease_KubeVersion(t *testing.T) {
 	is := assert.New(t)
 	instAction := installAction(t)
@@ -0,0 +1,57 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// validateLabels checks that the custom labels of a release are Kubernetes
+// labels, which do not override the labels managed by the storage drivers.
+func validateLabels(lbs map[string]string) error {
+	if driver.ContainsSystemLabels(lbs) {
+		return errors.Errorf("user-supplied labels contain system reserved labels: the labels %s, and the labels prefixed with helm.sh/ other than helm.sh/history-, are managed by Helm",
+			strings.Join(driver.GetSystemLabels(), ", "))
+	}
+	for key, value := range lbs {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return errors.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return errors.Errorf("invalid value %q of label %q: %s", value, key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// mergeCustomLabels returns the custom labels of a new revision of a release:
+// the custom labels of the current revision, overridden by lbs.
+func mergeCustomLabels(current, lbs map[string]string) map[string]string {
+	merged := driver.FilterSystemLabels(current)
+	for key, value := range lbs {
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,111 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"helm.sh/helm/v3/pkg/storage"
+)
+
+func TestInstallRelease_Labels(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	instAction := installAction(t)
+	instAction.Labels = map[string]string{"team": "payments"}
+	res, err := instAction.Run(buildChart(), nil)
+	req.NoError(err)
+
+	rel, err := instAction.cfg.Releases.Get(res.Name, res.Version)
+	req.NoError(err)
+	is.Equal(map[string]string{"team": "payments"}, rel.Labels)
+
+	for _, lbs := range []map[string]string{
+		{"owner": "me"},
+		{"helm.sh/release-chunk": "true"},
+		{"team": "pay ments"},
+		{"te am": "payments"},
+	} {
+		instAction := installAction(t)
+		instAction.Labels = lbs
+		_, err := instAction.Run(buildChart(), nil)
+		is.Error(err, "expected the labels %v to be rejected", lbs)
+	}
+}
+
+func TestUpgradeRelease_Labels(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	upAction := upgradeAction(t)
+	rel := releaseStub()
+	rel.Name = "labeled"
+	rel.Labels = map[string]string{"team": "payments", "tier": "prod", "owner": "helm"}
+	req.NoError(upAction.cfg.Releases.Create(rel))
+
+	upAction.Labels = map[string]string{"tier": "staging"}
+	res, err := upAction.Run(rel.Name, buildChart(), nil)
+	req.NoError(err)
+	is.Equal(map[string]string{"team": "payments", "tier": "staging"}, res.Labels)
+
+	upAction.ResetLabels = true
+	upAction.Labels = map[string]string{"cost-center": "42"}
+	res, err = upAction.Run(rel.Name, buildChart(), nil)
+	req.NoError(err)
+	is.Equal(map[string]string{"cost-center": "42"}, res.Labels)
+
+	upAction.Labels = map[string]string{"status": "ok"}
+	_, err = upAction.Run(rel.Name, buildChart(), nil)
+	is.Error(err)
+
+	rollAction := NewRollback(upAction.cfg)
+	rollAction.Version = 1
+	req.NoError(rollAction.Run(rel.Name))
+	res, err = upAction.cfg.Releases.Last(rel.Name)
+	req.NoError(err)
+	is.Equal(map[string]string{"cost-center": "42"}, res.Labels, "expected a rollback to keep the labels of the release")
+}
+
+func TestInstallRelease_RetentionLabels(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	instAction := installAction(t)
+	instAction.Labels = map[string]string{storage.RetentionMaxRevisionsLabel: "2"}
+	res, err := instAction.Run(buildChart(), nil)
+	req.NoError(err)
+
+	upAction := upgradeAction(t)
+	upAction.cfg = instAction.cfg
+	for i := 0; i < 3; i++ {
+		_, err := upAction.Run(res.Name, buildChart(), nil)
+		req.NoError(err)
+	}
+
+	history, err := instAction.cfg.Releases.History(res.Name)
+	req.NoError(err)
+	var versions []int
+	for _, rel := range history {
+		versions = append(versions, rel.Version)
+		is.Equal(map[string]string{storage.RetentionMaxRevisionsLabel: "2"}, rel.Labels)
+	}
+	is.ElementsMatch([]int{3, 4}, versions)
+}
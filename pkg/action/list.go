@@ -17,13 +17,17 @@ limitations under the License.
 package action
 
 import (
+	"context"
 	"path"
 	"regexp"
 
+	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
 // ListStates represents zero or more status codes that a list item may have set
@@ -158,15 +162,12 @@ func (l *List) Run() ([]*release.Release, error) {
 		}
 	}
 
-	results, err := l.cfg.Releases.List(func(rel *release.Release) bool {
-		// Skip anything that doesn't match the filter.
-		if filter != nil && !filter.MatchString(rel.Name) {
-			return false
-		}
-
-		return true
-	})
+	selectorObj, err := labels.Parse(l.Selector)
+	if err != nil {
+		return nil, err
+	}
 
+	results, err := l.releases(filter, selectorObj)
 	if err != nil {
 		return nil, err
 	}
@@ -187,10 +188,6 @@ func (l *List) Run() ([]*release.Release, error) {
 	results = l.filterStateMask(results)
 
 	// Skip anything that doesn't match the selector
-	selectorObj, err := labels.Parse(l.Selector)
-	if err != nil {
-		return nil, err
-	}
 	results = l.filterSelector(results, selectorObj)
 
 	// Unfortunately, we have to sort before truncating, which can incur substantial overhead
@@ -215,6 +212,106 @@ func (l *List) Run() ([]*release.Release, error) {
 	return results, err
 }
 
+// Watch streams the changes of the releases matching the filter, the selector
+// and the state mask of the list, until ctx is done. The deleted revisions are
+// streamed whatever their status.
+//
+// Start watching before running the list to not miss any change.
+func (l *List) Watch(ctx context.Context) (<-chan driver.Event, error) {
+	var filter *regexp.Regexp
+	if l.Filter != "" {
+		var err error
+		filter, err = regexp.Compile(l.Filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	selector, err := labels.Parse(l.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := l.cfg.Releases.Watch(ctx, func(rel *release.Release) bool {
+		return (filter == nil || filter.MatchString(rel.Name)) && selector.Matches(labels.Set(rel.Labels))
+	})
+	if err != nil {
+		return nil, err
+	}
+	filtered := make(chan driver.Event)
+	go func() {
+		defer close(filtered)
+		for ev := range events {
+			if ev.Type != driver.EventDeleted && len(l.filterStateMask([]*release.Release{ev.Release})) == 0 {
+				continue
+			}
+			select {
+			case filtered <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return filtered, nil
+}
+
+// releases returns the revisions of the releases whose name matches filter.
+//
+// When the selector requires labels to have a given value, the drivers are
+// queried for the releases having these labels, whose revisions are returned:
+// the selector is to be applied to the latest revision of each release, which
+// may not have the labels of the former ones.
+func (l *List) releases(filter *regexp.Regexp, selector labels.Selector) ([]*release.Release, error) {
+	matches := func(rel *release.Release) bool {
+		// Skip anything that doesn't match the filter.
+		return filter == nil || filter.MatchString(rel.Name)
+	}
+
+	query := selectorQuery(selector)
+	if len(query) == 0 {
+		return l.cfg.Releases.List(matches)
+	}
+	query["owner"] = "helm"
+	candidates, err := l.cfg.Releases.Query(query)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		// the driver does not hold the labels of the selector
+		l.cfg.Log("querying the releases by label failed, listing them: %v", err)
+		return l.cfg.Releases.List(matches)
+	}
+
+	var results []*release.Release
+	names := map[string]bool{}
+	for _, rel := range candidates {
+		if names[rel.Name] || !matches(rel) {
+			continue
+		}
+		names[rel.Name] = true
+		history, err := l.cfg.Releases.History(rel.Name)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, history...)
+	}
+	return results, nil
+}
+
+// selectorQuery returns the labels whose value is set by the selector.
+func selectorQuery(selector labels.Selector) map[string]string {
+	requirements, _ := selector.Requirements()
+	query := map[string]string{}
+	for _, r := range requirements {
+		switch r.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			if values := r.Values(); values.Len() == 1 {
+				query[r.Key()] = values.List()[0]
+			}
+		}
+	}
+	return query
+}
+
 // sort is an in-place sort where order is based on the value of a.Sort
 func (l *List) sort(rels []*release.Release) {
 	if l.SortReverse {
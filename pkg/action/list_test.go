@@ -365,4 +365,24 @@ func TestSelectorList(t *testing.T) {
 		expectedFilteredList := []*release.Release{r2, r3}
 		assert.ElementsMatch(t, expectedFilteredList, res)
 	})
+
+	t.Run("should select the latest revision of the releases", func(t *testing.T) {
+		r4 := releaseStub()
+		r4.Name = "r1"
+		r4.Version = 2
+		r4.Labels = map[string]string{"key": "value2"}
+		if err := lister.cfg.Releases.Create(r4); err != nil {
+			t.Fatal(err)
+		}
+
+		lister.Selector = "key=value1"
+		res, err := lister.Run()
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+
+		lister.Selector = "key=value2"
+		res, err = lister.Run()
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []*release.Release{r2, r4}, res)
+	})
 }
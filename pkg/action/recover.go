@@ -0,0 +1,281 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+// RecoverStrategy selects how a release stuck in a pending state is recovered.
+type RecoverStrategy string
+
+const (
+	// RecoverAuto resumes the pending operation if all of its resources exist
+	// in the cluster, rolls back to the last deployed revision otherwise, and
+	// marks the release as failed if it has never been deployed.
+	RecoverAuto RecoverStrategy = "auto"
+	// RecoverMarkFailed marks the pending revision as failed without touching
+	// the cluster.
+	RecoverMarkFailed RecoverStrategy = "fail"
+	// RecoverRollback marks the pending revision as failed and rolls back to
+	// the last deployed revision.
+	RecoverRollback RecoverStrategy = "rollback"
+	// RecoverResume applies the pending revision to the cluster again and
+	// marks it as deployed.
+	RecoverResume RecoverStrategy = "resume"
+)
+
+// RecoverStrategies lists the strategies accepted by Recover.
+var RecoverStrategies = []RecoverStrategy{RecoverAuto, RecoverMarkFailed, RecoverRollback, RecoverResume}
+
+var errNoDeployedRevision = errors.New("no deployed revision to roll back to")
+
+// Recover is the action for recovering a release left in a pending state by an
+// operation that was interrupted.
+//
+// It provides the implementation of 'helm recover'.
+type Recover struct {
+	cfg *Configuration
+
+	// Strategy selects how the release is recovered. Defaults to RecoverAuto.
+	Strategy     RecoverStrategy
+	Timeout      time.Duration
+	Wait         bool
+	WaitForJobs  bool
+	DisableHooks bool
+	// DryRun reports how the release would be recovered without changing it.
+	DryRun bool
+}
+
+// NewRecover creates a new Recover object with the given configuration.
+func NewRecover(cfg *Configuration) *Recover {
+	return &Recover{
+		cfg:      cfg,
+		Strategy: RecoverAuto,
+	}
+}
+
+// Run recovers the named release and returns its pending revision, whose
+// description records how it was recovered.
+//
+// The release is locked while it is recovered, so a release whose operation is
+// still running cannot be recovered until that operation finishes or its lock
+// expires.
+func (r *Recover) Run(name string) (*release.Release, error) {
+	if err := r.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	if err := chartutil.ValidateReleaseName(name); err != nil {
+		return nil, errors.Errorf("release name is invalid: %s", name)
+	}
+
+	if !r.DryRun {
+		unlock, err := r.cfg.lockRelease(name)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	rel, err := r.cfg.Releases.Last(name)
+	if err != nil {
+		return nil, err
+	}
+	if !rel.Info.Status.IsPending() {
+		return nil, errors.Errorf("release %q is not pending: revision %d is %s", name, rel.Version, rel.Info.Status)
+	}
+
+	deployed, err := r.cfg.Releases.Deployed(name)
+	if err != nil && !errors.Is(err, driver.ErrNoDeployedReleases) {
+		return nil, err
+	}
+
+	strategy := r.Strategy
+	if strategy == "" || strategy == RecoverAuto {
+		target, err := r.cfg.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to build kubernetes objects from pending release manifest")
+		}
+		_, missing, err := lookupResources(target)
+		if err != nil {
+			return nil, err
+		}
+		strategy = autoRecoverStrategy(len(missing), deployed != nil)
+		r.cfg.Log("%d of %d resources of %s revision %d are missing, recovering with %q", len(missing), len(target), name, rel.Version, strategy)
+	}
+
+	var status release.Status
+	var description string
+	switch strategy {
+	case RecoverMarkFailed:
+		status, description = release.StatusFailed, "marked as failed"
+	case RecoverRollback:
+		if deployed == nil {
+			return nil, errors.Wrapf(errNoDeployedRevision, "cannot recover release %q", name)
+		}
+		status, description = release.StatusFailed, fmt.Sprintf("rolled back to %d", deployed.Version)
+	case RecoverResume:
+		status, description = release.StatusDeployed, "resumed"
+	default:
+		return nil, errors.Errorf("unknown recover strategy %q", strategy)
+	}
+	pending := rel.Info.Status
+
+	if r.DryRun {
+		r.cfg.Log("dry run for %s", name)
+		preview := *rel
+		info := *rel.Info
+		preview.Info = &info
+		preview.SetStatus(status, fmt.Sprintf("Recovered from %s: %s", pending, description))
+		return &preview, nil
+	}
+	rel.SetStatus(status, fmt.Sprintf("Recovered from %s: %s", pending, description))
+
+	switch strategy {
+	case RecoverMarkFailed:
+		r.cfg.recordRelease(rel)
+	case RecoverRollback:
+		if err := r.cfg.Releases.Update(rel); err != nil {
+			return nil, err
+		}
+		if err := r.rollback(deployed); err != nil {
+			return rel, err
+		}
+	case RecoverResume:
+		if err := r.resume(rel, deployed); err != nil {
+			rel.SetStatus(release.StatusFailed, fmt.Sprintf("Recovered from %s: resume failed: %s", pending, err))
+			r.cfg.recordRelease(rel)
+			return rel, err
+		}
+	}
+	return rel, nil
+}
+
+// rollback rolls the release back to the given deployed revision.
+func (r *Recover) rollback(deployed *release.Release) error {
+	rb := NewRollback(r.cfg)
+	rb.Version = deployed.Version
+	rb.Timeout = r.Timeout
+	rb.Wait = r.Wait
+	rb.WaitForJobs = r.WaitForJobs
+	rb.DisableHooks = r.DisableHooks
+	rb.MaxHistory = r.cfg.Releases.MaxHistory
+	rb.lockHeld = true
+	return rb.Run(deployed.Name)
+}
+
+// resume applies the manifest of the pending revision rel and records it as the
+// deployed revision, superseding the previously deployed revision if any.
+// Hooks are not run again as there is no way of knowing which of them already
+// ran.
+func (r *Recover) resume(rel, deployed *release.Release) error {
+	var current kube.ResourceList
+	if deployed != nil {
+		var err error
+		current, err = r.cfg.KubeClient.Build(bytes.NewBufferString(deployed.Manifest), false)
+		if err != nil {
+			return errors.Wrap(err, "unable to build kubernetes objects from deployed release manifest")
+		}
+	}
+	target, err := r.cfg.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+	if err != nil {
+		return errors.Wrap(err, "unable to build kubernetes objects from pending release manifest")
+	}
+
+	// The resources the interrupted operation already created are not part of
+	// the deployed revision, and can only be updated, like the resources adopted
+	// by an install, as part of the current resources.
+	existing, _, err := lookupResources(target.Difference(current))
+	if err != nil {
+		return err
+	}
+	current = append(current, existing...)
+
+	if _, err := r.cfg.updateResources(current, target, false, nil); err != nil {
+		return err
+	}
+
+	if r.Wait {
+		if r.WaitForJobs {
+			err = r.cfg.KubeClient.WaitWithJobs(target, r.Timeout)
+		} else {
+			err = r.cfg.KubeClient.Wait(target, r.Timeout)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if deployed != nil {
+		r.cfg.Log("superseding previous deployment %d", deployed.Version)
+		deployed.Info.Status = release.StatusSuperseded
+		r.cfg.recordRelease(deployed)
+	}
+	rel.Info.LastDeployed = helmtime.Now()
+	return r.cfg.Releases.Update(rel)
+}
+
+// autoRecoverStrategy chooses the strategy used by RecoverAuto given the number
+// of resources of the pending revision missing from the cluster and whether the
+// release has a deployed revision.
+func autoRecoverStrategy(missing int, hasDeployed bool) RecoverStrategy {
+	switch {
+	case missing == 0:
+		return RecoverResume
+	case hasDeployed:
+		return RecoverRollback
+	default:
+		return RecoverMarkFailed
+	}
+}
+
+// lookupResources splits resources into the ones that exist in the cluster and
+// the ones that do not.
+func lookupResources(resources kube.ResourceList) (existing, missing kube.ResourceList, err error) {
+
+	err = resources.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		helper := resource.NewHelper(info.Client, info.Mapping)
+		if _, err := helper.Get(info.Namespace, info.Name); err != nil {
+			if apierrors.IsNotFound(err) {
+				missing.Append(info)
+				return nil
+			}
+			return errors.Wrapf(err, "could not get information about %s", resourceString(info))
+		}
+		existing.Append(info)
+		return nil
+	})
+
+	return existing, missing, err
+}
@@ -0,0 +1,254 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+	fakerest "k8s.io/client-go/rest/fake"
+	cmdtesting "k8s.io/kubectl/pkg/cmd/testing"
+
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// recoverFixture stores a deployed revision 1 followed by a revision 2 in the
+// given status.
+func recoverFixture(t *testing.T, status release.Status) *Recover {
+	t.Helper()
+	config := actionConfigFixture(t)
+
+	deployed := releaseStub()
+	deployed.Name = "stuck"
+	deployed.Version = 1
+	deployed.Info.Status = release.StatusDeployed
+	require.NoError(t, config.Releases.Create(deployed))
+
+	pending := releaseStub()
+	pending.Name = "stuck"
+	pending.Version = 2
+	pending.Info.Status = status
+	require.NoError(t, config.Releases.Create(pending))
+
+	return NewRecover(config)
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name        string
+		pending     release.Status
+		strategy    RecoverStrategy
+		description string
+		want        map[int]release.Status
+	}{{
+		name:        "auto resumes when all resources exist",
+		pending:     release.StatusPendingUpgrade,
+		strategy:    RecoverAuto,
+		description: "Recovered from pending-upgrade: resumed",
+		want:        map[int]release.Status{1: release.StatusSuperseded, 2: release.StatusDeployed},
+	}, {
+		name:        "mark failed",
+		pending:     release.StatusPendingUpgrade,
+		strategy:    RecoverMarkFailed,
+		description: "Recovered from pending-upgrade: marked as failed",
+		want:        map[int]release.Status{1: release.StatusDeployed, 2: release.StatusFailed},
+	}, {
+		name:        "rollback",
+		pending:     release.StatusPendingRollback,
+		strategy:    RecoverRollback,
+		description: "Recovered from pending-rollback: rolled back to 1",
+		want:        map[int]release.Status{1: release.StatusSuperseded, 2: release.StatusFailed, 3: release.StatusDeployed},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := assert.New(t)
+			req := require.New(t)
+
+			recoverAction := recoverFixture(t, tt.pending)
+			recoverAction.Strategy = tt.strategy
+
+			res, err := recoverAction.Run("stuck")
+			req.NoError(err)
+			is.Equal(2, res.Version)
+			is.Equal(tt.description, res.Info.Description)
+
+			history, err := recoverAction.cfg.Releases.History("stuck")
+			req.NoError(err)
+			is.Len(history, len(tt.want))
+			for _, rel := range history {
+				is.Equal(tt.want[rel.Version], rel.Info.Status, "revision %d", rel.Version)
+			}
+
+			stored, err := recoverAction.cfg.Releases.Get("stuck", 2)
+			req.NoError(err)
+			is.Equal(tt.description, stored.Info.Description)
+		})
+	}
+}
+
+func TestRecover_DryRun(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	recoverAction := recoverFixture(t, release.StatusPendingUpgrade)
+	recoverAction.Strategy = RecoverRollback
+	recoverAction.DryRun = true
+
+	res, err := recoverAction.Run("stuck")
+	req.NoError(err)
+	is.Equal(release.StatusFailed, res.Info.Status)
+	is.Equal("Recovered from pending-upgrade: rolled back to 1", res.Info.Description)
+
+	stored, err := recoverAction.cfg.Releases.Last("stuck")
+	req.NoError(err)
+	is.Equal(2, stored.Version)
+	is.Equal(release.StatusPendingUpgrade, stored.Info.Status)
+}
+
+func TestRecover_ResumeFailure(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	recoverAction := recoverFixture(t, release.StatusPendingUpgrade)
+	recoverAction.Strategy = RecoverResume
+	failer := recoverAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+	failer.UpdateError = fmt.Errorf("I timed out")
+	recoverAction.cfg.KubeClient = failer
+
+	res, err := recoverAction.Run("stuck")
+	req.Error(err)
+	is.Equal(release.StatusFailed, res.Info.Status)
+	is.Equal("Recovered from pending-upgrade: resume failed: I timed out", res.Info.Description)
+
+	deployed, err := recoverAction.cfg.Releases.Get("stuck", 1)
+	req.NoError(err)
+	is.Equal(release.StatusDeployed, deployed.Info.Status)
+}
+
+func TestRecover_Errors(t *testing.T) {
+	is := assert.New(t)
+
+	recoverAction := recoverFixture(t, release.StatusFailed)
+	_, err := recoverAction.Run("stuck")
+	is.EqualError(err, `release "stuck" is not pending: revision 2 is failed`)
+
+	recoverAction = NewRecover(actionConfigFixture(t))
+	rel := releaseStub()
+	rel.Name = "stuck"
+	rel.Info.Status = release.StatusPendingInstall
+	is.NoError(recoverAction.cfg.Releases.Create(rel))
+	recoverAction.Strategy = RecoverRollback
+	_, err = recoverAction.Run("stuck")
+	is.True(errors.Is(err, errNoDeployedRevision))
+
+	recoverAction.Strategy = "retry"
+	_, err = recoverAction.Run("stuck")
+	is.EqualError(err, `unknown recover strategy "retry"`)
+}
+
+func TestAutoRecoverStrategy(t *testing.T) {
+	is := assert.New(t)
+
+	is.Equal(RecoverResume, autoRecoverStrategy(0, true))
+	is.Equal(RecoverResume, autoRecoverStrategy(0, false))
+	is.Equal(RecoverRollback, autoRecoverStrategy(2, true))
+	is.Equal(RecoverMarkFailed, autoRecoverStrategy(2, false))
+}
+
+// reachableKubeClient is a kube.Client whose cluster is always reachable.
+type reachableKubeClient struct {
+	*kube.Client
+}
+
+func (reachableKubeClient) IsReachable() error { return nil }
+
+func podManifest(names ...string) string {
+	var manifest strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&manifest, "---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: %s\n  namespace: default\nspec:\n  containers:\n  - name: app\n    image: nginx\n", name)
+	}
+	return manifest.String()
+}
+
+func TestRecover_ResumeCreatedResources(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	recoverAction := recoverFixture(t, release.StatusPendingUpgrade)
+	recoverAction.Strategy = RecoverResume
+	deployed, err := recoverAction.cfg.Releases.Get("stuck", 1)
+	req.NoError(err)
+	deployed.Manifest = podManifest("starfish")
+	req.NoError(recoverAction.cfg.Releases.Update(deployed))
+	pending, err := recoverAction.cfg.Releases.Get("stuck", 2)
+	req.NoError(err)
+	pending.Manifest = podManifest("starfish", "dolphin")
+	req.NoError(recoverAction.cfg.Releases.Update(pending))
+
+	// the interrupted upgrade already created the dolphin pod
+	var patched []string
+	testFactory := cmdtesting.NewTestFactory()
+	defer testFactory.Cleanup()
+	testFactory.UnstructuredClient = &fakerest.RESTClient{
+		NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+		Client: fakerest.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			name := path.Base(req.URL.Path)
+			if req.Method == "PATCH" {
+				patched = append(patched, name)
+			} else if req.Method != "GET" {
+				t.Fatalf("unexpected request: %s %s", req.Method, req.URL.Path)
+			}
+			pod := &v1.Pod{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "nginx:old"}}},
+			}
+			header := http.Header{}
+			header.Set("Content-Type", runtime.ContentTypeJSON)
+			body, err := json.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+		}),
+	}
+	recoverAction.cfg.KubeClient = reachableKubeClient{&kube.Client{
+		Factory: testFactory.WithNamespace("default"),
+		Log:     t.Logf,
+	}}
+
+	res, err := recoverAction.Run("stuck")
+	req.NoError(err)
+	is.Equal(release.StatusDeployed, res.Info.Status)
+	is.ElementsMatch([]string{"starfish", "dolphin"}, patched)
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"time"
 
 	"github.com/pkg/errors"
@@ -27,6 +28,7 @@ import (
 
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
 )
 
 // ReleaseTesting is the action for testing a release.
@@ -38,6 +40,33 @@ type ReleaseTesting struct {
 	// Used for fetching logs from test pods
 	Namespace string
 	Filters   map[string][]string
+	// Parallel runs all of the tests concurrently, rather than in the order
+	// of their weights.
+	Parallel bool
+	// OnlyFailed only runs the tests that did not succeed in their last run.
+	OnlyFailed bool
+
+	results []*TestResult
+}
+
+// TestResult is the result of a test of a release.
+type TestResult struct {
+	// Name is the name of the test hook.
+	Name string `json:"name"`
+	// Skipped indicates that the test was not run, because it was not
+	// selected or because a pre-test hook failed. Its execution is then the
+	// one of its previous run, if any.
+	Skipped bool `json:"skipped,omitempty"`
+	// HookExecution is the last run of the test.
+	release.HookExecution
+}
+
+// Duration returns how long the test ran.
+func (t *TestResult) Duration() time.Duration {
+	if t.StartedAt.IsZero() || t.CompletedAt.IsZero() {
+		return 0
+	}
+	return t.CompletedAt.Sub(t.StartedAt)
 }
 
 // NewReleaseTesting creates a new ReleaseTesting object with the given configuration.
@@ -50,6 +79,7 @@ func NewReleaseTesting(cfg *Configuration) *ReleaseTesting {
 
 // Run executes 'helm test' against the given release.
 func (r *ReleaseTesting) Run(name string) (*release.Release, error) {
+	r.results = nil
 	if err := r.cfg.KubeClient.IsReachable(); err != nil {
 		return nil, err
 	}
@@ -64,40 +94,88 @@ func (r *ReleaseTesting) Run(name string) (*release.Release, error) {
 		return rel, err
 	}
 
+	// The filters select the test hooks, the other hooks are always executed.
 	skippedHooks := []*release.Hook{}
 	executingHooks := []*release.Hook{}
-	if len(r.Filters["!name"]) != 0 {
-		for _, h := range rel.Hooks {
-			if contains(r.Filters["!name"], h.Name) {
-				skippedHooks = append(skippedHooks, h)
-			} else {
-				executingHooks = append(executingHooks, h)
-			}
+	for _, h := range rel.Hooks {
+		if hasHookEvent(h, release.HookTest) && !r.selects(h) {
+			skippedHooks = append(skippedHooks, h)
+		} else {
+			executingHooks = append(executingHooks, h)
 		}
-		rel.Hooks = executingHooks
-	}
-	if len(r.Filters["name"]) != 0 {
-		executingHooks = nil
-		for _, h := range rel.Hooks {
-			if contains(r.Filters["name"], h.Name) {
-				executingHooks = append(executingHooks, h)
-			} else {
-				skippedHooks = append(skippedHooks, h)
-			}
+	}
+	rel.Hooks = executingHooks
+
+	started := helmtime.Now()
+	// pre-test hooks prepare the tests, which are not run if they fail
+	err = r.cfg.execHook(rel, release.HookPreTest, r.Timeout)
+	if err == nil {
+		err = r.cfg.execHookConcurrently(rel, release.HookTest, r.Timeout, r.Parallel)
+		// post-test hooks clean up after the tests, whether they passed or not
+		if postErr := r.cfg.execHook(rel, release.HookPostTest, r.Timeout); err == nil {
+			err = postErr
 		}
-		rel.Hooks = executingHooks
 	}
 
-	if err := r.cfg.execHook(rel, release.HookTest, r.Timeout); err != nil {
-		rel.Hooks = append(skippedHooks, rel.Hooks...)
+	rel.Hooks = append(skippedHooks, rel.Hooks...)
+	r.results = testResults(rel, started)
+	if err != nil {
 		r.cfg.Releases.Update(rel)
 		return rel, err
 	}
-
-	rel.Hooks = append(skippedHooks, rel.Hooks...)
 	return rel, r.cfg.Releases.Update(rel)
 }
 
+// Results returns the results of the tests of the last run, in the order of
+// their weights.
+func (r *ReleaseTesting) Results() []*TestResult {
+	return r.results
+}
+
+// selects returns whether a test hook is selected by the filters and, with
+// OnlyFailed, did not succeed in its last run.
+func (r *ReleaseTesting) selects(h *release.Hook) bool {
+	if contains(r.Filters["!name"], h.Name) {
+		return false
+	}
+	if len(r.Filters["name"]) != 0 && !contains(r.Filters["name"], h.Name) {
+		return false
+	}
+	return !r.OnlyFailed || h.LastRun.Phase != release.HookPhaseSucceeded
+}
+
+// testResults returns the results of the test hooks of a release tested since
+// started.
+func testResults(rel *release.Release, started helmtime.Time) []*TestResult {
+	var tests []*release.Hook
+	for _, h := range rel.Hooks {
+		if hasHookEvent(h, release.HookTest) {
+			tests = append(tests, h)
+		}
+	}
+	sort.Stable(hookByWeight(tests))
+
+	results := make([]*TestResult, 0, len(tests))
+	for _, h := range tests {
+		results = append(results, &TestResult{
+			Name:          h.Name,
+			Skipped:       h.LastRun.StartedAt.Before(started),
+			HookExecution: h.LastRun,
+		})
+	}
+	return results
+}
+
+// hasHookEvent returns whether the hook is executed for the given event.
+func hasHookEvent(h *release.Hook, event release.HookEvent) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
 // GetPodLogs will write the logs for all test pods in the given release into
 // the given writer. These can be immediately output to the user or captured for
 // other uses
@@ -0,0 +1,63 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// ReleaseUnlock is the action for removing the lock held on a release.
+//
+// It provides the implementation of 'helm release unlock'.
+type ReleaseUnlock struct {
+	cfg *Configuration
+}
+
+// NewReleaseUnlock creates a new ReleaseUnlock object with the given configuration.
+func NewReleaseUnlock(cfg *Configuration) *ReleaseUnlock {
+	return &ReleaseUnlock{
+		cfg: cfg,
+	}
+}
+
+// Run removes the lock on the named release regardless of its holder and
+// returns the lock that was removed.
+func (u *ReleaseUnlock) Run(name string) (*driver.LockInfo, error) {
+	if err := u.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	if err := chartutil.ValidateReleaseName(name); err != nil {
+		return nil, errors.Errorf("release name is invalid: %s", name)
+	}
+
+	lock, err := u.cfg.Releases.GetReleaseLock(name)
+	if err == driver.ErrLockNotFound {
+		return nil, errors.Errorf("release %q is not locked", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.cfg.Releases.ForceUnlockRelease(name); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
@@ -45,6 +45,16 @@ type Rollback struct {
 	Force         bool // will (if true) force resource upgrade through uninstall/recreate if needed
 	CleanupOnFail bool
 	MaxHistory    int // MaxHistory limits the maximum number of revisions saved per release
+	// ServerSide sends resources to the cluster with server-side apply.
+	ServerSide bool
+	// ForceConflicts takes ownership of fields managed by others when using server-side apply.
+	ForceConflicts bool
+	// Description is the description of the rolled back release. Defaults to
+	// "Rollback to <revision>".
+	Description string
+
+	// lockHeld is set by the operations rolling back a release they locked.
+	lockHeld bool
 }
 
 // NewRollback creates a new Rollback object with the given configuration.
@@ -62,6 +72,14 @@ func (r *Rollback) Run(name string) error {
 
 	r.cfg.Releases.MaxHistory = r.MaxHistory
 
+	if !r.DryRun && !r.lockHeld {
+		unlock, err := r.cfg.lockRelease(name)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
 	r.cfg.Log("preparing rollback of %s", name)
 	currentRelease, targetRelease, err := r.prepareRollback(name)
 	if err != nil {
@@ -117,6 +135,11 @@ func (r *Rollback) prepareRollback(name string) (*release.Release, *release.Rele
 		return nil, nil, err
 	}
 
+	description := r.Description
+	if description == "" {
+		description = fmt.Sprintf("Rollback to %d", previousVersion)
+	}
+
 	// Store a new release object with previous release's configuration
 	targetRelease := &release.Release{
 		Name:      name,
@@ -130,11 +153,13 @@ func (r *Rollback) prepareRollback(name string) (*release.Release, *release.Rele
 			Notes:         previousRelease.Info.Notes,
 			// Because we lose the reference to previous version elsewhere, we set the
 			// message here, and only override it later if we experience failure.
-			Description: fmt.Sprintf("Rollback to %d", previousVersion),
+			Description: description,
+			Audit:       r.cfg.audit(nil),
 		},
 		Version:  currentRelease.Version + 1,
 		Manifest: previousRelease.Manifest,
 		Hooks:    previousRelease.Hooks,
+		Labels:   mergeCustomLabels(currentRelease.Labels, nil),
 	}
 
 	return currentRelease, targetRelease, nil
@@ -164,7 +189,7 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 		r.cfg.Log("rollback hooks disabled for %s", targetRelease.Name)
 	}
 
-	results, err := r.cfg.KubeClient.Update(current, target, r.Force)
+	results, err := r.cfg.updateResources(current, target, r.Force, applyOptions(r.ServerSide, r.ForceConflicts))
 
 	if err != nil {
 		msg := fmt.Sprintf("Rollback %q failed: %s", targetRelease.Name, err)
@@ -176,7 +201,7 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 		r.cfg.recordRelease(targetRelease)
 		if r.CleanupOnFail {
 			r.cfg.Log("Cleanup on fail set, cleaning up %d resources", len(results.Created))
-			_, errs := r.cfg.KubeClient.Delete(results.Created)
+			_, errs := r.cfg.deleteResources(results.Created)
 			if errs != nil {
 				var errorList []string
 				for _, e := range errs {
@@ -0,0 +1,391 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+const (
+	// SnapshotScenariosGlob matches the values files of the snapshot
+	// scenarios of a chart. The scenario of ci/NAME-values.yaml is NAME.
+	SnapshotScenariosGlob = "ci/*-values.yaml"
+	// DefaultSnapshotScenario is the scenario rendering the chart with its own
+	// values. A ci/default-values.yaml file overrides it.
+	DefaultSnapshotScenario = "default"
+
+	// SnapshotIndexFile lists the snapshots Helm wrote in the directory of a
+	// scenario, one path per line. Only these are compared and removed.
+	SnapshotIndexFile = ".snapshot-index"
+
+	snapshotScenarioSuffix = "-values.yaml"
+)
+
+// SnapshotStatus describes how a rendered file differs from its snapshot.
+type SnapshotStatus string
+
+const (
+	// SnapshotAdded indicates that a file has no snapshot yet.
+	SnapshotAdded SnapshotStatus = "added"
+	// SnapshotRemoved indicates that a snapshot is no longer rendered.
+	SnapshotRemoved SnapshotStatus = "removed"
+	// SnapshotModified indicates that a file differs from its snapshot.
+	SnapshotModified SnapshotStatus = "modified"
+)
+
+func (x SnapshotStatus) String() string { return string(x) }
+
+// SnapshotFile describes a rendered file that differs from its snapshot.
+type SnapshotFile struct {
+	// Path is the path of the file relative to the directory of its
+	// scenario, such as "mychart/templates/deployment.yaml".
+	Path   string
+	Status SnapshotStatus
+	// Diff is the unified diff of the snapshot and the rendered file.
+	Diff string
+}
+
+// SnapshotResult is the result of a snapshot scenario.
+type SnapshotResult struct {
+	Scenario string
+	// Files are the files that differ from their snapshots.
+	Files []SnapshotFile
+	// Unchanged counts the files that match their snapshots.
+	Unchanged int
+}
+
+// Snapshot is the action for comparing the manifests rendered by a chart for
+// each of its scenarios against snapshots.
+//
+// It provides the implementation of 'helm snapshot verify' and of
+// 'helm template --snapshot-dir'.
+type Snapshot struct {
+	// Install renders the chart, client only.
+	Install *Install
+	// Dir is the directory of the snapshots, which holds a directory for each
+	// scenario.
+	Dir string
+	// Update writes the snapshots that differ or are missing, rather than
+	// only reporting them.
+	Update bool
+	// Prune removes the snapshots no longer rendered. Only the snapshots
+	// listed in the index of their scenario, which Helm wrote, are removed.
+	Prune bool
+}
+
+// NewSnapshot creates a new Snapshot object with the given configuration.
+func NewSnapshot(cfg *Configuration) *Snapshot {
+	return &Snapshot{
+		Install: NewInstall(cfg),
+	}
+}
+
+// Run renders the chart at chartPath for each of its scenarios, whose values
+// are merged over the given values, and compares the rendered files with their
+// snapshots. The snapshots of the scenarios the chart no longer has, whose
+// directories still hold an index, are reported as removed.
+func (s *Snapshot) Run(chartPath string, vals map[string]interface{}) ([]*SnapshotResult, error) {
+	if s.Dir == "" {
+		return nil, errors.New("the directory of the snapshots is required")
+	}
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	scenarios, err := snapshotScenarios(chrt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Install.DryRun = true
+	s.Install.ClientOnly = true
+	s.Install.Replace = true // Skip the name check
+	if s.Install.ReleaseName == "" {
+		s.Install.ReleaseName = "RELEASE-NAME"
+	}
+
+	var results []*SnapshotResult
+	seen := map[string]bool{}
+	for _, scenario := range scenarios {
+		seen[scenario.name] = true
+		// the chart is loaded for each scenario, as processing its
+		// dependencies removes the disabled ones
+		chrt, err := loader.Load(chartPath)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := s.Install.Run(chrt, chartutil.CoalesceTables(scenario.values, vals))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to render the scenario %s", scenario.name)
+		}
+		result, err := s.compare(scenario.name, snapshotFiles(rel))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	// the scenarios removed from the chart
+	entries, err := ioutil.ReadDir(s.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || seen[e.Name()] {
+			continue
+		}
+		// only the directories written by Helm are scenarios
+		if _, err := os.Stat(filepath.Join(s.Dir, e.Name(), SnapshotIndexFile)); err != nil {
+			continue
+		}
+		result, err := s.compare(e.Name(), nil)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// snapshotScenario is a scenario of a chart.
+type snapshotScenario struct {
+	name   string
+	values map[string]interface{}
+}
+
+// snapshotScenarios returns the scenarios of a chart, sorted by name.
+func snapshotScenarios(chrt *chart.Chart) ([]snapshotScenario, error) {
+	scenarios := map[string]map[string]interface{}{
+		DefaultSnapshotScenario: {},
+	}
+	for _, f := range chrt.Files {
+		if ok, _ := path.Match(SnapshotScenariosGlob, f.Name); !ok {
+			continue
+		}
+		vals, err := chartutil.ReadValues(f.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse the values of the scenario %s", f.Name)
+		}
+		name := strings.TrimSuffix(path.Base(f.Name), snapshotScenarioSuffix)
+		scenarios[name] = vals
+	}
+
+	list := make([]snapshotScenario, 0, len(scenarios))
+	for name, vals := range scenarios {
+		list = append(list, snapshotScenario{name: name, values: vals})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list, nil
+}
+
+var snapshotSourceRegex = regexp.MustCompile(`(?m)^# Source: (.+)$`)
+
+// snapshotFiles returns the files rendered for a release, keyed by the path of
+// their template, like 'helm template --output-dir' writes them. The documents
+// of each file are in the order of the release manifest, followed by the hooks.
+func snapshotFiles(rel *release.Release) map[string]string {
+	var all strings.Builder
+	fmt.Fprintln(&all, strings.TrimSpace(rel.Manifest))
+	for _, h := range rel.Hooks {
+		fmt.Fprintf(&all, "---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+	}
+
+	manifests := releaseutil.SplitManifests(all.String())
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	files := map[string]string{}
+	for _, k := range keys {
+		m := manifests[k]
+		source := snapshotSourceRegex.FindStringSubmatch(m)
+		if source == nil {
+			continue
+		}
+		files[source[1]] += fmt.Sprintf("---\n%s\n", m)
+	}
+	return files
+}
+
+// compare compares the files rendered for a scenario with their snapshots,
+// writing and removing snapshots if asked to.
+func (s *Snapshot) compare(scenario string, files map[string]string) (*SnapshotResult, error) {
+	dir := filepath.Join(s.Dir, scenario)
+	snapshots, err := readSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(files)+len(snapshots))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	for p := range snapshots {
+		if _, ok := files[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	result := &SnapshotResult{Scenario: scenario}
+	// index lists the snapshots left in the directory of the scenario
+	index := map[string]bool{}
+	for p := range snapshots {
+		index[p] = true
+	}
+	changed := false
+	for _, p := range paths {
+		rendered, isRendered := files[p]
+		snapshot, isSnapshot := snapshots[p]
+		var status SnapshotStatus
+		switch {
+		case !isSnapshot:
+			status = SnapshotAdded
+		case !isRendered:
+			status = SnapshotRemoved
+		case rendered != snapshot:
+			status = SnapshotModified
+		default:
+			result.Unchanged++
+			continue
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(snapshot),
+			B:        difflib.SplitLines(rendered),
+			FromFile: path.Join("snapshot", scenario, p),
+			ToFile:   path.Join("rendered", scenario, p),
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, SnapshotFile{Path: p, Status: status, Diff: diff})
+
+		file := filepath.Join(dir, filepath.FromSlash(p))
+		switch {
+		case status == SnapshotRemoved && s.Prune:
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			removeEmptyDirs(dir, filepath.Dir(file))
+			delete(index, p)
+			changed = true
+		case status != SnapshotRemoved && s.Update:
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return nil, err
+			}
+			if err := ioutil.WriteFile(file, []byte(rendered), 0644); err != nil {
+				return nil, err
+			}
+			index[p] = true
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := writeSnapshotIndex(dir, index); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// readSnapshots reads the snapshots listed in the index of a directory, keyed
+// by their path relative to it.
+func readSnapshots(dir string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, SnapshotIndexFile))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := map[string]string{}
+	for _, p := range strings.Split(string(data), "\n") {
+		if p == "" {
+			continue
+		}
+		// the index may have been edited, so the snapshots must be in the
+		// directory of the scenario
+		if path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, errors.Errorf("invalid snapshot path %q in %s", p, filepath.Join(dir, SnapshotIndexFile))
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			// a snapshot deleted by hand is reported as added
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read the snapshots in %s", dir)
+		}
+		snapshots[p] = string(content)
+	}
+	return snapshots, nil
+}
+
+// writeSnapshotIndex writes the index of the snapshots of a directory, or
+// removes it and the directory if there are no snapshots left.
+func writeSnapshotIndex(dir string, index map[string]bool) error {
+	file := filepath.Join(dir, SnapshotIndexFile)
+	if len(index) == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// only removed if nothing else is left in it
+		os.Remove(dir)
+		return nil
+	}
+	paths := make([]string, 0, len(index))
+	for p := range index {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(strings.Join(paths, "\n")+"\n"), 0644)
+}
+
+// removeEmptyDirs removes dir and its parents up to root, excluded, as long as
+// they are empty.
+func removeEmptyDirs(root, dir string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSnapshotChart(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"Chart.yaml":              "apiVersion: v2\nname: web\nversion: 0.1.0\n",
+		"values.yaml":             "replicas: 1\nextra: false\n",
+		"ci/prod-values.yaml":     "replicas: 3\nextra: true\n",
+		"templates/web.yaml":      "kind: Deployment\nmetadata:\n  name: {{ .Release.Name }}\nspec:\n  replicas: {{ .Values.replicas }}\n",
+		"templates/extra.yaml":    "{{- if .Values.extra }}\nkind: ConfigMap\nmetadata:\n  name: extra\n{{- end }}\n",
+		"templates/hook-job.yaml": "kind: Job\nmetadata:\n  name: migrate\n  annotations:\n    helm.sh/hook: pre-install\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func snapshotStatuses(results []*SnapshotResult) map[string]SnapshotStatus {
+	statuses := map[string]SnapshotStatus{}
+	for _, r := range results {
+		for _, f := range r.Files {
+			statuses[r.Scenario+"/"+f.Path] = f.Status
+		}
+	}
+	return statuses
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	chartDir := filepath.Join(dir, "web")
+	writeSnapshotChart(t, chartDir)
+
+	client := NewSnapshot(actionConfigFixture(t))
+	client.Dir = filepath.Join(dir, "snapshots")
+
+	// without snapshots, every file is added
+	results, err := client.Run(chartDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := snapshotStatuses(results)
+	expected := []string{
+		"default/web/templates/web.yaml",
+		"default/web/templates/hook-job.yaml",
+		"prod/web/templates/web.yaml",
+		"prod/web/templates/extra.yaml",
+		"prod/web/templates/hook-job.yaml",
+	}
+	if len(statuses) != len(expected) {
+		t.Errorf("expected %d added files, got %v", len(expected), statuses)
+	}
+	for _, f := range expected {
+		if statuses[f] != SnapshotAdded {
+			t.Errorf("expected %s to be added, got %q", f, statuses[f])
+		}
+	}
+	if _, err := os.Stat(client.Dir); !os.IsNotExist(err) {
+		t.Fatalf("expected no snapshots to be written without Update, got %v", err)
+	}
+
+	client.Update = true
+	if _, err := client.Run(chartDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := ioutil.ReadFile(filepath.Join(client.Dir, "prod", "web", "templates", "web.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "---\n# Source: web/templates/web.yaml\nkind: Deployment\nmetadata:\n  name: RELEASE-NAME\nspec:\n  replicas: 3\n"; string(snapshot) != expected {
+		t.Errorf("expected the snapshot\n%s\ngot\n%s", expected, snapshot)
+	}
+
+	client.Update = false
+	results, err = client.Run(chartDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if len(r.Files) != 0 {
+			t.Errorf("expected the scenario %s to match its snapshots, got %v", r.Scenario, r.Files)
+		}
+	}
+
+	// the command line values are merged under the values of the scenarios
+	if err := os.Remove(filepath.Join(chartDir, "ci", "prod-values.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	results, err = client.Run(chartDir, map[string]interface{}{"replicas": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses = snapshotStatuses(results)
+	if len(statuses) != 4 ||
+		statuses["default/web/templates/web.yaml"] != SnapshotModified ||
+		statuses["prod/web/templates/web.yaml"] != SnapshotRemoved ||
+		statuses["prod/web/templates/extra.yaml"] != SnapshotRemoved ||
+		statuses["prod/web/templates/hook-job.yaml"] != SnapshotRemoved {
+		t.Errorf("unexpected differences %v", statuses)
+	}
+	diff := results[0].Files[0].Diff
+	if !strings.Contains(diff, "--- snapshot/default/web/templates/web.yaml\n+++ rendered/default/web/templates/web.yaml\n") ||
+		!strings.Contains(diff, "-  replicas: 1\n+  replicas: 2\n") {
+		t.Errorf("unexpected diff\n%s", diff)
+	}
+
+	// updating the snapshots only writes them
+	client.Update = true
+	if _, err := client.Run(chartDir, map[string]interface{}{"replicas": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(client.Dir, "prod", "web", "templates", "web.yaml")); err != nil {
+		t.Errorf("expected the snapshots of the removed scenario to be kept without Prune, got %v", err)
+	}
+
+	client.Prune = true
+	if _, err := client.Run(chartDir, map[string]interface{}{"replicas": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(client.Dir, "prod")); !os.IsNotExist(err) {
+		t.Errorf("expected the snapshots of the removed scenario to be removed, got %v", err)
+	}
+}
+
+func TestSnapshot_PruneOnlyRemovesSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	chartDir := filepath.Join(dir, "web")
+	writeSnapshotChart(t, chartDir)
+
+	// the snapshots are written next to files Helm did not write
+	unrelated := []string{
+		"important/data.txt",
+		"default/notes.txt",
+		"default/web/templates/README.md",
+	}
+	for _, f := range unrelated {
+		file := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte("keep me\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := NewSnapshot(actionConfigFixture(t))
+	client.Dir = dir
+	client.Update = true
+	client.Prune = true
+	results, err := client.Run(chartDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f, status := range snapshotStatuses(results) {
+		if status != SnapshotAdded {
+			t.Errorf("expected %s to be added, got %q", f, status)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(chartDir, "ci", "prod-values.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(chartDir, "templates", "hook-job.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	results, err = client.Run(chartDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := snapshotStatuses(results)
+	expected := map[string]SnapshotStatus{
+		"default/web/templates/hook-job.yaml": SnapshotRemoved,
+		"prod/web/templates/web.yaml":         SnapshotRemoved,
+		"prod/web/templates/extra.yaml":       SnapshotRemoved,
+		"prod/web/templates/hook-job.yaml":    SnapshotRemoved,
+	}
+	if len(statuses) != len(expected) {
+		t.Errorf("expected the differences %v, got %v", expected, statuses)
+	}
+	for f, status := range expected {
+		if statuses[f] != status {
+			t.Errorf("expected %s to be %s, got %q", f, status, statuses[f])
+		}
+	}
+
+	for _, f := range unrelated {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+			t.Errorf("expected %s to be kept, got %v", f, err)
+		}
+	}
+	for _, f := range []string{"prod", "default/web/templates/hook-job.yaml"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f))); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", f, err)
+		}
+	}
+}
+
+func TestSnapshot_InvalidIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	chartDir := filepath.Join(dir, "web")
+	writeSnapshotChart(t, chartDir)
+
+	snapshotDir := filepath.Join(dir, "snapshots")
+	if err := os.MkdirAll(filepath.Join(snapshotDir, "default"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(snapshotDir, "default", SnapshotIndexFile)
+	if err := ioutil.WriteFile(index, []byte("../../web/Chart.yaml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewSnapshot(actionConfigFixture(t))
+	client.Dir = snapshotDir
+	client.Update = true
+	client.Prune = true
+	if _, err := client.Run(chartDir, nil); err == nil || !strings.Contains(err.Error(), `invalid snapshot path "../../web/Chart.yaml"`) {
+		t.Errorf("expected an invalid snapshot path error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chartDir, "Chart.yaml")); err != nil {
+		t.Errorf("expected Chart.yaml to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// StorageMigrate is the action for moving the release history from one
+// storage driver to another.
+type StorageMigrate struct {
+	cfg *Configuration
+
+	// From and To are the source and destination drivers, named as with
+	// HELM_DRIVER.
+	From string
+	To   string
+	// Namespace restricts the migration to the releases of a namespace. The
+	// releases of all namespaces are migrated when it is empty.
+	Namespace string
+	// DryRun lists the revisions that would be migrated without writing them.
+	DryRun bool
+	// Verify reads every migrated revision back from the destination and
+	// compares it with the source.
+	Verify bool
+	// Cleanup deletes the migrated revisions from the source once all of them
+	// have been migrated and verified.
+	Cleanup bool
+
+	// newDriver returns the driver named name for namespace.
+	newDriver func(name, namespace string) (driver.Driver, error)
+	// newLocker returns the Locker of the releases of a driver that does not
+	// lock them itself, or nil.
+	newLocker func(d driver.Driver, namespace string) driver.Locker
+}
+
+// NewStorageMigrate creates a new StorageMigrate object with the given configuration.
+func NewStorageMigrate(cfg *Configuration) *StorageMigrate {
+	return &StorageMigrate{
+		cfg:       cfg,
+		newDriver: cfg.StorageDriver,
+		newLocker: cfg.storageLocker,
+	}
+}
+
+// Run copies every revision of the selected releases from the source driver to
+// the destination driver. Revisions already present in the destination with
+// the same content are skipped. It returns the revisions that were migrated,
+// or that would be with DryRun.
+//
+// Each release is locked in the source while its revisions are copied, and
+// with Cleanup until they are deleted, so that no revision is written to the
+// source meanwhile.
+func (m *StorageMigrate) Run() ([]*release.Release, error) {
+	if m.From == m.To {
+		return nil, errors.Errorf("the source and destination drivers must be different, got %q", m.From)
+	}
+
+	source, err := m.newDriver(m.From, m.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	all, err := source.List(func(rls *release.Release) bool {
+		return m.Namespace == "" || rls.Namespace == m.Namespace
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list releases from the %s driver", m.From)
+	}
+	var releases []*release.Release
+	seen := map[string]bool{}
+	for _, rls := range all {
+		if id := rls.Namespace + "/" + rls.Name; !seen[id] {
+			seen[id] = true
+			releases = append(releases, rls)
+		}
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		a, b := releases[i], releases[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	sources := map[string]*storage.Storage{}
+	destinations := map[string]*storage.Storage{}
+	open := func(stores map[string]*storage.Storage, name, namespace string) (*storage.Storage, error) {
+		if s, ok := stores[namespace]; ok {
+			return s, nil
+		}
+		d, err := m.newDriver(name, namespace)
+		if err != nil {
+			return nil, err
+		}
+		s := storage.Init(d)
+		s.Log = m.cfg.Log
+		if s.Locker == nil {
+			s.Locker = m.newLocker(d, namespace)
+		}
+		stores[namespace] = s
+		return s, nil
+	}
+
+	// the releases to clean up stay locked until their revisions are deleted
+	type cleanup struct {
+		src       *storage.Storage
+		revisions []*release.Release
+		unlock    func()
+	}
+	var cleanups []cleanup
+	defer func() {
+		for _, c := range cleanups {
+			c.unlock()
+		}
+	}()
+
+	var migrated []*release.Release
+	for _, r := range releases {
+		src, err := open(sources, m.From, r.Namespace)
+		if err != nil {
+			return migrated, err
+		}
+		dst, err := open(destinations, m.To, r.Namespace)
+		if err != nil {
+			return migrated, err
+		}
+
+		unlock := func() {}
+		if !m.DryRun {
+			lock, err := src.LockRelease(r.Name)
+			if err != nil {
+				return migrated, err
+			}
+			unlock = func() {
+				if err := lock.Unlock(); err != nil {
+					m.cfg.Log("failed to unlock release %s/%s: %s", r.Namespace, r.Name, err)
+				}
+			}
+		}
+		// the history is read again once the release is locked
+		revisions, err := src.History(r.Name)
+		if err != nil {
+			unlock()
+			return migrated, errors.Wrapf(err, "failed to read the history of release %s/%s from the %s driver", r.Namespace, r.Name, m.From)
+		}
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version < revisions[j].Version })
+
+		copied, err := m.copyRevisions(dst, revisions)
+		migrated = append(migrated, copied...)
+		if err != nil {
+			unlock()
+			return migrated, err
+		}
+		if m.Cleanup && !m.DryRun {
+			cleanups = append(cleanups, cleanup{src: src, revisions: revisions, unlock: unlock})
+		} else {
+			unlock()
+		}
+	}
+
+	for _, c := range cleanups {
+		for _, rls := range c.revisions {
+			if _, err := c.src.Delete(rls.Name, rls.Version); err != nil {
+				return migrated, errors.Wrapf(err, "failed to delete revision %d of release %s/%s from the %s driver", rls.Version, rls.Namespace, rls.Name, m.From)
+			}
+		}
+	}
+	return migrated, nil
+}
+
+// copyRevisions copies the revisions of a release to the destination, returning
+// those that were copied, or that would be with DryRun.
+func (m *StorageMigrate) copyRevisions(dst *storage.Storage, revisions []*release.Release) ([]*release.Release, error) {
+	var migrated []*release.Release
+	for _, rls := range revisions {
+		existing, err := dst.Get(rls.Name, rls.Version)
+		switch {
+		case err == nil:
+			if equal, err := sameRelease(rls, existing); err != nil {
+				return migrated, err
+			} else if !equal {
+				return migrated, errors.Errorf("revision %d of release %s/%s already exists in the %s driver with a different content", rls.Version, rls.Namespace, rls.Name, m.To)
+			}
+			m.cfg.Log("skipping revision %d of release %s/%s: already migrated", rls.Version, rls.Namespace, rls.Name)
+			continue
+		case errors.Cause(err) != driver.ErrReleaseNotFound:
+			return migrated, errors.Wrapf(err, "failed to read revision %d of release %s/%s from the %s driver", rls.Version, rls.Namespace, rls.Name, m.To)
+		}
+
+		if m.DryRun {
+			migrated = append(migrated, rls)
+			continue
+		}
+		if err := dst.Create(rls); err != nil {
+			return migrated, errors.Wrapf(err, "failed to write revision %d of release %s/%s to the %s driver", rls.Version, rls.Namespace, rls.Name, m.To)
+		}
+		if m.Verify || m.Cleanup {
+			if err := verifyMigration(dst, rls); err != nil {
+				return migrated, errors.Wrapf(err, "verification of revision %d of release %s/%s failed", rls.Version, rls.Namespace, rls.Name)
+			}
+		}
+		migrated = append(migrated, rls)
+	}
+	return migrated, nil
+}
+
+// verifyMigration reads the release back from the destination and compares it
+// with the original.
+func verifyMigration(dst *storage.Storage, rls *release.Release) error {
+	stored, err := dst.Get(rls.Name, rls.Version)
+	if err != nil {
+		return err
+	}
+	equal, err := sameRelease(rls, stored)
+	if err != nil {
+		return err
+	}
+	if !equal {
+		return errors.New("the stored release differs from the source")
+	}
+	return nil
+}
+
+// sameRelease reports whether two releases have the same content and custom
+// labels. The labels set by the drivers are not compared, as they are derived
+// from the content.
+func sameRelease(a, b *release.Release) (bool, error) {
+	if !reflect.DeepEqual(driver.FilterSystemLabels(a.Labels), driver.FilterSystemLabels(b.Labels)) {
+		return false, nil
+	}
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(x, y), nil
+}
@@ -0,0 +1,237 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	gotime "time"
+
+	"github.com/stretchr/testify/assert"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// storageMigrateFixture returns a StorageMigrate between two file drivers,
+// "src" and "dst", the source holding two revisions of a release in the
+// default namespace and one in the spaced namespace.
+func storageMigrateFixture(t *testing.T) *StorageMigrate {
+	dir, err := ioutil.TempDir("", "helm-storage-migrate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	m := NewStorageMigrate(actionConfigFixture(t))
+	m.From, m.To = "src", "dst"
+	m.newDriver = func(name, namespace string) (driver.Driver, error) {
+		d, err := driver.NewFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		d.SetNamespace(namespace)
+		return d, nil
+	}
+
+	src := migrateStore(t, m, "src", "")
+	for _, rls := range []*release.Release{
+		namespacedReleaseStub("angry-panda", "default", 1, release.StatusSuperseded),
+		namespacedReleaseStub("angry-panda", "default", 2, release.StatusDeployed),
+		namespacedReleaseStub("sad-panda", "spaced", 1, release.StatusFailed),
+	} {
+		if err := src.Create(rls); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func namespacedReleaseStub(name, namespace string, version int, status release.Status) *release.Release {
+	rls := namedReleaseStub(name, status)
+	rls.Namespace = namespace
+	rls.Version = version
+	return rls
+}
+
+func migrateStore(t *testing.T, m *StorageMigrate, name, namespace string) *storage.Storage {
+	d, err := m.newDriver(name, namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage.Init(d)
+}
+
+func revisionsOf(t *testing.T, s *storage.Storage) []string {
+	all, err := s.ListReleases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revisions []string
+	for _, rls := range all {
+		revisions = append(revisions, fmt.Sprintf("%s/%s.v%d:%s", rls.Namespace, rls.Name, rls.Version, rls.Info.Status))
+	}
+	return revisions
+}
+
+func TestStorageMigrate(t *testing.T) {
+	is := assert.New(t)
+	m := storageMigrateFixture(t)
+	m.Verify = true
+
+	migrated, err := m.Run()
+	is.NoError(err)
+	is.Len(migrated, 3)
+
+	expected := []string{"default/angry-panda.v1:superseded", "default/angry-panda.v2:deployed", "spaced/sad-panda.v1:failed"}
+	is.ElementsMatch(expected, revisionsOf(t, migrateStore(t, m, "dst", "")))
+	is.ElementsMatch(expected, revisionsOf(t, migrateStore(t, m, "src", "")))
+
+	rls, err := migrateStore(t, m, "dst", "default").Get("angry-panda", 2)
+	is.NoError(err)
+	is.Equal("Named Release Stub", rls.Info.Description)
+
+	// migrating again skips the revisions already migrated
+	migrated, err = m.Run()
+	is.NoError(err)
+	is.Empty(migrated)
+}
+
+func TestStorageMigrate_Labels(t *testing.T) {
+	is := assert.New(t)
+	m := storageMigrateFixture(t)
+	m.Verify = true
+	labelled := namespacedReleaseStub("happy-panda", "default", 1, release.StatusDeployed)
+	labelled.Labels = map[string]string{"team": "guides"}
+	is.NoError(migrateStore(t, m, "src", "default").Create(labelled))
+
+	_, err := m.Run()
+	is.NoError(err)
+	rls, err := migrateStore(t, m, "dst", "default").Get("happy-panda", 1)
+	is.NoError(err)
+	is.Equal(map[string]string{"team": "guides"}, driver.FilterSystemLabels(rls.Labels))
+
+	// the revisions differing by their labels are not the same
+	relabelled := namespacedReleaseStub("happy-panda", "default", 2, release.StatusDeployed)
+	relabelled.Labels = map[string]string{"team": "guides"}
+	is.NoError(migrateStore(t, m, "src", "default").Create(relabelled))
+	relabelled.Labels = map[string]string{"team": "docs"}
+	is.NoError(migrateStore(t, m, "dst", "default").Create(relabelled))
+	_, err = m.Run()
+	is.EqualError(err, `revision 2 of release default/happy-panda already exists in the dst driver with a different content`)
+}
+
+func TestStorageMigrate_Locked(t *testing.T) {
+	is := assert.New(t)
+	m := storageMigrateFixture(t)
+	m.Cleanup = true
+
+	lock, err := migrateStore(t, m, "src", "default").LockRelease("angry-panda")
+	is.NoError(err)
+	_, err = m.Run()
+	is.True(errors.Is(err, driver.ErrLocked), "expected ErrLocked, got %v", err)
+	is.Len(revisionsOf(t, migrateStore(t, m, "src", "")), 3)
+	is.NoError(lock.Unlock())
+}
+
+// upgradingFile is a file driver on which a revision of a release is created
+// as its lock is acquired, as an upgrade racing the migration would.
+type upgradingFile struct {
+	*driver.File
+	upgrade func()
+}
+
+func (f *upgradingFile) AcquireLock(key, holder string, ttl gotime.Duration) error {
+	if f.upgrade != nil {
+		f.upgrade()
+		f.upgrade = nil
+	}
+	return f.File.AcquireLock(key, holder, ttl)
+}
+
+func TestStorageMigrate_CleanupRevisionsCreatedBeforeLocking(t *testing.T) {
+	is := assert.New(t)
+	m := storageMigrateFixture(t)
+	m.Namespace = "default"
+	m.Cleanup = true
+
+	newDriver := m.newDriver
+	m.newDriver = func(name, namespace string) (driver.Driver, error) {
+		d, err := newDriver(name, namespace)
+		if err != nil || name != "src" || namespace != "default" {
+			return d, err
+		}
+		return &upgradingFile{File: d.(*driver.File), upgrade: func() {
+			rls := namespacedReleaseStub("angry-panda", "default", 3, release.StatusDeployed)
+			is.NoError(migrateStore(t, m, "src", "default").Create(rls))
+		}}, nil
+	}
+
+	migrated, err := m.Run()
+	is.NoError(err)
+	is.Len(migrated, 3)
+	is.ElementsMatch([]string{"default/angry-panda.v1:superseded", "default/angry-panda.v2:deployed", "default/angry-panda.v3:deployed"}, revisionsOf(t, migrateStore(t, m, "dst", "")))
+	is.Equal([]string{"spaced/sad-panda.v1:failed"}, revisionsOf(t, migrateStore(t, m, "src", "")))
+}
+
+func TestStorageMigrate_DryRun(t *testing.T) {
+	is := assert.New(t)
+	m := storageMigrateFixture(t)
+	m.DryRun = true
+	m.Cleanup = true
+
+	migrated, err := m.Run()
+	is.NoError(err)
+	is.Len(migrated, 3)
+	is.Empty(revisionsOf(t, migrateStore(t, m, "dst", "")))
+	is.Len(revisionsOf(t, migrateStore(t, m, "src", "")), 3)
+}
+
+func TestStorageMigrate_Namespace(t *testing.T) {
+	is := assert.New(t)
+	m := storageMigrateFixture(t)
+	m.Namespace = "spaced"
+	m.Cleanup = true
+
+	migrated, err := m.Run()
+	is.NoError(err)
+	is.Len(migrated, 1)
+	is.Equal([]string{"spaced/sad-panda.v1:failed"}, revisionsOf(t, migrateStore(t, m, "dst", "")))
+	is.ElementsMatch([]string{"default/angry-panda.v1:superseded", "default/angry-panda.v2:deployed"}, revisionsOf(t, migrateStore(t, m, "src", "")))
+}
+
+func TestStorageMigrate_Conflict(t *testing.T) {
+	is := assert.New(t)
+	m := storageMigrateFixture(t)
+	m.Cleanup = true
+
+	conflicting := namespacedReleaseStub("angry-panda", "default", 2, release.StatusFailed)
+	is.NoError(migrateStore(t, m, "dst", "default").Create(conflicting))
+
+	_, err := m.Run()
+	is.EqualError(err, `revision 2 of release default/angry-panda already exists in the dst driver with a different content`)
+	is.Len(revisionsOf(t, migrateStore(t, m, "src", "")), 3)
+
+	m.To = "src"
+	_, err = m.Run()
+	is.EqualError(err, `the source and destination drivers must be different, got "src"`)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// StorageRekey is the action for re-encrypting the release history with the
+// current encryption key, after a key rotation or to encrypt the revisions
+// stored before encryption was enabled.
+type StorageRekey struct {
+	cfg *Configuration
+
+	// Driver is the storage driver of the releases, named as with
+	// HELM_DRIVER.
+	Driver string
+	// Namespace restricts the re-encryption to the releases of a namespace.
+	// The releases of all namespaces are re-encrypted when it is empty.
+	Namespace string
+	// DryRun lists the revisions that would be re-encrypted without writing
+	// them.
+	DryRun bool
+
+	// newDriver returns the driver named name for namespace.
+	newDriver func(name, namespace string) (driver.Driver, error)
+}
+
+// NewStorageRekey creates a new StorageRekey object with the given configuration.
+func NewStorageRekey(cfg *Configuration) *StorageRekey {
+	return &StorageRekey{
+		cfg:       cfg,
+		newDriver: cfg.StorageDriver,
+	}
+}
+
+// Run writes every revision of the selected releases back to the driver, which
+// encrypts them with its current key. It returns the revisions that were
+// re-encrypted, or that would be with DryRun.
+func (r *StorageRekey) Run() ([]*release.Release, error) {
+	d, err := r.newDriver(r.Driver, r.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := d.(driver.Encryptable); !ok {
+		return nil, errors.Errorf("the %s driver does not support encryption", d.Name())
+	}
+	revisions, err := d.List(func(rls *release.Release) bool {
+		return r.Namespace == "" || rls.Namespace == r.Namespace
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list releases from the %s driver", d.Name())
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		a, b := revisions[i], revisions[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	if r.DryRun {
+		return revisions, nil
+	}
+
+	stores := map[string]*storage.Storage{}
+	var rekeyed []*release.Release
+	for i := 0; i < len(revisions); {
+		ns, name := revisions[i].Namespace, revisions[i].Name
+		j := i + 1
+		for j < len(revisions) && revisions[j].Namespace == ns && revisions[j].Name == name {
+			j++
+		}
+		s, ok := stores[ns]
+		if !ok {
+			d, err := r.newDriver(r.Driver, ns)
+			if err != nil {
+				return rekeyed, err
+			}
+			s = storage.Init(d)
+			s.Log = r.cfg.Log
+			stores[ns] = s
+		}
+		done, err := r.rekeyRelease(s, revisions[i:j])
+		rekeyed = append(rekeyed, done...)
+		if err != nil {
+			return rekeyed, err
+		}
+		i = j
+	}
+	return rekeyed, nil
+}
+
+// rekeyRelease re-encrypts the revisions of a release and their charts under
+// its lock, so that they are not written concurrently by an upgrade.
+func (r *StorageRekey) rekeyRelease(s *storage.Storage, revisions []*release.Release) ([]*release.Release, error) {
+	name := revisions[0].Name
+	lock, err := s.LockRelease(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			r.cfg.Log("failed to unlock release %q: %s", name, err)
+		}
+	}()
+
+	var rekeyed []*release.Release
+	for _, listed := range revisions {
+		// the revision is read again as it may have changed since listed
+		rls, err := s.Get(name, listed.Version)
+		if errors.Cause(err) == driver.ErrReleaseNotFound {
+			continue
+		}
+		if err == nil {
+			err = s.Update(rls)
+		}
+		if err != nil {
+			return rekeyed, errors.Wrapf(err, "failed to re-encrypt revision %d of release %s/%s", listed.Version, listed.Namespace, name)
+		}
+		rekeyed = append(rekeyed, rls)
+	}
+	// the charts stored apart from the revisions are not written with them
+	if rekeyer, ok := s.Driver.(driver.ChartRekeyer); ok {
+		if err := rekeyer.RekeyCharts(rekeyed); err != nil {
+			return rekeyed, errors.Wrapf(err, "failed to re-encrypt the charts of release %s/%s", revisions[0].Namespace, name)
+		}
+	}
+	return rekeyed, nil
+}
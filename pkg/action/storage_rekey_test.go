@@ -0,0 +1,237 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"helm.sh/helm/v3/pkg/storage/encryption"
+)
+
+// writeKeys writes a keyfile holding keys with the given IDs.
+func writeKeys(t *testing.T, dir string, ids ...string) string {
+	var b strings.Builder
+	b.WriteString("keys:\n")
+	for _, id := range ids {
+		secret := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%32s", id)))
+		fmt.Fprintf(&b, "  - id: %q\n    secret: %s\n", id, secret)
+	}
+	path := filepath.Join(dir, "keys.yaml")
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStorageRekey(t *testing.T) {
+	is := assert.New(t)
+	dir, err := ioutil.TempDir("", "helm-storage-rekey-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// keyIDs are the keys of the file driver, and the first one encrypts
+	var keyIDs []string
+	newDriver := func(name, namespace string) (driver.Driver, error) {
+		d, err := driver.NewFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		d.SetNamespace(namespace)
+		if len(keyIDs) > 0 {
+			keys, err := encryption.LoadKeyfile(writeKeys(t, dir, keyIDs...))
+			if err != nil {
+				return nil, err
+			}
+			d.SetEncrypter(encryption.NewEnvelope(keys))
+		}
+		return d, nil
+	}
+	store := func(namespace string) *storage.Storage {
+		d, err := newDriver("releases", namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return storage.Init(d)
+	}
+	// keyOf returns the ID of the key encrypting a revision, read directly
+	// from its file
+	keyOf := func(namespace, name string, version int) string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "releases", namespace, fmt.Sprintf("sh.helm.release.v1.%s.v%d.json", name, version)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		const prefix = `"release":"sealed.v1:`
+		i := strings.Index(string(data), prefix)
+		if i < 0 {
+			return ""
+		}
+		encoded := string(data[i+len(prefix):])
+		sealed, err := base64.StdEncoding.DecodeString(encoded[:strings.Index(encoded, `"`)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := encryption.KeyID(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	// plain revisions, then a revision encrypted with the first key
+	is.NoError(store("default").Create(namespacedReleaseStub("angry-panda", "default", 1, release.StatusSuperseded)))
+	is.NoError(store("spaced").Create(namespacedReleaseStub("sad-panda", "spaced", 1, release.StatusFailed)))
+	keyIDs = []string{"first"}
+	is.NoError(store("default").Create(namespacedReleaseStub("angry-panda", "default", 2, release.StatusDeployed)))
+	is.Equal("", keyOf("default", "angry-panda", 1))
+	is.Equal("first", keyOf("default", "angry-panda", 2))
+
+	// rotate the key
+	keyIDs = []string{"second", "first"}
+	rekey := NewStorageRekey(actionConfigFixture(t))
+	rekey.Driver = "releases"
+	rekey.newDriver = newDriver
+
+	rekey.DryRun = true
+	rekeyed, err := rekey.Run()
+	is.NoError(err)
+	is.Len(rekeyed, 3)
+	is.Equal("first", keyOf("default", "angry-panda", 2))
+
+	rekey.DryRun = false
+	rekey.Namespace = "default"
+	rekeyed, err = rekey.Run()
+	is.NoError(err)
+	is.Len(rekeyed, 2)
+	is.Equal("second", keyOf("default", "angry-panda", 1))
+	is.Equal("second", keyOf("default", "angry-panda", 2))
+	is.Equal("", keyOf("spaced", "sad-panda", 1))
+
+	rekey.Namespace = ""
+	rekeyed, err = rekey.Run()
+	is.NoError(err)
+	is.Len(rekeyed, 3)
+	is.Equal("second", keyOf("spaced", "sad-panda", 1))
+
+	// the previous key can be removed
+	keyIDs = []string{"second"}
+	rls, err := store("default").Get("angry-panda", 2)
+	is.NoError(err)
+	is.Equal(release.StatusDeployed, rls.Info.Status)
+}
+
+func TestStorageRekeyUnsupportedDriver(t *testing.T) {
+	rekey := NewStorageRekey(actionConfigFixture(t))
+	rekey.newDriver = func(name, namespace string) (driver.Driver, error) {
+		return driver.NewMemory(), nil
+	}
+	_, err := rekey.Run()
+	assert.EqualError(t, err, "the Memory driver does not support encryption")
+}
+
+func TestStorageRekeySharedCharts(t *testing.T) {
+	is := assert.New(t)
+	dir, err := ioutil.TempDir("", "helm-storage-rekey-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var keyIDs []string
+	newDriver := func(name, namespace string) (driver.Driver, error) {
+		d, err := driver.NewFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		d.SetNamespace(namespace)
+		d.ShareCharts(true)
+		if len(keyIDs) > 0 {
+			keys, err := encryption.LoadKeyfile(writeKeys(t, dir, keyIDs...))
+			if err != nil {
+				return nil, err
+			}
+			d.SetEncrypter(encryption.NewEnvelope(keys))
+		}
+		return d, nil
+	}
+	// chartKeys returns the IDs of the keys encrypting the stored charts
+	chartKeys := func() []string {
+		files, err := ioutil.ReadDir(filepath.Join(dir, "releases", ".charts"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, f := range files {
+			data, err := ioutil.ReadFile(filepath.Join(dir, "releases", ".charts", f.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), "sealed.v1:") {
+				ids = append(ids, "")
+				continue
+			}
+			sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(data), "sealed.v1:"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := encryption.KeyID(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	d, err := newDriver("releases", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.Init(d)
+	is.NoError(store.Create(namespacedReleaseStub("angry-panda", "default", 1, release.StatusSuperseded)))
+	is.NoError(store.Create(namespacedReleaseStub("angry-panda", "default", 2, release.StatusDeployed)))
+	is.Equal([]string{""}, chartKeys())
+
+	keyIDs = []string{"first"}
+	rekey := NewStorageRekey(actionConfigFixture(t))
+	rekey.Driver = "releases"
+	rekey.newDriver = newDriver
+	rekeyed, err := rekey.Run()
+	is.NoError(err)
+	is.Len(rekeyed, 2)
+	is.Equal([]string{"first"}, chartKeys())
+
+	d, err = newDriver("releases", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rls, err := storage.Init(d).Get("angry-panda", 1)
+	is.NoError(err)
+	is.NotNil(rls.Chart)
+}
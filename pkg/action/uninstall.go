@@ -39,6 +39,9 @@ type Uninstall struct {
 	KeepHistory  bool
 	Timeout      time.Duration
 	Description  string
+
+	// lockHeld is set by the operations uninstalling a release they locked.
+	lockHeld bool
 }
 
 // NewUninstall creates a new Uninstall object with the given configuration.
@@ -67,6 +70,14 @@ func (u *Uninstall) Run(name string) (*release.UninstallReleaseResponse, error)
 		return nil, errors.Errorf("uninstall: Release name is invalid: %s", name)
 	}
 
+	if !u.lockHeld {
+		unlock, err := u.cfg.lockRelease(name)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
 	rels, err := u.cfg.Releases.History(name)
 	if err != nil {
 		return nil, errors.Wrapf(err, "uninstall: Release not loaded: %s", name)
@@ -202,7 +213,7 @@ func (u *Uninstall) deleteRelease(rel *release.Release) (string, []error) {
 		return "", []error{errors.Wrap(err, "unable to build kubernetes objects for delete")}
 	}
 	if len(resources) > 0 {
-		_, errs = u.cfg.KubeClient.Delete(resources)
+		_, errs = u.cfg.deleteResources(resources)
 	}
 	return kept, errs
 }
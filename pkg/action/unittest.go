@@ -0,0 +1,65 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/unittest"
+)
+
+// UnitTest is the action for running the unit tests of the templates of a
+// chart, without a cluster.
+//
+// It provides the implementation of 'helm unittest'.
+type UnitTest struct {
+	// UpdateSnapshots rewrites the snapshots that do not match rather than
+	// failing.
+	UpdateSnapshots bool
+}
+
+// NewUnitTest creates a new UnitTest object.
+func NewUnitTest() *UnitTest {
+	return &UnitTest{}
+}
+
+// Run runs the test suites of the chart in the given directory.
+func (u *UnitTest) Run(chartPath string) ([]*unittest.SuiteResult, error) {
+	// Guard: Error out if this is not a chart directory.
+	if _, err := os.Stat(filepath.Join(chartPath, "Chart.yaml")); err != nil {
+		return nil, errors.Wrap(err, "unable to check Chart.yaml file in chart")
+	}
+
+	suites, err := unittest.LoadSuites(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(suites) == 0 {
+		return nil, errors.Errorf("no test suites found matching %s", unittest.SuitesGlob)
+	}
+
+	runner := unittest.NewRunner(chartPath)
+	runner.UpdateSnapshots = u.UpdateSnapshots
+	results := make([]*unittest.SuiteResult, 0, len(suites))
+	for _, s := range suites {
+		results = append(results, runner.Run(s))
+	}
+	return results, nil
+}
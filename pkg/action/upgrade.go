@@ -75,6 +75,12 @@ type Upgrade struct {
 	//
 	// This should be used with caution.
 	Force bool
+	// ServerSide will, if set to `true`, send resources to the cluster with server-side apply
+	// instead of a client-side three-way merge patch.
+	ServerSide bool
+	// ForceConflicts will, if set to `true`, take ownership of fields managed by other field
+	// managers when using server-side apply.
+	ForceConflicts bool
 	// ResetValues will reset the values to the chart's built-ins rather than merging with existing.
 	ResetValues bool
 	// ReuseValues will re-use the user's last supplied values.
@@ -98,6 +104,21 @@ type Upgrade struct {
 	PostRenderer postrender.PostRenderer
 	// DisableOpenAPIValidation controls whether OpenAPI validation is enforced.
 	DisableOpenAPIValidation bool
+	// SkipHealthChecks skips the health checks declared by the chart. When
+	// they run and fail, the release is rolled back to its last successful
+	// revision.
+	SkipHealthChecks bool
+	// HealthCheckTimeout is the time given to the health checks to pass.
+	// Defaults to Timeout.
+	HealthCheckTimeout time.Duration
+	// ValuesFiles are the sources of the values, recorded in the audit record
+	// of the release.
+	ValuesFiles []string
+	// Labels are added to the custom labels of the release, or replace them
+	// with ResetLabels.
+	Labels map[string]string
+	// ResetLabels drops the custom labels of the previous revision.
+	ResetLabels bool
 }
 
 // NewUpgrade creates a new Upgrade object with the given configuration.
@@ -120,6 +141,19 @@ func (u *Upgrade) Run(name string, chart *chart.Chart, vals map[string]interface
 	if err := chartutil.ValidateReleaseName(name); err != nil {
 		return nil, errors.Errorf("release name is invalid: %s", name)
 	}
+
+	if err := validateLabels(u.Labels); err != nil {
+		return nil, err
+	}
+
+	if !u.DryRun {
+		unlock, err := u.cfg.lockRelease(name)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
 	u.cfg.Log("preparing upgrade for %s", name)
 	currentRelease, upgradedRelease, err := u.prepareUpgrade(name, chart, vals)
 	if err != nil {
@@ -216,6 +250,7 @@ func (u *Upgrade) prepareUpgrade(name string, chart *chart.Chart, vals map[strin
 	if err != nil {
 		return nil, nil, err
 	}
+	u.cfg.emit(Event{Type: EventRendered, Message: fmt.Sprintf("rendered chart %s with %d hooks", chart.Name(), len(hooks))})
 
 	// Store an upgraded release.
 	upgradedRelease := &release.Release{
@@ -228,10 +263,15 @@ func (u *Upgrade) prepareUpgrade(name string, chart *chart.Chart, vals map[strin
 			LastDeployed:  Timestamper(),
 			Status:        release.StatusPendingUpgrade,
 			Description:   "Preparing upgrade", // This should be overwritten later.
+			Audit:         u.cfg.audit(u.ValuesFiles),
 		},
 		Version:  revision,
 		Manifest: manifestDoc.String(),
 		Hooks:    hooks,
+		Labels:   u.Labels,
+	}
+	if !u.ResetLabels {
+		upgradedRelease.Labels = mergeCustomLabels(lastRelease.Labels, u.Labels)
 	}
 
 	if len(notesTxt) > 0 {
@@ -314,7 +354,7 @@ func (u *Upgrade) performUpgrade(originalRelease, upgradedRelease *release.Relea
 		u.cfg.Log("upgrade hooks disabled for %s", upgradedRelease.Name)
 	}
 
-	results, err := u.cfg.KubeClient.Update(current, target, u.Force)
+	results, err := u.cfg.updateResources(current, target, u.Force, applyOptions(u.ServerSide, u.ForceConflicts))
 	if err != nil {
 		u.cfg.recordRelease(originalRelease)
 		return u.failRelease(upgradedRelease, results.Created, err)
@@ -351,6 +391,16 @@ func (u *Upgrade) performUpgrade(originalRelease, upgradedRelease *release.Relea
 		}
 	}
 
+	if !u.SkipHealthChecks {
+		timeout := u.HealthCheckTimeout
+		if timeout == 0 {
+			timeout = u.Timeout
+		}
+		if err := u.cfg.runHealthChecks(upgradedRelease, target, timeout, u.DisableHooks); err != nil {
+			return u.failHealthChecks(upgradedRelease, err)
+		}
+	}
+
 	originalRelease.Info.Status = release.StatusSuperseded
 	u.cfg.recordRelease(originalRelease)
 
@@ -371,9 +421,12 @@ func (u *Upgrade) failRelease(rel *release.Release, created kube.ResourceList, e
 	rel.Info.Status = release.StatusFailed
 	rel.Info.Description = msg
 	u.cfg.recordRelease(rel)
+	if !u.DisableHooks {
+		u.cfg.execFailureHook(rel, release.HookPostUpgradeFailure, u.Timeout)
+	}
 	if u.CleanupOnFail && len(created) > 0 {
 		u.cfg.Log("Cleanup on fail set, cleaning up %d resources", len(created))
-		_, errs := u.cfg.KubeClient.Delete(created)
+		_, errs := u.cfg.deleteResources(created)
 		if errs != nil {
 			var errorList []string
 			for _, e := range errs {
@@ -385,37 +438,8 @@ func (u *Upgrade) failRelease(rel *release.Release, created kube.ResourceList, e
 	}
 	if u.Atomic {
 		u.cfg.Log("Upgrade failed and atomic is set, rolling back to last successful release")
-
-		// As a protection, get the last successful release before rollback.
-		// If there are no successful releases, bail out
-		hist := NewHistory(u.cfg)
-		fullHistory, herr := hist.Run(rel.Name)
-		if herr != nil {
-			return rel, errors.Wrapf(herr, "an error occurred while finding last successful release. original upgrade error: %s", err)
-		}
-
-		// There isn't a way to tell if a previous release was successful, but
-		// generally failed releases do not get superseded unless the next
-		// release is successful, so this should be relatively safe
-		filteredHistory := releaseutil.FilterFunc(func(r *release.Release) bool {
-			return r.Info.Status == release.StatusSuperseded || r.Info.Status == release.StatusDeployed
-		}).Filter(fullHistory)
-		if len(filteredHistory) == 0 {
-			return rel, errors.Wrap(err, "unable to find a previously successful release when attempting to rollback. original upgrade error")
-		}
-
-		releaseutil.Reverse(filteredHistory, releaseutil.SortByRevision)
-
-		rollin := NewRollback(u.cfg)
-		rollin.Version = filteredHistory[0].Version
-		rollin.Wait = true
-		rollin.WaitForJobs = u.WaitForJobs
-		rollin.DisableHooks = u.DisableHooks
-		rollin.Recreate = u.Recreate
-		rollin.Force = u.Force
-		rollin.Timeout = u.Timeout
-		if rollErr := rollin.Run(rel.Name); rollErr != nil {
-			return rel, errors.Wrapf(rollErr, "an error occurred while rolling back the release. original upgrade error: %s", err)
+		if rerr := u.rollbackToLastSuccessful(rel, "", err); rerr != nil {
+			return rel, rerr
 		}
 		return rel, errors.Wrapf(err, "release %s failed, and has been rolled back due to atomic being set", rel.Name)
 	}
@@ -423,6 +447,71 @@ func (u *Upgrade) failRelease(rel *release.Release, created kube.ResourceList, e
 	return rel, err
 }
 
+// failHealthChecks marks the release as failed because its health checks did
+// not pass and rolls it back to its last successful revision.
+func (u *Upgrade) failHealthChecks(rel *release.Release, err error) (*release.Release, error) {
+	msg := fmt.Sprintf("Upgrade %q failed health checks: %s", rel.Name, err)
+	u.cfg.Log("warning: %s", msg)
+
+	rel.Info.Status = release.StatusFailed
+	rel.Info.Description = msg
+	u.cfg.recordRelease(rel)
+	if !u.DisableHooks {
+		u.cfg.execFailureHook(rel, release.HookPostUpgradeFailure, u.Timeout)
+	}
+
+	u.cfg.Log("Health checks failed, rolling back to last successful release")
+	reason := fmt.Sprintf("revision %d failed health checks", rel.Version)
+	if rerr := u.rollbackToLastSuccessful(rel, reason, err); rerr != nil {
+		return rel, rerr
+	}
+	return rel, errors.Wrapf(err, "release %s failed health checks, and has been rolled back", rel.Name)
+}
+
+// rollbackToLastSuccessful rolls the failed release back to its last
+// successful revision. The reason, if any, is recorded in the description of
+// the rolled back revision. err is the error that made the release fail.
+func (u *Upgrade) rollbackToLastSuccessful(rel *release.Release, reason string, err error) error {
+	// As a protection, get the last successful release before rollback.
+	// If there are no successful releases, bail out
+	hist := NewHistory(u.cfg)
+	fullHistory, herr := hist.Run(rel.Name)
+	if herr != nil {
+		return errors.Wrapf(herr, "an error occurred while finding last successful release. original upgrade error: %s", err)
+	}
+
+	// There isn't a way to tell if a previous release was successful, but
+	// generally failed releases do not get superseded unless the next
+	// release is successful, so this should be relatively safe
+	filteredHistory := releaseutil.FilterFunc(func(r *release.Release) bool {
+		return r.Info.Status == release.StatusSuperseded || r.Info.Status == release.StatusDeployed
+	}).Filter(fullHistory)
+	if len(filteredHistory) == 0 {
+		return errors.Wrap(err, "unable to find a previously successful release when attempting to rollback. original upgrade error")
+	}
+
+	releaseutil.Reverse(filteredHistory, releaseutil.SortByRevision)
+
+	rollin := NewRollback(u.cfg)
+	rollin.Version = filteredHistory[0].Version
+	rollin.Wait = true
+	rollin.WaitForJobs = u.WaitForJobs
+	rollin.DisableHooks = u.DisableHooks
+	rollin.Recreate = u.Recreate
+	rollin.Force = u.Force
+	rollin.ServerSide = u.ServerSide
+	rollin.ForceConflicts = u.ForceConflicts
+	rollin.Timeout = u.Timeout
+	rollin.lockHeld = true
+	if reason != "" {
+		rollin.Description = fmt.Sprintf("Rollback to %d: %s", rollin.Version, reason)
+	}
+	if rollErr := rollin.Run(rel.Name); rollErr != nil {
+		return errors.Wrapf(rollErr, "an error occurred while rolling back the release. original upgrade error: %s", err)
+	}
+	return nil
+}
+
 // reuseValues copies values from the current release to a new release if the
 // new release does not have any values.
 //
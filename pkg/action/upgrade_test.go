@@ -17,6 +17,7 @@ limitations under the License.
 package action
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -25,8 +26,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"helm.sh/helm/v3/pkg/kube"
 	kubefake "helm.sh/helm/v3/pkg/kube/fake"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"helm.sh/helm/v3/pkg/time"
 )
 
@@ -296,3 +300,198 @@ func TestUpgradeRelease_Pending(t *testing.T) {
 	_, err := upAction.Run(rel.Name, buildChart(), vals)
 	req.Contains(err.Error(), "progress", err)
 }
+
+func TestUpgradeRelease_ServerSide(t *testing.T) {
+	t.Run("succeeds with server-side apply", func(t *testing.T) {
+		is := assert.New(t)
+		req := require.New(t)
+
+		upAction := upgradeAction(t)
+		rel := releaseStub()
+		rel.Name = "come-apply-away"
+		rel.Info.Status = release.StatusDeployed
+		upAction.cfg.Releases.Create(rel)
+		upAction.ServerSide = true
+
+		res, err := upAction.Run(rel.Name, buildChart(), map[string]interface{}{})
+		req.NoError(err)
+		is.Equal(release.StatusDeployed, res.Info.Status)
+	})
+
+	t.Run("reports field conflicts", func(t *testing.T) {
+		is := assert.New(t)
+		req := require.New(t)
+
+		upAction := upgradeAction(t)
+		rel := releaseStub()
+		rel.Name = "come-fail-away"
+		rel.Info.Status = release.StatusDeployed
+		upAction.cfg.Releases.Create(rel)
+
+		failer := upAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+		failer.UpdateError = &kube.ConflictError{
+			Kind:      "ConfigMap",
+			Name:      "settings",
+			Conflicts: []kube.FieldConflict{{Manager: "kubectl-edit", Field: ".data.color"}},
+		}
+		upAction.ServerSide = true
+
+		res, err := upAction.Run(rel.Name, buildChart(), map[string]interface{}{})
+		req.Error(err)
+		var conflict *kube.ConflictError
+		is.True(errors.As(err, &conflict))
+		is.Contains(res.Info.Description, `.data.color (owned by "kubectl-edit")`)
+		is.Equal(release.StatusFailed, res.Info.Status)
+	})
+
+	t.Run("cannot be combined with force", func(t *testing.T) {
+		is := assert.New(t)
+
+		upAction := upgradeAction(t)
+		rel := releaseStub()
+		rel.Name = "come-force-away"
+		rel.Info.Status = release.StatusDeployed
+		upAction.cfg.Releases.Create(rel)
+		upAction.ServerSide = true
+		upAction.Force = true
+
+		_, err := upAction.Run(rel.Name, buildChart(), map[string]interface{}{})
+		is.Contains(err.Error(), errServerSideWithForce.Error())
+	})
+
+	t.Run("requires client support", func(t *testing.T) {
+		is := assert.New(t)
+
+		upAction := upgradeAction(t)
+		rel := releaseStub()
+		rel.Name = "come-unsupported-away"
+		rel.Info.Status = release.StatusDeployed
+		upAction.cfg.Releases.Create(rel)
+		upAction.cfg.KubeClient = struct{ kube.Interface }{upAction.cfg.KubeClient}
+		upAction.ServerSide = true
+
+		_, err := upAction.Run(rel.Name, buildChart(), map[string]interface{}{})
+		is.Contains(err.Error(), "server-side apply is not supported")
+	})
+}
+
+func TestUpgradeRelease_Locked(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	upAction := upgradeAction(t)
+	rel := releaseStub()
+	rel.Name = "come-lock-away"
+	rel.Info.Status = release.StatusDeployed
+	upAction.cfg.Releases.Create(rel)
+
+	other := storage.Init(upAction.cfg.Releases.Driver)
+	other.LockHolder = "ci/2"
+	lock, err := other.LockRelease(rel.Name)
+	req.NoError(err)
+
+	_, err = upAction.Run(rel.Name, buildChart(), map[string]interface{}{})
+	req.Error(err)
+	is.True(errors.Is(err, driver.ErrLocked))
+	is.Contains(err.Error(), `"ci/2/`)
+
+	req.NoError(lock.Unlock())
+	res, err := upAction.Run(rel.Name, buildChart(), map[string]interface{}{})
+	req.NoError(err)
+	is.Equal(release.StatusDeployed, res.Info.Status)
+
+	// The lock is released once the upgrade is done.
+	_, err = upAction.cfg.Releases.GetReleaseLock(rel.Name)
+	is.Equal(driver.ErrLockNotFound, err)
+
+	// Another operation sharing the configuration cannot upgrade the release
+	// while it is locked.
+	lock, err = upAction.cfg.Releases.LockRelease(rel.Name)
+	req.NoError(err)
+	_, err = upAction.Run(rel.Name, buildChart(), map[string]interface{}{})
+	is.True(errors.Is(err, driver.ErrLocked))
+	req.NoError(lock.Unlock())
+}
+
+var manifestWithHealthCheck = `kind: ConfigMap
+metadata:
+  name: smoke-test
+  annotations:
+    "helm.sh/hook": health-check
+data:
+  name: value`
+
+func TestUpgradeRelease_HealthChecks(t *testing.T) {
+	healthCheckedChart := func() *chart.Chart {
+		ch := buildChart()
+		ch.Templates = []*chart.File{
+			{Name: "templates/hello", Data: []byte("hello: world")},
+			{Name: "templates/health", Data: []byte(manifestWithHealthCheck)},
+		}
+		return ch
+	}
+
+	t.Run("failed health checks roll back", func(t *testing.T) {
+		is := assert.New(t)
+		req := require.New(t)
+
+		upAction := upgradeAction(t)
+		rel := releaseStub()
+		rel.Name = "checked"
+		upAction.cfg.Releases.Create(rel)
+
+		failer := upAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+		failer.WatchUntilReadyError = fmt.Errorf("smoke test failed")
+		upAction.cfg.KubeClient = failer
+
+		res, err := upAction.Run(rel.Name, healthCheckedChart(), map[string]interface{}{})
+		req.Error(err)
+		is.Contains(err.Error(), "smoke test failed")
+		is.Contains(err.Error(), "failed health checks, and has been rolled back")
+		is.Equal(release.StatusFailed, res.Info.Status)
+		is.Contains(res.Info.Description, `Upgrade "checked" failed health checks`)
+
+		rolledBack, err := upAction.cfg.Releases.Get(rel.Name, 3)
+		req.NoError(err)
+		is.Equal(release.StatusDeployed, rolledBack.Info.Status)
+		is.Equal("Rollback to 1: revision 2 failed health checks", rolledBack.Info.Description)
+	})
+
+	t.Run("skipped health checks", func(t *testing.T) {
+		is := assert.New(t)
+		req := require.New(t)
+
+		upAction := upgradeAction(t)
+		rel := releaseStub()
+		rel.Name = "unchecked"
+		upAction.cfg.Releases.Create(rel)
+
+		failer := upAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+		failer.WatchUntilReadyError = fmt.Errorf("smoke test failed")
+		upAction.cfg.KubeClient = failer
+		upAction.SkipHealthChecks = true
+
+		res, err := upAction.Run(rel.Name, healthCheckedChart(), map[string]interface{}{})
+		req.NoError(err)
+		is.Equal(release.StatusDeployed, res.Info.Status)
+	})
+
+	t.Run("disabled hooks skip the health-check hooks", func(t *testing.T) {
+		is := assert.New(t)
+		req := require.New(t)
+
+		upAction := upgradeAction(t)
+		rel := releaseStub()
+		rel.Name = "unhooked"
+		upAction.cfg.Releases.Create(rel)
+
+		failer := upAction.cfg.KubeClient.(*kubefake.FailingKubeClient)
+		failer.WatchUntilReadyError = fmt.Errorf("smoke test failed")
+		upAction.cfg.KubeClient = failer
+		upAction.DisableHooks = true
+
+		res, err := upAction.Run(rel.Name, healthCheckedChart(), map[string]interface{}{})
+		req.NoError(err)
+		is.Equal(release.StatusDeployed, res.Info.Status)
+	})
+}
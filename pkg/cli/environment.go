@@ -68,12 +68,16 @@ type EnvSettings struct {
 	PluginsDirectory string
 	// MaxHistory is the max release history maintained.
 	MaxHistory int
+	// HistoryRetention is the retention policy of the release history, as
+	// parsed by storage.ParseRetentionPolicy.
+	HistoryRetention string
 }
 
 func New() *EnvSettings {
 	env := &EnvSettings{
 		namespace:        os.Getenv("HELM_NAMESPACE"),
 		MaxHistory:       envIntOr("HELM_MAX_HISTORY", defaultMaxHistory),
+		HistoryRetention: os.Getenv("HELM_HISTORY_RETENTION"),
 		KubeContext:      os.Getenv("HELM_KUBECONTEXT"),
 		KubeToken:        os.Getenv("HELM_KUBETOKEN"),
 		KubeAsUser:       os.Getenv("HELM_KUBEASUSER"),
@@ -157,6 +161,7 @@ func (s *EnvSettings) EnvVars() map[string]string {
 		"HELM_REPOSITORY_CONFIG": s.RepositoryConfig,
 		"HELM_NAMESPACE":         s.Namespace(),
 		"HELM_MAX_HISTORY":       strconv.Itoa(s.MaxHistory),
+		"HELM_HISTORY_RETENTION": s.HistoryRetention,
 
 		// broken, these are populated from helm flags and not kubeconfig.
 		"HELM_KUBECONTEXT":   s.KubeContext,
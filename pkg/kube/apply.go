@@ -0,0 +1,172 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// DefaultFieldManager is the field manager used by Helm for server-side apply
+// when none is given.
+const DefaultFieldManager = "helm"
+
+// ApplyOptions configures how resources are sent to the API server when using
+// server-side apply.
+type ApplyOptions struct {
+	// FieldManager is the name recorded as the owner of the applied fields.
+	// Defaults to DefaultFieldManager.
+	FieldManager string
+	// ForceConflicts takes ownership of fields currently owned by other field
+	// managers instead of failing with a ConflictError.
+	ForceConflicts bool
+}
+
+func (o ApplyOptions) fieldManager() string {
+	if o.FieldManager == "" {
+		return DefaultFieldManager
+	}
+	return o.FieldManager
+}
+
+// FieldConflict describes a single field whose ownership is claimed by
+// another field manager.
+type FieldConflict struct {
+	// Manager is the field manager that currently owns the field.
+	Manager string `json:"manager,omitempty"`
+	// Field is the path of the conflicting field, e.g. ".spec.replicas".
+	Field string `json:"field"`
+	// Message is the message returned by the API server.
+	Message string `json:"message"`
+}
+
+// ConflictError is returned when the API server rejects a server-side apply
+// because fields of the applied configuration are owned by other managers.
+type ConflictError struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Conflicts []FieldConflict
+
+	err error
+}
+
+func (e *ConflictError) Error() string {
+	fields := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		if c.Manager != "" {
+			fields = append(fields, fmt.Sprintf("%s (owned by %q)", c.Field, c.Manager))
+		} else {
+			fields = append(fields, c.Field)
+		}
+	}
+	target := fmt.Sprintf("%s %q", e.Kind, e.Name)
+	if e.Namespace != "" {
+		target += fmt.Sprintf(" in namespace %q", e.Namespace)
+	}
+	if len(fields) == 0 {
+		return fmt.Sprintf("conflict applying %s: %v", target, e.err)
+	}
+	return fmt.Sprintf("conflict applying %s: %s", target, strings.Join(fields, ", "))
+}
+
+// Unwrap returns the error reported by the API server.
+func (e *ConflictError) Unwrap() error { return e.err }
+
+// Cause returns the error reported by the API server.
+func (e *ConflictError) Cause() error { return e.err }
+
+var conflictManagerRegexp = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+// newConflictError extracts the field conflicts from an apply error returned
+// by the API server.
+func newConflictError(info *resource.Info, err error) *ConflictError {
+	ce := &ConflictError{
+		Kind:      info.Mapping.GroupVersionKind.Kind,
+		Name:      info.Name,
+		Namespace: info.Namespace,
+		err:       err,
+	}
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return ce
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		c := FieldConflict{Field: cause.Field, Message: cause.Message}
+		if m := conflictManagerRegexp.FindStringSubmatch(cause.Message); m != nil {
+			c.Manager = m[1]
+		}
+		ce.Conflicts = append(ce.Conflicts, c)
+	}
+	return ce
+}
+
+// applyResource sends the target object to the API server as a server-side
+// apply patch, creating the resource if it does not exist yet.
+func applyResource(info *resource.Info, opts ApplyOptions) error {
+	data, err := json.Marshal(info.Object)
+	if err != nil {
+		return errors.Wrap(err, "serializing target configuration")
+	}
+	helper := resource.NewHelper(info.Client, info.Mapping).WithFieldManager(opts.fieldManager())
+	force := opts.ForceConflicts
+	obj, err := helper.Patch(info.Namespace, info.Name, types.ApplyPatchType, data, &metav1.PatchOptions{Force: &force})
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			return newConflictError(info, err)
+		}
+		return errors.Wrapf(err, "cannot apply %q with kind %s", info.Name, info.Mapping.GroupVersionKind.Kind)
+	}
+	return info.Refresh(obj, true)
+}
+
+// CreateServerSide creates Kubernetes resources specified in the resource list
+// using server-side apply.
+func (c *Client) CreateServerSide(resources ResourceList, opts ApplyOptions) (*Result, error) {
+	c.Log("applying %d resource(s) as %q", len(resources), opts.fieldManager())
+	if err := perform(resources, func(info *resource.Info) error {
+		return applyResource(info, opts)
+	}); err != nil {
+		return nil, err
+	}
+	return &Result{Created: resources}, nil
+}
+
+// UpdateServerSide behaves like Update, but sends the target configuration
+// with server-side apply instead of computing a three-way merge patch. Fields
+// owned by other field managers are left untouched unless they are part of
+// the target configuration, in which case a *ConflictError is returned unless
+// opts.ForceConflicts is set.
+func (c *Client) UpdateServerSide(original, target ResourceList, opts ApplyOptions) (*Result, error) {
+	apply := func(info *resource.Info) error {
+		return applyResource(info, opts)
+	}
+	return c.update(original, target, apply, func(info *resource.Info, _ *resource.Info) error {
+		return apply(info)
+	})
+}
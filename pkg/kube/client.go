@@ -61,6 +61,9 @@ type Client struct {
 	Log     func(string, ...interface{})
 	// Namespace allows to bypass the kubeconfig file for the choice of the namespace
 	Namespace string
+	// ReadinessObserver, if set, is called while waiting for resources each
+	// time the readiness of a resource changes.
+	ReadinessObserver func(ResourceReadiness)
 
 	kubeClient *kubernetes.Clientset
 }
@@ -133,9 +136,10 @@ func (c *Client) Wait(resources ResourceList, timeout time.Duration) error {
 		return err
 	}
 	w := waiter{
-		c:       cs,
-		log:     c.Log,
-		timeout: timeout,
+		c:        cs,
+		log:      c.Log,
+		timeout:  timeout,
+		observer: c.ReadinessObserver,
 	}
 	return w.waitForResources(resources, false)
 }
@@ -147,9 +151,10 @@ func (c *Client) WaitWithJobs(resources ResourceList, timeout time.Duration) err
 		return err
 	}
 	w := waiter{
-		c:       cs,
-		log:     c.Log,
-		timeout: timeout,
+		c:        cs,
+		log:      c.Log,
+		timeout:  timeout,
+		observer: c.ReadinessObserver,
 	}
 	return w.waitForResources(resources, true)
 }
@@ -195,7 +200,16 @@ func (c *Client) Build(reader io.Reader, validate bool) (ResourceList, error) {
 // resource updates, creations, and deletions that were attempted. These can be
 // used for cleanup or other logging purposes.
 func (c *Client) Update(original, target ResourceList, force bool) (*Result, error) {
-	updateErrors := []string{}
+	return c.update(original, target, createResource, func(info, originalInfo *resource.Info) error {
+		return updateResource(c, info, originalInfo.Object, force)
+	})
+}
+
+// update walks the target resources, calling create for those missing from
+// the cluster and update for those already owned by the original list, and
+// then deletes what is no longer part of the target.
+func (c *Client) update(original, target ResourceList, create func(*resource.Info) error, update func(info, originalInfo *resource.Info) error) (*Result, error) {
+	updateErrors := []error{}
 	res := &Result{}
 
 	c.Log("checking %d resources for changes", len(target))
@@ -214,7 +228,7 @@ func (c *Client) Update(original, target ResourceList, force bool) (*Result, err
 			res.Created = append(res.Created, info)
 
 			// Since the resource does not exist, create it.
-			if err := createResource(info); err != nil {
+			if err := create(info); err != nil {
 				return errors.Wrap(err, "failed to create resource")
 			}
 
@@ -229,9 +243,9 @@ func (c *Client) Update(original, target ResourceList, force bool) (*Result, err
 			return errors.Errorf("no %s with the name %q found", kind, info.Name)
 		}
 
-		if err := updateResource(c, info, originalInfo.Object, force); err != nil {
+		if err := update(info, originalInfo); err != nil {
 			c.Log("error updating the resource %q:\n\t %v", info.Name, err)
-			updateErrors = append(updateErrors, err.Error())
+			updateErrors = append(updateErrors, err)
 		}
 		// Because we check for errors later, append the info regardless
 		res.Updated = append(res.Updated, info)
@@ -242,8 +256,14 @@ func (c *Client) Update(original, target ResourceList, force bool) (*Result, err
 	switch {
 	case err != nil:
 		return res, err
+	case len(updateErrors) == 1:
+		return res, updateErrors[0]
 	case len(updateErrors) != 0:
-		return res, errors.Errorf(strings.Join(updateErrors, " && "))
+		msgs := make([]string, 0, len(updateErrors))
+		for _, e := range updateErrors {
+			msgs = append(msgs, e.Error())
+		}
+		return res, errors.Errorf(strings.Join(msgs, " && "))
 	}
 
 	for _, info := range original.Difference(target) {
@@ -27,6 +27,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest/fake"
@@ -214,6 +215,150 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestUpdateServerSide(t *testing.T) {
+	listA := newPodList("starfish", "squid")
+	listB := newPodList("starfish", "dolphin")
+
+	var actions []string
+
+	c := newTestClient(t)
+	c.Factory.(*cmdtesting.TestFactory).UnstructuredClient = &fake.RESTClient{
+		NegotiatedSerializer: unstructuredSerializer,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			p, m := req.URL.Path, req.Method
+			actions = append(actions, p+":"+m)
+			t.Logf("got request %s %s", p, m)
+			if m == "PATCH" {
+				if ct := req.Header.Get("Content-Type"); ct != string(types.ApplyPatchType) {
+					t.Errorf("expected content type %q, got %q", types.ApplyPatchType, ct)
+				}
+				if fm := req.URL.Query().Get("fieldManager"); fm != DefaultFieldManager {
+					t.Errorf("expected field manager %q, got %q", DefaultFieldManager, fm)
+				}
+				if force := req.URL.Query().Get("force"); force != "true" {
+					t.Errorf("expected force to be set, got %q", force)
+				}
+			}
+			switch {
+			case p == "/namespaces/default/pods/starfish" && m == "GET":
+				return newResponse(200, &listA.Items[0])
+			case p == "/namespaces/default/pods/starfish" && m == "PATCH":
+				return newResponse(200, &listB.Items[0])
+			case p == "/namespaces/default/pods/dolphin" && m == "GET":
+				return newResponse(404, notFoundBody())
+			case p == "/namespaces/default/pods/dolphin" && m == "PATCH":
+				return newResponse(200, &listB.Items[1])
+			case p == "/namespaces/default/pods/squid" && m == "GET":
+				return newResponse(200, &listA.Items[1])
+			case p == "/namespaces/default/pods/squid" && m == "DELETE":
+				return newResponse(200, &listA.Items[1])
+			default:
+				t.Fatalf("unexpected request: %s %s", req.Method, req.URL.Path)
+				return nil, nil
+			}
+		}),
+	}
+	first, err := c.Build(objBody(&listA), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Build(objBody(&listB), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.UpdateServerSide(first, second, ApplyOptions{ForceConflicts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Created) != 1 {
+		t.Errorf("expected 1 resource created, got %d", len(result.Created))
+	}
+	if len(result.Updated) != 1 {
+		t.Errorf("expected 1 resource updated, got %d", len(result.Updated))
+	}
+	if len(result.Deleted) != 1 {
+		t.Errorf("expected 1 resource deleted, got %d", len(result.Deleted))
+	}
+
+	expectedActions := []string{
+		"/namespaces/default/pods/starfish:GET",
+		"/namespaces/default/pods/starfish:PATCH",
+		"/namespaces/default/pods/dolphin:GET",
+		"/namespaces/default/pods/dolphin:PATCH",
+		"/namespaces/default/pods/squid:GET",
+		"/namespaces/default/pods/squid:DELETE",
+	}
+	if len(expectedActions) != len(actions) {
+		t.Fatalf("unexpected number of requests, expected %d, got %d: %v", len(expectedActions), len(actions), actions)
+	}
+	for k, v := range expectedActions {
+		if actions[k] != v {
+			t.Errorf("expected %s request got %s", v, actions[k])
+		}
+	}
+}
+
+func TestUpdateServerSideConflict(t *testing.T) {
+	list := newPodList("starfish")
+	conflict := &metav1.Status{
+		Code:    http.StatusConflict,
+		Status:  metav1.StatusFailure,
+		Reason:  metav1.StatusReasonConflict,
+		Message: "Apply failed with 1 conflict: conflict with \"kubectl-edit\" using v1: .spec.containers[name=\"app:v4\"].image",
+		Details: &metav1.StatusDetails{
+			Causes: []metav1.StatusCause{{
+				Type:    metav1.CauseTypeFieldManagerConflict,
+				Message: "conflict with \"kubectl-edit\" using v1",
+				Field:   ".spec.containers[name=\"app:v4\"].image",
+			}},
+		},
+	}
+
+	c := newTestClient(t)
+	c.Factory.(*cmdtesting.TestFactory).UnstructuredClient = &fake.RESTClient{
+		NegotiatedSerializer: unstructuredSerializer,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			p, m := req.URL.Path, req.Method
+			switch {
+			case p == "/namespaces/default/pods/starfish" && m == "GET":
+				return newResponse(200, &list.Items[0])
+			case p == "/namespaces/default/pods/starfish" && m == "PATCH":
+				if force := req.URL.Query().Get("force"); force != "false" {
+					t.Errorf("expected force to be unset, got %q", force)
+				}
+				return newResponse(http.StatusConflict, conflict)
+			default:
+				t.Fatalf("unexpected request: %s %s", req.Method, req.URL.Path)
+				return nil, nil
+			}
+		}),
+	}
+	resources, err := c.Build(objBody(&list), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.UpdateServerSide(resources, resources, ApplyOptions{})
+	ce, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("expected a *ConflictError, got %T: %v", err, err)
+	}
+	if ce.Kind != "Pod" || ce.Name != "starfish" || ce.Namespace != "default" {
+		t.Errorf("unexpected conflicting resource %s %s/%s", ce.Kind, ce.Namespace, ce.Name)
+	}
+	if len(ce.Conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %d", len(ce.Conflicts))
+	}
+	if ce.Conflicts[0].Manager != "kubectl-edit" {
+		t.Errorf("expected conflicting manager %q, got %q", "kubectl-edit", ce.Conflicts[0].Manager)
+	}
+	expected := `conflict applying Pod "starfish" in namespace "default": .spec.containers[name="app:v4"].image (owned by "kubectl-edit")`
+	if ce.Error() != expected {
+		t.Errorf("expected error\n%s\ngot\n%s", expected, ce.Error())
+	}
+}
+
 func TestBuild(t *testing.T) {
 	tests := []struct {
 		name      string
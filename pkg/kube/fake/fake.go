@@ -40,6 +40,10 @@ type FailingKubeClient struct {
 	BuildError                       error
 	BuildUnstructuredError           error
 	WaitAndGetCompletedPodPhaseError error
+	ProbeHTTPError                   error
+	WaitForDeleteError               error
+	// FailedPodLogs are returned by FailureLogs when set.
+	FailedPodLogs *kube.FailureLogs
 }
 
 // Create returns the configured error if set or prints
@@ -90,6 +94,22 @@ func (f *FailingKubeClient) Update(r, modified kube.ResourceList, ignoreMe bool)
 	return f.PrintingKubeClient.Update(r, modified, ignoreMe)
 }
 
+// CreateServerSide returns the configured error if set or prints
+func (f *FailingKubeClient) CreateServerSide(resources kube.ResourceList, opts kube.ApplyOptions) (*kube.Result, error) {
+	if f.CreateError != nil {
+		return nil, f.CreateError
+	}
+	return f.PrintingKubeClient.CreateServerSide(resources, opts)
+}
+
+// UpdateServerSide returns the configured error if set or prints
+func (f *FailingKubeClient) UpdateServerSide(r, modified kube.ResourceList, opts kube.ApplyOptions) (*kube.Result, error) {
+	if f.UpdateError != nil {
+		return &kube.Result{}, f.UpdateError
+	}
+	return f.PrintingKubeClient.UpdateServerSide(r, modified, opts)
+}
+
 // Build returns the configured error if set or prints
 func (f *FailingKubeClient) Build(r io.Reader, _ bool) (kube.ResourceList, error) {
 	if f.BuildError != nil {
@@ -105,3 +125,27 @@ func (f *FailingKubeClient) WaitAndGetCompletedPodPhase(s string, d time.Duratio
 	}
 	return f.PrintingKubeClient.WaitAndGetCompletedPodPhase(s, d)
 }
+
+// ProbeHTTP returns the configured error if set or prints
+func (f *FailingKubeClient) ProbeHTTP(info *resource.Info, port int, path string) error {
+	if f.ProbeHTTPError != nil {
+		return f.ProbeHTTPError
+	}
+	return f.PrintingKubeClient.ProbeHTTP(info, port, path)
+}
+
+// WaitForDelete returns the configured error if set or prints
+func (f *FailingKubeClient) WaitForDelete(resources kube.ResourceList, d time.Duration) error {
+	if f.WaitForDeleteError != nil {
+		return f.WaitForDeleteError
+	}
+	return f.PrintingKubeClient.WaitForDelete(resources, d)
+}
+
+// FailureLogs returns the configured logs if set or prints
+func (f *FailingKubeClient) FailureLogs(resources kube.ResourceList, tailLines int64) (*kube.FailureLogs, error) {
+	if f.FailedPodLogs != nil {
+		return f.FailedPodLogs, nil
+	}
+	return f.PrintingKubeClient.FailureLogs(resources, tailLines)
+}
@@ -86,6 +86,16 @@ func (p *PrintingKubeClient) Update(_, modified kube.ResourceList, _ bool) (*kub
 	return &kube.Result{Updated: modified}, nil
 }
 
+// CreateServerSide implements KubeClient CreateServerSide.
+func (p *PrintingKubeClient) CreateServerSide(resources kube.ResourceList, _ kube.ApplyOptions) (*kube.Result, error) {
+	return p.Create(resources)
+}
+
+// UpdateServerSide implements KubeClient UpdateServerSide.
+func (p *PrintingKubeClient) UpdateServerSide(original, modified kube.ResourceList, _ kube.ApplyOptions) (*kube.Result, error) {
+	return p.Update(original, modified, false)
+}
+
 // Build implements KubeClient Build.
 func (p *PrintingKubeClient) Build(_ io.Reader, _ bool) (kube.ResourceList, error) {
 	return []*resource.Info{}, nil
@@ -96,6 +106,21 @@ func (p *PrintingKubeClient) WaitAndGetCompletedPodPhase(_ string, _ time.Durati
 	return v1.PodSucceeded, nil
 }
 
+// ProbeHTTP implements KubeClient ProbeHTTP.
+func (p *PrintingKubeClient) ProbeHTTP(_ *resource.Info, _ int, _ string) error {
+	return nil
+}
+
+// FailureLogs implements KubeClient FailureLogs.
+func (p *PrintingKubeClient) FailureLogs(_ kube.ResourceList, _ int64) (*kube.FailureLogs, error) {
+	return &kube.FailureLogs{}, nil
+}
+
+// WaitForDelete implements KubeClient WaitForDelete.
+func (p *PrintingKubeClient) WaitForDelete(_ kube.ResourceList, _ time.Duration) error {
+	return nil
+}
+
 func bufferize(resources kube.ResourceList) io.Reader {
 	var builder strings.Builder
 	for _, info := range resources {
@@ -65,4 +65,17 @@ type Interface interface {
 	IsReachable() error
 }
 
+// InterfaceServerSideApply is implemented by clients that can send resources
+// to the API server with server-side apply. It is separate from Interface to
+// avoid breaking backwards compatibility for Interface implementers.
+type InterfaceServerSideApply interface {
+	// CreateServerSide creates one or more resources with server-side apply.
+	CreateServerSide(resources ResourceList, opts ApplyOptions) (*Result, error)
+
+	// UpdateServerSide updates one or more resources with server-side apply
+	// or creates the resource if it doesn't exist.
+	UpdateServerSide(original, target ResourceList, opts ApplyOptions) (*Result, error)
+}
+
 var _ Interface = (*Client)(nil)
+var _ InterfaceServerSideApply = (*Client)(nil)
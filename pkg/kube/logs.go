@@ -0,0 +1,160 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// InterfaceFailureLogs is implemented by clients that can tell why the Jobs
+// and Pods of resources failed. It is separate from Interface to avoid
+// breaking backwards compatibility for Interface implementers.
+type InterfaceFailureLogs interface {
+	// FailureLogs returns the reasons of the failures of the Jobs and Pods
+	// of the resources, and the last tailLines lines of the logs of the
+	// containers of their pods. The other resources are ignored.
+	FailureLogs(resources ResourceList, tailLines int64) (*FailureLogs, error)
+}
+
+var _ InterfaceFailureLogs = (*Client)(nil)
+
+// FailureLogs describes why Jobs and Pods failed.
+type FailureLogs struct {
+	// Reasons are the reasons of the failed conditions of the Jobs, and of the
+	// terminations of the containers of the pods.
+	Reasons []string
+	// Logs are the logs of the containers of the pods, each led by a
+	// "==> pod/NAME container NAME <==" header.
+	Logs string
+	// ExitCode is the exit code of the first container of the pods that
+	// failed, or 0 if the containers that terminated all succeeded. It is nil
+	// if no container terminated.
+	ExitCode *int32
+}
+
+// FailureLogs returns why the Jobs and Pods of the resources failed.
+func (c *Client) FailureLogs(resources ResourceList, tailLines int64) (*FailureLogs, error) {
+	cs, err := c.getKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	return failureLogs(cs, resources, tailLines)
+}
+
+func failureLogs(cs kubernetes.Interface, resources ResourceList, tailLines int64) (*FailureLogs, error) {
+	ctx := context.Background()
+	fl := &FailureLogs{}
+	var logs strings.Builder
+	for _, info := range resources {
+		pods := cs.CoreV1().Pods(info.Namespace)
+		var candidates []corev1.Pod
+		switch AsVersioned(info).(type) {
+		case *batchv1.Job:
+			job, err := cs.BatchV1().Jobs(info.Namespace).Get(ctx, info.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range job.Status.Conditions {
+				if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+					fl.Reasons = append(fl.Reasons, fmt.Sprintf("job/%s: %s: %s", job.Name, c.Reason, c.Message))
+				}
+			}
+			selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+			if err != nil {
+				return nil, err
+			}
+			list, err := pods.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+			if err != nil {
+				return nil, err
+			}
+			candidates = list.Items
+		case *corev1.Pod:
+			pod, err := pods.Get(ctx, info.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			candidates = []corev1.Pod{*pod}
+		default:
+			continue
+		}
+
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Name < candidates[j].Name })
+		for _, pod := range candidates {
+			statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+			for _, s := range statuses {
+				if t := s.State.Terminated; t != nil && (fl.ExitCode == nil || *fl.ExitCode == 0) {
+					exitCode := t.ExitCode
+					fl.ExitCode = &exitCode
+				}
+				if reason := containerFailure(s); reason != "" {
+					fl.Reasons = append(fl.Reasons, fmt.Sprintf("pod/%s container %s: %s", pod.Name, s.Name, reason))
+				}
+				if s.State.Waiting != nil && s.LastTerminationState.Terminated == nil {
+					// the container never ran
+					continue
+				}
+				fmt.Fprintf(&logs, "==> pod/%s container %s <==\n", pod.Name, s.Name)
+				raw, err := pods.GetLogs(pod.Name, &corev1.PodLogOptions{Container: s.Name, TailLines: &tailLines}).DoRaw(ctx)
+				if err != nil {
+					fmt.Fprintf(&logs, "unable to get the logs: %s\n", err)
+					continue
+				}
+				logs.Write(raw)
+				if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+					logs.WriteByte('\n')
+				}
+			}
+		}
+	}
+	fl.Logs = logs.String()
+	return fl, nil
+}
+
+// containerFailure returns why a container failed, or "" if it did not.
+func containerFailure(s corev1.ContainerStatus) string {
+	if t := s.State.Terminated; t != nil && t.ExitCode != 0 {
+		return terminationReason(t)
+	}
+	w := s.State.Waiting
+	if w == nil || w.Reason == "" || w.Reason == "ContainerCreating" || w.Reason == "PodInitializing" {
+		return ""
+	}
+	reason := "waiting: " + w.Reason
+	if w.Message != "" {
+		reason += ": " + w.Message
+	}
+	if t := s.LastTerminationState.Terminated; t != nil {
+		reason += ", last terminated: " + terminationReason(t)
+	}
+	return reason
+}
+
+func terminationReason(t *corev1.ContainerStateTerminated) string {
+	reason := fmt.Sprintf("%s (exit code %d)", t.Reason, t.ExitCode)
+	if msg := strings.TrimSpace(t.Message); msg != "" {
+		reason += ": " + msg
+	}
+	return reason
+}
@@ -0,0 +1,104 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFailureLogs(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: defaultNamespace},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"job-name": "migrate"}},
+		},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+			Type:    batchv1.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "BackoffLimitExceeded",
+			Message: "Job has reached the specified backoff limit",
+		}}},
+	}
+	failed := newPodWithCondition("migrate-abcde", corev1.ConditionFalse)
+	failed.Labels = map[string]string{"job-name": "migrate"}
+	failed.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "wait",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}},
+	}}
+	failed.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name: "migrate",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			Reason:   "Error",
+			ExitCode: 2,
+			Message:  "relation \"users\" already exists\n",
+		}},
+	}}
+	pending := newPodWithCondition("check", corev1.ConditionFalse)
+	pending.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name: "check",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+			Reason:  "ImagePullBackOff",
+			Message: "Back-off pulling image \"check:latest\"",
+		}},
+	}}
+	other := newPodWithCondition("other", corev1.ConditionFalse)
+	other.Labels = map[string]string{"job-name": "other"}
+
+	c := fake.NewSimpleClientset(job, failed, pending, other)
+	resources := ResourceList{
+		newWaitInfo(job, "migrate", batchv1.SchemeGroupVersion.WithKind("Job")),
+		newWaitInfo(pending, "check", corev1.SchemeGroupVersion.WithKind("Pod")),
+		newWaitInfo(newDeployment("web", 1, 1, 0), "web", appsv1.SchemeGroupVersion.WithKind("Deployment")),
+	}
+
+	fl, err := failureLogs(c, resources, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedReasons := []string{
+		"job/migrate: BackoffLimitExceeded: Job has reached the specified backoff limit",
+		`pod/migrate-abcde container migrate: Error (exit code 2): relation "users" already exists`,
+		`pod/check container check: waiting: ImagePullBackOff: Back-off pulling image "check:latest"`,
+	}
+	if !reflect.DeepEqual(fl.Reasons, expectedReasons) {
+		t.Errorf("expected reasons %q, got %q", expectedReasons, fl.Reasons)
+	}
+	// the fake client returns "fake logs" as the logs of every container
+	expectedLogs := "==> pod/migrate-abcde container wait <==\nfake logs\n" +
+		"==> pod/migrate-abcde container migrate <==\nfake logs\n"
+	if fl.Logs != expectedLogs {
+		t.Errorf("expected logs %q, got %q", expectedLogs, fl.Logs)
+	}
+	if fl.ExitCode == nil || *fl.ExitCode != 2 {
+		t.Errorf("expected exit code 2, got %v", fl.ExitCode)
+	}
+
+	fl, err = failureLogs(c, ResourceList{newWaitInfo(pending, "check", corev1.SchemeGroupVersion.WithKind("Pod"))}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fl.ExitCode != nil {
+		t.Errorf("expected no exit code for a container that never ran, got %d", *fl.ExitCode)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// probeTimeout bounds the time taken by a single HTTP probe.
+const probeTimeout = 10 * time.Second
+
+// InterfaceHTTPProbe is implemented by clients that can probe the HTTP
+// endpoints served by the pods of a resource. It is separate from Interface to
+// avoid breaking backwards compatibility for Interface implementers.
+type InterfaceHTTPProbe interface {
+	// ProbeHTTP forwards a local port to the given port of a ready pod of the
+	// resource and sends a GET request for path. It fails if the request fails
+	// or the response status code is not lower than 400.
+	ProbeHTTP(resource *resource.Info, port int, path string) error
+}
+
+var _ InterfaceHTTPProbe = (*Client)(nil)
+
+// ProbeHTTP probes an HTTP endpoint of the resource through a port-forward.
+// The resource must be a Pod or an object selecting pods, such as a Service or
+// a Deployment.
+func (c *Client) ProbeHTTP(info *resource.Info, port int, path string) error {
+	cs, err := c.getKubeClient()
+	if err != nil {
+		return err
+	}
+	pod, err := readyPodFor(cs.CoreV1().Pods(info.Namespace), info)
+	if err != nil {
+		return err
+	}
+
+	config, err := c.Factory.ToRawKubeConfigLoader().ClientConfig()
+	if err != nil {
+		return err
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return err
+	}
+	req := cs.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	ready := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)}, stop, ready, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	failed := make(chan error, 1)
+	go func() { failed <- fw.ForwardPorts() }()
+	select {
+	case <-ready:
+	case err := <-failed:
+		return errors.Wrapf(err, "unable to forward port %d of pod %s/%s", port, pod.Namespace, pod.Name)
+	}
+	ports, err := fw.GetPorts()
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/%s", ports[0].Local, strings.TrimPrefix(path, "/"))
+	c.Log("probing %s of pod %s/%s", path, pod.Namespace, pod.Name)
+	resp, err := (&http.Client{Timeout: probeTimeout}).Get(url)
+	if err != nil {
+		return errors.Wrapf(err, "GET %s on port %d of pod %s/%s failed", path, port, pod.Namespace, pod.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("GET %s on port %d of pod %s/%s returned %s", path, port, pod.Namespace, pod.Name, resp.Status)
+	}
+	return nil
+}
+
+type podLister interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Pod, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*corev1.PodList, error)
+}
+
+// readyPodFor returns a running and ready pod of the resource.
+func readyPodFor(pods podLister, info *resource.Info) (*corev1.Pod, error) {
+	var candidates []corev1.Pod
+	if obj, ok := AsVersioned(info).(*corev1.Pod); ok {
+		pod, err := pods.Get(context.Background(), obj.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		candidates = []corev1.Pod{*pod}
+	} else {
+		selector, err := SelectorsForObject(AsVersioned(info))
+		if err != nil {
+			return nil, err
+		}
+		list, err := pods.List(context.Background(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		candidates = list.Items
+	}
+
+	for i := range candidates {
+		if pod := &candidates[i]; pod.Status.Phase == corev1.PodRunning && podReady(pod) {
+			return pod, nil
+		}
+	}
+	return nil, errors.Errorf("no ready pod found for %s/%s", info.Namespace, info.Name)
+}
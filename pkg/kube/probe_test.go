@@ -0,0 +1,55 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReadyPodFor(t *testing.T) {
+	dep := newDeployment("web", 2, 1, 0)
+	pending := newPodWithCondition("web", corev1.ConditionFalse)
+	pending.Name = "web-pending"
+	running := newPodWithCondition("web", corev1.ConditionTrue)
+	running.Name = "web-running"
+	running.Status.Phase = corev1.PodRunning
+	pods := fake.NewSimpleClientset(pending, running).CoreV1().Pods(defaultNamespace)
+
+	pod, err := readyPodFor(pods, newWaitInfo(dep, "web", appsv1.SchemeGroupVersion.WithKind("Deployment")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name != "web-running" {
+		t.Errorf("expected pod web-running, got %s", pod.Name)
+	}
+
+	pod, err = readyPodFor(pods, newWaitInfo(running, "web-running", corev1.SchemeGroupVersion.WithKind("Pod")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name != "web-running" {
+		t.Errorf("expected pod web-running, got %s", pod.Name)
+	}
+
+	if _, err := readyPodFor(pods, newWaitInfo(pending, "web-pending", corev1.SchemeGroupVersion.WithKind("Pod"))); err == nil {
+		t.Error("expected a pod that is not ready to be rejected")
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	// ReadinessJSONPathAnnotation is the annotation holding a JSONPath
+	// expression evaluated against a resource to decide whether it is ready,
+	// e.g. '{.status.phase}'.
+	ReadinessJSONPathAnnotation = "helm.sh/readiness-jsonpath"
+	// ReadinessValueAnnotation is the annotation holding the value the
+	// expression of ReadinessJSONPathAnnotation must evaluate to for the
+	// resource to be ready. Defaults to "True".
+	ReadinessValueAnnotation = "helm.sh/readiness-value"
+)
+
+// ReadinessChecker decides whether a resource is ready.
+type ReadinessChecker interface {
+	// IsReady is given the current state of the resource in the cluster and
+	// returns whether it is ready and, if it is not, the reason why. An error
+	// aborts the wait.
+	IsReady(obj *unstructured.Unstructured) (ready bool, reason string, err error)
+}
+
+// ReadinessCheckerFunc adapts an ordinary function to a ReadinessChecker.
+type ReadinessCheckerFunc func(obj *unstructured.Unstructured) (bool, string, error)
+
+// IsReady calls f(obj).
+func (f ReadinessCheckerFunc) IsReady(obj *unstructured.Unstructured) (bool, string, error) {
+	return f(obj)
+}
+
+var (
+	readinessCheckersMu sync.RWMutex
+	readinessCheckers   = map[schema.GroupKind]ReadinessChecker{}
+)
+
+// RegisterReadinessChecker registers the checker used when waiting for
+// resources of the given group and kind, replacing the built-in check of the
+// kind if there is one. Registering a nil checker removes the checker of the
+// kind.
+//
+// Resources of kinds without a checker or a built-in check are evaluated with
+// StatusReadiness.
+func RegisterReadinessChecker(gk schema.GroupKind, checker ReadinessChecker) {
+	readinessCheckersMu.Lock()
+	defer readinessCheckersMu.Unlock()
+	if checker == nil {
+		delete(readinessCheckers, gk)
+		return
+	}
+	readinessCheckers[gk] = checker
+}
+
+func readinessCheckerFor(gk schema.GroupKind) ReadinessChecker {
+	readinessCheckersMu.RLock()
+	defer readinessCheckersMu.RUnlock()
+	return readinessCheckers[gk]
+}
+
+// StatusReadiness is a ReadinessChecker following the conventions of the
+// status of Kubernetes resources. A resource is ready once:
+//
+//   - its status.observedGeneration, if set, has caught up with its
+//     metadata.generation,
+//   - it has no Stalled or Reconciling condition with status True, and
+//   - its Ready condition, if any, has status True.
+//
+// Resources without a status are ready.
+var StatusReadiness ReadinessChecker = ReadinessCheckerFunc(statusReady)
+
+func statusReady(obj *unstructured.Unstructured) (bool, string, error) {
+	generation := obj.GetGeneration()
+	observed, found, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if err != nil {
+		return false, "", err
+	}
+	if found && observed < generation {
+		return false, fmt.Sprintf("observed generation %d is behind generation %d", observed, generation), nil
+	}
+
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, "", err
+	}
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condType, _, _ := unstructured.NestedString(cond, "type")
+		status, _, _ := unstructured.NestedString(cond, "status")
+		switch {
+		case (condType == "Stalled" || condType == "Reconciling") && status == "True",
+			condType == "Ready" && status != "True":
+			return false, conditionReason(condType, status, cond), nil
+		}
+	}
+	return true, "", nil
+}
+
+func conditionReason(condType, status string, cond map[string]interface{}) string {
+	s := fmt.Sprintf("condition %s is %s", condType, status)
+	reason, _, _ := unstructured.NestedString(cond, "reason")
+	message, _, _ := unstructured.NestedString(cond, "message")
+	if reason != "" {
+		s += ": " + reason
+	}
+	if message != "" {
+		s += ": " + message
+	}
+	return s
+}
+
+// JSONPathReadiness returns a ReadinessChecker that considers a resource ready
+// when the JSONPath expression evaluates to the given value. An empty value
+// stands for "True". When the expression yields several results, all of them
+// must be equal to the value.
+func JSONPathReadiness(expr, value string) (ReadinessChecker, error) {
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+	if value == "" {
+		value = "True"
+	}
+	jp := jsonpath.New("readiness").AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return nil, errors.Wrapf(err, "invalid readiness expression %q", expr)
+	}
+
+	return ReadinessCheckerFunc(func(obj *unstructured.Unstructured) (bool, string, error) {
+		results, err := jp.FindResults(obj.Object)
+		if err != nil {
+			return false, "", errors.Wrapf(err, "unable to evaluate readiness expression %q", expr)
+		}
+		var values []string
+		for _, result := range results {
+			for _, r := range result {
+				values = append(values, fmt.Sprint(r.Interface()))
+			}
+		}
+		if len(values) == 0 {
+			return false, fmt.Sprintf("%s is not set", expr), nil
+		}
+		for _, v := range values {
+			if v != value {
+				return false, fmt.Sprintf("%s is %q, waiting for %q", expr, strings.Join(values, " "), value), nil
+			}
+		}
+		return true, "", nil
+	}), nil
+}
+
+// readinessChecker returns the checker of the resource: the checker given by
+// its annotations, or else the checker registered for its kind. It returns
+// nil if the resource has neither.
+func readinessChecker(v *resource.Info) (ReadinessChecker, error) {
+	if accessor, err := meta.Accessor(v.Object); err == nil {
+		annotations := accessor.GetAnnotations()
+		if expr, ok := annotations[ReadinessJSONPathAnnotation]; ok {
+			checker, err := JSONPathReadiness(expr, annotations[ReadinessValueAnnotation])
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s annotation of %s %s/%s", ReadinessJSONPathAnnotation, kindOf(v).Kind, v.Namespace, v.Name)
+			}
+			return checker, nil
+		}
+	}
+	return readinessCheckerFor(kindOf(v).GroupKind()), nil
+}
+
+func kindOf(v *resource.Info) schema.GroupVersionKind {
+	if v.Mapping != nil {
+		return v.Mapping.GroupVersionKind
+	}
+	return v.Object.GetObjectKind().GroupVersionKind()
+}
+
+// checkReadiness fetches the resource from the cluster and evaluates it with
+// the checker.
+func (w *waiter) checkReadiness(v *resource.Info, checker ReadinessChecker) (bool, error) {
+	obj, err := resource.NewHelper(v.Client, v.Mapping).Get(v.Namespace, v.Name)
+	if err != nil {
+		return false, err
+	}
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return false, err
+	}
+	ready, reason, err := checker.IsReady(u)
+	if err != nil || ready {
+		return ready, err
+	}
+	if reason == "" {
+		reason = "not ready"
+	}
+	w.notReady("%s is not ready: %s/%s: %s", kindOf(v).Kind, v.Namespace, v.Name, reason)
+	return false, nil
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to convert object to unstructured")
+	}
+	return &unstructured.Unstructured{Object: u}, nil
+}
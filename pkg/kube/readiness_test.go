@@ -0,0 +1,246 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/fake"
+	restfake "k8s.io/client-go/rest/fake"
+)
+
+var widgetGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+func newWidget(generation int64, status map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]interface{}{
+			"name":       "w",
+			"namespace":  defaultNamespace,
+			"generation": generation,
+		},
+	}}
+	if status != nil {
+		u.Object["status"] = status
+	}
+	return u
+}
+
+func condition(condType, status string) map[string]interface{} {
+	return map[string]interface{}{"type": condType, "status": status, "reason": "Testing"}
+}
+
+func TestStatusReadiness(t *testing.T) {
+	tests := []struct {
+		name   string
+		obj    *unstructured.Unstructured
+		ready  bool
+		reason string
+	}{{
+		name:  "no status",
+		obj:   newWidget(1, nil),
+		ready: true,
+	}, {
+		name:   "observed generation behind",
+		obj:    newWidget(2, map[string]interface{}{"observedGeneration": int64(1)}),
+		reason: "observed generation 1 is behind generation 2",
+	}, {
+		name: "ready",
+		obj: newWidget(2, map[string]interface{}{
+			"observedGeneration": int64(2),
+			"conditions":         []interface{}{condition("Ready", "True")},
+		}),
+		ready: true,
+	}, {
+		name: "not ready",
+		obj: newWidget(1, map[string]interface{}{
+			"conditions": []interface{}{condition("Ready", "False")},
+		}),
+		reason: "condition Ready is False: Testing",
+	}, {
+		name: "reconciling",
+		obj: newWidget(1, map[string]interface{}{
+			"conditions": []interface{}{condition("Ready", "True"), condition("Reconciling", "True")},
+		}),
+		reason: "condition Reconciling is True: Testing",
+	}, {
+		name: "stalled",
+		obj: newWidget(1, map[string]interface{}{
+			"conditions": []interface{}{condition("Stalled", "True")},
+		}),
+		reason: "condition Stalled is True: Testing",
+	}, {
+		name: "unrelated conditions",
+		obj: newWidget(1, map[string]interface{}{
+			"conditions": []interface{}{condition("Stalled", "False"), condition("Available", "False")},
+		}),
+		ready: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, reason, err := StatusReadiness.IsReady(tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ready != tt.ready || reason != tt.reason {
+				t.Errorf("expected (%t, %q), got (%t, %q)", tt.ready, tt.reason, ready, reason)
+			}
+		})
+	}
+}
+
+func TestJSONPathReadiness(t *testing.T) {
+	obj := newWidget(1, map[string]interface{}{
+		"phase":      "Running",
+		"conditions": []interface{}{condition("Synced", "True")},
+	})
+
+	tests := []struct {
+		expr   string
+		value  string
+		ready  bool
+		reason string
+	}{
+		{expr: "{.status.phase}", value: "Running", ready: true},
+		{expr: ".status.phase", value: "Running", ready: true},
+		{expr: "{.status.phase}", value: "Done", reason: `{.status.phase} is "Running", waiting for "Done"`},
+		{expr: `{.status.conditions[?(@.type=="Synced")].status}`, ready: true},
+		{expr: "{.status.endpoint}", value: "x", reason: "{.status.endpoint} is not set"},
+	}
+
+	for _, tt := range tests {
+		checker, err := JSONPathReadiness(tt.expr, tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ready, reason, err := checker.IsReady(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ready != tt.ready || reason != tt.reason {
+			t.Errorf("%s: expected (%t, %q), got (%t, %q)", tt.expr, tt.ready, tt.reason, ready, reason)
+		}
+	}
+
+	if _, err := JSONPathReadiness("{.status[", ""); err == nil {
+		t.Error("expected an invalid expression to fail")
+	}
+}
+
+// newWidgetInfo returns the info of the manifest of a Widget whose state in
+// the cluster is live.
+func newWidgetInfo(manifest, live *unstructured.Unstructured) *resource.Info {
+	client := &restfake.RESTClient{
+		NegotiatedSerializer: unstructuredSerializer,
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			body, err := live.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			header := http.Header{}
+			header.Set("Content-Type", runtime.ContentTypeJSON)
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+		}),
+	}
+	return &resource.Info{
+		Client:    client,
+		Name:      manifest.GetName(),
+		Namespace: manifest.GetNamespace(),
+		Object:    manifest,
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: widgetGVK,
+			Resource:         widgetGVK.GroupVersion().WithResource("widgets"),
+			Scope:            meta.RESTScopeNamespace,
+		},
+	}
+}
+
+func TestWaiterCustomResourceReadiness(t *testing.T) {
+	live := newWidget(2, map[string]interface{}{
+		"observedGeneration": int64(2),
+		"phase":              "Provisioning",
+		"conditions":         []interface{}{condition("Ready", "True")},
+	})
+	w := &waiter{c: fake.NewSimpleClientset(), log: nopLogger}
+
+	ready, err := w.isReady(newWidgetInfo(newWidget(2, nil), live), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ready {
+		t.Errorf("expected the status conditions to make the widget ready, got %q", w.reason)
+	}
+
+	annotated := newWidget(2, nil)
+	annotated.SetAnnotations(map[string]string{
+		ReadinessJSONPathAnnotation: "{.status.phase}",
+		ReadinessValueAnnotation:    "Provisioned",
+	})
+	ready, err = w.isReady(newWidgetInfo(annotated, live), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready {
+		t.Error("expected the annotation to make the widget not ready")
+	}
+	if expected := `Widget is not ready: default/w: {.status.phase} is "Provisioning", waiting for "Provisioned"`; w.reason != expected {
+		t.Errorf("expected reason %q, got %q", expected, w.reason)
+	}
+
+	annotated.SetAnnotations(map[string]string{ReadinessJSONPathAnnotation: "{.status["})
+	if _, err := w.isReady(newWidgetInfo(annotated, live), false); err == nil {
+		t.Error("expected an invalid annotation to fail")
+	}
+}
+
+func TestRegisterReadinessChecker(t *testing.T) {
+	live := newWidget(1, map[string]interface{}{
+		"conditions": []interface{}{condition("Ready", "False")},
+	})
+	info := newWidgetInfo(newWidget(1, nil), live)
+	w := &waiter{c: fake.NewSimpleClientset(), log: nopLogger}
+
+	RegisterReadinessChecker(widgetGVK.GroupKind(), ReadinessCheckerFunc(func(obj *unstructured.Unstructured) (bool, string, error) {
+		return obj.GetName() == "w", "", nil
+	}))
+	ready, err := w.isReady(info, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ready {
+		t.Error("expected the registered checker to make the widget ready")
+	}
+
+	RegisterReadinessChecker(widgetGVK.GroupKind(), nil)
+	ready, err = w.isReady(info, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready {
+		t.Error("expected the widget not to be ready once the checker is removed")
+	}
+}
@@ -31,20 +31,39 @@ import (
 	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 
 	deploymentutil "helm.sh/helm/v3/internal/third_party/k8s.io/kubernetes/deployment/util"
 )
 
+// ResourceReadiness is the readiness of a resource observed while waiting for
+// it to be ready.
+type ResourceReadiness struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Ready     bool
+	// Reason explains why the resource is not ready.
+	Reason string
+}
+
 type waiter struct {
-	c       kubernetes.Interface
-	timeout time.Duration
-	log     func(string, ...interface{})
+	c        kubernetes.Interface
+	timeout  time.Duration
+	log      func(string, ...interface{})
+	observer func(ResourceReadiness)
+
+	// reason records why the last resource checked is not ready.
+	reason string
+	// observed holds the last readiness recorded for each resource.
+	observed map[string]ResourceReadiness
 }
 
 // waitForResources polls to get the current status of all pods, PVCs, Services and
@@ -52,108 +71,174 @@ type waiter struct {
 func (w *waiter) waitForResources(created ResourceList, waitForJobsEnabled bool) error {
 	w.log("beginning wait for %d resources with timeout of %v", len(created), w.timeout)
 
-	return wait.Poll(2*time.Second, w.timeout, func() (bool, error) {
+	err := wait.Poll(2*time.Second, w.timeout, func() (bool, error) {
+		allReady := true
 		for _, v := range created {
-			var (
-				// This defaults to true, otherwise we get to a point where
-				// things will always return false unless one of the objects
-				// that manages pods has been hit
-				ok  = true
-				err error
-			)
-			switch value := AsVersioned(v).(type) {
-			case *corev1.Pod:
-				pod, err := w.c.CoreV1().Pods(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
-				if err != nil || !w.isPodReady(pod) {
-					return false, err
-				}
-			case *batchv1.Job:
-				if waitForJobsEnabled {
-					job, err := w.c.BatchV1().Jobs(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
-					if err != nil || !w.jobReady(job) {
-						return false, err
-					}
-				}
-			case *appsv1.Deployment, *appsv1beta1.Deployment, *appsv1beta2.Deployment, *extensionsv1beta1.Deployment:
-				currentDeployment, err := w.c.AppsV1().Deployments(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				// If paused deployment will never be ready
-				if currentDeployment.Spec.Paused {
-					continue
-				}
-				// Find RS associated with deployment
-				newReplicaSet, err := deploymentutil.GetNewReplicaSet(currentDeployment, w.c.AppsV1())
-				if err != nil || newReplicaSet == nil {
-					return false, err
-				}
-				if !w.deploymentReady(newReplicaSet, currentDeployment) {
-					return false, nil
-				}
-			case *corev1.PersistentVolumeClaim:
-				claim, err := w.c.CoreV1().PersistentVolumeClaims(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				if !w.volumeReady(claim) {
-					return false, nil
-				}
-			case *corev1.Service:
-				svc, err := w.c.CoreV1().Services(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				if !w.serviceReady(svc) {
-					return false, nil
-				}
-			case *extensionsv1beta1.DaemonSet, *appsv1.DaemonSet, *appsv1beta2.DaemonSet:
-				ds, err := w.c.AppsV1().DaemonSets(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				if !w.daemonSetReady(ds) {
-					return false, nil
-				}
-			case *apiextv1beta1.CustomResourceDefinition:
-				if err := v.Get(); err != nil {
-					return false, err
-				}
-				crd := &apiextv1beta1.CustomResourceDefinition{}
-				if err := scheme.Scheme.Convert(v.Object, crd, nil); err != nil {
-					return false, err
-				}
-				if !w.crdBetaReady(*crd) {
-					return false, nil
-				}
-			case *apiextv1.CustomResourceDefinition:
-				if err := v.Get(); err != nil {
-					return false, err
-				}
-				crd := &apiextv1.CustomResourceDefinition{}
-				if err := scheme.Scheme.Convert(v.Object, crd, nil); err != nil {
-					return false, err
-				}
-				if !w.crdReady(*crd) {
-					return false, nil
-				}
-			case *appsv1.StatefulSet, *appsv1beta1.StatefulSet, *appsv1beta2.StatefulSet:
-				sts, err := w.c.AppsV1().StatefulSets(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				if !w.statefulSetReady(sts) {
-					return false, nil
-				}
-			case *corev1.ReplicationController, *extensionsv1beta1.ReplicaSet, *appsv1beta2.ReplicaSet, *appsv1.ReplicaSet:
-				ok, err = w.podsReadyForObject(v.Namespace, value)
-			}
-			if !ok || err != nil {
+			ready, err := w.isReady(v, waitForJobsEnabled)
+			if err != nil {
 				return false, err
 			}
+			w.observe(v, ready)
+			if !ready {
+				allReady = false
+			}
 		}
-		return true, nil
+		return allReady, nil
 	})
+	if err == wait.ErrWaitTimeout {
+		return w.timeoutError(created)
+	}
+	return err
+}
+
+// isReady returns whether the resource is ready, recording the reason it is
+// not in w.reason.
+//
+// A resource is checked with the checker given by its annotations or
+// registered for its kind, if any. Otherwise built-in kinds are checked by
+// their own rules, and custom resources with StatusReadiness.
+func (w *waiter) isReady(v *resource.Info, waitForJobsEnabled bool) (bool, error) {
+	w.reason = ""
+	checker, err := readinessChecker(v)
+	if err != nil {
+		return false, err
+	}
+	if checker != nil {
+		return w.checkReadiness(v, checker)
+	}
+
+	switch value := AsVersioned(v).(type) {
+	case *corev1.Pod:
+		pod, err := w.c.CoreV1().Pods(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+		if err != nil || !w.isPodReady(pod) {
+			return false, err
+		}
+	case *batchv1.Job:
+		if waitForJobsEnabled {
+			job, err := w.c.BatchV1().Jobs(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+			if err != nil || !w.jobReady(job) {
+				return false, err
+			}
+		}
+	case *appsv1.Deployment, *appsv1beta1.Deployment, *appsv1beta2.Deployment, *extensionsv1beta1.Deployment:
+		currentDeployment, err := w.c.AppsV1().Deployments(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		// If paused deployment will never be ready
+		if currentDeployment.Spec.Paused {
+			return true, nil
+		}
+		// Find RS associated with deployment
+		newReplicaSet, err := deploymentutil.GetNewReplicaSet(currentDeployment, w.c.AppsV1())
+		if err != nil || newReplicaSet == nil {
+			w.reason = "Deployment has no new ReplicaSet yet"
+			return false, err
+		}
+		if !w.deploymentReady(newReplicaSet, currentDeployment) {
+			return false, nil
+		}
+	case *corev1.PersistentVolumeClaim:
+		claim, err := w.c.CoreV1().PersistentVolumeClaims(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if !w.volumeReady(claim) {
+			return false, nil
+		}
+	case *corev1.Service:
+		svc, err := w.c.CoreV1().Services(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if !w.serviceReady(svc) {
+			return false, nil
+		}
+	case *extensionsv1beta1.DaemonSet, *appsv1.DaemonSet, *appsv1beta2.DaemonSet:
+		ds, err := w.c.AppsV1().DaemonSets(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if !w.daemonSetReady(ds) {
+			return false, nil
+		}
+	case *apiextv1beta1.CustomResourceDefinition:
+		if err := v.Get(); err != nil {
+			return false, err
+		}
+		crd := &apiextv1beta1.CustomResourceDefinition{}
+		if err := scheme.Scheme.Convert(v.Object, crd, nil); err != nil {
+			return false, err
+		}
+		if !w.crdBetaReady(*crd) {
+			w.reason = "CustomResourceDefinition is not established"
+			return false, nil
+		}
+	case *apiextv1.CustomResourceDefinition:
+		if err := v.Get(); err != nil {
+			return false, err
+		}
+		crd := &apiextv1.CustomResourceDefinition{}
+		if err := scheme.Scheme.Convert(v.Object, crd, nil); err != nil {
+			return false, err
+		}
+		if !w.crdReady(*crd) {
+			w.reason = "CustomResourceDefinition is not established"
+			return false, nil
+		}
+	case *appsv1.StatefulSet, *appsv1beta1.StatefulSet, *appsv1beta2.StatefulSet:
+		sts, err := w.c.AppsV1().StatefulSets(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if !w.statefulSetReady(sts) {
+			return false, nil
+		}
+	case *corev1.ReplicationController, *extensionsv1beta1.ReplicaSet, *appsv1beta2.ReplicaSet, *appsv1.ReplicaSet:
+		return w.podsReadyForObject(v.Namespace, value)
+	case *unstructured.Unstructured:
+		return w.checkReadiness(v, StatusReadiness)
+	}
+	return true, nil
+}
+
+// observe records the readiness of the resource and reports it to the
+// observer if it changed since it was last recorded.
+func (w *waiter) observe(v *resource.Info, ready bool) {
+	r := ResourceReadiness{
+		Name:      v.Name,
+		Namespace: v.Namespace,
+		Ready:     ready,
+		Reason:    w.reason,
+	}
+	if v.Mapping != nil {
+		r.Kind = v.Mapping.GroupVersionKind.Kind
+	}
+	key := readinessKey(v)
+	if prev, ok := w.observed[key]; ok && prev == r {
+		return
+	}
+	if w.observed == nil {
+		w.observed = map[string]ResourceReadiness{}
+	}
+	w.observed[key] = r
+	if w.observer != nil {
+		w.observer(r)
+	}
+}
+
+func readinessKey(v *resource.Info) string {
+	var kind string
+	if v.Mapping != nil {
+		kind = v.Mapping.GroupVersionKind.Kind
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, v.Namespace, v.Name)
+}
+
+// notReady records why a resource is not ready and logs it.
+func (w *waiter) notReady(format string, args ...interface{}) {
+	w.reason = fmt.Sprintf(format, args...)
+	w.log(format, args...)
 }
 
 func (w *waiter) podsReadyForObject(namespace string, obj runtime.Object) (bool, error) {
@@ -185,17 +270,17 @@ func (w *waiter) isPodReady(pod *corev1.Pod) bool {
 			return true
 		}
 	}
-	w.log("Pod is not ready: %s/%s", pod.GetNamespace(), pod.GetName())
+	w.notReady("Pod is not ready: %s/%s", pod.GetNamespace(), pod.GetName())
 	return false
 }
 
 func (w *waiter) jobReady(job *batchv1.Job) bool {
 	if job.Status.Failed >= *job.Spec.BackoffLimit {
-		w.log("Job is failed: %s/%s", job.GetNamespace(), job.GetName())
+		w.notReady("Job is failed: %s/%s", job.GetNamespace(), job.GetName())
 		return false
 	}
 	if job.Status.Succeeded < *job.Spec.Completions {
-		w.log("Job is not completed: %s/%s", job.GetNamespace(), job.GetName())
+		w.notReady("Job is not completed: %s/%s", job.GetNamespace(), job.GetName())
 		return false
 	}
 	return true
@@ -209,7 +294,7 @@ func (w *waiter) serviceReady(s *corev1.Service) bool {
 
 	// Ensure that the service cluster IP is not empty
 	if s.Spec.ClusterIP == "" {
-		w.log("Service does not have cluster IP address: %s/%s", s.GetNamespace(), s.GetName())
+		w.notReady("Service does not have cluster IP address: %s/%s", s.GetNamespace(), s.GetName())
 		return false
 	}
 
@@ -222,7 +307,7 @@ func (w *waiter) serviceReady(s *corev1.Service) bool {
 		}
 
 		if s.Status.LoadBalancer.Ingress == nil {
-			w.log("Service does not have load balancer ingress IP address: %s/%s", s.GetNamespace(), s.GetName())
+			w.notReady("Service does not have load balancer ingress IP address: %s/%s", s.GetNamespace(), s.GetName())
 			return false
 		}
 	}
@@ -232,7 +317,7 @@ func (w *waiter) serviceReady(s *corev1.Service) bool {
 
 func (w *waiter) volumeReady(v *corev1.PersistentVolumeClaim) bool {
 	if v.Status.Phase != corev1.ClaimBound {
-		w.log("PersistentVolumeClaim is not bound: %s/%s", v.GetNamespace(), v.GetName())
+		w.notReady("PersistentVolumeClaim is not bound: %s/%s", v.GetNamespace(), v.GetName())
 		return false
 	}
 	return true
@@ -241,7 +326,7 @@ func (w *waiter) volumeReady(v *corev1.PersistentVolumeClaim) bool {
 func (w *waiter) deploymentReady(rs *appsv1.ReplicaSet, dep *appsv1.Deployment) bool {
 	expectedReady := *dep.Spec.Replicas - deploymentutil.MaxUnavailable(*dep)
 	if !(rs.Status.ReadyReplicas >= expectedReady) {
-		w.log("Deployment is not ready: %s/%s. %d out of %d expected pods are ready", dep.Namespace, dep.Name, rs.Status.ReadyReplicas, expectedReady)
+		w.notReady("Deployment is not ready: %s/%s. %d out of %d expected pods are ready", dep.Namespace, dep.Name, rs.Status.ReadyReplicas, expectedReady)
 		return false
 	}
 	return true
@@ -255,7 +340,7 @@ func (w *waiter) daemonSetReady(ds *appsv1.DaemonSet) bool {
 
 	// Make sure all the updated pods have been scheduled
 	if ds.Status.UpdatedNumberScheduled != ds.Status.DesiredNumberScheduled {
-		w.log("DaemonSet is not ready: %s/%s. %d out of %d expected pods have been scheduled", ds.Namespace, ds.Name, ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled)
+		w.notReady("DaemonSet is not ready: %s/%s. %d out of %d expected pods have been scheduled", ds.Namespace, ds.Name, ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled)
 		return false
 	}
 	maxUnavailable, err := intstr.GetValueFromIntOrPercent(ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable, int(ds.Status.DesiredNumberScheduled), true)
@@ -268,7 +353,7 @@ func (w *waiter) daemonSetReady(ds *appsv1.DaemonSet) bool {
 
 	expectedReady := int(ds.Status.DesiredNumberScheduled) - maxUnavailable
 	if !(int(ds.Status.NumberReady) >= expectedReady) {
-		w.log("DaemonSet is not ready: %s/%s. %d out of %d expected pods are ready", ds.Namespace, ds.Name, ds.Status.NumberReady, expectedReady)
+		w.notReady("DaemonSet is not ready: %s/%s. %d out of %d expected pods are ready", ds.Namespace, ds.Name, ds.Status.NumberReady, expectedReady)
 		return false
 	}
 	return true
@@ -345,12 +430,12 @@ func (w *waiter) statefulSetReady(sts *appsv1.StatefulSet) bool {
 
 	// Make sure all the updated pods have been scheduled
 	if int(sts.Status.UpdatedReplicas) != expectedReplicas {
-		w.log("StatefulSet is not ready: %s/%s. %d out of %d expected pods have been scheduled", sts.Namespace, sts.Name, sts.Status.UpdatedReplicas, expectedReplicas)
+		w.notReady("StatefulSet is not ready: %s/%s. %d out of %d expected pods have been scheduled", sts.Namespace, sts.Name, sts.Status.UpdatedReplicas, expectedReplicas)
 		return false
 	}
 
 	if int(sts.Status.ReadyReplicas) != replicas {
-		w.log("StatefulSet is not ready: %s/%s. %d out of %d expected pods are ready", sts.Namespace, sts.Name, sts.Status.ReadyReplicas, replicas)
+		w.notReady("StatefulSet is not ready: %s/%s. %d out of %d expected pods are ready", sts.Namespace, sts.Name, sts.Status.ReadyReplicas, replicas)
 		return false
 	}
 	return true
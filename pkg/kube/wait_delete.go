@@ -0,0 +1,66 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// waitForDeleteInterval is the interval at which WaitForDelete checks whether
+// the resources still exist.
+var waitForDeleteInterval = 2 * time.Second
+
+// InterfaceWaitForDelete is implemented by clients that can wait for deleted
+// resources to be gone. It is separate from Interface to avoid breaking
+// backwards compatibility for Interface implementers.
+type InterfaceWaitForDelete interface {
+	// WaitForDelete waits up to the given timeout for the resources to no
+	// longer exist, such as deleted resources whose finalizers are pending.
+	WaitForDelete(resources ResourceList, timeout time.Duration) error
+}
+
+var _ InterfaceWaitForDelete = (*Client)(nil)
+
+// WaitForDelete waits up to the given timeout for the resources to be deleted.
+func (c *Client) WaitForDelete(resources ResourceList, timeout time.Duration) error {
+	c.Log("waiting for the deletion of %d resource(s) with timeout of %v", len(resources), timeout)
+	var remaining *resource.Info
+	err := wait.PollImmediate(waitForDeleteInterval, timeout, func() (bool, error) {
+		remaining = nil
+		for _, info := range resources {
+			_, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, info.Name)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, errors.Wrapf(err, "could not get information about %s %q", info.Mapping.GroupVersionKind.Kind, info.Name)
+			}
+			remaining = info
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("timed out waiting for the deletion of %s %q", remaining.Mapping.GroupVersionKind.Kind, remaining.Name)
+	}
+	return err
+}
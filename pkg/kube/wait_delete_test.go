@@ -0,0 +1,80 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest/fake"
+	cmdtesting "k8s.io/kubectl/pkg/cmd/testing"
+)
+
+func TestWaitForDelete(t *testing.T) {
+	defer func(interval time.Duration) { waitForDeleteInterval = interval }(waitForDeleteInterval)
+	waitForDeleteInterval = time.Millisecond
+
+	// the starfish pod is deleted after being found twice, the otter pod never
+	gets := map[string]int{}
+	c := newTestClient(t)
+	c.Factory.(*cmdtesting.TestFactory).UnstructuredClient = &fake.RESTClient{
+		NegotiatedSerializer: unstructuredSerializer,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			p, m := req.URL.Path, req.Method
+			if m != "GET" {
+				t.Fatalf("unexpected request: %s %s", m, p)
+			}
+			gets[p]++
+			switch {
+			case p == "/namespaces/default/pods/starfish" && gets[p] > 2:
+				return newResponse(404, notFoundBody())
+			case p == "/namespaces/default/pods/starfish":
+				pod := newPod("starfish")
+				return newResponse(200, &pod)
+			case p == "/namespaces/default/pods/otter":
+				pod := newPod("otter")
+				return newResponse(200, &pod)
+			default:
+				t.Fatalf("unexpected request: %s %s", m, p)
+				return nil, nil
+			}
+		}),
+	}
+
+	starfish := newPodList("starfish")
+	resources, err := c.Build(objBody(&starfish), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForDelete(resources, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if gets["/namespaces/default/pods/starfish"] != 3 {
+		t.Errorf("expected the pod to be checked 3 times, got %d", gets["/namespaces/default/pods/starfish"])
+	}
+
+	otter := newPodList("otter")
+	resources, err = c.Build(objBody(&otter), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForDelete(resources, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), `timed out waiting for the deletion of Pod "otter"`) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
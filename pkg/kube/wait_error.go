@@ -0,0 +1,316 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+const (
+	// maxDiagnosedPods is the number of unready pods inspected per resource.
+	maxDiagnosedPods = 3
+	// maxWarningEvents is the number of warning events reported per object.
+	maxWarningEvents = 5
+)
+
+// WaitError is returned when resources are not ready before the wait times out.
+// It lists the resources that were not ready along with what is known about
+// why.
+type WaitError struct {
+	Timeout time.Duration
+	Unready []UnreadyResource
+}
+
+// UnreadyResource describes a resource that was not ready when waiting for it
+// timed out.
+type UnreadyResource struct {
+	Kind      string
+	Name      string
+	Namespace string
+	// Reason is the last reason the resource was found not to be ready.
+	Reason string
+	// Containers lists the containers of the pods of the resource that are
+	// waiting or have been terminated.
+	Containers []ContainerDiagnostic
+	// Events lists the most recent warning events of the resource and its pods.
+	Events []WarningEvent
+}
+
+// ContainerDiagnostic describes the state of a container that is not running
+// normally.
+type ContainerDiagnostic struct {
+	Pod          string
+	Container    string
+	RestartCount int32
+	// WaitingReason and WaitingMessage are set when the container is waiting
+	// to start, e.g. with reason CrashLoopBackOff or ImagePullBackOff.
+	WaitingReason  string
+	WaitingMessage string
+	// Terminated is the current or last termination of the container.
+	Terminated *ContainerTermination
+}
+
+// ContainerTermination describes how a container terminated.
+type ContainerTermination struct {
+	Reason   string
+	ExitCode int32
+	Message  string
+}
+
+// WarningEvent is a summary of a Kubernetes warning event.
+type WarningEvent struct {
+	// Object is the object the event is about, as "Kind/name".
+	Object   string
+	Reason   string
+	Message  string
+	Count    int32
+	LastSeen time.Time
+}
+
+func (e *WaitError) Error() string {
+	var b strings.Builder
+	b.WriteString(wait.ErrWaitTimeout.Error())
+	if len(e.Unready) == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, ": %d resource(s) not ready after %s", len(e.Unready), e.Timeout)
+	for _, r := range e.Unready {
+		fmt.Fprintf(&b, "\n%s %s/%s", r.Kind, r.Namespace, r.Name)
+		if r.Reason != "" {
+			fmt.Fprintf(&b, ": %s", r.Reason)
+		}
+		for _, c := range r.Containers {
+			fmt.Fprintf(&b, "\n  %s", c)
+		}
+		for _, ev := range r.Events {
+			fmt.Fprintf(&b, "\n  %s", ev)
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns wait.ErrWaitTimeout.
+func (e *WaitError) Unwrap() error { return wait.ErrWaitTimeout }
+
+// Cause returns wait.ErrWaitTimeout.
+func (e *WaitError) Cause() error { return wait.ErrWaitTimeout }
+
+func (c ContainerDiagnostic) String() string {
+	s := fmt.Sprintf("pod %s container %q", c.Pod, c.Container)
+	if c.WaitingReason != "" {
+		s += fmt.Sprintf(" is waiting: %s", c.WaitingReason)
+		if c.WaitingMessage != "" {
+			s += fmt.Sprintf(" (%s)", c.WaitingMessage)
+		}
+	}
+	if c.RestartCount > 0 {
+		s += fmt.Sprintf(", restarted %d times", c.RestartCount)
+	}
+	if t := c.Terminated; t != nil {
+		s += fmt.Sprintf(", terminated: %s with exit code %d", t.Reason, t.ExitCode)
+		if t.Message != "" {
+			s += fmt.Sprintf(": %s", strings.TrimSpace(t.Message))
+		}
+	}
+	return s
+}
+
+func (e WarningEvent) String() string {
+	s := fmt.Sprintf("%s warning %s: %s", e.Object, e.Reason, e.Message)
+	if e.Count > 1 {
+		s += fmt.Sprintf(" (x%d)", e.Count)
+	}
+	return s
+}
+
+// timeoutError builds the error returned when waiting for the resources timed
+// out, collecting diagnostics for the resources that were not ready.
+func (w *waiter) timeoutError(resources ResourceList) error {
+	werr := &WaitError{Timeout: w.timeout}
+	for _, v := range resources {
+		r, ok := w.observed[readinessKey(v)]
+		if ok && r.Ready {
+			continue
+		}
+		if !ok {
+			r = ResourceReadiness{Name: v.Name, Namespace: v.Namespace, Reason: "readiness was never checked"}
+			if v.Mapping != nil {
+				r.Kind = v.Mapping.GroupVersionKind.Kind
+			}
+		}
+		werr.Unready = append(werr.Unready, w.diagnose(v, r))
+	}
+	return werr
+}
+
+// diagnose gathers the state of the containers and the warning events of an
+// unready resource. Failing to gather diagnostics is logged and otherwise
+// ignored.
+func (w *waiter) diagnose(v *resource.Info, r ResourceReadiness) UnreadyResource {
+	u := UnreadyResource{Kind: r.Kind, Name: r.Name, Namespace: r.Namespace, Reason: r.Reason}
+
+	events, err := w.warningEvents(v.Namespace, r.Kind, v.Name)
+	if err != nil {
+		w.log("unable to list events of %s %s/%s: %s", r.Kind, v.Namespace, v.Name, err)
+	}
+	u.Events = append(u.Events, events...)
+
+	pods, err := w.unreadyPods(v)
+	if err != nil {
+		w.log("unable to list pods of %s %s/%s: %s", r.Kind, v.Namespace, v.Name, err)
+	}
+	for _, pod := range pods {
+		u.Containers = append(u.Containers, containerDiagnostics(&pod)...)
+		events, err := w.warningEvents(pod.Namespace, "Pod", pod.Name)
+		if err != nil {
+			w.log("unable to list events of pod %s/%s: %s", pod.Namespace, pod.Name, err)
+		}
+		u.Events = append(u.Events, events...)
+	}
+	return u
+}
+
+// unreadyPods returns up to maxDiagnosedPods pods of a workload that are not
+// ready.
+func (w *waiter) unreadyPods(v *resource.Info) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	switch obj := AsVersioned(v).(type) {
+	case *corev1.Pod:
+		pod, err := w.c.CoreV1().Pods(v.Namespace).Get(context.Background(), v.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		pods = []corev1.Pod{*pod}
+	case *appsv1.Deployment, *appsv1beta1.Deployment, *appsv1beta2.Deployment, *extensionsv1beta1.Deployment,
+		*appsv1.DaemonSet, *appsv1beta2.DaemonSet, *extensionsv1beta1.DaemonSet,
+		*appsv1.StatefulSet, *appsv1beta1.StatefulSet, *appsv1beta2.StatefulSet,
+		*appsv1.ReplicaSet, *appsv1beta2.ReplicaSet, *extensionsv1beta1.ReplicaSet,
+		*corev1.ReplicationController, *batchv1.Job:
+		var err error
+		if pods, err = w.podsforObject(v.Namespace, obj); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	var unready []corev1.Pod
+	for _, pod := range pods {
+		if podReady(&pod) || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		unready = append(unready, pod)
+		if len(unready) == maxDiagnosedPods {
+			break
+		}
+	}
+	return unready, nil
+}
+
+// warningEvents returns the most recent warning events of an object.
+func (w *waiter) warningEvents(namespace, kind, name string) ([]WarningEvent, error) {
+	selector := fields.Set{
+		"involvedObject.name": name,
+		"involvedObject.kind": kind,
+		"type":                corev1.EventTypeWarning,
+	}.AsSelector().String()
+	list, err := w.c.CoreV1().Events(namespace).List(context.Background(), metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	var events []WarningEvent
+	for _, e := range list.Items {
+		// Not every client honours field selectors, so filter again.
+		if e.Type != corev1.EventTypeWarning || e.InvolvedObject.Name != name || e.InvolvedObject.Kind != kind {
+			continue
+		}
+		lastSeen := e.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = e.EventTime.Time
+		}
+		events = append(events, WarningEvent{
+			Object:   fmt.Sprintf("%s/%s", kind, name),
+			Reason:   e.Reason,
+			Message:  e.Message,
+			Count:    e.Count,
+			LastSeen: lastSeen,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastSeen.After(events[j].LastSeen)
+	})
+	if len(events) > maxWarningEvents {
+		events = events[:maxWarningEvents]
+	}
+	return events, nil
+}
+
+// containerDiagnostics returns the containers of a pod that are waiting or have
+// been terminated.
+func containerDiagnostics(pod *corev1.Pod) []ContainerDiagnostic {
+	var diags []ContainerDiagnostic
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		d := ContainerDiagnostic{Pod: pod.Name, Container: cs.Name, RestartCount: cs.RestartCount}
+		if waiting := cs.State.Waiting; waiting != nil {
+			d.WaitingReason = waiting.Reason
+			d.WaitingMessage = waiting.Message
+		}
+		terminated := cs.State.Terminated
+		if terminated == nil {
+			terminated = cs.LastTerminationState.Terminated
+		}
+		if terminated != nil && (terminated.ExitCode != 0 || terminated.Reason != "Completed") {
+			d.Terminated = &ContainerTermination{
+				Reason:   terminated.Reason,
+				ExitCode: terminated.ExitCode,
+				Message:  terminated.Message,
+			}
+		}
+		if d.WaitingReason == "" && d.Terminated == nil {
+			continue
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// podReady returns whether the pod has the Ready condition.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
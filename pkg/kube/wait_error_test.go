@@ -0,0 +1,135 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube // import "helm.sh/helm/v3/pkg/kube"
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newWaitInfo(obj runtime.Object, name string, gvk schema.GroupVersionKind) *resource.Info {
+	return &resource.Info{
+		Name:      name,
+		Namespace: defaultNamespace,
+		Object:    obj,
+		Mapping:   &meta.RESTMapping{GroupVersionKind: gvk},
+	}
+}
+
+func newWarningEvent(name, kind, objName, reason, message string, count int32, lastSeen time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: defaultNamespace},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: objName, Namespace: defaultNamespace},
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		Message:        message,
+		Count:          count,
+		LastTimestamp:  metav1.NewTime(lastSeen),
+	}
+}
+
+func TestWaitTimeoutError(t *testing.T) {
+	now := time.Now()
+	dep := newDeployment("web", 1, 1, 0)
+	claim := newPersistentVolumeClaim("data", corev1.ClaimPending)
+
+	crashing := newPodWithCondition("web-1", corev1.ConditionFalse)
+	crashing.Labels = map[string]string{"name": "web"}
+	crashing.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:         "app",
+		RestartCount: 4,
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+			Reason:  "CrashLoopBackOff",
+			Message: "back-off 40s restarting failed container",
+		}},
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			Reason:   "Error",
+			ExitCode: 1,
+			Message:  "panic: no database\n",
+		}},
+	}, {
+		Name:  "sidecar",
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}}
+	ready := newPodWithCondition("web-2", corev1.ConditionTrue)
+	ready.Labels = map[string]string{"name": "web"}
+
+	c := fake.NewSimpleClientset(dep, claim, crashing, ready,
+		newWarningEvent("e1", "Pod", "web-1", "BackOff", "Back-off restarting failed container", 7, now),
+		newWarningEvent("e2", "Pod", "web-1", "Unhealthy", "Readiness probe failed", 1, now.Add(-time.Minute)),
+		newWarningEvent("e3", "PersistentVolumeClaim", "data", "ProvisioningFailed", `storageclass.storage.k8s.io "fast" not found`, 1, now),
+		newWarningEvent("e4", "Pod", "web-2", "Unhealthy", "Readiness probe failed", 1, now),
+	)
+	w := &waiter{c: c, log: nopLogger, timeout: 5 * time.Minute}
+
+	depInfo := newWaitInfo(dep, "web", appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	claimInfo := newWaitInfo(claim, "data", corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"))
+	w.reason = "Deployment is not ready: default/web. 0 out of 1 expected pods are ready"
+	w.observe(depInfo, false)
+	w.reason = "PersistentVolumeClaim is not bound: default/data"
+	w.observe(claimInfo, false)
+
+	err := w.timeoutError(ResourceList{depInfo, claimInfo})
+
+	var werr *WaitError
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected a *WaitError, got %T", err)
+	}
+	if !errors.Is(err, wait.ErrWaitTimeout) {
+		t.Error("expected the error to wrap wait.ErrWaitTimeout")
+	}
+	if len(werr.Unready) != 2 {
+		t.Fatalf("expected 2 unready resources, got %d", len(werr.Unready))
+	}
+
+	expected := `timed out waiting for the condition: 2 resource(s) not ready after 5m0s
+Deployment default/web: Deployment is not ready: default/web. 0 out of 1 expected pods are ready
+  pod web-1 container "app" is waiting: CrashLoopBackOff (back-off 40s restarting failed container), restarted 4 times, terminated: Error with exit code 1: panic: no database
+  Pod/web-1 warning BackOff: Back-off restarting failed container (x7)
+  Pod/web-1 warning Unhealthy: Readiness probe failed
+PersistentVolumeClaim default/data: PersistentVolumeClaim is not bound: default/data
+  PersistentVolumeClaim/data warning ProvisioningFailed: storageclass.storage.k8s.io "fast" not found`
+	if err.Error() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, err.Error())
+	}
+}
+
+func TestWaitForResourcesTimeout(t *testing.T) {
+	claim := newPersistentVolumeClaim("data", corev1.ClaimPending)
+	w := &waiter{c: fake.NewSimpleClientset(claim), log: nopLogger, timeout: time.Millisecond}
+	info := newWaitInfo(claim, "data", corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"))
+
+	err := w.waitForResources(ResourceList{info}, false)
+	var werr *WaitError
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected a *WaitError, got %v", err)
+	}
+	if len(werr.Unready) != 1 || werr.Unready[0].Name != "data" {
+		t.Errorf("expected data to be reported unready, got %+v", werr.Unready)
+	}
+}
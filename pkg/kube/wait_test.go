@@ -18,14 +18,17 @@ package kube // import "helm.sh/helm/v3/pkg/kube"
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -479,6 +482,60 @@ func newPersistentVolumeClaim(name string, phase corev1.PersistentVolumeClaimPha
 	}
 }
 
+func Test_waiter_observeReadiness(t *testing.T) {
+	claim := newPersistentVolumeClaim("foo", corev1.ClaimPending)
+	c := fake.NewSimpleClientset(claim)
+	var observed []ResourceReadiness
+	w := &waiter{
+		c:   c,
+		log: nopLogger,
+		observer: func(r ResourceReadiness) {
+			observed = append(observed, r)
+		},
+	}
+	info := &resource.Info{
+		Name:      claim.Name,
+		Namespace: claim.Namespace,
+		Object:    claim,
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"),
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		ready, err := w.isReady(info, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.observe(info, ready)
+	}
+
+	claim.Status.Phase = corev1.ClaimBound
+	if _, err := c.CoreV1().PersistentVolumeClaims(defaultNamespace).UpdateStatus(context.Background(), claim, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ready, err := w.isReady(info, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.observe(info, ready)
+
+	expected := []ResourceReadiness{{
+		Kind:      "PersistentVolumeClaim",
+		Name:      "foo",
+		Namespace: defaultNamespace,
+		Reason:    "PersistentVolumeClaim is not bound: default/foo",
+	}, {
+		Kind:      "PersistentVolumeClaim",
+		Name:      "foo",
+		Namespace: defaultNamespace,
+		Ready:     true,
+	}}
+	if !reflect.DeepEqual(observed, expected) {
+		t.Errorf("expected %+v, got %+v", expected, observed)
+	}
+}
+
 func newJob(name string, backoffLimit, completions, succeeded, failed int) *batchv1.Job {
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,32 @@
+/*
+Copyright The Helm Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+// Audit records who performed the operation of a release revision, and how.
+type Audit struct {
+	// User is the Kubernetes user that performed the operation, if known.
+	User string `json:"user,omitempty"`
+	// HelmVersion is the version of Helm that performed the operation.
+	HelmVersion string `json:"helm_version,omitempty"`
+	// Hostname is the name of the host the operation was performed from.
+	Hostname string `json:"hostname,omitempty"`
+	// Command is the command line of the operation, with its secrets redacted.
+	Command []string `json:"command,omitempty"`
+	// ValuesFiles are the sources of the values files of the operation.
+	ValuesFiles []string `json:"values_files,omitempty"`
+	// CI holds the environment of the CI job that performed the operation.
+	CI map[string]string `json:"ci,omitempty"`
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package release
 
 import (
+	gotime "time"
+
 	"helm.sh/helm/v3/pkg/time"
 )
 
@@ -24,6 +26,14 @@ import (
 type HookEvent string
 
 // Hook event types
+//
+// An install runs the pre-install hooks, creates the resources and runs the
+// post-install hooks. An upgrade runs the pre-upgrade hooks, updates the
+// resources, runs the post-upgrade hooks and then the health-check hooks. When
+// an install or an upgrade fails, its post-install-failure or
+// post-upgrade-failure hooks run before the release is uninstalled or rolled
+// back, which runs the pre-rollback and post-rollback hooks of the revision
+// rolled back to. A test runs the pre-test, test and post-test hooks.
 const (
 	HookPreInstall   HookEvent = "pre-install"
 	HookPostInstall  HookEvent = "post-install"
@@ -34,6 +44,20 @@ const (
 	HookPreRollback  HookEvent = "pre-rollback"
 	HookPostRollback HookEvent = "post-rollback"
 	HookTest         HookEvent = "test"
+	// HookHealthCheck hooks verify the health of a release once it has been
+	// upgraded. A failure rolls the release back.
+	HookHealthCheck HookEvent = "health-check"
+	// HookPostInstallFailure hooks run once an install has failed, before
+	// the release is uninstalled if the install is atomic.
+	HookPostInstallFailure HookEvent = "post-install-failure"
+	// HookPostUpgradeFailure hooks run once an upgrade has failed, before
+	// the release is rolled back if the upgrade is atomic.
+	HookPostUpgradeFailure HookEvent = "post-upgrade-failure"
+	// HookPreTest hooks run before the test hooks. If one fails, the tests
+	// are not run.
+	HookPreTest HookEvent = "pre-test"
+	// HookPostTest hooks run after the test hooks, whether they passed or not.
+	HookPostTest HookEvent = "post-test"
 )
 
 func (x HookEvent) String() string { return string(x) }
@@ -59,6 +83,23 @@ const HookWeightAnnotation = "helm.sh/hook-weight"
 // HookDeleteAnnotation is the label name for the delete policy for a hook
 const HookDeleteAnnotation = "helm.sh/hook-delete-policy"
 
+// HookTimeoutAnnotation is the label name for the time to wait for a hook to
+// complete, such as "10m", overriding the timeout of the operation
+const HookTimeoutAnnotation = "helm.sh/hook-timeout"
+
+// HookRetriesAnnotation is the label name for the number of times a failed
+// hook is retried
+const HookRetriesAnnotation = "helm.sh/hook-retries"
+
+// HookRetryBackoffAnnotation is the label name for the time to wait before
+// retrying a failed hook, such as "30s", doubled after each retry up to 5
+// minutes
+const HookRetryBackoffAnnotation = "helm.sh/hook-retry-backoff"
+
+// HookAllowFailureAnnotation is the label name for whether the failure of a
+// hook is allowed, without failing the operation
+const HookAllowFailureAnnotation = "helm.sh/hook-allow-failure"
+
 // Hook defines a hook object.
 type Hook struct {
 	Name string `json:"name,omitempty"`
@@ -76,6 +117,17 @@ type Hook struct {
 	Weight int `json:"weight,omitempty"`
 	// DeletePolicies are the policies that indicate when to delete the hook
 	DeletePolicies []HookDeletePolicy `json:"delete_policies,omitempty"`
+	// Timeout is the time to wait for the hook to complete, including its
+	// retries. If zero, the timeout of the operation is used.
+	Timeout gotime.Duration `json:"timeout,omitempty"`
+	// Retries is the number of times the hook is retried if it fails.
+	Retries int `json:"retries,omitempty"`
+	// RetryBackoff is the time to wait before the first retry of the hook,
+	// doubled after each retry up to 5 minutes.
+	RetryBackoff gotime.Duration `json:"retry_backoff,omitempty"`
+	// AllowFailure indicates that the failure of the hook does not fail the
+	// operation.
+	AllowFailure bool `json:"allow_failure,omitempty"`
 }
 
 // A HookExecution records the result for the last execution of a hook for a given release.
@@ -86,6 +138,18 @@ type HookExecution struct {
 	CompletedAt time.Time `json:"completed_at,omitempty"`
 	// Phase indicates whether the hook completed successfully
 	Phase HookPhase `json:"phase"`
+	// Attempts is the number of times the hook was run, including its retries.
+	Attempts int `json:"attempts,omitempty"`
+	// Reason tells why a failed hook failed, such as the termination reasons
+	// of the containers of its pods, one per line.
+	Reason string `json:"reason,omitempty"`
+	// Logs holds the end of the logs of the containers of a failed hook, or
+	// of a test hook.
+	Logs string `json:"logs,omitempty"`
+	// ExitCode is the exit code of the containers of a failed hook, or of a
+	// test hook: the exit code of the first container that failed, or 0. It
+	// is nil if no container terminated.
+	ExitCode *int32 `json:"exit_code,omitempty"`
 }
 
 // A HookPhase indicates the state of a hook execution
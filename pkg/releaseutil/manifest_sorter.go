@@ -22,6 +22,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"sigs.k8s.io/yaml"
@@ -53,15 +54,20 @@ type result struct {
 // TODO: Refactor this out. It's here because naming conventions were not followed through.
 // So fix the Test hook names and then remove this.
 var events = map[string]release.HookEvent{
-	release.HookPreInstall.String():   release.HookPreInstall,
-	release.HookPostInstall.String():  release.HookPostInstall,
-	release.HookPreDelete.String():    release.HookPreDelete,
-	release.HookPostDelete.String():   release.HookPostDelete,
-	release.HookPreUpgrade.String():   release.HookPreUpgrade,
-	release.HookPostUpgrade.String():  release.HookPostUpgrade,
-	release.HookPreRollback.String():  release.HookPreRollback,
-	release.HookPostRollback.String(): release.HookPostRollback,
-	release.HookTest.String():         release.HookTest,
+	release.HookPreInstall.String():         release.HookPreInstall,
+	release.HookPostInstall.String():        release.HookPostInstall,
+	release.HookPostInstallFailure.String(): release.HookPostInstallFailure,
+	release.HookPreDelete.String():          release.HookPreDelete,
+	release.HookPostDelete.String():         release.HookPostDelete,
+	release.HookPreUpgrade.String():         release.HookPreUpgrade,
+	release.HookPostUpgrade.String():        release.HookPostUpgrade,
+	release.HookPostUpgradeFailure.String(): release.HookPostUpgradeFailure,
+	release.HookPreRollback.String():        release.HookPreRollback,
+	release.HookPostRollback.String():       release.HookPostRollback,
+	release.HookPreTest.String():            release.HookPreTest,
+	release.HookTest.String():               release.HookTest,
+	release.HookPostTest.String():           release.HookPostTest,
+	release.HookHealthCheck.String():        release.HookHealthCheck,
 	// Support test-success for backward compatibility with Helm 2 tests
 	"test-success": release.HookTest,
 }
@@ -130,6 +136,17 @@ func SortManifests(files map[string]string, apis chartutil.VersionSet, ordering
 //  metadata:
 // 		annotations:
 // 			helm.sh/hook-delete-policy: hook-succeeded
+//
+// To determine how to run the hook, it looks for a YAML structure like this:
+//
+//  kind: SomeKind
+//  apiVersion: v1
+//  metadata:
+// 		annotations:
+// 			helm.sh/hook-timeout: 10m
+// 			helm.sh/hook-retries: "3"
+// 			helm.sh/hook-retry-backoff: 30s
+// 			helm.sh/hook-allow-failure: "true"
 func (file *manifestFile) sort(result *result) error {
 	// Go through manifests in order found in file (function `SplitManifests` creates integer-sortable keys)
 	var sortedEntryKeys []string
@@ -193,6 +210,10 @@ func (file *manifestFile) sort(result *result) error {
 			continue
 		}
 
+		if err := parseHookExecution(entry, h); err != nil {
+			return errors.Wrapf(err, "hook %s in %s", h.Name, file.path)
+		}
+
 		result.hooks = append(result.hooks, h)
 
 		operateAnnotationValues(entry, release.HookDeleteAnnotation, func(value string) {
@@ -222,6 +243,44 @@ func calculateHookWeight(entry SimpleHead) int {
 	return hw
 }
 
+// parseHookExecution sets how to run a hook from the hook timeout, retries,
+// retry backoff and allow failure annotations.
+func parseHookExecution(entry SimpleHead, h *release.Hook) error {
+	annotations := entry.Metadata.Annotations
+	var err error
+	if v, ok := annotations[release.HookTimeoutAnnotation]; ok {
+		if h.Timeout, err = parseHookDuration(release.HookTimeoutAnnotation, v); err != nil {
+			return err
+		}
+	}
+	if v, ok := annotations[release.HookRetriesAnnotation]; ok {
+		h.Retries, err = strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || h.Retries < 0 {
+			return errors.Errorf("invalid %s annotation %q: must be a non-negative integer", release.HookRetriesAnnotation, v)
+		}
+	}
+	if v, ok := annotations[release.HookRetryBackoffAnnotation]; ok {
+		if h.RetryBackoff, err = parseHookDuration(release.HookRetryBackoffAnnotation, v); err != nil {
+			return err
+		}
+	}
+	if v, ok := annotations[release.HookAllowFailureAnnotation]; ok {
+		h.AllowFailure, err = strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return errors.Errorf("invalid %s annotation %q: must be true or false", release.HookAllowFailureAnnotation, v)
+		}
+	}
+	return nil
+}
+
+func parseHookDuration(annotation, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid %s annotation %q: must be a positive duration, such as \"90s\" or \"10m\"", annotation, value)
+	}
+	return d, nil
+}
+
 // operateAnnotationValues finds the given annotation and runs the operate function with the value of that annotation
 func operateAnnotationValues(entry SimpleHead, annotation string, operate func(p string)) {
 	if dps, ok := entry.Metadata.Annotations[annotation]; ok {
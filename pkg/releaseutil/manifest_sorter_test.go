@@ -19,6 +19,7 @@ package releaseutil
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"sigs.k8s.io/yaml"
 
@@ -226,3 +227,65 @@ metadata:
 		}
 	}
 }
+
+func TestSortManifestsHookExecution(t *testing.T) {
+	manifests := map[string]string{
+		"templates/migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-upgrade
+    "helm.sh/hook-timeout": 10m
+    "helm.sh/hook-retries": "3"
+    "helm.sh/hook-retry-backoff": 30s
+    "helm.sh/hook-allow-failure": "true"
+`,
+		"templates/notify.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: notify
+  annotations:
+    "helm.sh/hook": post-upgrade
+`,
+	}
+
+	hs, _, err := SortManifests(manifests, chartutil.VersionSet{"v1", "batch/v1"}, InstallOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 2 {
+		t.Fatalf("expected 2 hooks, got %d", len(hs))
+	}
+	for _, h := range hs {
+		switch h.Name {
+		case "migrate":
+			if h.Timeout != 10*time.Minute || h.Retries != 3 || h.RetryBackoff != 30*time.Second || !h.AllowFailure {
+				t.Errorf("unexpected execution of hook migrate: timeout %s, retries %d, retry backoff %s, allow failure %t", h.Timeout, h.Retries, h.RetryBackoff, h.AllowFailure)
+			}
+		case "notify":
+			if h.Timeout != 0 || h.Retries != 0 || h.RetryBackoff != 0 || h.AllowFailure {
+				t.Errorf("expected hook notify to run by default, got timeout %s, retries %d, retry backoff %s, allow failure %t", h.Timeout, h.Retries, h.RetryBackoff, h.AllowFailure)
+			}
+		}
+	}
+
+	for annotation, value := range map[string]string{
+		release.HookTimeoutAnnotation:      "ten minutes",
+		release.HookRetriesAnnotation:      "-1",
+		release.HookRetryBackoffAnnotation: "0s",
+		release.HookAllowFailureAnnotation: "maybe",
+	} {
+		manifests := map[string]string{"templates/migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-upgrade
+    "` + annotation + `": "` + value + `"
+`}
+		if _, _, err := SortManifests(manifests, chartutil.VersionSet{"v1", "batch/v1"}, InstallOrder); err == nil {
+			t.Errorf("expected an error for the %s annotation %q", annotation, value)
+		}
+	}
+}
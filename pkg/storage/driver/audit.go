@@ -0,0 +1,63 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"strings"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// AuditUserLabel is the label of the user in the audit record of a release,
+// set by the Secrets, ConfigMaps, File and Memory drivers. The SQL driver,
+// whose releases can only be queried by the labels stored in its columns,
+// does not set it: the user is only recorded in the audit record.
+const AuditUserLabel = "auditUser"
+
+// AuditUserLabelValue returns the value of the AuditUserLabel of the releases
+// of user. Label values are at most 63 alphanumerics, '-', '_' or '.', begin
+// and end with an alphanumeric: the other characters are replaced with '.',
+// so that "system:serviceaccount:ci:deployer" is labeled
+// "system.serviceaccount.ci.deployer".
+func AuditUserLabelValue(user string) string {
+	value := []byte(user)
+	for i, c := range value {
+		if !isLabelAlphanumeric(c) && c != '-' && c != '_' && c != '.' {
+			value[i] = '.'
+		}
+	}
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.TrimFunc(string(value), func(r rune) bool {
+		return r > 0x7f || !isLabelAlphanumeric(byte(r))
+	})
+}
+
+func isLabelAlphanumeric(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// setAuditLabels sets the labels of the audit record of rls.
+func setAuditLabels(lbs labels, rls *rspb.Release) {
+	if rls.Info == nil || rls.Info.Audit == nil {
+		return
+	}
+	if user := AuditUserLabelValue(rls.Info.Audit.User); user != "" {
+		lbs.set(AuditUserLabel, user)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"strings"
+	"testing"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+func TestAuditUserLabelValue(t *testing.T) {
+	tests := map[string]string{
+		"alice":                             "alice",
+		"system:serviceaccount:ci:deployer": "system.serviceaccount.ci.deployer",
+		"alice@example.com":                 "alice.example.com",
+		"-admin-":                           "admin",
+		"élise":                             "lise",
+		strings.Repeat("a", 70):             strings.Repeat("a", 63),
+		"":                                  "",
+	}
+	for user, expected := range tests {
+		if got := AuditUserLabelValue(user); got != expected {
+			t.Errorf("expected %q to be labeled %q, got %q", user, expected, got)
+		}
+	}
+}
+
+func TestQueryAuditUser(t *testing.T) {
+	audited := func(name, user string) *rspb.Release {
+		rls := releaseStub(name, 1, "default", rspb.StatusDeployed)
+		rls.Info.Audit = &rspb.Audit{User: user}
+		return rls
+	}
+	rls := []*rspb.Release{
+		audited("rls-a", "system:serviceaccount:ci:deployer"),
+		audited("rls-b", "alice"),
+		releaseStub("rls-c", 1, "default", rspb.StatusDeployed),
+	}
+	mem := NewMemory()
+	for _, r := range rls {
+		if err := mem.Create(testKey(r.Name, r.Version), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, d := range map[string]Driver{
+		"secrets":    newTestFixtureSecrets(t, rls...),
+		"configmaps": newTestFixtureCfgMaps(t, rls...),
+		"memory":     mem,
+	} {
+		found, err := d.Query(map[string]string{AuditUserLabel: AuditUserLabelValue("system:serviceaccount:ci:deployer")})
+		if err != nil {
+			t.Errorf("%s: failed to query by audit user: %s", name, err)
+			continue
+		}
+		if len(found) != 1 || found[0].Name != "rls-a" {
+			t.Errorf("%s: expected to find rls-a, got %d releases", name, len(found))
+		}
+	}
+}
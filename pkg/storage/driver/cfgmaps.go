@@ -27,13 +27,17 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 
 	rspb "helm.sh/helm/v3/pkg/release"
 )
 
 var _ Driver = (*ConfigMaps)(nil)
+var _ Watcher = (*ConfigMaps)(nil)
 
 // ConfigMapsDriverName is the string name of the driver.
 const ConfigMapsDriverName = "ConfigMap"
@@ -41,6 +45,8 @@ const ConfigMapsDriverName = "ConfigMap"
 // ConfigMaps is a wrapper around an implementation of a kubernetes
 // ConfigMapsInterface.
 type ConfigMaps struct {
+	codec
+	chartSharing
 	impl corev1.ConfigMapInterface
 	Log  func(string, ...interface{})
 }
@@ -73,11 +79,12 @@ func (cfgmaps *ConfigMaps) Get(key string) (*rspb.Release, error) {
 		return nil, err
 	}
 	// found the configmap, decode the base64 data string
-	r, err := decodeRelease(obj.Data["release"])
+	r, err := cfgmaps.decode(obj, newChartLoader(cfgmaps))
 	if err != nil {
 		cfgmaps.Log("get: failed to decode data %q: %s", key, err)
 		return nil, err
 	}
+	r.Labels = obj.ObjectMeta.Labels
 	// return the release object
 	return r, nil
 }
@@ -96,11 +103,13 @@ func (cfgmaps *ConfigMaps) List(filter func(*rspb.Release) bool) ([]*rspb.Releas
 	}
 
 	var results []*rspb.Release
+	charts := newChartLoader(cfgmaps)
 
 	// iterate over the configmaps object list
 	// and decode each release
-	for _, item := range list.Items {
-		rls, err := decodeRelease(item.Data["release"])
+	for i := range list.Items {
+		item := &list.Items[i]
+		rls, err := cfgmaps.decode(item, charts)
 		if err != nil {
 			cfgmaps.Log("list: failed to decode release: %v: %s", item, err)
 			continue
@@ -139,17 +148,42 @@ func (cfgmaps *ConfigMaps) Query(labels map[string]string) ([]*rspb.Release, err
 	}
 
 	var results []*rspb.Release
-	for _, item := range list.Items {
-		rls, err := decodeRelease(item.Data["release"])
+	charts := newChartLoader(cfgmaps)
+	for i := range list.Items {
+		rls, err := cfgmaps.decode(&list.Items[i], charts)
 		if err != nil {
 			cfgmaps.Log("query: failed to decode release: %s", err)
 			continue
 		}
+		rls.Labels = list.Items[i].ObjectMeta.Labels
 		results = append(results, rls)
 	}
 	return results, nil
 }
 
+// Watch streams the events of the releases with an informer.
+func (cfgmaps *ConfigMaps) Watch(ctx context.Context) (<-chan Event, error) {
+	selector := kblabels.Set{"owner": "helm"}.AsSelector().String()
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = selector
+			return cfgmaps.impl.List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = selector
+			return cfgmaps.impl.Watch(ctx, opts)
+		},
+	}
+	return watchObjects(ctx, lw, &v1.ConfigMap{}, func(obj interface{}) (*rspb.Release, error) {
+		cfgmap := obj.(*v1.ConfigMap)
+		rls, err := cfgmaps.decode(cfgmap, newChartLoader(cfgmaps))
+		if rls != nil {
+			rls.Labels = cfgmap.ObjectMeta.Labels
+		}
+		return rls, err
+	}, cfgmaps.Log)
+}
+
 // Create creates a new ConfigMap holding the release. If the
 // ConfigMap already exists, ErrReleaseExists is returned.
 func (cfgmaps *ConfigMaps) Create(key string, rls *rspb.Release) error {
@@ -159,14 +193,47 @@ func (cfgmaps *ConfigMaps) Create(key string, rls *rspb.Release) error {
 	lbs.init()
 	lbs.set("createdAt", strconv.Itoa(int(time.Now().Unix())))
 
-	// create a new configmap to hold the release
-	obj, err := newConfigMapsObject(key, rls, lbs)
+	// create a new configmap to hold the release, without its chart
+	stripped, ch, err := cfgmaps.splitSharedChart(rls)
+	if err != nil {
+		cfgmaps.Log("create: failed to encode release %q: %s", rls.Name, err)
+		return err
+	}
+	obj, err := newConfigMapsObject(key, stripped, lbs)
+	if err == nil {
+		obj.Data["release"], err = cfgmaps.seal(obj.Data["release"])
+	}
 	if err != nil {
 		cfgmaps.Log("create: failed to encode release %q: %s", rls.Name, err)
 		return err
 	}
+	// split the release in chunks if it does not fit in a single configmap
+	var index map[string]string
+	if len(obj.Data["release"]) > releaseChunkSize {
+		if _, err := cfgmaps.impl.Get(context.Background(), key, metav1.GetOptions{}); err == nil {
+			return ErrReleaseExists
+		}
+		if index, err = cfgmaps.chunk(obj); err != nil {
+			cfgmaps.Log("create: %s", err)
+			return err
+		}
+	}
+	if err := storeChart(cfgmaps, ch); err != nil {
+		if index != nil {
+			deleteReleaseChunks(cfgmaps, key, index)
+		}
+		cfgmaps.Log("create: %s", err)
+		return err
+	}
+	setConfigMapChart(obj, ch)
 	// push the configmap object out into the kubiverse
 	if _, err := cfgmaps.impl.Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+		if index != nil {
+			deleteReleaseChunks(cfgmaps, key, index)
+		}
+		if err := collectChart(cfgmaps, digestOf(ch)); err != nil {
+			cfgmaps.Log("create: %s", err)
+		}
 		if apierrors.IsAlreadyExists(err) {
 			return ErrReleaseExists
 		}
@@ -174,6 +241,12 @@ func (cfgmaps *ConfigMaps) Create(key string, rls *rspb.Release) error {
 		cfgmaps.Log("create: failed to create: %s", err)
 		return err
 	}
+	// the chart may have been collected by the deletion of its last other
+	// release in the meantime
+	if err := storeChart(cfgmaps, ch); err != nil {
+		cfgmaps.Log("create: %s", err)
+		return err
+	}
 	return nil
 }
 
@@ -186,32 +259,298 @@ func (cfgmaps *ConfigMaps) Update(key string, rls *rspb.Release) error {
 	lbs.init()
 	lbs.set("modifiedAt", strconv.Itoa(int(time.Now().Unix())))
 
-	// create a new configmap object to hold the release
-	obj, err := newConfigMapsObject(key, rls, lbs)
+	// create a new configmap object to hold the release, without its chart
+	stripped, ch, err := cfgmaps.splitSharedChart(rls)
 	if err != nil {
 		cfgmaps.Log("update: failed to encode release %q: %s", rls.Name, err)
 		return err
 	}
-	// push the configmap object out into the kubiverse
-	_, err = cfgmaps.impl.Update(context.Background(), obj, metav1.UpdateOptions{})
+	obj, err := newConfigMapsObject(key, stripped, lbs)
+	if err == nil {
+		obj.Data["release"], err = cfgmaps.seal(obj.Data["release"])
+	}
+	if err != nil {
+		cfgmaps.Log("update: failed to encode release %q: %s", rls.Name, err)
+		return err
+	}
+	current, err := cfgmaps.impl.Get(context.Background(), key, metav1.GetOptions{})
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ErrReleaseNotFound
+		}
+		cfgmaps.Log("update: failed to get %q: %s", key, err)
+		return err
+	}
+	// split the release in chunks if it does not fit in a single configmap
+	index, err := cfgmaps.chunk(obj)
+	if err != nil {
+		cfgmaps.Log("update: %s", err)
+		return err
+	}
+	previous := configMapIndex(current)
+	previousChart := current.Data[releaseChartKey]
+	if err := storeChart(cfgmaps, ch); err != nil {
+		if index != nil && (previous == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+			deleteReleaseChunks(cfgmaps, key, index)
+		}
+		cfgmaps.Log("update: %s", err)
+		return err
+	}
+	setConfigMapChart(obj, ch)
+	// push the configmap object out into the kubiverse
+	if _, err = cfgmaps.impl.Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		if index != nil && (previous == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+			deleteReleaseChunks(cfgmaps, key, index)
+		}
+		if digestOf(ch) != previousChart {
+			if err := collectChart(cfgmaps, digestOf(ch)); err != nil {
+				cfgmaps.Log("update: %s", err)
+			}
+		}
+		if apierrors.IsNotFound(err) {
+			return ErrReleaseNotFound
+		}
 		cfgmaps.Log("update: failed to update: %s", err)
 		return err
 	}
+	// remove the chunks of the previous content of the release
+	if previous != nil && (index == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+		if err := deleteReleaseChunks(cfgmaps, key, previous); err != nil {
+			cfgmaps.Log("update: %s", err)
+		}
+	}
+	// remove the previous chart of the release if no other release uses it
+	if previousChart != digestOf(ch) {
+		if err := collectChart(cfgmaps, previousChart); err != nil {
+			cfgmaps.Log("update: %s", err)
+		}
+	}
+	// the chart may have been collected by the deletion of its last other
+	// release in the meantime
+	if err := storeChart(cfgmaps, ch); err != nil {
+		cfgmaps.Log("update: %s", err)
+		return err
+	}
 	return nil
 }
 
 // Delete deletes the ConfigMap holding the release named by key.
 func (cfgmaps *ConfigMaps) Delete(key string) (rls *rspb.Release, err error) {
 	// fetch the release to check existence
-	if rls, err = cfgmaps.Get(key); err != nil {
+	obj, err := cfgmaps.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrReleaseNotFound
+		}
+		cfgmaps.Log("delete: failed to get %q: %s", key, err)
+		return nil, err
+	}
+	if rls, err = cfgmaps.decode(obj, newChartLoader(cfgmaps)); err != nil {
+		cfgmaps.Log("delete: failed to decode data %q: %s", key, err)
 		return nil, err
 	}
 	// delete the release
 	if err = cfgmaps.impl.Delete(context.Background(), key, metav1.DeleteOptions{}); err != nil {
 		return rls, err
 	}
-	return rls, nil
+	if index := configMapIndex(obj); index != nil {
+		err = deleteReleaseChunks(cfgmaps, key, index)
+	}
+	// remove the chart of the release if no other release uses it
+	if err := collectChart(cfgmaps, obj.Data[releaseChartKey]); err != nil {
+		cfgmaps.Log("delete: %s", err)
+	}
+	return rls, err
+}
+
+// RekeyCharts encrypts the charts of the releases stored apart from them
+// again with the current Encrypter.
+func (cfgmaps *ConfigMaps) RekeyCharts(releases []*rspb.Release) error {
+	return rekeyCharts(cfgmaps, releases)
+}
+
+// decode decodes the release held by a configmap, reassembling its chunks and
+// loading its chart.
+func (cfgmaps *ConfigMaps) decode(obj *v1.ConfigMap, charts *chartLoader) (*rspb.Release, error) {
+	encoded := obj.Data["release"]
+	if index := configMapIndex(obj); index != nil {
+		var err error
+		if encoded, err = readReleaseChunks(cfgmaps, obj.Name, index); err != nil {
+			return nil, err
+		}
+	}
+	rls, err := cfgmaps.decodeRelease(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return rls, charts.load(rls, obj.Data[releaseChartKey])
+}
+
+// chunk stores the release held by obj in chunks if it is too large for a
+// single configmap, and replaces it with the index record of the chunks.
+func (cfgmaps *ConfigMaps) chunk(obj *v1.ConfigMap) (map[string]string, error) {
+	index, err := writeReleaseChunks(cfgmaps, obj.Name, obj.Data["release"])
+	if err != nil || index == nil {
+		return nil, err
+	}
+	obj.Data = map[string]string{}
+	for k, v := range index {
+		obj.Data[k] = v
+	}
+	return index, nil
+}
+
+func (cfgmaps *ConfigMaps) createChunk(name, data string) error {
+	obj := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{releaseChunkLabel: "true"},
+		},
+		Data: map[string]string{"release": data},
+	}
+	_, err := cfgmaps.impl.Create(context.Background(), obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func (cfgmaps *ConfigMaps) getChunk(name string) (string, error) {
+	obj, err := cfgmaps.impl.Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return obj.Data["release"], nil
+}
+
+func (cfgmaps *ConfigMaps) deleteChunk(name string) error {
+	err := cfgmaps.impl.Delete(context.Background(), name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (cfgmaps *ConfigMaps) putChart(digest, encoded string) error {
+	name := chartKey(digest)
+	if _, err := cfgmaps.impl.Get(context.Background(), name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		return err
+	}
+	obj := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{releaseChartLabel: "true"},
+		},
+		Data: map[string]string{releaseChartKey: encoded},
+	}
+	// split the chart in chunks if it does not fit in a single configmap
+	index, err := writeReleaseChunks(cfgmaps, name, encoded)
+	if err != nil {
+		return err
+	}
+	if index != nil {
+		obj.Data = index
+	}
+	_, err = cfgmaps.impl.Create(context.Background(), obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// the chunks, named after the digest, are the ones of the stored chart
+		return nil
+	}
+	if err != nil && index != nil {
+		deleteReleaseChunks(cfgmaps, name, index)
+	}
+	return err
+}
+
+func (cfgmaps *ConfigMaps) replaceChart(digest, encoded string) error {
+	obj, err := cfgmaps.impl.Get(context.Background(), chartKey(digest), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	previous := configMapIndex(obj)
+	obj.Data = map[string]string{releaseChartKey: encoded}
+	index, err := writeReleaseChunks(cfgmaps, obj.Name, encoded)
+	if err != nil {
+		return err
+	}
+	if index != nil {
+		obj.Data = index
+	}
+	if _, err := cfgmaps.impl.Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		if index != nil && (previous == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+			deleteReleaseChunks(cfgmaps, obj.Name, index)
+		}
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	// remove the chunks of the previous content of the chart
+	if previous != nil && (index == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+		return deleteReleaseChunks(cfgmaps, obj.Name, previous)
+	}
+	return nil
+}
+
+func (cfgmaps *ConfigMaps) getChart(digest string) (string, error) {
+	obj, err := cfgmaps.impl.Get(context.Background(), chartKey(digest), metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if index := configMapIndex(obj); index != nil {
+		return readReleaseChunks(cfgmaps, obj.Name, index)
+	}
+	return obj.Data[releaseChartKey], nil
+}
+
+func (cfgmaps *ConfigMaps) deleteChart(digest string) error {
+	obj, err := cfgmaps.impl.Get(context.Background(), chartKey(digest), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if err := cfgmaps.deleteChunk(obj.Name); err != nil {
+		return err
+	}
+	if index := configMapIndex(obj); index != nil {
+		return deleteReleaseChunks(cfgmaps, obj.Name, index)
+	}
+	return nil
+}
+
+func (cfgmaps *ConfigMaps) chartReferenced(digest string) (bool, error) {
+	lsel := kblabels.Set{chartDigestLabel: chartDigestLabelValue(digest)}.AsSelector()
+	list, err := cfgmaps.impl.List(context.Background(), metav1.ListOptions{LabelSelector: lsel.String(), Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	return len(list.Items) > 0, nil
+}
+
+// setConfigMapChart makes a configmap reference the chart of its release.
+func setConfigMapChart(obj *v1.ConfigMap, ch *encodedChart) {
+	if ch == nil {
+		return
+	}
+	obj.Data[releaseChartKey] = ch.digest
+	obj.Labels[chartDigestLabel] = chartDigestLabelValue(ch.digest)
+}
+
+// configMapIndex returns the index record held by a configmap, or nil if the
+// configmap holds the release itself.
+func configMapIndex(obj *v1.ConfigMap) map[string]string {
+	if _, ok := obj.Data[releaseChunksKey]; !ok {
+		return nil
+	}
+	return map[string]string{
+		releaseChunksKey: obj.Data[releaseChunksKey],
+		releaseDigestKey: obj.Data[releaseDigestKey],
+	}
 }
 
 // newConfigMapsObject constructs a kubernetes ConfigMap object
@@ -226,7 +565,10 @@ func (cfgmaps *ConfigMaps) Delete(key string) (rls *rspb.Release, err error) {
 //    "status"         - status of the release (see pkg/release/status.go for variants)
 //    "owner"          - owner of the configmap, currently "helm".
 //    "name"           - name of the release.
+//    "chartDigest"    - prefix of the digest of the chart, stored apart. (see charts.go)
+//    "auditUser"      - user that performed the operation. (see audit.go)
 //
+// The custom labels of the release, set by the users, are added as well.
 func newConfigMapsObject(key string, rls *rspb.Release, lbs labels) (*v1.ConfigMap, error) {
 	const owner = "helm"
 
@@ -241,10 +583,12 @@ func newConfigMapsObject(key string, rls *rspb.Release, lbs labels) (*v1.ConfigM
 	}
 
 	// apply labels
+	lbs.fromMap(FilterSystemLabels(rls.Labels))
 	lbs.set("name", rls.Name)
 	lbs.set("owner", owner)
 	lbs.set("status", rls.Info.Status.String())
 	lbs.set("version", strconv.Itoa(rls.Version))
+	setAuditLabels(lbs, rls)
 
 	// create and return configmap object
 	return &v1.ConfigMap{
@@ -17,6 +17,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"reflect"
+	"strconv"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
@@ -46,6 +47,7 @@ func TestConfigMapGet(t *testing.T) {
 		t.Fatalf("Failed to get release: %s", err)
 	}
 	// compare fetched release with original
+	got.Labels = FilterSystemLabels(got.Labels)
 	if !reflect.DeepEqual(rel, got) {
 		t.Errorf("Expected {%v}, got {%v}", rel, got)
 	}
@@ -78,6 +80,7 @@ func TestUncompressedConfigMapGet(t *testing.T) {
 		t.Fatalf("Failed to get release: %s", err)
 	}
 	// compare fetched release with original
+	got.Labels = FilterSystemLabels(got.Labels)
 	if !reflect.DeepEqual(rel, got) {
 		t.Errorf("Expected {%v}, got {%v}", rel, got)
 	}
@@ -175,6 +178,7 @@ func TestConfigMapCreate(t *testing.T) {
 	}
 
 	// compare created release with original
+	got.Labels = FilterSystemLabels(got.Labels)
 	if !reflect.DeepEqual(rel, got) {
 		t.Errorf("Expected {%v}, got {%v}", rel, got)
 	}
@@ -239,3 +243,47 @@ func TestConfigMapDelete(t *testing.T) {
 		t.Errorf("Expected {%v}, got {%v}", ErrReleaseNotFound, err)
 	}
 }
+
+func TestConfigMapChunks(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+	releaseChunkSize = 256
+
+	name := "smug-pigeon"
+	key := testKey(name, 1)
+	rel := releaseStub(name, 1, "default", rspb.StatusDeployed)
+	rel.Manifest = incompressibleManifest(4096)
+
+	cfgmaps := newTestFixtureCfgMaps(t)
+	objects := cfgmaps.impl.(*MockConfigMapsInterface).objects
+	if err := cfgmaps.Create(key, rel); err != nil {
+		t.Fatalf("Failed to create release: %s", err)
+	}
+	if len(objects) < 3 || objects[key].Data["chunks"] != strconv.Itoa(len(objects)-1) {
+		t.Fatalf("Expected an index record and chunks, got %d objects", len(objects))
+	}
+
+	got, err := cfgmaps.Get(key)
+	if err != nil {
+		t.Fatalf("Failed to get release: %s", err)
+	}
+	got.Labels = FilterSystemLabels(got.Labels)
+	if !reflect.DeepEqual(rel, got) {
+		t.Errorf("Expected {%v}, got {%v}", rel, got)
+	}
+
+	// the release shrinks back to a single configmap
+	rel.Manifest = ""
+	if err := cfgmaps.Update(key, rel); err != nil {
+		t.Fatalf("Failed to update release: %s", err)
+	}
+	if len(objects) != 1 || objects[key].Data["release"] == "" {
+		t.Errorf("Expected the chunks to be deleted, got %d objects", len(objects))
+	}
+
+	if _, err := cfgmaps.Delete(key); err != nil {
+		t.Fatalf("Failed to delete release: %s", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("Expected no objects, got %d", len(objects))
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// The revisions of a release usually share their chart, so the Secrets,
+// ConfigMaps and File drivers can store each chart once, named after its
+// digest, the release records referencing it instead of embedding it:
+//
+//    "chart"          - sha256 digest of the chart, "sha256:<hex>", stored
+//                       alongside the release.
+//    "chartDigest"    - label of the release record, the first 40 hex
+//                       characters of the digest, to find the records
+//                       referencing a chart.
+//
+// A chart is encrypted like the records when the driver has an Encrypter, its
+// digest being the one of the plain chart. A chart is deleted with the last
+// release record referencing it. Records
+// embedding their chart, as written by the previous versions of the drivers,
+// are read as before. The records written in this format cannot be read by
+// previous versions of Helm, which expect the chart in the release, so the
+// drivers only write it once enabled by ShareCharts (see ChartSharer).
+//
+// The release locks do not serialize the releases sharing a chart, so the
+// chart of a record being written may be collected by the deletion of the last
+// other record referencing it. Writers and collectors follow a protocol
+// ensuring that a chart referenced by a record is never left deleted:
+//
+//    writers    - store the chart, write the record, then store the chart
+//                 again if it is missing.
+//    collectors - read the chart, delete it unless a record references it,
+//                 then check the references again and restore the chart if
+//                 a record now references it.
+//
+// Either the collector sees the new record when checking again and restores
+// the chart, or the record was written after that check, hence after the
+// deletion, and its writer stores the chart again. Readers may briefly find
+// the chart missing while it is restored.
+
+const (
+	releaseChartKey   = "chart"
+	chartDigestLabel  = "chartDigest"
+	chartKeyPrefix    = "sh.helm.chart.v1."
+	chartDigestPrefix = "sha256:"
+
+	// releaseChartLabel marks the chart objects.
+	releaseChartLabel = "helm.sh/release-chart"
+	// releaseChartType is the type of the chart Secrets.
+	releaseChartType = "helm.sh/chart.v1"
+)
+
+// ChartSharer is the interface of the drivers able to store each chart once,
+// apart from the releases referencing it.
+//
+// The Secrets, ConfigMaps and File drivers are chart sharers. Sharing the
+// charts is to be enabled only once every Helm client accessing the releases
+// is able to read them, as the previous versions of Helm read the releases
+// written this way without their chart.
+type ChartSharer interface {
+	ShareCharts(share bool)
+}
+
+// chartSharing enables the sharing of the charts of a driver.
+type chartSharing struct {
+	shared bool
+}
+
+// ShareCharts sets whether the charts of the releases stored from then on are
+// stored apart from them. The releases are read in either format.
+func (c *chartSharing) ShareCharts(share bool) {
+	c.shared = share
+}
+
+// splitSharedChart splits the chart from the release, as splitChart does, if
+// the charts are shared. Otherwise the release is returned as is, along with
+// a nil chart.
+func (c *chartSharing) splitSharedChart(rls *rspb.Release) (*rspb.Release, *encodedChart, error) {
+	if !c.shared {
+		return rls, nil, nil
+	}
+	return splitChart(rls)
+}
+
+// chartStore is implemented by the drivers storing charts apart from their
+// releases.
+type chartStore interface {
+	// putChart stores the encoded chart under its digest, unless it is
+	// already stored.
+	putChart(digest, encoded string) error
+	// replaceChart replaces the encoded chart stored under digest, if it is
+	// stored.
+	replaceChart(digest, encoded string) error
+	// getChart returns the encoded chart stored under digest.
+	getChart(digest string) (string, error)
+	deleteChart(digest string) error
+	// chartReferenced reports whether a release record references the
+	// chart.
+	chartReferenced(digest string) (bool, error)
+
+	// seal and open encrypt and decrypt the encoded charts, see codec.
+	seal(encoded string) (string, error)
+	open(data string) (string, error)
+}
+
+// encodedChart is a chart encoded to be stored apart from its releases.
+type encodedChart struct {
+	digest  string
+	encoded string
+}
+
+// chartKey returns the name of the object holding a chart.
+func chartKey(digest string) string {
+	return chartKeyPrefix + strings.TrimPrefix(digest, chartDigestPrefix)
+}
+
+// chartDigestLabelValue returns the value of the label referencing a chart,
+// digests being too long for label values.
+func chartDigestLabelValue(digest string) string {
+	return strings.TrimPrefix(digest, chartDigestPrefix)[:40]
+}
+
+// splitChart returns a copy of the release without its chart, and its
+// chart encoded. Releases without a chart are returned as is, along with a nil
+// chart.
+func splitChart(rls *rspb.Release) (*rspb.Release, *encodedChart, error) {
+	if rls.Chart == nil {
+		return rls, nil, nil
+	}
+	b, err := json.Marshal(rls.Chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := compress(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	stripped := *rls
+	stripped.Chart = nil
+	return &stripped, &encodedChart{digest: releaseDigest(string(b)), encoded: encoded}, nil
+}
+
+// storeChart stores the chart of a release record, before the record is
+// written and again after it is, unless the chart is already stored.
+func storeChart(store chartStore, ch *encodedChart) error {
+	if ch == nil {
+		return nil
+	}
+	sealed, err := store.seal(ch.encoded)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store chart %s", ch.digest)
+	}
+	return errors.Wrapf(store.putChart(ch.digest, sealed), "failed to store chart %s", ch.digest)
+}
+
+// rekeyCharts encrypts the stored charts of releases again, each chart once.
+// The charts embedded in their release records are re-encrypted with them.
+func rekeyCharts(store chartStore, releases []*rspb.Release) error {
+	done := map[string]bool{}
+	for _, rls := range releases {
+		_, ch, err := splitChart(rls)
+		if err != nil {
+			return err
+		}
+		if ch == nil || done[ch.digest] {
+			continue
+		}
+		done[ch.digest] = true
+		sealed, err := store.seal(ch.encoded)
+		if err == nil {
+			err = store.replaceChart(ch.digest, sealed)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to re-encrypt chart %s", ch.digest)
+		}
+	}
+	return nil
+}
+
+// collectChart deletes a chart if no release record references it anymore,
+// restoring it if a record written meanwhile references it.
+func collectChart(store chartStore, digest string) error {
+	if !validChartDigest(digest) {
+		return nil
+	}
+	referenced, err := store.chartReferenced(digest)
+	if err != nil || referenced {
+		return errors.Wrapf(err, "failed to look up the releases of chart %s", digest)
+	}
+	// the chart is kept to be restored
+	encoded, readErr := store.getChart(digest)
+	if err := store.deleteChart(digest); err != nil {
+		return errors.Wrapf(err, "failed to delete chart %s", digest)
+	}
+	referenced, err = store.chartReferenced(digest)
+	if err != nil {
+		return errors.Wrapf(err, "failed to look up the releases of chart %s", digest)
+	}
+	if !referenced {
+		return nil
+	}
+	if readErr != nil {
+		return errors.Wrapf(readErr, "failed to restore chart %s", digest)
+	}
+	return errors.Wrapf(store.putChart(digest, encoded), "failed to restore chart %s", digest)
+}
+
+// chartLoader restores the charts of the releases read from a store, reading
+// each chart once.
+type chartLoader struct {
+	store  chartStore
+	charts map[string][]byte
+}
+
+func newChartLoader(store chartStore) *chartLoader {
+	return &chartLoader{store: store, charts: map[string][]byte{}}
+}
+
+// load sets the chart of a release read from a record referencing the chart
+// digest. Nothing is done for records embedding their chart, with no digest.
+func (l *chartLoader) load(rls *rspb.Release, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	b, ok := l.charts[digest]
+	if !ok {
+		if !validChartDigest(digest) {
+			return errors.Errorf("invalid chart digest %q", digest)
+		}
+		encoded, err := l.store.getChart(digest)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read chart %s", digest)
+		}
+		if encoded, err = l.store.open(encoded); err != nil {
+			return errors.Wrapf(err, "failed to decrypt chart %s", digest)
+		}
+		if b, err = decompress(encoded); err != nil {
+			return errors.Wrapf(err, "failed to decode chart %s", digest)
+		}
+		if actual := releaseDigest(string(b)); actual != digest {
+			return errors.Errorf("digest mismatch for chart %s: got %s", digest, actual)
+		}
+		l.charts[digest] = b
+	}
+	// each release gets its own copy of the chart
+	var ch chart.Chart
+	if err := json.Unmarshal(b, &ch); err != nil {
+		return errors.Wrapf(err, "failed to decode chart %s", digest)
+	}
+	rls.Chart = &ch
+	return nil
+}
+
+// validChartDigest checks that a chart digest is a sha256 digest.
+func validChartDigest(digest string) bool {
+	hexDigest := strings.TrimPrefix(digest, chartDigestPrefix)
+	if len(hexDigest) != 64 || len(hexDigest) == len(digest) {
+		return false
+	}
+	_, err := hex.DecodeString(hexDigest)
+	return err == nil
+}
+
+// digestOf returns the digest of an encoded chart, or "" for no chart.
+func digestOf(ch *encodedChart) string {
+	if ch == nil {
+		return ""
+	}
+	return ch.digest
+}
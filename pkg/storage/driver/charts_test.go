@@ -0,0 +1,297 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+func chartStub(version string) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "hello", Version: version},
+		Templates: []*chart.File{
+			{Name: "templates/hello.yaml", Data: []byte(incompressibleManifest(256))},
+		},
+		Values: map[string]interface{}{"name": "hello"},
+	}
+}
+
+func releaseWithChart(name string, vers int, ch *chart.Chart) *rspb.Release {
+	rls := releaseStub(name, vers, "default", rspb.StatusSuperseded)
+	rls.Chart = ch
+	return rls
+}
+
+func TestSecretsChartDeduplication(t *testing.T) {
+	secrets := newTestFixtureSecrets(t)
+	secrets.ShareCharts(true)
+	mock := secrets.impl.(*MockSecretsInterface)
+	testChartDeduplication(t, secrets, func() int {
+		var n int
+		for _, obj := range mock.objects {
+			if obj.Labels[releaseChartLabel] == "true" {
+				n++
+			}
+		}
+		return n
+	})
+}
+
+func TestConfigMapsChartDeduplication(t *testing.T) {
+	cfgmaps := newTestFixtureCfgMaps(t)
+	cfgmaps.ShareCharts(true)
+	mock := cfgmaps.impl.(*MockConfigMapsInterface)
+	testChartDeduplication(t, cfgmaps, func() int {
+		var n int
+		for _, obj := range mock.objects {
+			if obj.Labels[releaseChartLabel] == "true" {
+				n++
+			}
+		}
+		return n
+	})
+}
+
+func TestChunkedChartDeduplication(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+	releaseChunkSize = 64
+
+	secrets := newTestFixtureSecrets(t)
+	secrets.ShareCharts(true)
+	mock := secrets.impl.(*MockSecretsInterface)
+	testChartDeduplication(t, secrets, func() int {
+		var n int
+		for _, obj := range mock.objects {
+			if obj.Labels[releaseChartLabel] == "true" {
+				n++
+			}
+		}
+		return n
+	})
+	if len(mock.objects) != 0 {
+		t.Errorf("expected the chunks to be deleted, got %d objects", len(mock.objects))
+	}
+}
+
+func TestFileChartDeduplication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-file-driver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ShareCharts(true)
+	testChartDeduplication(t, f, func() int {
+		entries, _ := ioutil.ReadDir(filepath.Join(f.dir, fileChartsDir))
+		return len(entries)
+	})
+}
+
+func testChartDeduplication(t *testing.T, d Driver, countCharts func() int) {
+	v1, v2 := chartStub("0.1.0"), chartStub("0.2.0")
+
+	for i := 1; i <= 3; i++ {
+		if err := d.Create(testKey("rls-a", i), releaseWithChart("rls-a", i, v1)); err != nil {
+			t.Fatalf("failed to create release: %s", err)
+		}
+	}
+	if err := d.Create(testKey("rls-b", 1), releaseWithChart("rls-b", 1, v1)); err != nil {
+		t.Fatalf("failed to create release: %s", err)
+	}
+	if n := countCharts(); n != 1 {
+		t.Errorf("expected 1 chart to be stored, got %d", n)
+	}
+
+	rls, err := d.Get(testKey("rls-a", 2))
+	if err != nil {
+		t.Fatalf("failed to get release: %s", err)
+	}
+	if !reflect.DeepEqual(rls.Chart, v1) {
+		t.Errorf("expected the chart to be restored, got %+v", rls.Chart)
+	}
+	all, err := d.List(func(*rspb.Release) bool { return true })
+	if err != nil {
+		t.Fatalf("failed to list releases: %s", err)
+	}
+	for _, rls := range all {
+		if rls.Chart == nil || rls.Chart.Metadata.Version != "0.1.0" {
+			t.Errorf("expected %s to have its chart, got %+v", testKey(rls.Name, rls.Version), rls.Chart)
+		}
+	}
+
+	// upgrading the chart of a revision stores the new chart
+	if err := d.Update(testKey("rls-a", 3), releaseWithChart("rls-a", 3, v2)); err != nil {
+		t.Fatalf("failed to update release: %s", err)
+	}
+	if n := countCharts(); n != 2 {
+		t.Errorf("expected 2 charts to be stored, got %d", n)
+	}
+
+	// charts are deleted with the last release referencing them
+	for i := 1; i <= 3; i++ {
+		rls, err := d.Delete(testKey("rls-a", i))
+		if err != nil {
+			t.Fatalf("failed to delete release: %s", err)
+		}
+		if rls.Chart == nil {
+			t.Errorf("expected the deleted release to have its chart")
+		}
+	}
+	if n := countCharts(); n != 1 {
+		t.Errorf("expected the chart of rls-b to be kept, got %d charts", n)
+	}
+	if _, err := d.Delete(testKey("rls-b", 1)); err != nil {
+		t.Fatalf("failed to delete release: %s", err)
+	}
+	if n := countCharts(); n != 0 {
+		t.Errorf("expected the charts to be deleted, got %d", n)
+	}
+}
+
+func TestChartsNotSharedByDefault(t *testing.T) {
+	secrets := newTestFixtureSecrets(t)
+	if err := secrets.Create(testKey("rls-a", 1), releaseWithChart("rls-a", 1, chartStub("0.1.0"))); err != nil {
+		t.Fatalf("failed to create release: %s", err)
+	}
+	mock := secrets.impl.(*MockSecretsInterface)
+	for key, obj := range mock.objects {
+		if obj.Labels[releaseChartLabel] == "true" || obj.Data[releaseChartKey] != nil {
+			t.Errorf("expected the chart to be embedded in the release, got %s", key)
+		}
+	}
+	rls, err := secrets.Get(testKey("rls-a", 1))
+	if err != nil {
+		t.Fatalf("failed to get release: %s", err)
+	}
+	if rls.Chart == nil || rls.Chart.Metadata.Version != "0.1.0" {
+		t.Errorf("expected the chart of the release, got %+v", rls.Chart)
+	}
+}
+
+func TestEmbeddedChartCompatibility(t *testing.T) {
+	// releases stored before the charts were stored apart embed them
+	legacy := releaseWithChart("rls-a", 1, chartStub("0.1.0"))
+	secrets := newTestFixtureSecrets(t, legacy)
+
+	rls, err := secrets.Get(testKey("rls-a", 1))
+	if err != nil {
+		t.Fatalf("failed to get release: %s", err)
+	}
+	if !reflect.DeepEqual(rls.Chart, legacy.Chart) {
+		t.Errorf("expected the embedded chart, got %+v", rls.Chart)
+	}
+
+	if err := secrets.Create(testKey("rls-a", 2), releaseWithChart("rls-a", 2, legacy.Chart)); err != nil {
+		t.Fatalf("failed to create release: %s", err)
+	}
+	if _, err := secrets.Delete(testKey("rls-a", 1)); err != nil {
+		t.Fatalf("failed to delete release: %s", err)
+	}
+	rls, err = secrets.Get(testKey("rls-a", 2))
+	if err != nil {
+		t.Fatalf("failed to get release: %s", err)
+	}
+	if !reflect.DeepEqual(rls.Chart, legacy.Chart) {
+		t.Errorf("expected the stored chart, got %+v", rls.Chart)
+	}
+}
+
+func TestChartDigestMismatch(t *testing.T) {
+	secrets := newTestFixtureSecrets(t)
+	secrets.ShareCharts(true)
+	rls := releaseWithChart("rls-a", 1, chartStub("0.1.0"))
+	if err := secrets.Create(testKey("rls-a", 1), rls); err != nil {
+		t.Fatalf("failed to create release: %s", err)
+	}
+
+	_, ch, err := splitChart(releaseWithChart("rls-a", 1, chartStub("0.2.0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := secrets.impl.(*MockSecretsInterface)
+	for _, obj := range mock.objects {
+		if obj.Labels[releaseChartLabel] == "true" {
+			obj.Data[releaseChartKey] = []byte(ch.encoded)
+		}
+	}
+	if _, err := secrets.Get(testKey("rls-a", 1)); err == nil {
+		t.Error("expected a tampered chart to be rejected")
+	}
+}
+
+// racingChartStore runs a function once a chart is deleted, as a concurrent
+// writer could.
+type racingChartStore struct {
+	*Secrets
+	deleted func()
+}
+
+func (s racingChartStore) deleteChart(digest string) error {
+	err := s.Secrets.deleteChart(digest)
+	s.deleted()
+	return err
+}
+
+func TestCollectChartRestoresReferencedChart(t *testing.T) {
+	secrets := newTestFixtureSecrets(t)
+	secrets.ShareCharts(true)
+	rls := releaseWithChart("rls-a", 1, chartStub("0.1.0"))
+	stripped, ch, err := splitChart(rls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeChart(secrets, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	// a record referencing the chart is written once the chart was found
+	// unreferenced
+	store := racingChartStore{Secrets: secrets, deleted: func() {
+		obj, err := newSecretsObject(testKey("rls-a", 1), stripped, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setSecretChart(obj, ch)
+		if _, err := secrets.impl.Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}}
+	if err := collectChart(store, ch.digest); err != nil {
+		t.Fatal(err)
+	}
+	got, err := secrets.Get(testKey("rls-a", 1))
+	if err != nil {
+		t.Fatalf("expected the chart to be restored, got %s", err)
+	}
+	if !reflect.DeepEqual(got.Chart, rls.Chart) {
+		t.Errorf("expected the restored chart, got %+v", got.Chart)
+	}
+}
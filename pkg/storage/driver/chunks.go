@@ -0,0 +1,140 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Releases too large to be stored in a single Kubernetes object are split by
+// the Secrets and ConfigMaps drivers in chunk objects. The object named by the
+// key of the release is then an index record, holding the labels of the
+// release and, instead of the release, the number of chunks and the digest of
+// the encoded release:
+//
+//    "chunks"         - number of chunks.
+//    "digest"         - sha256 digest of the encoded release, "sha256:<hex>".
+//
+// The chunk objects are named <key>.<digest prefix>.<n>, n starting at 1, so
+// that the chunks of a new version of the release never overwrite the chunks
+// the index record points to.
+
+// releaseChunkSize is the size of the chunks of the encoded releases, below
+// the 1MiB limit of Kubernetes objects to leave room for their metadata.
+var releaseChunkSize = 768 * 1024
+
+const (
+	releaseChunksKey = "chunks"
+	releaseDigestKey = "digest"
+
+	// releaseChunkLabel marks the chunk objects.
+	releaseChunkLabel = "helm.sh/release-chunk"
+	// releaseChunkType is the type of the chunk Secrets.
+	releaseChunkType = "helm.sh/release-chunk.v1"
+)
+
+// chunkStore is implemented by the drivers storing the chunks of releases.
+type chunkStore interface {
+	// createChunk creates the chunk named name. Creating a chunk that
+	// already exists is not an error, as chunks are named after the digest
+	// of their release.
+	createChunk(name, data string) error
+	getChunk(name string) (string, error)
+	deleteChunk(name string) error
+}
+
+// releaseDigest returns the digest of an encoded release.
+func releaseDigest(encoded string) string {
+	sum := sha256.Sum256([]byte(encoded))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// releaseChunkName returns the name of the nth chunk of a release.
+func releaseChunkName(key, digest string, n int) string {
+	return fmt.Sprintf("%s.%s.%d", key, strings.TrimPrefix(digest, "sha256:")[:12], n)
+}
+
+// writeReleaseChunks stores the encoded release in chunks if it is too large
+// for a single object, and returns the data of its index record. It returns
+// nil if the release fits in a single object.
+func writeReleaseChunks(store chunkStore, key, encoded string) (map[string]string, error) {
+	if len(encoded) <= releaseChunkSize {
+		return nil, nil
+	}
+
+	digest := releaseDigest(encoded)
+	var n int
+	for start := 0; start < len(encoded); start += releaseChunkSize {
+		end := start + releaseChunkSize
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		n++
+		if err := store.createChunk(releaseChunkName(key, digest, n), encoded[start:end]); err != nil {
+			index := map[string]string{releaseChunksKey: strconv.Itoa(n - 1), releaseDigestKey: digest}
+			deleteReleaseChunks(store, key, index)
+			return nil, errors.Wrapf(err, "failed to store chunk %d of %q", n, key)
+		}
+	}
+	return map[string]string{releaseChunksKey: strconv.Itoa(n), releaseDigestKey: digest}, nil
+}
+
+// readReleaseChunks reassembles the encoded release of an index record and
+// checks its digest.
+func readReleaseChunks(store chunkStore, key string, index map[string]string) (string, error) {
+	n, err := strconv.Atoi(index[releaseChunksKey])
+	if err != nil || n < 1 {
+		return "", errors.Errorf("invalid number of chunks %q for %q", index[releaseChunksKey], key)
+	}
+	digest := index[releaseDigestKey]
+	if !strings.HasPrefix(digest, "sha256:") || len(digest) < len("sha256:")+12 {
+		return "", errors.Errorf("invalid digest %q for %q", digest, key)
+	}
+
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		chunk, err := store.getChunk(releaseChunkName(key, digest, i))
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read chunk %d of %q", i, key)
+		}
+		b.WriteString(chunk)
+	}
+	encoded := b.String()
+	if actual := releaseDigest(encoded); actual != digest {
+		return "", errors.Errorf("digest mismatch for %q: expected %s, got %s", key, digest, actual)
+	}
+	return encoded, nil
+}
+
+// deleteReleaseChunks deletes the chunks of an index record, returning the
+// first error.
+func deleteReleaseChunks(store chunkStore, key string, index map[string]string) error {
+	n, _ := strconv.Atoi(index[releaseChunksKey])
+	var first error
+	for i := 1; i <= n; i++ {
+		if err := store.deleteChunk(releaseChunkName(key, index[releaseDigestKey], i)); err != nil && first == nil {
+			first = errors.Wrapf(err, "failed to delete chunk %d of %q", i, key)
+		}
+	}
+	return first
+}
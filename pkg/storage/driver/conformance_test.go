@@ -0,0 +1,328 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// The conformance suite checks the behavior documented by the Driver and
+// Locker interfaces. Every driver must pass it, starting empty and accessing
+// the default namespace.
+
+func TestMemoryConformance(t *testing.T) {
+	testDriverConformance(t, NewMemory())
+}
+
+func TestFileConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-file-driver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDriverConformance(t, f)
+}
+
+func TestSecretsConformance(t *testing.T) {
+	testDriverConformance(t, newTestFixtureSecrets(t))
+}
+
+func TestConfigMapsConformance(t *testing.T) {
+	testDriverConformance(t, newTestFixtureCfgMaps(t))
+}
+
+func TestSharedChartsSecretsConformance(t *testing.T) {
+	secrets := newTestFixtureSecrets(t)
+	secrets.ShareCharts(true)
+	testDriverConformance(t, secrets)
+}
+
+func TestChunkedSecretsConformance(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+	releaseChunkSize = 64
+	testDriverConformance(t, newTestFixtureSecrets(t))
+}
+
+func TestChunkedConfigMapsConformance(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+	releaseChunkSize = 64
+	testDriverConformance(t, newTestFixtureCfgMaps(t))
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	if !sqliteSupported {
+		t.Skip("SQLite requires cgo")
+	}
+	dir, err := ioutil.TempDir("", "helm-sql-driver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testDriverConformance(t, newSQLConformanceFixture(t, "sqlite://"+filepath.Join(dir, "helm.db")))
+}
+
+// The PostgreSQL and MySQL dialects are tested against the databases given by
+// these environment variables, whose releases are deleted.
+func TestPostgreSQLConformance(t *testing.T) {
+	testSQLConformanceFromEnv(t, "HELM_TEST_POSTGRESQL_CONNECTION_STRING")
+}
+
+func TestMySQLConformance(t *testing.T) {
+	testSQLConformanceFromEnv(t, "HELM_TEST_MYSQL_CONNECTION_STRING")
+}
+
+func testSQLConformanceFromEnv(t *testing.T, env string) {
+	connectionString := os.Getenv(env)
+	if connectionString == "" {
+		t.Skipf("%s is not set", env)
+	}
+	s := newSQLConformanceFixture(t, connectionString)
+	for _, table := range []string{sqlReleaseTableName, sqlCustomLabelsTableName, sqlLockTableName} {
+		if _, err := s.db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testDriverConformance(t, s)
+}
+
+func newSQLConformanceFixture(t *testing.T, connectionString string) *SQL {
+	s, err := NewSQL(connectionString, t.Logf, "default")
+	if err != nil {
+		t.Fatalf("failed to initialize the SQL driver: %s", err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	return s
+}
+
+func testDriverConformance(t *testing.T, d Driver) {
+	if d.Name() == "" {
+		t.Error("expected the driver to have a name")
+	}
+
+	releases := []*rspb.Release{
+		releaseStub("rls-a", 1, "default", rspb.StatusSuperseded),
+		releaseStub("rls-a", 2, "default", rspb.StatusDeployed),
+		releaseStub("rls-b", 1, "default", rspb.StatusDeployed),
+	}
+	releases[0].Chart = chartStub("0.1.0")
+	releases[1].Chart = chartStub("0.1.0")
+
+	t.Run("Create", func(t *testing.T) {
+		for _, rls := range releases {
+			if err := d.Create(testKey(rls.Name, rls.Version), rls); err != nil {
+				t.Fatalf("failed to create %s.v%d: %s", rls.Name, rls.Version, err)
+			}
+		}
+		rls := releases[0]
+		if err := d.Create(testKey(rls.Name, rls.Version), rls); !errors.Is(err, ErrReleaseExists) {
+			t.Errorf("expected ErrReleaseExists, got %v", err)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		rls, err := d.Get(testKey("rls-a", 2))
+		if err != nil {
+			t.Fatalf("failed to get release: %s", err)
+		}
+		if got, want := describeRelease(rls), describeRelease(releases[1]); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+		if rls.Chart == nil || rls.Chart.Metadata.Version != "0.1.0" {
+			t.Errorf("expected the chart of the release, got %+v", rls.Chart)
+		}
+		if _, err := d.Get(testKey("rls-z", 1)); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("expected ErrReleaseNotFound, got %v", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		all, err := d.List(func(*rspb.Release) bool { return true })
+		if err != nil {
+			t.Fatalf("failed to list releases: %s", err)
+		}
+		if len(all) != 3 {
+			t.Errorf("expected 3 releases, got %d", len(all))
+		}
+		deployed, err := d.List(func(rls *rspb.Release) bool { return rls.Info.Status == rspb.StatusDeployed })
+		if err != nil {
+			t.Fatalf("failed to list releases: %s", err)
+		}
+		if len(deployed) != 2 {
+			t.Errorf("expected 2 deployed releases, got %d", len(deployed))
+		}
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		queries := []struct {
+			labels map[string]string
+			count  int
+		}{
+			{map[string]string{"name": "rls-a", "owner": "helm"}, 2},
+			{map[string]string{"status": "deployed"}, 2},
+			{map[string]string{"name": "rls-a", "version": "1"}, 1},
+		}
+		for _, q := range queries {
+			found, err := d.Query(q.labels)
+			if err != nil {
+				t.Fatalf("failed to query %v: %s", q.labels, err)
+			}
+			if len(found) != q.count {
+				t.Errorf("expected %d releases matching %v, got %d", q.count, q.labels, len(found))
+			}
+		}
+		if _, err := d.Query(map[string]string{"name": "rls-z"}); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("expected ErrReleaseNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		rls := releaseStub("rls-a", 2, "default", rspb.StatusSuperseded)
+		if err := d.Update(testKey(rls.Name, rls.Version), rls); err != nil {
+			t.Fatalf("failed to update release: %s", err)
+		}
+		got, err := d.Get(testKey(rls.Name, rls.Version))
+		if err != nil {
+			t.Fatalf("failed to get release: %s", err)
+		}
+		if got.Info.Status != rspb.StatusSuperseded {
+			t.Errorf("expected status %s, got %s", rspb.StatusSuperseded, got.Info.Status)
+		}
+		deployed, err := d.Query(map[string]string{"status": "deployed"})
+		if err != nil {
+			t.Fatalf("failed to query: %s", err)
+		}
+		if len(deployed) != 1 {
+			t.Errorf("expected the labels to be updated, got %d deployed releases", len(deployed))
+		}
+
+		missing := releaseStub("rls-z", 1, "default", rspb.StatusDeployed)
+		if err := d.Update(testKey(missing.Name, missing.Version), missing); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("expected ErrReleaseNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rls, err := d.Delete(testKey("rls-b", 1))
+		if err != nil {
+			t.Fatalf("failed to delete release: %s", err)
+		}
+		if got, want := describeRelease(rls), describeRelease(releases[2]); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+		if _, err := d.Get(testKey("rls-b", 1)); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("expected ErrReleaseNotFound, got %v", err)
+		}
+		if _, err := d.Delete(testKey("rls-b", 1)); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("expected ErrReleaseNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Labels", func(t *testing.T) {
+		rls := releaseStub("rls-c", 1, "default", rspb.StatusDeployed)
+		rls.Labels = map[string]string{"team": "guides"}
+		if err := d.Create(testKey(rls.Name, rls.Version), rls); err != nil {
+			t.Fatalf("failed to create release: %s", err)
+		}
+		got, err := d.Get(testKey(rls.Name, rls.Version))
+		if err != nil {
+			t.Fatalf("failed to get release: %s", err)
+		}
+		if labels := FilterSystemLabels(got.Labels); len(labels) != 1 || labels["team"] != "guides" {
+			t.Errorf("expected the custom labels of the release, got %v", got.Labels)
+		}
+		found, err := d.Query(map[string]string{"team": "guides", "owner": "helm"})
+		if err != nil || len(found) != 1 || found[0].Labels["team"] != "guides" {
+			t.Errorf("expected to find the release by custom label, got %d releases (%v)", len(found), err)
+		}
+
+		// updating a release replaces its custom labels
+		rls.Labels = map[string]string{"tier": "docs"}
+		if err := d.Update(testKey(rls.Name, rls.Version), rls); err != nil {
+			t.Fatalf("failed to update release: %s", err)
+		}
+		if got, err = d.Get(testKey(rls.Name, rls.Version)); err != nil {
+			t.Fatalf("failed to get release: %s", err)
+		}
+		if labels := FilterSystemLabels(got.Labels); len(labels) != 1 || labels["tier"] != "docs" {
+			t.Errorf("expected the custom labels of the updated release, got %v", got.Labels)
+		}
+		all, err := d.List(func(r *rspb.Release) bool { return r.Name == rls.Name })
+		if err != nil || len(all) != 1 || all[0].Labels["tier"] != "docs" {
+			t.Errorf("expected to list the release with its custom labels, got %d releases (%v)", len(all), err)
+		}
+		if _, err := d.Delete(testKey(rls.Name, rls.Version)); err != nil {
+			t.Fatalf("failed to delete release: %s", err)
+		}
+		if _, err := d.Query(map[string]string{"tier": "docs", "owner": "helm"}); !errors.Is(err, ErrReleaseNotFound) {
+			t.Errorf("expected the labels to be deleted with the release, got %v", err)
+		}
+	})
+
+	if l, ok := d.(Locker); ok {
+		t.Run("Lock", func(t *testing.T) {
+			testLockerConformance(t, l)
+		})
+	}
+}
+
+func testLockerConformance(t *testing.T, l Locker) {
+	key := "sh.helm.release.v1.rls-a.lock"
+
+	if _, err := l.GetLock(key); !errors.Is(err, ErrLockNotFound) {
+		t.Fatalf("expected ErrLockNotFound, got %v", err)
+	}
+	if err := l.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("failed to acquire lock: %s", err)
+	}
+	if err := l.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("failed to renew lock: %s", err)
+	}
+	err := l.AcquireLock(key, "ci/2", time.Minute)
+	if lerr, ok := err.(*LockedError); !ok || lerr.Lock.Holder != "ci/1" {
+		t.Errorf("expected the lock to be held by %q, got %v", "ci/1", err)
+	}
+	if err := l.ReleaseLock(key, "ci/2"); err != nil {
+		t.Fatalf("failed to release lock: %s", err)
+	}
+	if lock, err := l.GetLock(key); err != nil || lock.Holder != "ci/1" {
+		t.Fatalf("expected the lock to be held by %q, got %v (%v)", "ci/1", lock, err)
+	}
+	if err := l.ReleaseLock(key, "ci/1"); err != nil {
+		t.Fatalf("failed to release lock: %s", err)
+	}
+	if _, err := l.GetLock(key); !errors.Is(err, ErrLockNotFound) {
+		t.Fatalf("expected ErrLockNotFound, got %v", err)
+	}
+}
+
+func describeRelease(rls *rspb.Release) string {
+	return fmt.Sprintf("%s/%s.v%d (%s)", rls.Namespace, rls.Name, rls.Version, rls.Info.Status)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// sealedPrefix prefixes the encrypted releases, followed by the base64
+// encoded ciphertext. The prefix is not valid base64, so that the encrypted
+// releases are told apart from the plain ones, which are still read when
+// encryption is enabled.
+const sealedPrefix = "sealed.v1:"
+
+// Encrypter encrypts the releases stored by a driver, see the
+// pkg/storage/encryption package.
+type Encrypter interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// Encryptable is the interface of the drivers able to encrypt the releases
+// they store.
+//
+// The Secrets, ConfigMaps, SQL and File drivers are encryptable. They
+// encrypt the records of the releases, which hold their manifests, values and
+// hooks, and the charts stored apart from the releases (see charts.go).
+type Encryptable interface {
+	SetEncrypter(Encrypter)
+}
+
+// ChartRekeyer is the interface of the encryptable drivers storing the charts
+// apart from the releases. As a stored chart is not written again with the
+// releases referencing it, RekeyCharts encrypts the stored charts of the
+// releases again with the current Encrypter.
+type ChartRekeyer interface {
+	RekeyCharts(releases []*rspb.Release) error
+}
+
+// codec encrypts and decrypts the encoded releases of a driver.
+type codec struct {
+	encrypter Encrypter
+}
+
+// SetEncrypter sets the Encrypter of the releases. Releases stored from then
+// on are encrypted, and the releases stored in plain text are still read.
+func (c *codec) SetEncrypter(e Encrypter) {
+	c.encrypter = e
+}
+
+// seal encrypts a release encoded by encodeRelease, if an Encrypter is set.
+func (c *codec) seal(encoded string) (string, error) {
+	if c.encrypter == nil {
+		return encoded, nil
+	}
+	b, err := b64.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := c.encrypter.Encrypt(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encrypt release")
+	}
+	return sealedPrefix + b64.EncodeToString(sealed), nil
+}
+
+// open decrypts a release sealed by seal. Releases which are not encrypted
+// are returned unchanged.
+func (c *codec) open(data string) (string, error) {
+	if !strings.HasPrefix(data, sealedPrefix) {
+		return data, nil
+	}
+	if c.encrypter == nil {
+		return "", errors.New("release is encrypted and no encryption key is configured")
+	}
+	b, err := b64.DecodeString(strings.TrimPrefix(data, sealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	opened, err := c.encrypter.Decrypt(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt release")
+	}
+	return b64.EncodeToString(opened), nil
+}
+
+// encodeRelease encodes and seals a release.
+func (c *codec) encodeRelease(rls *rspb.Release) (string, error) {
+	s, err := encodeRelease(rls)
+	if err != nil {
+		return "", err
+	}
+	return c.seal(s)
+}
+
+// decodeRelease opens and decodes a release.
+func (c *codec) decodeRelease(data string) (*rspb.Release, error) {
+	s, err := c.open(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRelease(s)
+}
@@ -0,0 +1,267 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// xorEncrypter is a toy Encrypter, the actual encryption being tested in
+// pkg/storage/encryption.
+type xorEncrypter struct{}
+
+var xorTag = []byte("xor:")
+
+func (xorEncrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	out := append([]byte{}, xorTag...)
+	for _, b := range plaintext {
+		out = append(out, b^0x5a)
+	}
+	return out, nil
+}
+
+func (xorEncrypter) Decrypt(ciphertext []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ciphertext, xorTag) {
+		return nil, errors.New("not encrypted by xorEncrypter")
+	}
+	out := []byte{}
+	for _, b := range ciphertext[len(xorTag):] {
+		out = append(out, b^0x5a)
+	}
+	return out, nil
+}
+
+type encryptableDriver interface {
+	Driver
+	Encryptable
+}
+
+func TestSecretsEncryption(t *testing.T) {
+	secrets := newTestFixtureSecrets(t, releaseStub("rls-a", 1, "default", rspb.StatusSuperseded))
+	mock := secrets.impl.(*MockSecretsInterface)
+	testEncryption(t, secrets, func(key string) string {
+		return string(mock.objects[key].Data["release"])
+	}, func() Driver {
+		return NewSecrets(mock)
+	})
+}
+
+func TestConfigMapsEncryption(t *testing.T) {
+	cfgmaps := newTestFixtureCfgMaps(t, releaseStub("rls-a", 1, "default", rspb.StatusSuperseded))
+	mock := cfgmaps.impl.(*MockConfigMapsInterface)
+	testEncryption(t, cfgmaps, func(key string) string {
+		return mock.objects[key].Data["release"]
+	}, func() Driver {
+		return NewConfigMaps(mock)
+	})
+}
+
+func TestChunkedEncryption(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+	releaseChunkSize = 64
+
+	secrets := newTestFixtureSecrets(t, releaseStub("rls-a", 1, "default", rspb.StatusSuperseded))
+	mock := secrets.impl.(*MockSecretsInterface)
+	testEncryption(t, secrets, func(key string) string {
+		obj := mock.objects[key]
+		if index := secretIndex(obj); index != nil {
+			s, _ := readReleaseChunks(secrets, key, index)
+			return s
+		}
+		return string(obj.Data["release"])
+	}, func() Driver {
+		return NewSecrets(mock)
+	})
+}
+
+func TestFileEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-file-driver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetNamespace("default")
+	if err := f.Create(testKey("rls-a", 1), releaseStub("rls-a", 1, "default", rspb.StatusSuperseded)); err != nil {
+		t.Fatal(err)
+	}
+	testEncryption(t, f, func(key string) string {
+		rec, err := f.read(filepath.Join(f.dir, "default", key+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec.Release
+	}, func() Driver {
+		plain, _ := NewFile(f.dir)
+		plain.SetNamespace("default")
+		return plain
+	})
+}
+
+// testEncryption tests an encryptable driver holding the plain release rls-a.1:
+// raw returns the stored release of a key, and plain creates a driver without
+// encryption sharing the same storage.
+func testEncryption(t *testing.T, d encryptableDriver, raw func(key string) string, plain func() Driver) {
+	d.SetEncrypter(xorEncrypter{})
+
+	key1, key2 := testKey("rls-a", 1), testKey("rls-a", 2)
+	if err := d.Create(key2, releaseStub("rls-a", 2, "default", rspb.StatusDeployed)); err != nil {
+		t.Fatalf("failed to create release: %s", err)
+	}
+	if s := raw(key2); !strings.HasPrefix(s, sealedPrefix) {
+		t.Errorf("expected %s to be encrypted, got %q", key2, s)
+	}
+	if s := raw(key1); strings.HasPrefix(s, sealedPrefix) {
+		t.Errorf("expected %s to be stored in plain text", key1)
+	}
+
+	// plain and encrypted releases are both read
+	for _, key := range []string{key1, key2} {
+		if _, err := d.Get(key); err != nil {
+			t.Errorf("failed to get %s: %s", key, err)
+		}
+	}
+	rls, err := d.Query(map[string]string{"name": "rls-a", "owner": "helm"})
+	if err != nil || len(rls) != 2 {
+		t.Errorf("expected 2 releases, got %d (%v)", len(rls), err)
+	}
+
+	// updating a release encrypts it
+	if err := d.Update(key1, releaseStub("rls-a", 1, "default", rspb.StatusSuperseded)); err != nil {
+		t.Fatalf("failed to update release: %s", err)
+	}
+	if s := raw(key1); !strings.HasPrefix(s, sealedPrefix) {
+		t.Errorf("expected %s to be encrypted after an update", key1)
+	}
+	if got, err := d.Get(key1); err != nil || got.Info.Status != rspb.StatusSuperseded {
+		t.Errorf("failed to get %s after an update: %v", key1, err)
+	}
+
+	// encrypted releases are not read without the key
+	if _, err := plain().Get(key2); err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Errorf("expected an encrypted release to fail to decode without a key, got %v", err)
+	}
+}
+
+func TestSharedChartEncryption(t *testing.T) {
+	secrets := newTestFixtureSecrets(t)
+	secrets.ShareCharts(true)
+	secrets.SetEncrypter(xorEncrypter{})
+	mock := secrets.impl.(*MockSecretsInterface)
+
+	rls := releaseWithChart("rls-a", 1, chartStub("0.1.0"))
+	if err := secrets.Create(testKey("rls-a", 1), rls); err != nil {
+		t.Fatalf("failed to create release: %s", err)
+	}
+	if s := storedChart(t, secrets); !strings.HasPrefix(s, sealedPrefix) {
+		t.Errorf("expected the chart to be encrypted, got %q", s)
+	}
+	got, err := secrets.Get(testKey("rls-a", 1))
+	if err != nil {
+		t.Fatalf("failed to get release: %s", err)
+	}
+	if !reflect.DeepEqual(got.Chart, rls.Chart) {
+		t.Errorf("expected the decrypted chart, got %+v", got.Chart)
+	}
+
+	// the chart is not read without the key, even along a plain record
+	plain := NewSecrets(mock)
+	plain.ShareCharts(true)
+	if err := plain.Create(testKey("rls-b", 1), releaseWithChart("rls-b", 1, chartStub("0.1.0"))); err != nil {
+		t.Fatalf("failed to create release: %s", err)
+	}
+	if _, err := plain.Get(testKey("rls-b", 1)); err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Errorf("expected an encrypted chart to fail to decode without a key, got %v", err)
+	}
+}
+
+func TestRekeyCharts(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+
+	for _, size := range []int{releaseChunkSize, 64} {
+		releaseChunkSize = size
+		secrets := newTestFixtureSecrets(t)
+		secrets.ShareCharts(true)
+		mock := secrets.impl.(*MockSecretsInterface)
+
+		var revisions []*rspb.Release
+		for i := 1; i <= 2; i++ {
+			rls := releaseWithChart("rls-a", i, chartStub("0.1.0"))
+			if err := secrets.Create(testKey("rls-a", i), rls); err != nil {
+				t.Fatalf("failed to create release: %s", err)
+			}
+			revisions = append(revisions, rls)
+		}
+		previous := map[string]bool{}
+		for name := range mock.objects {
+			previous[name] = true
+		}
+		if s := storedChart(t, secrets); strings.HasPrefix(s, sealedPrefix) {
+			t.Errorf("expected the chart to be stored in plain text")
+		}
+
+		secrets.SetEncrypter(xorEncrypter{})
+		if err := secrets.RekeyCharts(revisions); err != nil {
+			t.Fatalf("failed to rekey the charts: %s", err)
+		}
+		if s := storedChart(t, secrets); !strings.HasPrefix(s, sealedPrefix) {
+			t.Errorf("expected the chart to be encrypted once rekeyed, got %q", s)
+		}
+		// the chunks of the chart are all new, the other objects are kept
+		for name, obj := range mock.objects {
+			if previous[name] != (obj.Labels[releaseChunkLabel] != "true" || !strings.HasPrefix(name, chartKeyPrefix)) {
+				t.Errorf("expected the chunks of the chart to be replaced, got %s", name)
+			}
+		}
+		got, err := secrets.Get(testKey("rls-a", 2))
+		if err != nil {
+			t.Fatalf("failed to get release: %s", err)
+		}
+		if !reflect.DeepEqual(got.Chart, revisions[1].Chart) {
+			t.Errorf("expected the decrypted chart, got %+v", got.Chart)
+		}
+	}
+}
+
+// storedChart returns the single chart stored by secrets, as stored.
+func storedChart(t *testing.T, secrets *Secrets) string {
+	t.Helper()
+	for _, obj := range secrets.impl.(*MockSecretsInterface).objects {
+		if obj.Labels[releaseChartLabel] == "true" {
+			s, err := secrets.getChart(chartDigestPrefix + strings.TrimPrefix(obj.Name, chartKeyPrefix))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+	}
+	t.Fatal("no chart stored")
+	return ""
+}
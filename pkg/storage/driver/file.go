@@ -0,0 +1,629 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+var _ Driver = (*File)(nil)
+var _ Locker = (*File)(nil)
+
+const (
+	// FileDriverName is the string name of this driver.
+	FileDriverName = "File"
+
+	fileRecordExt   = ".json"
+	fileLocksDir    = ".locks"
+	fileChartsDir   = ".charts"
+	fileLockName    = ".lock"
+	fileTempPattern = ".tmp-"
+)
+
+// File is the storage driver keeping releases in a local directory.
+//
+// Each release is stored in its own file, <dir>/<namespace>/<key>.json,
+// holding the labels of the release and the release itself encoded like the
+// other drivers do. Once ShareCharts is enabled, the charts of the releases
+// are stored once for all namespaces, in <dir>/.charts/<digest>. Files are
+// replaced atomically and a lock file serializes the processes sharing the
+// directory.
+type File struct {
+	codec
+	chartSharing
+	dir       string
+	namespace string
+	Log       func(string, ...interface{})
+
+	// mu serializes the goroutines of this process, flock the processes.
+	mu    sync.RWMutex
+	flock *flock.Flock
+}
+
+// fileRecord is the content of the file of a release.
+type fileRecord struct {
+	Labels  map[string]string `json:"labels"`
+	Release string            `json:"release"`
+	// Chart is the digest of the chart of the release, if it is not
+	// embedded in the release.
+	Chart string `json:"chart,omitempty"`
+}
+
+// NewFile initializes a new File driver storing releases in dir, which is
+// created if it does not exist.
+func NewFile(dir string) (*File, error) {
+	if dir == "" {
+		return nil, errors.New("file driver: no directory given")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "file driver")
+	}
+	return &File{
+		dir:       dir,
+		namespace: defaultNamespace,
+		Log:       func(_ string, _ ...interface{}) {},
+		flock:     flock.New(filepath.Join(dir, fileLockName)),
+	}, nil
+}
+
+// SetNamespace sets a specific namespace in which releases will be accessed.
+// An empty string indicates all namespaces (for the list and query operations)
+func (f *File) SetNamespace(ns string) {
+	f.namespace = ns
+}
+
+// Name returns the name of the driver.
+func (f *File) Name() string {
+	return FileDriverName
+}
+
+// Get returns the release named by key or returns ErrReleaseNotFound.
+func (f *File) Get(key string) (*rspb.Release, error) {
+	if err := validFileKey(key); err != nil {
+		return nil, err
+	}
+	unlock, err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rec, err := f.read(filepath.Join(f.namespaceDir(f.namespace), key+fileRecordExt))
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil, ErrReleaseNotFound
+		}
+		f.Log("get: failed to read %q: %s", key, err)
+		return nil, err
+	}
+	rls, err := f.decode(rec, newChartLoader(f))
+	if err != nil {
+		f.Log("get: failed to decode data %q: %s", key, err)
+		return nil, err
+	}
+	rls.Labels = rec.Labels
+	return rls, nil
+}
+
+// List returns the list of all releases such that filter(release) == true
+func (f *File) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
+	unlock, err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var results []*rspb.Release
+	charts := newChartLoader(f)
+	err = f.walk(f.namespace, func(rec *fileRecord) {
+		if rec.Labels["owner"] != "helm" {
+			return
+		}
+		rls, err := f.decode(rec, charts)
+		if err != nil {
+			f.Log("list: failed to decode release: %s", err)
+			return
+		}
+		rls.Labels = rec.Labels
+		if filter(rls) {
+			results = append(results, rls)
+		}
+	})
+	return results, err
+}
+
+// Query returns the set of releases that match the provided set of labels
+func (f *File) Query(keyvals map[string]string) ([]*rspb.Release, error) {
+	unlock, err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var lbs labels
+	lbs.init()
+	lbs.fromMap(keyvals)
+
+	var results []*rspb.Release
+	charts := newChartLoader(f)
+	err = f.walk(f.namespace, func(rec *fileRecord) {
+		if !labels(rec.Labels).match(lbs) {
+			return
+		}
+		rls, err := f.decode(rec, charts)
+		if err != nil {
+			f.Log("query: failed to decode release: %s", err)
+			return
+		}
+		rls.Labels = rec.Labels
+		results = append(results, rls)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrReleaseNotFound
+	}
+	return results, nil
+}
+
+// Create creates a new release or returns ErrReleaseExists.
+func (f *File) Create(key string, rls *rspb.Release) error {
+	if err := validFileKey(key); err != nil {
+		return err
+	}
+	unlock, err := f.wlock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := filepath.Join(f.namespaceDir(f.releaseNamespace(rls)), key+fileRecordExt)
+	if _, err := os.Stat(path); err == nil {
+		return ErrReleaseExists
+	}
+
+	var lbs labels
+	lbs.init()
+	lbs.set("createdAt", strconv.Itoa(int(time.Now().Unix())))
+	if _, err := f.write(path, rls, lbs); err != nil {
+		f.Log("create: failed to write %q: %s", key, err)
+		return err
+	}
+	return nil
+}
+
+// Update updates a release or returns ErrReleaseNotFound.
+func (f *File) Update(key string, rls *rspb.Release) error {
+	if err := validFileKey(key); err != nil {
+		return err
+	}
+	unlock, err := f.wlock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := filepath.Join(f.namespaceDir(f.releaseNamespace(rls)), key+fileRecordExt)
+	current, err := f.read(path)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return ErrReleaseNotFound
+		}
+		return err
+	}
+
+	var lbs labels
+	lbs.init()
+	if createdAt, ok := current.Labels["createdAt"]; ok {
+		lbs.set("createdAt", createdAt)
+	}
+	lbs.set("modifiedAt", strconv.Itoa(int(time.Now().Unix())))
+	chart, err := f.write(path, rls, lbs)
+	if err != nil {
+		f.Log("update: failed to write %q: %s", key, err)
+		return err
+	}
+	// remove the previous chart of the release if no other release uses it
+	if current.Chart != chart {
+		if err := collectChart(f, current.Chart); err != nil {
+			f.Log("update: %s", err)
+		}
+	}
+	return nil
+}
+
+// Delete deletes a release or returns ErrReleaseNotFound.
+func (f *File) Delete(key string) (*rspb.Release, error) {
+	if err := validFileKey(key); err != nil {
+		return nil, err
+	}
+	unlock, err := f.wlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	path := filepath.Join(f.namespaceDir(f.namespace), key+fileRecordExt)
+	rec, err := f.read(path)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil, ErrReleaseNotFound
+		}
+		return nil, err
+	}
+	rls, err := f.decode(rec, newChartLoader(f))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, errors.Wrapf(err, "delete: failed to remove %q", key)
+	}
+	// remove the chart of the release if no other release uses it
+	if err := collectChart(f, rec.Chart); err != nil {
+		f.Log("delete: %s", err)
+	}
+	return rls, nil
+}
+
+// RekeyCharts encrypts the charts of the releases stored apart from them
+// again with the current Encrypter.
+func (f *File) RekeyCharts(releases []*rspb.Release) error {
+	unlock, err := f.wlock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return rekeyCharts(f, releases)
+}
+
+// AcquireLock acquires or renews the lock named by key for holder.
+func (f *File) AcquireLock(key, holder string, ttl time.Duration) error {
+	if err := validFileKey(key); err != nil {
+		return err
+	}
+	unlock, err := f.wlock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := f.lockPath(key)
+	now := time.Now()
+	var lock LockInfo
+	current, err := readLockFile(path)
+	switch {
+	case err != nil && !os.IsNotExist(errors.Cause(err)):
+		return errors.Wrapf(err, "acquire: failed to read lock %q", key)
+	case err != nil || current.Holder != holder && current.Expired(now):
+		lock = LockInfo{Holder: holder, AcquiredAt: now}
+	case current.Holder != holder:
+		return &LockedError{Lock: *current}
+	default:
+		lock = *current
+	}
+	lock.RenewedAt = now
+	lock.TTL = ttl
+
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// ReleaseLock releases the lock named by key if it is held by holder.
+func (f *File) ReleaseLock(key, holder string) error {
+	if err := validFileKey(key); err != nil {
+		return err
+	}
+	unlock, err := f.wlock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := f.lockPath(key)
+	current, err := readLockFile(path)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return errors.Wrapf(err, "release: failed to read lock %q", key)
+	}
+	if holder != "" && current.Holder != holder {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "release: failed to remove lock %q", key)
+	}
+	return nil
+}
+
+// GetLock returns the holder of the lock named by key or ErrLockNotFound.
+func (f *File) GetLock(key string) (*LockInfo, error) {
+	if err := validFileKey(key); err != nil {
+		return nil, err
+	}
+	unlock, err := f.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	lock, err := readLockFile(f.lockPath(key))
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil, ErrLockNotFound
+		}
+		return nil, errors.Wrapf(err, "get: failed to read lock %q", key)
+	}
+	return lock, nil
+}
+
+// namespaceDir returns the directory holding the releases of a namespace.
+func (f *File) namespaceDir(namespace string) string {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return filepath.Join(f.dir, namespace)
+}
+
+// releaseNamespace returns the namespace a release is stored in.
+func (f *File) releaseNamespace(rls *rspb.Release) string {
+	// For backwards compatibility, we protect against an unset namespace
+	if rls.Namespace != "" {
+		return rls.Namespace
+	}
+	return defaultNamespace
+}
+
+// lockPath returns the path of the file holding the lock named by key.
+func (f *File) lockPath(key string) string {
+	return filepath.Join(f.namespaceDir(f.namespace), fileLocksDir, key+fileRecordExt)
+}
+
+// walk calls fn for each release file in a namespace, or in every namespace if
+// it is empty.
+func (f *File) walk(namespace string, fn func(*fileRecord)) error {
+	dirs := []string{f.namespaceDir(namespace)}
+	if namespace == "" {
+		entries, err := ioutil.ReadDir(f.dir)
+		if err != nil {
+			return errors.Wrap(err, "failed to list namespaces")
+		}
+		dirs = nil
+		for _, e := range entries {
+			if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				dirs = append(dirs, filepath.Join(f.dir, e.Name()))
+			}
+		}
+	}
+
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to list %s", dir)
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), fileRecordExt) || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			rec, err := f.read(filepath.Join(dir, e.Name()))
+			if err != nil {
+				f.Log("failed to read %s: %s", e.Name(), err)
+				continue
+			}
+			fn(rec)
+		}
+	}
+	return nil
+}
+
+// decode decodes the release of a file, loading its chart.
+func (f *File) decode(rec *fileRecord, charts *chartLoader) (*rspb.Release, error) {
+	rls, err := f.decodeRelease(rec.Release)
+	if err != nil {
+		return nil, err
+	}
+	return rls, charts.load(rls, rec.Chart)
+}
+
+func (f *File) read(path string) (*fileRecord, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec fileRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return &rec, nil
+}
+
+// write stores the release in the file at path, and returns the digest of its
+// chart. The following labels are stored alongside the release, in addition to
+// the given ones:
+//
+//    "version"        - version of the release.
+//    "status"         - status of the release (see pkg/release/status.go for variants)
+//    "owner"          - owner of the file, always "helm".
+//    "name"           - name of the release.
+//    "chartDigest"    - prefix of the digest of the chart, stored apart. (see charts.go)
+//    "auditUser"      - user that performed the operation. (see audit.go)
+//
+// The custom labels of the release, set by the users, are added as well.
+func (f *File) write(path string, rls *rspb.Release, lbs labels) (string, error) {
+	stripped, ch, err := f.splitSharedChart(rls)
+	if err != nil {
+		return "", err
+	}
+	s, err := f.encodeRelease(stripped)
+	if err != nil {
+		return "", err
+	}
+	lbs.fromMap(FilterSystemLabels(rls.Labels))
+	lbs.set("name", rls.Name)
+	lbs.set("owner", "helm")
+	lbs.set("status", rls.Info.Status.String())
+	lbs.set("version", strconv.Itoa(rls.Version))
+	setAuditLabels(lbs, rls)
+	if ch != nil {
+		lbs.set(chartDigestLabel, chartDigestLabelValue(ch.digest))
+	}
+
+	data, err := json.Marshal(fileRecord{Labels: lbs.toMap(), Release: s, Chart: digestOf(ch)})
+	if err != nil {
+		return "", err
+	}
+	if err := storeChart(f, ch); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		if err := collectChart(f, digestOf(ch)); err != nil {
+			f.Log("%s", err)
+		}
+		return "", err
+	}
+	return digestOf(ch), nil
+}
+
+func (f *File) putChart(digest, encoded string) error {
+	path := f.chartPath(digest)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return writeFileAtomic(path, []byte(encoded))
+}
+
+func (f *File) replaceChart(digest, encoded string) error {
+	path := f.chartPath(digest)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return writeFileAtomic(path, []byte(encoded))
+}
+
+func (f *File) getChart(digest string) (string, error) {
+	data, err := ioutil.ReadFile(f.chartPath(digest))
+	return string(data), err
+}
+
+func (f *File) deleteChart(digest string) error {
+	if err := os.Remove(f.chartPath(digest)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *File) chartReferenced(digest string) (bool, error) {
+	var referenced bool
+	err := f.walk("", func(rec *fileRecord) {
+		referenced = referenced || rec.Chart == digest
+	})
+	return referenced, err
+}
+
+// chartPath returns the path of the file holding a chart.
+func (f *File) chartPath(digest string) string {
+	return filepath.Join(f.dir, fileChartsDir, strings.TrimPrefix(digest, chartDigestPrefix))
+}
+
+// wlock locks the directory for writing.
+func (f *File) wlock() (func(), error) {
+	f.mu.Lock()
+	if err := f.flock.Lock(); err != nil {
+		f.mu.Unlock()
+		return nil, errors.Wrap(err, "failed to lock the release directory")
+	}
+	return func() {
+		f.flock.Unlock()
+		f.mu.Unlock()
+	}, nil
+}
+
+// rlock locks the directory for reading.
+func (f *File) rlock() (func(), error) {
+	// A Flock holds a single lock at a time, so readers of this process are
+	// serialized too.
+	return f.wlock()
+}
+
+// validFileKey checks that a key can be used as a file name.
+func validFileKey(key string) error {
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+func readLockFile(path string) (*LockInfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock LockInfo
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return &lock, nil
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of path and
+// renames it to path, so that readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, fileTempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,375 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+func TestFileName(t *testing.T) {
+	if f := newTestFixtureFile(t); f.Name() != FileDriverName {
+		t.Errorf("Expected name to be %q, got %q", FileDriverName, f.Name())
+	}
+}
+
+func TestFileCreate(t *testing.T) {
+	var tests = []struct {
+		desc string
+		rls  *rspb.Release
+		err  bool
+	}{
+		{
+			"create should succeed",
+			releaseStub("rls-c", 1, "default", rspb.StatusDeployed),
+			false,
+		},
+		{
+			"create should fail (release already exists)",
+			releaseStub("rls-a", 1, "default", rspb.StatusDeployed),
+			true,
+		},
+		{
+			"create in namespace should succeed",
+			releaseStub("rls-a", 1, "mynamespace", rspb.StatusDeployed),
+			false,
+		},
+		{
+			"create in other namespace should fail (release already exists)",
+			releaseStub("rls-c", 1, "mynamespace", rspb.StatusDeployed),
+			true,
+		},
+	}
+
+	ts := newTestFixtureFile(t)
+	for _, tt := range tests {
+		err := ts.Create(testKey(tt.rls.Name, tt.rls.Version), tt.rls)
+		if err != nil {
+			if !tt.err {
+				t.Fatalf("failed to create %q: %s", tt.desc, err)
+			}
+			if err != ErrReleaseExists {
+				t.Fatalf("Expected ErrReleaseExists for %q, got %v", tt.desc, err)
+			}
+		} else if tt.err {
+			t.Fatalf("Did not get expected error for %q\n", tt.desc)
+		}
+	}
+}
+
+func TestFileGet(t *testing.T) {
+	ts := newTestFixtureFile(t)
+
+	rls := releaseStub("rls-a", 3, "default", rspb.StatusSuperseded)
+	got, err := ts.Get(testKey(rls.Name, rls.Version))
+	if err != nil {
+		t.Fatalf("Failed to get release: %s", err)
+	}
+	got.Labels = FilterSystemLabels(got.Labels)
+	if !reflect.DeepEqual(rls, got) {
+		t.Errorf("Expected release {%v}, got {%v}", rls, got)
+	}
+
+	if _, err := ts.Get(testKey("rls-c", 1)); err != ErrReleaseNotFound {
+		t.Errorf("Expected ErrReleaseNotFound for a release in another namespace, got %v", err)
+	}
+	ts.SetNamespace("mynamespace")
+	if _, err := ts.Get(testKey("rls-c", 1)); err != nil {
+		t.Errorf("Failed to get release in namespace: %s", err)
+	}
+
+	if _, err := ts.Get("../escape"); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestFileList(t *testing.T) {
+	ts := newTestFixtureFile(t)
+	ts.SetNamespace("default")
+
+	// list all deployed releases
+	dpl, err := ts.List(func(rel *rspb.Release) bool {
+		return rel.Info.Status == rspb.StatusDeployed
+	})
+	if err != nil {
+		t.Fatalf("Failed to list deployed releases: %s", err)
+	}
+	if len(dpl) != 2 {
+		t.Errorf("Expected 2 deployed, got %d", len(dpl))
+	}
+	for _, rls := range dpl {
+		if rls.Labels["owner"] != "helm" || rls.Labels["createdAt"] == "" {
+			t.Errorf("Expected the labels of the release to be set, got %v", rls.Labels)
+		}
+	}
+
+	// list all superseded releases
+	ssd, err := ts.List(func(rel *rspb.Release) bool {
+		return rel.Info.Status == rspb.StatusSuperseded
+	})
+	if err != nil {
+		t.Fatalf("Failed to list superseded releases: %s", err)
+	}
+	if len(ssd) != 6 {
+		t.Errorf("Expected 6 superseded, got %d", len(ssd))
+	}
+
+	// list the releases of all namespaces
+	ts.SetNamespace("")
+	all, err := ts.List(func(*rspb.Release) bool { return true })
+	if err != nil {
+		t.Fatalf("Failed to list releases: %s", err)
+	}
+	if len(all) != 12 {
+		t.Errorf("Expected 12 releases, got %d", len(all))
+	}
+}
+
+func TestFileQuery(t *testing.T) {
+	var tests = []struct {
+		desc      string
+		xlen      int
+		namespace string
+		lbs       map[string]string
+	}{
+		{
+			"should be 2 query results",
+			2,
+			"default",
+			map[string]string{"status": "deployed"},
+		},
+		{
+			"should be 1 query result",
+			1,
+			"mynamespace",
+			map[string]string{"status": "deployed"},
+		},
+		{
+			"should be 3 query results",
+			3,
+			"",
+			map[string]string{"status": "deployed"},
+		},
+		{
+			"should be 4 query results",
+			4,
+			"default",
+			map[string]string{"name": "rls-a", "owner": "helm"},
+		},
+	}
+
+	ts := newTestFixtureFile(t)
+	for _, tt := range tests {
+		ts.SetNamespace(tt.namespace)
+		l, err := ts.Query(tt.lbs)
+		if err != nil {
+			t.Fatalf("Failed to query: %s\n", err)
+		}
+
+		if tt.xlen != len(l) {
+			t.Fatalf("%s: expected %d results, actual %d\n", tt.desc, tt.xlen, len(l))
+		}
+	}
+
+	ts.SetNamespace("default")
+	if _, err := ts.Query(map[string]string{"name": "rls-c"}); err != ErrReleaseNotFound {
+		t.Errorf("Expected ErrReleaseNotFound, got %v", err)
+	}
+}
+
+func TestFileUpdate(t *testing.T) {
+	ts := newTestFixtureFile(t)
+
+	rls := releaseStub("rls-a", 4, "default", rspb.StatusSuperseded)
+	key := testKey(rls.Name, rls.Version)
+	if err := ts.Update(key, rls); err != nil {
+		t.Fatalf("Failed to update release: %s", err)
+	}
+	got, err := ts.Get(key)
+	if err != nil {
+		t.Fatalf("Failed to get release: %s", err)
+	}
+	if got.Info.Status != rspb.StatusSuperseded {
+		t.Errorf("Expected status %s, got %s", rspb.StatusSuperseded, got.Info.Status)
+	}
+
+	l, err := ts.Query(map[string]string{"name": "rls-a", "version": "4"})
+	if err != nil {
+		t.Fatalf("Failed to query: %s", err)
+	}
+	if lbs := l[0].Labels; lbs["status"] != "superseded" || lbs["createdAt"] == "" || lbs["modifiedAt"] == "" {
+		t.Errorf("Expected the labels to be updated, got %v", lbs)
+	}
+
+	missing := releaseStub("rls-z", 1, "default", rspb.StatusDeployed)
+	if err := ts.Update(testKey(missing.Name, missing.Version), missing); err != ErrReleaseNotFound {
+		t.Errorf("Expected ErrReleaseNotFound, got %v", err)
+	}
+}
+
+func TestFileDelete(t *testing.T) {
+	ts := newTestFixtureFile(t)
+
+	key := testKey("rls-a", 1)
+	rls, err := ts.Delete(key)
+	if err != nil {
+		t.Fatalf("Failed to delete release: %s", err)
+	}
+	if rls.Name != "rls-a" || rls.Version != 1 {
+		t.Errorf("Expected deleted release rls-a.v1, got %s.v%d", rls.Name, rls.Version)
+	}
+	if _, err := ts.Get(key); err != ErrReleaseNotFound {
+		t.Errorf("Expected ErrReleaseNotFound, got %v", err)
+	}
+	if _, err := ts.Delete(key); err != ErrReleaseNotFound {
+		t.Errorf("Expected ErrReleaseNotFound, got %v", err)
+	}
+}
+
+func TestFileEncoding(t *testing.T) {
+	ts := newTestFixtureFile(t)
+
+	data, err := ioutil.ReadFile(filepath.Join(ts.dir, "default", testKey("rls-a", 1)+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec fileRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := encodeRelease(releaseStub("rls-a", 1, "default", rspb.StatusSuperseded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Release != expected {
+		t.Errorf("Expected the release to be stored as encoded by encodeRelease")
+	}
+
+	// temporary files are not left behind
+	files, err := ioutil.ReadDir(filepath.Join(ts.dir, "default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 8 {
+		t.Errorf("Expected 8 files, got %d", len(files))
+	}
+}
+
+func TestFileConcurrentCreate(t *testing.T) {
+	dir := newTestFixtureFile(t).dir
+
+	// drivers sharing a directory behave like separate processes
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+	rls := releaseStub("rls-z", 1, "default", rspb.StatusDeployed)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := NewFile(dir)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			switch err := f.Create(testKey(rls.Name, rls.Version), rls); err {
+			case nil:
+				mu.Lock()
+				created++
+				mu.Unlock()
+			case ErrReleaseExists:
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("Expected the release to be created once, got %d", created)
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	f := newTestFixtureFile(t)
+	key := "sh.helm.release.v1.rls-a.lock"
+
+	if _, err := f.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+	if err := f.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("Failed to acquire lock: %s", err)
+	}
+	// renewing the lock as the same holder succeeds
+	if err := f.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("Failed to renew lock: %s", err)
+	}
+
+	// the lock is shared with the other drivers using the directory
+	other, err := NewFile(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.AcquireLock(key, "ci/2", time.Minute)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+	if lerr, ok := err.(*LockedError); !ok || lerr.Lock.Holder != "ci/1" {
+		t.Errorf("Expected lock to be held by %q, got %v", "ci/1", err)
+	}
+
+	// other holders cannot release the lock
+	if err := other.ReleaseLock(key, "ci/2"); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if lock, err := f.GetLock(key); err != nil || lock.Holder != "ci/1" {
+		t.Fatalf("Expected lock to be held by %q, got %v (%v)", "ci/1", lock, err)
+	}
+
+	if err := f.ReleaseLock(key, "ci/1"); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if _, err := f.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+
+	// expired locks can be taken over
+	if err := f.AcquireLock(key, "ci/1", 0); err != nil {
+		t.Fatalf("Failed to acquire lock: %s", err)
+	}
+	if err := other.AcquireLock(key, "ci/2", time.Minute); err != nil {
+		t.Fatalf("Failed to take over expired lock: %s", err)
+	}
+
+	// an empty holder releases the lock regardless of who holds it
+	if err := f.ReleaseLock(key, ""); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if _, err := f.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+}
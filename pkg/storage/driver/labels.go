@@ -16,6 +16,8 @@ limitations under the License.
 
 package driver
 
+import "strings"
+
 // labels is a map of key value pairs to be included as metadata in a configmap object.
 type labels map[string]string
 
@@ -46,3 +48,56 @@ func (lbs *labels) fromMap(kvs map[string]string) {
 		lbs.set(k, v)
 	}
 }
+
+// systemLabels are the labels managed by the drivers, which cannot be set by
+// the users. The labels prefixed with "helm.sh/" are reserved as well, except
+// for the labels prefixed with userHelmLabelPrefix.
+var systemLabels = []string{"name", "owner", "status", "version", "createdAt", "modifiedAt", chartDigestLabel, AuditUserLabel}
+
+// GetSystemLabels returns the labels managed by the drivers.
+func GetSystemLabels() []string {
+	return append([]string(nil), systemLabels...)
+}
+
+// userHelmLabelPrefix prefixes the labels reserved by Helm which are set by the
+// users, such as the labels overriding the retention policy of a release.
+const userHelmLabelPrefix = "helm.sh/history-"
+
+// IsSystemLabel reports whether key is a label managed by the drivers.
+func IsSystemLabel(key string) bool {
+	if strings.HasPrefix(key, "helm.sh/") && !strings.HasPrefix(key, userHelmLabelPrefix) {
+		return true
+	}
+	for _, l := range systemLabels {
+		if key == l {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsSystemLabels reports whether lbs holds a label managed by the drivers.
+func ContainsSystemLabels(lbs map[string]string) bool {
+	for key := range lbs {
+		if IsSystemLabel(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterSystemLabels returns the custom labels of a release, set by the users,
+// given all of its labels.
+func FilterSystemLabels(lbs map[string]string) map[string]string {
+	var custom map[string]string
+	for key, value := range lbs {
+		if IsSystemLabel(key) {
+			continue
+		}
+		if custom == nil {
+			custom = map[string]string{}
+		}
+		custom[key] = value
+	}
+	return custom
+}
@@ -18,6 +18,8 @@ package driver // import "helm.sh/helm/v3/pkg/storage/driver"
 
 import (
 	"testing"
+
+	rspb "helm.sh/helm/v3/pkg/release"
 )
 
 func TestLabelsMatch(t *testing.T) {
@@ -47,3 +49,76 @@ func TestLabelsMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestSystemLabels(t *testing.T) {
+	for _, key := range []string{"name", "owner", "status", "version", "createdAt", "modifiedAt", "chartDigest", "auditUser", "helm.sh/release-chunk"} {
+		if !IsSystemLabel(key) {
+			t.Errorf("expected %s to be a system label", key)
+		}
+	}
+	for _, key := range []string{"team", "helm.sh/history-max-revisions"} {
+		if IsSystemLabel(key) {
+			t.Errorf("expected %s not to be a system label", key)
+		}
+	}
+	if ContainsSystemLabels(map[string]string{"team": "payments"}) {
+		t.Error("expected no system labels")
+	}
+	if !ContainsSystemLabels(map[string]string{"team": "payments", "owner": "me"}) {
+		t.Error("expected the owner label to be a system label")
+	}
+
+	custom := FilterSystemLabels(map[string]string{"team": "payments", "owner": "helm", "version": "1"})
+	if len(custom) != 1 || custom["team"] != "payments" {
+		t.Errorf("expected the custom labels to be team=payments, got %v", custom)
+	}
+	if custom := FilterSystemLabels(map[string]string{"owner": "helm"}); custom != nil {
+		t.Errorf("expected no custom labels, got %v", custom)
+	}
+}
+
+func TestCustomLabels(t *testing.T) {
+	labeled := func(name string, lbs map[string]string) *rspb.Release {
+		rls := releaseStub(name, 1, "default", rspb.StatusDeployed)
+		rls.Labels = lbs
+		return rls
+	}
+	rls := []*rspb.Release{
+		// custom labels do not override the system labels
+		labeled("rls-x", map[string]string{"team": "payments", "name": "rls-y"}),
+		labeled("rls-y", map[string]string{"team": "search"}),
+	}
+
+	mem := NewMemory()
+	f := newTestFixtureFile(t)
+	for _, r := range rls {
+		if err := mem.Create(testKey(r.Name, r.Version), r); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Create(testKey(r.Name, r.Version), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, d := range map[string]Driver{
+		"secrets":    newTestFixtureSecrets(t, rls...),
+		"configmaps": newTestFixtureCfgMaps(t, rls...),
+		"memory":     mem,
+		"file":       f,
+	} {
+		found, err := d.Query(map[string]string{"team": "payments", "owner": "helm"})
+		if err != nil {
+			t.Errorf("%s: failed to query by custom label: %s", name, err)
+			continue
+		}
+		if len(found) != 1 || found[0].Name != "rls-x" {
+			t.Errorf("%s: expected to find rls-x, got %d releases", name, len(found))
+			continue
+		}
+		if found[0].Labels["team"] != "payments" {
+			t.Errorf("%s: expected the release to have its custom labels, got %v", name, found[0].Labels)
+		}
+		if found, err := d.Query(map[string]string{"name": "rls-y", "owner": "helm"}); err != nil || len(found) != 1 {
+			t.Errorf("%s: expected a custom label not to override the name of a release", name)
+		}
+	}
+}
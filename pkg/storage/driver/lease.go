@@ -0,0 +1,168 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	coordv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+var _ Locker = (*Leases)(nil)
+
+// Leases is a Locker backed by coordination.k8s.io Lease objects. It is used
+// to lock releases stored by the Secrets and ConfigMaps drivers.
+type Leases struct {
+	impl coordinationv1.LeaseInterface
+	Log  func(string, ...interface{})
+}
+
+// NewLeases initializes a new Leases wrapping an implementation of
+// the kubernetes LeaseInterface.
+func NewLeases(impl coordinationv1.LeaseInterface) *Leases {
+	return &Leases{
+		impl: impl,
+		Log:  func(_ string, _ ...interface{}) {},
+	}
+}
+
+// AcquireLock acquires or renews the lease named by key for holder.
+func (leases *Leases) AcquireLock(key, holder string, ttl time.Duration) error {
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(math.Ceil(ttl.Seconds()))
+
+	obj, err := leases.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "acquire: failed to get %q", key)
+		}
+		obj = &coordv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   key,
+				Labels: map[string]string{"owner": "helm"},
+			},
+			Spec: coordv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if _, err := leases.impl.Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return leases.lockedError(key)
+			}
+			return errors.Wrapf(err, "acquire: failed to create %q", key)
+		}
+		return nil
+	}
+
+	current := leaseInfo(obj)
+	if current.Holder != holder {
+		if !current.Expired(now.Time) {
+			return &LockedError{Lock: *current}
+		}
+		leases.Log("lock: taking over expired lease %q from %q", key, current.Holder)
+		transitions := int32(0)
+		if obj.Spec.LeaseTransitions != nil {
+			transitions = *obj.Spec.LeaseTransitions
+		}
+		transitions++
+		obj.Spec.HolderIdentity = &holder
+		obj.Spec.AcquireTime = &now
+		obj.Spec.LeaseTransitions = &transitions
+	}
+	obj.Spec.RenewTime = &now
+	obj.Spec.LeaseDurationSeconds = &duration
+
+	// The update carries the resource version we read, so a concurrent
+	// writer makes it fail with a conflict instead of both acquiring the lock.
+	if _, err := leases.impl.Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsConflict(err) {
+			return leases.lockedError(key)
+		}
+		return errors.Wrapf(err, "acquire: failed to update %q", key)
+	}
+	return nil
+}
+
+// ReleaseLock deletes the lease named by key if it is held by holder.
+func (leases *Leases) ReleaseLock(key, holder string) error {
+	obj, err := leases.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "release: failed to get %q", key)
+	}
+	if holder != "" && leaseInfo(obj).Holder != holder {
+		return nil
+	}
+	opts := metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &obj.ResourceVersion},
+	}
+	if err := leases.impl.Delete(context.Background(), key, opts); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "release: failed to delete %q", key)
+	}
+	return nil
+}
+
+// GetLock returns the holder of the lease named by key.
+func (leases *Leases) GetLock(key string) (*LockInfo, error) {
+	obj, err := leases.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrLockNotFound
+		}
+		return nil, errors.Wrapf(err, "get: failed to get lock %q", key)
+	}
+	return leaseInfo(obj), nil
+}
+
+// lockedError reports the current holder of a lease that was modified
+// concurrently.
+func (leases *Leases) lockedError(key string) error {
+	info, err := leases.GetLock(key)
+	if err != nil {
+		return ErrLocked
+	}
+	return &LockedError{Lock: *info}
+}
+
+// leaseInfo converts the spec of a lease to a LockInfo.
+func leaseInfo(obj *coordv1.Lease) *LockInfo {
+	var info LockInfo
+	if obj.Spec.HolderIdentity != nil {
+		info.Holder = *obj.Spec.HolderIdentity
+	}
+	if obj.Spec.AcquireTime != nil {
+		info.AcquiredAt = obj.Spec.AcquireTime.Time
+	}
+	if obj.Spec.RenewTime != nil {
+		info.RenewedAt = obj.Spec.RenewTime.Time
+	}
+	if obj.Spec.LeaseDurationSeconds != nil {
+		info.TTL = time.Duration(*obj.Spec.LeaseDurationSeconds) * time.Second
+	}
+	return &info
+}
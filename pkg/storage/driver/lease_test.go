@@ -0,0 +1,104 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLeasesLock(t *testing.T) {
+	leases, mock := newTestFixtureLeases()
+	key := "sh.helm.release.v1.smug-pigeon.lock"
+
+	if _, err := leases.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+	if err := leases.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("Failed to acquire lock: %s", err)
+	}
+	lease := mock.objects[key]
+	if *lease.Spec.HolderIdentity != "ci/1" || *lease.Spec.LeaseDurationSeconds != 60 {
+		t.Errorf("Unexpected lease spec: %+v", lease.Spec)
+	}
+	if lease.Labels["owner"] != "helm" {
+		t.Errorf("Expected lease to be owned by helm, got labels %v", lease.Labels)
+	}
+
+	// renewing the lock as the same holder succeeds
+	if err := leases.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("Failed to renew lock: %s", err)
+	}
+
+	err := leases.AcquireLock(key, "ci/2", time.Minute)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+	if lerr, ok := err.(*LockedError); !ok || lerr.Lock.Holder != "ci/1" {
+		t.Errorf("Expected lock to be held by %q, got %v", "ci/1", err)
+	}
+
+	// other holders cannot release the lock
+	if err := leases.ReleaseLock(key, "ci/2"); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if _, ok := mock.objects[key]; !ok {
+		t.Fatal("Expected lease to still exist")
+	}
+	if err := leases.ReleaseLock(key, "ci/1"); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if _, ok := mock.objects[key]; ok {
+		t.Fatal("Expected lease to be deleted")
+	}
+}
+
+func TestLeasesTakeOverExpired(t *testing.T) {
+	leases, mock := newTestFixtureLeases()
+	key := "sh.helm.release.v1.smug-pigeon.lock"
+
+	if err := leases.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("Failed to acquire lock: %s", err)
+	}
+	stale := metav1.NewMicroTime(time.Now().Add(-2 * time.Minute))
+	mock.objects[key].Spec.RenewTime = &stale
+
+	if err := leases.AcquireLock(key, "ci/2", time.Minute); err != nil {
+		t.Fatalf("Failed to take over expired lock: %s", err)
+	}
+	lock, err := leases.GetLock(key)
+	if err != nil {
+		t.Fatalf("Failed to get lock: %s", err)
+	}
+	if lock.Holder != "ci/2" {
+		t.Errorf("Expected lock to be held by %q, got %q", "ci/2", lock.Holder)
+	}
+	if transitions := *mock.objects[key].Spec.LeaseTransitions; transitions != 1 {
+		t.Errorf("Expected 1 lease transition, got %d", transitions)
+	}
+
+	// an empty holder releases the lock regardless of who holds it
+	if err := leases.ReleaseLock(key, ""); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if _, err := leases.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+}
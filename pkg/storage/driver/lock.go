@@ -0,0 +1,88 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrLocked indicates that a release is locked by another holder.
+	ErrLocked = errors.New("release: locked")
+	// ErrLockNotFound indicates that a release is not locked.
+	ErrLockNotFound = errors.New("release: lock not found")
+)
+
+// LockInfo describes the current holder of a release lock.
+type LockInfo struct {
+	// Holder identifies the process holding the lock.
+	Holder string `json:"holder"`
+	// AcquiredAt is the time the holder acquired the lock.
+	AcquiredAt time.Time `json:"acquiredAt"`
+	// RenewedAt is the last time the holder renewed the lock.
+	RenewedAt time.Time `json:"renewedAt"`
+	// TTL is how long the lock stays valid after RenewedAt.
+	TTL time.Duration `json:"ttl"`
+}
+
+// ExpiresAt returns the time at which the lock expires unless it is renewed.
+func (l *LockInfo) ExpiresAt() time.Time {
+	return l.RenewedAt.Add(l.TTL)
+}
+
+// Expired reports whether the lock has expired at the given time.
+func (l *LockInfo) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt())
+}
+
+// LockedError records the holder of a lock that could not be acquired.
+type LockedError struct {
+	Lock LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s by %q since %s (expires %s)",
+		ErrLocked,
+		e.Lock.Holder,
+		e.Lock.AcquiredAt.Format(time.RFC3339),
+		e.Lock.ExpiresAt().Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error { return ErrLocked }
+
+// Locker is the interface implemented by drivers able to serialize operations
+// on a release across Helm processes.
+//
+// AcquireLock acquires the lock named by key on behalf of holder for the
+// duration of ttl. Acquiring a lock that is already held by holder renews it.
+// Locks held by another holder which have not expired yet cause a
+// *LockedError.
+//
+// ReleaseLock releases the lock named by key if it is held by holder. An empty
+// holder releases the lock regardless of who holds it. Releasing a lock that
+// is not held is not an error.
+//
+// GetLock returns the current holder of the lock named by key or returns
+// ErrLockNotFound if the lock is not held.
+type Locker interface {
+	AcquireLock(key, holder string, ttl time.Duration) error
+	ReleaseLock(key, holder string) error
+	GetLock(key string) (*LockInfo, error)
+}
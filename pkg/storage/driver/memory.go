@@ -17,14 +17,18 @@ limitations under the License.
 package driver
 
 import (
+	"context"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	rspb "helm.sh/helm/v3/pkg/release"
 )
 
 var _ Driver = (*Memory)(nil)
+var _ Locker = (*Memory)(nil)
+var _ Watcher = (*Memory)(nil)
 
 const (
 	// MemoryDriverName is the string name of this driver.
@@ -42,11 +46,19 @@ type Memory struct {
 	namespace string
 	// A map of namespaces to releases
 	cache map[string]memReleases
+	// A map of namespaces to held locks
+	locks map[string]map[string]LockInfo
+	// A map of the event streams of the watchers to their namespace
+	watchers map[*eventStream]string
 }
 
 // NewMemory initializes a new memory driver.
 func NewMemory() *Memory {
-	return &Memory{cache: map[string]memReleases{}, namespace: "default"}
+	return &Memory{
+		cache:     map[string]memReleases{},
+		locks:     map[string]map[string]LockInfo{},
+		namespace: "default",
+	}
 }
 
 // SetNamespace sets a specific namespace in which releases will be accessed.
@@ -169,9 +181,11 @@ func (mem *Memory) Create(key string, rls *rspb.Release) error {
 			return err
 		}
 		mem.cache[namespace][rls.Name] = recs
+		mem.notify(EventCreated, namespace, rls)
 		return nil
 	}
 	mem.cache[namespace][rls.Name] = records{newRecord(key, rls)}
+	mem.notify(EventCreated, namespace, rls)
 	return nil
 }
 
@@ -189,6 +203,7 @@ func (mem *Memory) Update(key string, rls *rspb.Release) error {
 	if _, ok := mem.cache[namespace]; ok {
 		if rs, ok := mem.cache[namespace][rls.Name]; ok && rs.Exists(key) {
 			rs.Replace(key, newRecord(key, rls))
+			mem.notify(EventUpdated, namespace, rls)
 			return nil
 		}
 	}
@@ -215,6 +230,7 @@ func (mem *Memory) Delete(key string) (*rspb.Release, error) {
 			if r := recs.Remove(key); r != nil {
 				// recs.Remove changes the slice reference, so we have to re-assign it.
 				mem.cache[mem.namespace][name] = recs
+				mem.notify(EventDeleted, mem.namespace, r.rls)
 				return r.rls, nil
 			}
 		}
@@ -222,6 +238,90 @@ func (mem *Memory) Delete(key string) (*rspb.Release, error) {
 	return nil, ErrReleaseNotFound
 }
 
+// Watch streams the events of the releases of the namespace of the driver, or
+// of all namespaces if it is empty.
+func (mem *Memory) Watch(ctx context.Context) (<-chan Event, error) {
+	defer unlock(mem.wlock())
+
+	if mem.watchers == nil {
+		mem.watchers = map[*eventStream]string{}
+	}
+	s := newEventStream(ctx)
+	mem.watchers[s] = mem.namespace
+	go func() {
+		<-ctx.Done()
+		defer unlock(mem.wlock())
+		delete(mem.watchers, s)
+	}()
+	return s.out, nil
+}
+
+// notify sends an event to the watchers of the namespace. It is called with
+// mem locked for writing.
+func (mem *Memory) notify(typ EventType, namespace string, rls *rspb.Release) {
+	for s, ns := range mem.watchers {
+		if ns == "" || ns == namespace {
+			s.push(typ, rls)
+		}
+	}
+}
+
+// AcquireLock acquires or renews the lock named by key for holder.
+func (mem *Memory) AcquireLock(key, holder string, ttl time.Duration) error {
+	defer unlock(mem.wlock())
+
+	namespace := mem.lockNamespace()
+	if mem.locks == nil {
+		mem.locks = map[string]map[string]LockInfo{}
+	}
+	if _, ok := mem.locks[namespace]; !ok {
+		mem.locks[namespace] = map[string]LockInfo{}
+	}
+
+	now := time.Now()
+	lock, ok := mem.locks[namespace][key]
+	switch {
+	case !ok || lock.Holder != holder && lock.Expired(now):
+		lock = LockInfo{Holder: holder, AcquiredAt: now}
+	case lock.Holder != holder:
+		return &LockedError{Lock: lock}
+	}
+	lock.RenewedAt = now
+	lock.TTL = ttl
+	mem.locks[namespace][key] = lock
+	return nil
+}
+
+// ReleaseLock releases the lock named by key if it is held by holder.
+func (mem *Memory) ReleaseLock(key, holder string) error {
+	defer unlock(mem.wlock())
+
+	namespace := mem.lockNamespace()
+	if lock, ok := mem.locks[namespace][key]; ok && (holder == "" || lock.Holder == holder) {
+		delete(mem.locks[namespace], key)
+	}
+	return nil
+}
+
+// GetLock returns the holder of the lock named by key or ErrLockNotFound.
+func (mem *Memory) GetLock(key string) (*LockInfo, error) {
+	defer unlock(mem.rlock())
+
+	lock, ok := mem.locks[mem.lockNamespace()][key]
+	if !ok {
+		return nil, ErrLockNotFound
+	}
+	return &lock, nil
+}
+
+// lockNamespace returns the namespace locks are kept in.
+func (mem *Memory) lockNamespace() string {
+	if mem.namespace == "" {
+		return defaultNamespace
+	}
+	return mem.namespace
+}
+
 // wlock locks mem for writing
 func (mem *Memory) wlock() func() {
 	mem.Lock()
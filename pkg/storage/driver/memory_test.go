@@ -17,9 +17,11 @@ limitations under the License.
 package driver
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	rspb "helm.sh/helm/v3/pkg/release"
 )
@@ -287,3 +289,58 @@ func TestMemoryDelete(t *testing.T) {
 	}
 
 }
+
+func TestMemoryLock(t *testing.T) {
+	mem := NewMemory()
+	key := "sh.helm.release.v1.rls-a.lock"
+
+	if _, err := mem.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+	if err := mem.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("Failed to acquire lock: %s", err)
+	}
+	// renewing the lock as the same holder succeeds
+	if err := mem.AcquireLock(key, "ci/1", time.Minute); err != nil {
+		t.Fatalf("Failed to renew lock: %s", err)
+	}
+
+	err := mem.AcquireLock(key, "ci/2", time.Minute)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+	if lerr, ok := err.(*LockedError); !ok || lerr.Lock.Holder != "ci/1" {
+		t.Errorf("Expected lock to be held by %q, got %v", "ci/1", err)
+	}
+
+	// other holders cannot release the lock
+	if err := mem.ReleaseLock(key, "ci/2"); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if lock, err := mem.GetLock(key); err != nil || lock.Holder != "ci/1" {
+		t.Fatalf("Expected lock to be held by %q, got %v (%v)", "ci/1", lock, err)
+	}
+
+	if err := mem.ReleaseLock(key, "ci/1"); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if _, err := mem.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+
+	// expired locks can be taken over
+	if err := mem.AcquireLock(key, "ci/1", 0); err != nil {
+		t.Fatalf("Failed to acquire lock: %s", err)
+	}
+	if err := mem.AcquireLock(key, "ci/2", time.Minute); err != nil {
+		t.Fatalf("Failed to take over expired lock: %s", err)
+	}
+
+	// an empty holder releases the lock regardless of who holds it
+	if err := mem.ReleaseLock(key, ""); err != nil {
+		t.Fatalf("Failed to release lock: %s", err)
+	}
+	if _, err := mem.GetLock(key); err != ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+}
@@ -18,17 +18,24 @@ package driver // import "helm.sh/helm/v3/pkg/storage/driver"
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
 	"testing"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 
+	coordv1 "k8s.io/api/coordination/v1"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kblabels "k8s.io/apimachinery/pkg/labels"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	rspb "helm.sh/helm/v3/pkg/release"
@@ -43,6 +50,13 @@ func releaseStub(name string, vers int, namespace string, status rspb.Status) *r
 	}
 }
 
+// incompressibleManifest returns a manifest of n random bytes, hex encoded.
+func incompressibleManifest(n int) string {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return hex.EncodeToString(b)
+}
+
 func testKey(name string, vers int) string {
 	return fmt.Sprintf("%s.v%d", name, vers)
 }
@@ -76,6 +90,33 @@ func tsFixtureMemory(t *testing.T) *Memory {
 	return mem
 }
 
+// newTestFixtureFile initializes a File driver in a temporary directory,
+// holding the same releases as tsFixtureMemory.
+func newTestFixtureFile(t *testing.T) *File {
+	dir, err := ioutil.TempDir("", "helm-file-driver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := tsFixtureMemory(t)
+	mem.SetNamespace("")
+	hs, err := mem.List(func(*rspb.Release) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range hs {
+		if err := f.Create(testKey(tt.Name, tt.Version), tt); err != nil {
+			t.Fatalf("Test setup failed to create: %s\n", err)
+		}
+	}
+	return f
+}
+
 // newTestFixture initializes a MockConfigMapsInterface.
 // ConfigMaps are created for each release provided.
 func newTestFixtureCfgMaps(t *testing.T, releases ...*rspb.Release) *ConfigMaps {
@@ -258,8 +299,69 @@ func newTestFixtureSQL(t *testing.T, releases ...*rspb.Release) (*SQL, sqlmock.S
 	sqlxDB := sqlx.NewDb(sqlDB, "sqlmock")
 	return &SQL{
 		db:               sqlxDB,
+		dialect:          sqlDialects[postgreSQLDialect],
 		Log:              func(a string, b ...interface{}) {},
 		namespace:        "default",
 		statementBuilder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
 	}, mock
 }
+
+// newTestFixtureLeases initializes a MockLeasesInterface.
+func newTestFixtureLeases() (*Leases, *MockLeasesInterface) {
+	mock := &MockLeasesInterface{objects: map[string]*coordv1.Lease{}}
+	return NewLeases(mock), mock
+}
+
+// MockLeasesInterface mocks a kubernetes LeaseInterface
+type MockLeasesInterface struct {
+	coordinationv1.LeaseInterface
+
+	objects map[string]*coordv1.Lease
+}
+
+// Get returns the Lease by name.
+func (mock *MockLeasesInterface) Get(_ context.Context, name string, _ metav1.GetOptions) (*coordv1.Lease, error) {
+	object, ok := mock.objects[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(coordv1.Resource("leases"), name)
+	}
+	return object.DeepCopy(), nil
+}
+
+// Create creates a new Lease.
+func (mock *MockLeasesInterface) Create(_ context.Context, lease *coordv1.Lease, _ metav1.CreateOptions) (*coordv1.Lease, error) {
+	name := lease.ObjectMeta.Name
+	if object, ok := mock.objects[name]; ok {
+		return object, apierrors.NewAlreadyExists(coordv1.Resource("leases"), name)
+	}
+	lease = lease.DeepCopy()
+	lease.ResourceVersion = "1"
+	mock.objects[name] = lease
+	return lease, nil
+}
+
+// Update updates a Lease, rejecting stale resource versions.
+func (mock *MockLeasesInterface) Update(_ context.Context, lease *coordv1.Lease, _ metav1.UpdateOptions) (*coordv1.Lease, error) {
+	name := lease.ObjectMeta.Name
+	object, ok := mock.objects[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(coordv1.Resource("leases"), name)
+	}
+	if object.ResourceVersion != lease.ResourceVersion {
+		return nil, apierrors.NewConflict(coordv1.Resource("leases"), name, fmt.Errorf("stale resource version"))
+	}
+	version, _ := strconv.Atoi(object.ResourceVersion)
+	lease = lease.DeepCopy()
+	lease.ResourceVersion = strconv.Itoa(version + 1)
+	mock.objects[name] = lease
+	return lease, nil
+}
+
+// Delete deletes a Lease by name.
+func (mock *MockLeasesInterface) Delete(_ context.Context, name string, _ metav1.DeleteOptions) error {
+	if _, ok := mock.objects[name]; !ok {
+		return apierrors.NewNotFound(coordv1.Resource("leases"), name)
+	}
+	delete(mock.objects, name)
+	return nil
+}
@@ -27,13 +27,17 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 
 	rspb "helm.sh/helm/v3/pkg/release"
 )
 
 var _ Driver = (*Secrets)(nil)
+var _ Watcher = (*Secrets)(nil)
 
 // SecretsDriverName is the string name of the driver.
 const SecretsDriverName = "Secret"
@@ -41,6 +45,8 @@ const SecretsDriverName = "Secret"
 // Secrets is a wrapper around an implementation of a kubernetes
 // SecretsInterface.
 type Secrets struct {
+	codec
+	chartSharing
 	impl corev1.SecretInterface
 	Log  func(string, ...interface{})
 }
@@ -71,8 +77,12 @@ func (secrets *Secrets) Get(key string) (*rspb.Release, error) {
 		return nil, errors.Wrapf(err, "get: failed to get %q", key)
 	}
 	// found the secret, decode the base64 data string
-	r, err := decodeRelease(string(obj.Data["release"]))
-	return r, errors.Wrapf(err, "get: failed to decode data %q", key)
+	r, err := secrets.decode(obj, newChartLoader(secrets))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get: failed to decode data %q", key)
+	}
+	r.Labels = obj.ObjectMeta.Labels
+	return r, nil
 }
 
 // List fetches all releases and returns the list releases such
@@ -88,11 +98,13 @@ func (secrets *Secrets) List(filter func(*rspb.Release) bool) ([]*rspb.Release,
 	}
 
 	var results []*rspb.Release
+	charts := newChartLoader(secrets)
 
 	// iterate over the secrets object list
 	// and decode each release
-	for _, item := range list.Items {
-		rls, err := decodeRelease(string(item.Data["release"]))
+	for i := range list.Items {
+		item := &list.Items[i]
+		rls, err := secrets.decode(item, charts)
 		if err != nil {
 			secrets.Log("list: failed to decode release: %v: %s", item, err)
 			continue
@@ -130,17 +142,42 @@ func (secrets *Secrets) Query(labels map[string]string) ([]*rspb.Release, error)
 	}
 
 	var results []*rspb.Release
-	for _, item := range list.Items {
-		rls, err := decodeRelease(string(item.Data["release"]))
+	charts := newChartLoader(secrets)
+	for i := range list.Items {
+		rls, err := secrets.decode(&list.Items[i], charts)
 		if err != nil {
 			secrets.Log("query: failed to decode release: %s", err)
 			continue
 		}
+		rls.Labels = list.Items[i].ObjectMeta.Labels
 		results = append(results, rls)
 	}
 	return results, nil
 }
 
+// Watch streams the events of the releases with an informer.
+func (secrets *Secrets) Watch(ctx context.Context) (<-chan Event, error) {
+	selector := kblabels.Set{"owner": "helm"}.AsSelector().String()
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = selector
+			return secrets.impl.List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = selector
+			return secrets.impl.Watch(ctx, opts)
+		},
+	}
+	return watchObjects(ctx, lw, &v1.Secret{}, func(obj interface{}) (*rspb.Release, error) {
+		secret := obj.(*v1.Secret)
+		rls, err := secrets.decode(secret, newChartLoader(secrets))
+		if rls != nil {
+			rls.Labels = secret.ObjectMeta.Labels
+		}
+		return rls, err
+	}, secrets.Log)
+}
+
 // Create creates a new Secret holding the release. If the
 // Secret already exists, ErrReleaseExists is returned.
 func (secrets *Secrets) Create(key string, rls *rspb.Release) error {
@@ -150,20 +187,52 @@ func (secrets *Secrets) Create(key string, rls *rspb.Release) error {
 	lbs.init()
 	lbs.set("createdAt", strconv.Itoa(int(time.Now().Unix())))
 
-	// create a new secret to hold the release
-	obj, err := newSecretsObject(key, rls, lbs)
+	// create a new secret to hold the release, without its chart
+	stripped, ch, err := secrets.splitSharedChart(rls)
+	if err != nil {
+		return errors.Wrapf(err, "create: failed to encode release %q", rls.Name)
+	}
+	obj, err := newSecretsObject(key, stripped, lbs)
 	if err != nil {
 		return errors.Wrapf(err, "create: failed to encode release %q", rls.Name)
 	}
+	if err := secrets.sealObject(obj); err != nil {
+		return errors.Wrapf(err, "create: failed to encode release %q", rls.Name)
+	}
+	// split the release in chunks if it does not fit in a single secret
+	var index map[string]string
+	if len(obj.Data["release"]) > releaseChunkSize {
+		if _, err := secrets.impl.Get(context.Background(), key, metav1.GetOptions{}); err == nil {
+			return ErrReleaseExists
+		}
+		if index, err = secrets.chunk(obj); err != nil {
+			return errors.Wrap(err, "create: failed to create")
+		}
+	}
+	if err := storeChart(secrets, ch); err != nil {
+		if index != nil {
+			deleteReleaseChunks(secrets, key, index)
+		}
+		return errors.Wrap(err, "create: failed to create")
+	}
+	setSecretChart(obj, ch)
 	// push the secret object out into the kubiverse
 	if _, err := secrets.impl.Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+		if index != nil {
+			deleteReleaseChunks(secrets, key, index)
+		}
+		if err := collectChart(secrets, digestOf(ch)); err != nil {
+			secrets.Log("create: %s", err)
+		}
 		if apierrors.IsAlreadyExists(err) {
 			return ErrReleaseExists
 		}
 
 		return errors.Wrap(err, "create: failed to create")
 	}
-	return nil
+	// the chart may have been collected by the deletion of its last other
+	// release in the meantime
+	return errors.Wrap(storeChart(secrets, ch), "create: failed to create")
 }
 
 // Update updates the Secret holding the release. If not found
@@ -175,27 +244,303 @@ func (secrets *Secrets) Update(key string, rls *rspb.Release) error {
 	lbs.init()
 	lbs.set("modifiedAt", strconv.Itoa(int(time.Now().Unix())))
 
-	// create a new secret object to hold the release
-	obj, err := newSecretsObject(key, rls, lbs)
+	// create a new secret object to hold the release, without its chart
+	stripped, ch, err := secrets.splitSharedChart(rls)
 	if err != nil {
 		return errors.Wrapf(err, "update: failed to encode release %q", rls.Name)
 	}
+	obj, err := newSecretsObject(key, stripped, lbs)
+	if err != nil {
+		return errors.Wrapf(err, "update: failed to encode release %q", rls.Name)
+	}
+	if err := secrets.sealObject(obj); err != nil {
+		return errors.Wrapf(err, "update: failed to encode release %q", rls.Name)
+	}
+	current, err := secrets.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ErrReleaseNotFound
+		}
+		return errors.Wrap(err, "update: failed to update")
+	}
+	// split the release in chunks if it does not fit in a single secret
+	index, err := secrets.chunk(obj)
+	if err != nil {
+		return errors.Wrap(err, "update: failed to update")
+	}
+	previous := secretIndex(current)
+	previousChart := string(current.Data[releaseChartKey])
+	if err := storeChart(secrets, ch); err != nil {
+		if index != nil && (previous == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+			deleteReleaseChunks(secrets, key, index)
+		}
+		return errors.Wrap(err, "update: failed to update")
+	}
+	setSecretChart(obj, ch)
 	// push the secret object out into the kubiverse
-	_, err = secrets.impl.Update(context.Background(), obj, metav1.UpdateOptions{})
-	return errors.Wrap(err, "update: failed to update")
+	if _, err = secrets.impl.Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		if index != nil && (previous == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+			deleteReleaseChunks(secrets, key, index)
+		}
+		if digestOf(ch) != previousChart {
+			if err := collectChart(secrets, digestOf(ch)); err != nil {
+				secrets.Log("update: %s", err)
+			}
+		}
+		if apierrors.IsNotFound(err) {
+			return ErrReleaseNotFound
+		}
+		return errors.Wrap(err, "update: failed to update")
+	}
+	// remove the chunks of the previous content of the release
+	if previous != nil && (index == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+		if err := deleteReleaseChunks(secrets, key, previous); err != nil {
+			secrets.Log("update: %s", err)
+		}
+	}
+	// remove the previous chart of the release if no other release uses it
+	if previousChart != digestOf(ch) {
+		if err := collectChart(secrets, previousChart); err != nil {
+			secrets.Log("update: %s", err)
+		}
+	}
+	// the chart may have been collected by the deletion of its last other
+	// release in the meantime
+	return errors.Wrap(storeChart(secrets, ch), "update: failed to update")
 }
 
 // Delete deletes the Secret holding the release named by key.
 func (secrets *Secrets) Delete(key string) (rls *rspb.Release, err error) {
 	// fetch the release to check existence
-	if rls, err = secrets.Get(key); err != nil {
-		return nil, err
+	obj, err := secrets.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrReleaseNotFound
+		}
+		return nil, errors.Wrapf(err, "delete: failed to get %q", key)
+	}
+	if rls, err = secrets.decode(obj, newChartLoader(secrets)); err != nil {
+		return nil, errors.Wrapf(err, "delete: failed to decode data %q", key)
 	}
 	// delete the release
-	err = secrets.impl.Delete(context.Background(), key, metav1.DeleteOptions{})
+	if err = secrets.impl.Delete(context.Background(), key, metav1.DeleteOptions{}); err != nil {
+		return rls, err
+	}
+	if index := secretIndex(obj); index != nil {
+		err = deleteReleaseChunks(secrets, key, index)
+	}
+	// remove the chart of the release if no other release uses it
+	if err := collectChart(secrets, string(obj.Data[releaseChartKey])); err != nil {
+		secrets.Log("delete: %s", err)
+	}
 	return rls, err
 }
 
+// RekeyCharts encrypts the charts of the releases stored apart from them
+// again with the current Encrypter.
+func (secrets *Secrets) RekeyCharts(releases []*rspb.Release) error {
+	return rekeyCharts(secrets, releases)
+}
+
+// decode decodes the release held by a secret, reassembling its chunks and
+// loading its chart.
+func (secrets *Secrets) decode(obj *v1.Secret, charts *chartLoader) (*rspb.Release, error) {
+	encoded := string(obj.Data["release"])
+	if index := secretIndex(obj); index != nil {
+		var err error
+		if encoded, err = readReleaseChunks(secrets, obj.Name, index); err != nil {
+			return nil, err
+		}
+	}
+	rls, err := secrets.decodeRelease(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return rls, charts.load(rls, string(obj.Data[releaseChartKey]))
+}
+
+// sealObject encrypts the release held by obj, if encryption is enabled.
+func (secrets *Secrets) sealObject(obj *v1.Secret) error {
+	sealed, err := secrets.seal(string(obj.Data["release"]))
+	obj.Data["release"] = []byte(sealed)
+	return err
+}
+
+// chunk stores the release held by obj in chunks if it is too large for a
+// single secret, and replaces it with the index record of the chunks.
+func (secrets *Secrets) chunk(obj *v1.Secret) (map[string]string, error) {
+	index, err := writeReleaseChunks(secrets, obj.Name, string(obj.Data["release"]))
+	if err != nil || index == nil {
+		return nil, err
+	}
+	obj.Data = map[string][]byte{}
+	for k, v := range index {
+		obj.Data[k] = []byte(v)
+	}
+	return index, nil
+}
+
+func (secrets *Secrets) createChunk(name, data string) error {
+	obj := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{releaseChunkLabel: "true"},
+		},
+		Type: releaseChunkType,
+		Data: map[string][]byte{"release": []byte(data)},
+	}
+	_, err := secrets.impl.Create(context.Background(), obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func (secrets *Secrets) getChunk(name string) (string, error) {
+	obj, err := secrets.impl.Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(obj.Data["release"]), nil
+}
+
+func (secrets *Secrets) deleteChunk(name string) error {
+	err := secrets.impl.Delete(context.Background(), name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (secrets *Secrets) putChart(digest, encoded string) error {
+	name := chartKey(digest)
+	if _, err := secrets.impl.Get(context.Background(), name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		return err
+	}
+	obj := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{releaseChartLabel: "true"},
+		},
+		Type: releaseChartType,
+		Data: map[string][]byte{releaseChartKey: []byte(encoded)},
+	}
+	// split the chart in chunks if it does not fit in a single secret
+	index, err := writeReleaseChunks(secrets, name, encoded)
+	if err != nil {
+		return err
+	}
+	if index != nil {
+		obj.Data = map[string][]byte{}
+		for k, v := range index {
+			obj.Data[k] = []byte(v)
+		}
+	}
+	_, err = secrets.impl.Create(context.Background(), obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// the chunks, named after the digest, are the ones of the stored chart
+		return nil
+	}
+	if err != nil && index != nil {
+		deleteReleaseChunks(secrets, name, index)
+	}
+	return err
+}
+
+func (secrets *Secrets) replaceChart(digest, encoded string) error {
+	obj, err := secrets.impl.Get(context.Background(), chartKey(digest), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	previous := secretIndex(obj)
+	obj.Data = map[string][]byte{releaseChartKey: []byte(encoded)}
+	index, err := writeReleaseChunks(secrets, obj.Name, encoded)
+	if err != nil {
+		return err
+	}
+	if index != nil {
+		obj.Data = map[string][]byte{}
+		for k, v := range index {
+			obj.Data[k] = []byte(v)
+		}
+	}
+	if _, err := secrets.impl.Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		if index != nil && (previous == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+			deleteReleaseChunks(secrets, obj.Name, index)
+		}
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	// remove the chunks of the previous content of the chart
+	if previous != nil && (index == nil || previous[releaseDigestKey] != index[releaseDigestKey]) {
+		return deleteReleaseChunks(secrets, obj.Name, previous)
+	}
+	return nil
+}
+
+func (secrets *Secrets) getChart(digest string) (string, error) {
+	obj, err := secrets.impl.Get(context.Background(), chartKey(digest), metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if index := secretIndex(obj); index != nil {
+		return readReleaseChunks(secrets, obj.Name, index)
+	}
+	return string(obj.Data[releaseChartKey]), nil
+}
+
+func (secrets *Secrets) deleteChart(digest string) error {
+	obj, err := secrets.impl.Get(context.Background(), chartKey(digest), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if err := secrets.deleteChunk(obj.Name); err != nil {
+		return err
+	}
+	if index := secretIndex(obj); index != nil {
+		return deleteReleaseChunks(secrets, obj.Name, index)
+	}
+	return nil
+}
+
+func (secrets *Secrets) chartReferenced(digest string) (bool, error) {
+	lsel := kblabels.Set{chartDigestLabel: chartDigestLabelValue(digest)}.AsSelector()
+	list, err := secrets.impl.List(context.Background(), metav1.ListOptions{LabelSelector: lsel.String(), Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	return len(list.Items) > 0, nil
+}
+
+// setSecretChart makes a secret reference the chart of its release.
+func setSecretChart(obj *v1.Secret, ch *encodedChart) {
+	if ch == nil {
+		return
+	}
+	obj.Data[releaseChartKey] = []byte(ch.digest)
+	obj.Labels[chartDigestLabel] = chartDigestLabelValue(ch.digest)
+}
+
+// secretIndex returns the index record held by a secret, or nil if the secret
+// holds the release itself.
+func secretIndex(obj *v1.Secret) map[string]string {
+	if _, ok := obj.Data[releaseChunksKey]; !ok {
+		return nil
+	}
+	return map[string]string{
+		releaseChunksKey: string(obj.Data[releaseChunksKey]),
+		releaseDigestKey: string(obj.Data[releaseDigestKey]),
+	}
+}
+
 // newSecretsObject constructs a kubernetes Secret object
 // to store a release. Each secret data entry is the base64
 // encoded gzipped string of a release.
@@ -208,7 +553,10 @@ func (secrets *Secrets) Delete(key string) (rls *rspb.Release, err error) {
 //    "status"         - status of the release (see pkg/release/status.go for variants)
 //    "owner"          - owner of the secret, currently "helm".
 //    "name"           - name of the release.
+//    "chartDigest"    - prefix of the digest of the chart, stored apart. (see charts.go)
+//    "auditUser"      - user that performed the operation. (see audit.go)
 //
+// The custom labels of the release, set by the users, are added as well.
 func newSecretsObject(key string, rls *rspb.Release, lbs labels) (*v1.Secret, error) {
 	const owner = "helm"
 
@@ -223,10 +571,12 @@ func newSecretsObject(key string, rls *rspb.Release, lbs labels) (*v1.Secret, er
 	}
 
 	// apply labels
+	lbs.fromMap(FilterSystemLabels(rls.Labels))
 	lbs.set("name", rls.Name)
 	lbs.set("owner", owner)
 	lbs.set("status", rls.Info.Status.String())
 	lbs.set("version", strconv.Itoa(rls.Version))
+	setAuditLabels(lbs, rls)
 
 	// create and return secret object.
 	// Helm 3 introduced setting the 'Type' field
@@ -17,6 +17,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
@@ -46,6 +48,7 @@ func TestSecretGet(t *testing.T) {
 		t.Fatalf("Failed to get release: %s", err)
 	}
 	// compare fetched release with original
+	got.Labels = FilterSystemLabels(got.Labels)
 	if !reflect.DeepEqual(rel, got) {
 		t.Errorf("Expected {%v}, got {%v}", rel, got)
 	}
@@ -78,6 +81,7 @@ func TestUNcompressedSecretGet(t *testing.T) {
 		t.Fatalf("Failed to get release: %s", err)
 	}
 	// compare fetched release with original
+	got.Labels = FilterSystemLabels(got.Labels)
 	if !reflect.DeepEqual(rel, got) {
 		t.Errorf("Expected {%v}, got {%v}", rel, got)
 	}
@@ -175,6 +179,7 @@ func TestSecretCreate(t *testing.T) {
 	}
 
 	// compare created release with original
+	got.Labels = FilterSystemLabels(got.Labels)
 	if !reflect.DeepEqual(rel, got) {
 		t.Errorf("Expected {%v}, got {%v}", rel, got)
 	}
@@ -239,3 +244,89 @@ func TestSecretDelete(t *testing.T) {
 		t.Errorf("Expected {%v}, got {%v}", ErrReleaseNotFound, err)
 	}
 }
+
+func TestSecretChunks(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+	releaseChunkSize = 256
+
+	name := "smug-pigeon"
+	key := testKey(name, 1)
+	rel := releaseStub(name, 1, "default", rspb.StatusDeployed)
+	rel.Manifest = incompressibleManifest(4096)
+
+	secrets := newTestFixtureSecrets(t)
+	objects := secrets.impl.(*MockSecretsInterface).objects
+	if err := secrets.Create(key, rel); err != nil {
+		t.Fatalf("Failed to create release: %s", err)
+	}
+	index := objects[key]
+	if _, ok := index.Data["release"]; ok || string(index.Data["chunks"]) != strconv.Itoa(len(objects)-1) {
+		t.Fatalf("Expected an index record of %d chunks, got %v", len(objects)-1, index.Data)
+	}
+	if len(objects) < 3 {
+		t.Fatalf("Expected the release to be split in chunks, got %d objects", len(objects))
+	}
+
+	got, err := secrets.Get(key)
+	if err != nil {
+		t.Fatalf("Failed to get release: %s", err)
+	}
+	got.Labels = FilterSystemLabels(got.Labels)
+	if !reflect.DeepEqual(rel, got) {
+		t.Errorf("Expected {%v}, got {%v}", rel, got)
+	}
+	if l, err := secrets.Query(map[string]string{"name": name, "owner": "helm"}); err != nil || len(l) != 1 {
+		t.Errorf("Expected the chunks to be hidden from queries, got %d releases (%v)", len(l), err)
+	}
+
+	// updating the release replaces its chunks
+	rel.Info.Status = rspb.StatusSuperseded
+	rel.Manifest = incompressibleManifest(2048)
+	if err := secrets.Update(key, rel); err != nil {
+		t.Fatalf("Failed to update release: %s", err)
+	}
+	if n, _ := strconv.Atoi(string(objects[key].Data["chunks"])); n != len(objects)-1 {
+		t.Errorf("Expected the previous chunks to be deleted, got %d objects for %d chunks", len(objects), n)
+	}
+	if got, err := secrets.Get(key); err != nil || got.Manifest != rel.Manifest {
+		t.Errorf("Expected the updated release, got %v", err)
+	}
+
+	// a corrupted chunk is detected
+	chunk := objects[releaseChunkName(key, string(objects[key].Data["digest"]), 1)]
+	chunk.Data["release"] = append([]byte("x"), chunk.Data["release"][1:]...)
+	if _, err := secrets.Get(key); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("Expected a digest mismatch, got %v", err)
+	}
+
+	if _, err := secrets.Delete(key); err == nil {
+		t.Error("Expected the corrupted release not to be deleted")
+	}
+	delete(objects, key)
+	if len(objects) == 0 {
+		t.Fatal("Expected the chunks to remain")
+	}
+}
+
+func TestSecretChunksDelete(t *testing.T) {
+	defer func(size int) { releaseChunkSize = size }(releaseChunkSize)
+	releaseChunkSize = 256
+
+	key := testKey("smug-pigeon", 1)
+	rel := releaseStub("smug-pigeon", 1, "default", rspb.StatusDeployed)
+	rel.Manifest = incompressibleManifest(4096)
+
+	secrets := newTestFixtureSecrets(t)
+	if err := secrets.Create(key, rel); err != nil {
+		t.Fatalf("Failed to create release: %s", err)
+	}
+	if err := secrets.Create(key, rel); err != ErrReleaseExists {
+		t.Errorf("Expected ErrReleaseExists, got %v", err)
+	}
+	if _, err := secrets.Delete(key); err != nil {
+		t.Fatalf("Failed to delete release: %s", err)
+	}
+	if objects := secrets.impl.(*MockSecretsInterface).objects; len(objects) != 0 {
+		t.Errorf("Expected the chunks to be deleted, got %d objects", len(objects))
+	}
+}
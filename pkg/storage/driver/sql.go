@@ -17,22 +17,29 @@ limitations under the License.
 package driver // import "helm.sh/helm/v3/pkg/storage/driver"
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"math"
 	"sort"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 	migrate "github.com/rubenv/sql-migrate"
 
 	sq "github.com/Masterminds/squirrel"
 
-	// Import pq for postgres dialect
-	_ "github.com/lib/pq"
-
 	rspb "helm.sh/helm/v3/pkg/release"
 )
 
 var _ Driver = (*SQL)(nil)
+var _ Locker = (*SQL)(nil)
+var _ Watcher = (*SQL)(nil)
+
+// sqlWatchInterval is the interval at which the SQL driver polls the
+// database for the changes of the releases.
+var sqlWatchInterval = 2 * time.Second
 
 var labelMap = map[string]struct{}{
 	"modifiedAt": {},
@@ -43,8 +50,6 @@ var labelMap = map[string]struct{}{
 	"name":       {},
 }
 
-const postgreSQLDialect = "postgres"
-
 // SQLDriverName is the string name of this driver.
 const SQLDriverName = "SQL"
 
@@ -63,6 +68,28 @@ const (
 	sqlReleaseTableModifiedAtColumn = "modifiedAt"
 )
 
+// The custom labels of the releases are stored in their own table, a row per
+// label.
+const sqlCustomLabelsTableName = "custom_labels_v1"
+
+const (
+	sqlCustomLabelsTableReleaseKeyColumn       = "releaseKey"
+	sqlCustomLabelsTableReleaseNamespaceColumn = "releaseNamespace"
+	sqlCustomLabelsTableKeyColumn              = "key"
+	sqlCustomLabelsTableValueColumn            = "value"
+)
+
+const sqlLockTableName = "release_locks_v1"
+
+const (
+	sqlLockTableKeyColumn        = "key"
+	sqlLockTableNamespaceColumn  = "namespace"
+	sqlLockTableHolderColumn     = "holder"
+	sqlLockTableAcquiredAtColumn = "acquiredAt"
+	sqlLockTableRenewedAtColumn  = "renewedAt"
+	sqlLockTableTTLColumn        = "ttl"
+)
+
 const (
 	sqlReleaseDefaultOwner = "helm"
 	sqlReleaseDefaultType  = "helm.sh/release.v1"
@@ -70,7 +97,9 @@ const (
 
 // SQL is the sql storage driver implementation.
 type SQL struct {
+	codec
 	db               *sqlx.DB
+	dialect          *sqlDialect
 	namespace        string
 	statementBuilder sq.StatementBuilderType
 
@@ -85,75 +114,10 @@ func (s *SQL) Name() string {
 func (s *SQL) ensureDBSetup() error {
 	// Populate the database with the relations we need if they don't exist yet
 	migrations := &migrate.MemoryMigrationSource{
-		Migrations: []*migrate.Migration{
-			{
-				Id: "init",
-				Up: []string{
-					fmt.Sprintf(`
-						CREATE TABLE %s (
-							%s VARCHAR(67),
-							%s VARCHAR(64) NOT NULL,
-							%s TEXT NOT NULL,
-							%s VARCHAR(64) NOT NULL,
-							%s VARCHAR(64) NOT NULL,
-							%s INTEGER NOT NULL,
-							%s TEXT NOT NULL,
-							%s TEXT NOT NULL,
-							%s INTEGER NOT NULL,
-							%s INTEGER NOT NULL DEFAULT 0,
-							PRIMARY KEY(%s, %s)
-						);
-						CREATE INDEX ON %s (%s, %s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-						
-						GRANT ALL ON %s TO PUBLIC;
-
-						ALTER TABLE %s ENABLE ROW LEVEL SECURITY;
-					`,
-						sqlReleaseTableName,
-						sqlReleaseTableKeyColumn,
-						sqlReleaseTableTypeColumn,
-						sqlReleaseTableBodyColumn,
-						sqlReleaseTableNameColumn,
-						sqlReleaseTableNamespaceColumn,
-						sqlReleaseTableVersionColumn,
-						sqlReleaseTableStatusColumn,
-						sqlReleaseTableOwnerColumn,
-						sqlReleaseTableCreatedAtColumn,
-						sqlReleaseTableModifiedAtColumn,
-						sqlReleaseTableKeyColumn,
-						sqlReleaseTableNamespaceColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableKeyColumn,
-						sqlReleaseTableNamespaceColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableVersionColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableStatusColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableOwnerColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableCreatedAtColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableModifiedAtColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableName,
-					),
-				},
-				Down: []string{
-					fmt.Sprintf(`
-						DROP TABLE %s;
-					`, sqlReleaseTableName),
-				},
-			},
-		},
-	}
-
-	_, err := migrate.Exec(s.db.DB, postgreSQLDialect, migrations, migrate.Up)
+		Migrations: s.dialect.migrations(s.dialect),
+	}
+
+	_, err := migrate.Exec(s.db.DB, s.dialect.name, migrations, migrate.Up)
 	return err
 }
 
@@ -180,17 +144,49 @@ type SQLReleaseWrapper struct {
 	ModifiedAt int    `db:"modifiedAt"`
 }
 
-// NewSQL initializes a new sql driver.
+// SQLLockWrapper describes how release locks are stored in an SQL database
+type SQLLockWrapper struct {
+	Key        string `db:"key"`
+	Namespace  string `db:"namespace"`
+	Holder     string `db:"holder"`
+	AcquiredAt int    `db:"acquiredAt"`
+	RenewedAt  int    `db:"renewedAt"`
+	// TTL is the lifetime of the lock in seconds
+	TTL int `db:"ttl"`
+}
+
+func (w *SQLLockWrapper) info() *LockInfo {
+	return &LockInfo{
+		Holder:     w.Holder,
+		AcquiredAt: time.Unix(int64(w.AcquiredAt), 0),
+		RenewedAt:  time.Unix(int64(w.RenewedAt), 0),
+		TTL:        time.Duration(w.TTL) * time.Second,
+	}
+}
+
+// NewSQL initializes a new sql driver. The database is PostgreSQL, unless the
+// connection string starts with mysql:// for MySQL, or sqlite:// for SQLite,
+// which requires Helm to be built with cgo.
 func NewSQL(connectionString string, logger func(string, ...interface{}), namespace string) (*SQL, error) {
-	db, err := sqlx.Connect(postgreSQLDialect, connectionString)
+	dialect, dataSourceName := parseSQLConnectionString(connectionString)
+	if dialect.name == sqliteDialect && !sqliteSupported {
+		return nil, errors.New("the SQLite storage is not supported by this build of Helm, which was built without cgo (CGO_ENABLED=0)")
+	}
+	db, err := sqlx.Connect(dialect.name, dataSourceName)
 	if err != nil {
 		return nil, err
 	}
+	if dialect.name == sqliteDialect {
+		// SQLite allows a single writer, and each connection to an in-memory
+		// database opens a new one.
+		db.SetMaxOpenConns(1)
+	}
 
 	driver := &SQL{
 		db:               db,
+		dialect:          dialect,
 		Log:              logger,
-		statementBuilder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+		statementBuilder: sq.StatementBuilder.PlaceholderFormat(dialect.placeholder),
 	}
 
 	if err := driver.ensureDBSetup(); err != nil {
@@ -209,7 +205,7 @@ func (s *SQL) Get(key string) (*rspb.Release, error) {
 	qb := s.statementBuilder.
 		Select(sqlReleaseTableBodyColumn).
 		From(sqlReleaseTableName).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
+		Where(sq.Eq{s.dialect.quote(sqlReleaseTableKeyColumn): key}).
 		Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace})
 
 	query, args, err := qb.ToSql()
@@ -224,19 +220,26 @@ func (s *SQL) Get(key string) (*rspb.Release, error) {
 		return nil, ErrReleaseNotFound
 	}
 
-	release, err := decodeRelease(record.Body)
+	release, err := s.decodeRelease(record.Body)
 	if err != nil {
 		s.Log("get: failed to decode data %q: %v", key, err)
 		return nil, err
 	}
 
+	labels, err := s.customLabels(key, s.namespace)
+	if err != nil {
+		s.Log("get: failed to get the custom labels of %q: %v", key, err)
+		return nil, err
+	}
+	release.Labels = labels[s.namespace+"/"+key]
+
 	return release, nil
 }
 
 // List returns the list of all releases such that filter(release) == true
 func (s *SQL) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
 	sb := s.statementBuilder.
-		Select(sqlReleaseTableBodyColumn).
+		Select(s.dialect.quote(sqlReleaseTableKeyColumn), sqlReleaseTableNamespaceColumn, sqlReleaseTableBodyColumn).
 		From(sqlReleaseTableName).
 		Where(sq.Eq{sqlReleaseTableOwnerColumn: sqlReleaseDefaultOwner})
 
@@ -257,13 +260,20 @@ func (s *SQL) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
 		return nil, err
 	}
 
+	labels, err := s.customLabels("", s.namespace)
+	if err != nil {
+		s.Log("list: failed to list the custom labels: %v", err)
+		return nil, err
+	}
+
 	var releases []*rspb.Release
 	for _, record := range records {
-		release, err := decodeRelease(record.Body)
+		release, err := s.decodeRelease(record.Body)
 		if err != nil {
 			s.Log("list: failed to decode release: %v: %v", record, err)
 			continue
 		}
+		release.Labels = labels[record.Namespace+"/"+record.Key]
 		if filter(release) {
 			releases = append(releases, release)
 		}
@@ -275,7 +285,7 @@ func (s *SQL) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
 // Query returns the set of releases that match the provided set of labels.
 func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 	sb := s.statementBuilder.
-		Select(sqlReleaseTableBodyColumn).
+		Select(s.dialect.quote(sqlReleaseTableKeyColumn), sqlReleaseTableNamespaceColumn, sqlReleaseTableBodyColumn).
 		From(sqlReleaseTableName)
 
 	keys := make([]string, 0, len(labels))
@@ -286,6 +296,8 @@ func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 	for _, key := range keys {
 		if _, ok := labelMap[key]; ok {
 			sb = sb.Where(sq.Eq{key: labels[key]})
+		} else if !IsSystemLabel(key) {
+			sb = sb.Where(s.hasCustomLabel(key, labels[key]))
 		} else {
 			s.Log("unknown label %s", key)
 			return nil, fmt.Errorf("unknow label %s", key)
@@ -310,13 +322,23 @@ func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 		return nil, err
 	}
 
+	if len(records) == 0 {
+		return nil, ErrReleaseNotFound
+	}
+	customLabels, err := s.customLabels("", s.namespace)
+	if err != nil {
+		s.Log("list: failed to list the custom labels: %v", err)
+		return nil, err
+	}
+
 	var releases []*rspb.Release
 	for _, record := range records {
-		release, err := decodeRelease(record.Body)
+		release, err := s.decodeRelease(record.Body)
 		if err != nil {
 			s.Log("list: failed to decode release: %v: %v", record, err)
 			continue
 		}
+		release.Labels = customLabels[record.Namespace+"/"+record.Key]
 		releases = append(releases, release)
 	}
 
@@ -335,7 +357,7 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 	}
 	s.namespace = namespace
 
-	body, err := encodeRelease(rls)
+	body, err := s.encodeRelease(rls)
 	if err != nil {
 		s.Log("failed to encode release: %v", err)
 		return err
@@ -350,7 +372,7 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 	insertQuery, args, err := s.statementBuilder.
 		Insert(sqlReleaseTableName).
 		Columns(
-			sqlReleaseTableKeyColumn,
+			s.dialect.quote(sqlReleaseTableKeyColumn),
 			sqlReleaseTableTypeColumn,
 			sqlReleaseTableBodyColumn,
 			sqlReleaseTableNameColumn,
@@ -380,9 +402,9 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 		defer transaction.Rollback()
 
 		selectQuery, args, buildErr := s.statementBuilder.
-			Select(sqlReleaseTableKeyColumn).
+			Select(s.dialect.quote(sqlReleaseTableKeyColumn)).
 			From(sqlReleaseTableName).
-			Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
+			Where(sq.Eq{s.dialect.quote(sqlReleaseTableKeyColumn): key}).
 			Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace}).
 			ToSql()
 		if buildErr != nil {
@@ -399,6 +421,12 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 		s.Log("failed to store release %s in SQL database: %v", key, err)
 		return err
 	}
+
+	if err := s.insertCustomLabels(transaction, key, namespace, rls.Labels); err != nil {
+		transaction.Rollback()
+		s.Log("failed to store the custom labels of release %s in SQL database: %v", key, err)
+		return err
+	}
 	defer transaction.Commit()
 
 	return nil
@@ -412,7 +440,7 @@ func (s *SQL) Update(key string, rls *rspb.Release) error {
 	}
 	s.namespace = namespace
 
-	body, err := encodeRelease(rls)
+	body, err := s.encodeRelease(rls)
 	if err != nil {
 		s.Log("failed to encode release: %v", err)
 		return err
@@ -426,7 +454,7 @@ func (s *SQL) Update(key string, rls *rspb.Release) error {
 		Set(sqlReleaseTableStatusColumn, rls.Info.Status.String()).
 		Set(sqlReleaseTableOwnerColumn, sqlReleaseDefaultOwner).
 		Set(sqlReleaseTableModifiedAtColumn, int(time.Now().Unix())).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
+		Where(sq.Eq{s.dialect.quote(sqlReleaseTableKeyColumn): key}).
 		Where(sq.Eq{sqlReleaseTableNamespaceColumn: namespace}).
 		ToSql()
 
@@ -435,12 +463,36 @@ func (s *SQL) Update(key string, rls *rspb.Release) error {
 		return err
 	}
 
-	if _, err := s.db.Exec(query, args...); err != nil {
+	transaction, err := s.db.Beginx()
+	if err != nil {
+		s.Log("failed to start SQL transaction: %v", err)
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+
+	result, err := transaction.Exec(query, args...)
+	if err != nil {
+		transaction.Rollback()
 		s.Log("failed to update release %s in SQL database: %v", key, err)
 		return err
 	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		transaction.Rollback()
+		return ErrReleaseNotFound
+	}
 
-	return nil
+	// the custom labels of the release are replaced
+	if err := s.deleteCustomLabels(transaction, key, namespace); err != nil {
+		transaction.Rollback()
+		s.Log("failed to delete the custom labels of release %s in SQL database: %v", key, err)
+		return err
+	}
+	if err := s.insertCustomLabels(transaction, key, namespace, rls.Labels); err != nil {
+		transaction.Rollback()
+		s.Log("failed to store the custom labels of release %s in SQL database: %v", key, err)
+		return err
+	}
+
+	return transaction.Commit()
 }
 
 // Delete deletes a release or returns ErrReleaseNotFound.
@@ -454,7 +506,7 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 	selectQuery, args, err := s.statementBuilder.
 		Select(sqlReleaseTableBodyColumn).
 		From(sqlReleaseTableName).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
+		Where(sq.Eq{s.dialect.quote(sqlReleaseTableKeyColumn): key}).
 		Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace}).
 		ToSql()
 	if err != nil {
@@ -466,10 +518,11 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 	err = transaction.Get(&record, selectQuery, args...)
 	if err != nil {
 		s.Log("release %s not found: %v", key, err)
+		transaction.Rollback()
 		return nil, ErrReleaseNotFound
 	}
 
-	release, err := decodeRelease(record.Body)
+	release, err := s.decodeRelease(record.Body)
 	if err != nil {
 		s.Log("failed to decode release %s: %v", key, err)
 		transaction.Rollback()
@@ -479,7 +532,7 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 
 	deleteQuery, args, err := s.statementBuilder.
 		Delete(sqlReleaseTableName).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
+		Where(sq.Eq{s.dialect.quote(sqlReleaseTableKeyColumn): key}).
 		Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace}).
 		ToSql()
 	if err != nil {
@@ -487,6 +540,456 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 		return nil, err
 	}
 
-	_, err = transaction.Exec(deleteQuery, args...)
+	if _, err = transaction.Exec(deleteQuery, args...); err != nil {
+		return release, err
+	}
+	if release.Labels, err = s.customLabelsIn(transaction, key, s.namespace); err == nil {
+		err = s.deleteCustomLabels(transaction, key, s.namespace)
+	}
+	if err != nil {
+		// the release is kept along with its labels
+		transaction.Rollback()
+	}
 	return release, err
 }
+
+// customLabels returns the custom labels of the release named by key in
+// namespace, or of every release of namespace if key is empty, or of every
+// release if both are empty. The labels are returned by "<namespace>/<key>".
+func (s *SQL) customLabels(key, namespace string) (map[string]map[string]string, error) {
+	sb := s.statementBuilder.
+		Select(
+			sqlCustomLabelsTableReleaseKeyColumn,
+			sqlCustomLabelsTableReleaseNamespaceColumn,
+			s.dialect.quote(sqlCustomLabelsTableKeyColumn),
+			s.dialect.quote(sqlCustomLabelsTableValueColumn),
+		).
+		From(sqlCustomLabelsTableName)
+	if key != "" {
+		sb = sb.Where(sq.Eq{sqlCustomLabelsTableReleaseKeyColumn: key})
+	}
+	if namespace != "" {
+		sb = sb.Where(sq.Eq{sqlCustomLabelsTableReleaseNamespaceColumn: namespace})
+	}
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	// the columns are scanned by position, as PostgreSQL lowercases their
+	// names
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	labels := map[string]map[string]string{}
+	for rows.Next() {
+		var releaseKey, releaseNamespace, k, v string
+		if err := rows.Scan(&releaseKey, &releaseNamespace, &k, &v); err != nil {
+			return nil, err
+		}
+		id := releaseNamespace + "/" + releaseKey
+		if labels[id] == nil {
+			labels[id] = map[string]string{}
+		}
+		labels[id][k] = v
+	}
+	return labels, rows.Err()
+}
+
+// customLabelsIn returns the custom labels of the release named by key in
+// namespace, read in transaction.
+func (s *SQL) customLabelsIn(transaction *sqlx.Tx, key, namespace string) (map[string]string, error) {
+	query, args, err := s.statementBuilder.
+		Select(s.dialect.quote(sqlCustomLabelsTableKeyColumn), s.dialect.quote(sqlCustomLabelsTableValueColumn)).
+		From(sqlCustomLabelsTableName).
+		Where(sq.Eq{sqlCustomLabelsTableReleaseKeyColumn: key}).
+		Where(sq.Eq{sqlCustomLabelsTableReleaseNamespaceColumn: namespace}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := transaction.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var labels map[string]string
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[k] = v
+	}
+	return labels, rows.Err()
+}
+
+// insertCustomLabels stores the custom labels of the release named by key in
+// namespace, the system labels being held by the columns of the releases.
+func (s *SQL) insertCustomLabels(transaction *sqlx.Tx, key, namespace string, lbs map[string]string) error {
+	custom := FilterSystemLabels(lbs)
+	if len(custom) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(custom))
+	for k := range custom {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ib := s.statementBuilder.
+		Insert(sqlCustomLabelsTableName).
+		Columns(
+			sqlCustomLabelsTableReleaseKeyColumn,
+			sqlCustomLabelsTableReleaseNamespaceColumn,
+			s.dialect.quote(sqlCustomLabelsTableKeyColumn),
+			s.dialect.quote(sqlCustomLabelsTableValueColumn),
+		)
+	for _, k := range keys {
+		ib = ib.Values(key, namespace, k, custom[k])
+	}
+	query, args, err := ib.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = transaction.Exec(query, args...)
+	return err
+}
+
+// deleteCustomLabels deletes the custom labels of the release named by key in
+// namespace.
+func (s *SQL) deleteCustomLabels(transaction *sqlx.Tx, key, namespace string) error {
+	query, args, err := s.statementBuilder.
+		Delete(sqlCustomLabelsTableName).
+		Where(sq.Eq{sqlCustomLabelsTableReleaseKeyColumn: key}).
+		Where(sq.Eq{sqlCustomLabelsTableReleaseNamespaceColumn: namespace}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = transaction.Exec(query, args...)
+	return err
+}
+
+// hasCustomLabel returns the condition of the releases having the custom
+// label key set to value.
+func (s *SQL) hasCustomLabel(key, value string) sq.Sqlizer {
+	return sq.Expr(fmt.Sprintf(
+		"EXISTS (SELECT 1 FROM %s WHERE %s = %s.%s AND %s = %s.%s AND %s = ? AND %s = ?)",
+		sqlCustomLabelsTableName,
+		sqlCustomLabelsTableReleaseKeyColumn, sqlReleaseTableName, s.dialect.quote(sqlReleaseTableKeyColumn),
+		sqlCustomLabelsTableReleaseNamespaceColumn, sqlReleaseTableName, sqlReleaseTableNamespaceColumn,
+		s.dialect.quote(sqlCustomLabelsTableKeyColumn),
+		s.dialect.quote(sqlCustomLabelsTableValueColumn),
+	), key, value)
+}
+
+// AcquireLock acquires or renews the lock named by key for holder. The lock
+// row is read with SELECT ... FOR UPDATE, or in an immediate transaction with
+// SQLite, so concurrent writers are serialized by the database until the
+// transaction completes.
+func (s *SQL) AcquireLock(key, holder string, ttl time.Duration) error {
+	namespace := s.lockNamespace()
+	now := int(time.Now().Unix())
+	seconds := int(math.Ceil(ttl.Seconds()))
+
+	transaction, err := s.db.Beginx()
+	if err != nil {
+		s.Log("failed to start SQL transaction: %v", err)
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	defer transaction.Rollback()
+
+	sb := s.statementBuilder.
+		Select(
+			sqlLockTableHolderColumn,
+			sqlLockTableAcquiredAtColumn,
+			sqlLockTableRenewedAtColumn,
+			sqlLockTableTTLColumn,
+		).
+		From(sqlLockTableName).
+		Where(sq.Eq{s.dialect.quote(sqlLockTableKeyColumn): key}).
+		Where(sq.Eq{sqlLockTableNamespaceColumn: namespace})
+	if s.dialect.forUpdate != "" {
+		sb = sb.Suffix(s.dialect.forUpdate)
+	}
+	selectQuery, args, err := sb.ToSql()
+	if err != nil {
+		s.Log("failed to build select query: %v", err)
+		return err
+	}
+
+	var record SQLLockWrapper
+	var query string
+	switch err := transaction.Get(&record, selectQuery, args...); {
+	case err == sql.ErrNoRows:
+		query, args, err = s.statementBuilder.
+			Insert(sqlLockTableName).
+			Columns(
+				s.dialect.quote(sqlLockTableKeyColumn),
+				sqlLockTableNamespaceColumn,
+				sqlLockTableHolderColumn,
+				sqlLockTableAcquiredAtColumn,
+				sqlLockTableRenewedAtColumn,
+				sqlLockTableTTLColumn,
+			).
+			Values(key, namespace, holder, now, now, seconds).
+			ToSql()
+		if err != nil {
+			s.Log("failed to build insert query: %v", err)
+			return err
+		}
+	case err != nil:
+		s.Log("failed to get lock %s: %v", key, err)
+		return err
+	default:
+		lock := record.info()
+		ub := s.statementBuilder.
+			Update(sqlLockTableName).
+			Set(sqlLockTableRenewedAtColumn, now).
+			Set(sqlLockTableTTLColumn, seconds)
+		if lock.Holder != holder {
+			if !lock.Expired(time.Unix(int64(now), 0)) {
+				return &LockedError{Lock: *lock}
+			}
+			s.Log("taking over expired lock %s from %q", key, lock.Holder)
+			ub = ub.
+				Set(sqlLockTableHolderColumn, holder).
+				Set(sqlLockTableAcquiredAtColumn, now)
+		}
+		query, args, err = ub.
+			Where(sq.Eq{s.dialect.quote(sqlLockTableKeyColumn): key}).
+			Where(sq.Eq{sqlLockTableNamespaceColumn: namespace}).
+			ToSql()
+		if err != nil {
+			s.Log("failed to build update query: %v", err)
+			return err
+		}
+	}
+
+	if _, err := transaction.Exec(query, args...); err != nil {
+		s.Log("failed to store lock %s in SQL database: %v", key, err)
+		// A concurrent insert of the same lock violates the primary key.
+		if s.dialect.uniqueViolation(err) {
+			return ErrLocked
+		}
+		return errors.Wrapf(err, "failed to store lock %s", key)
+	}
+	return transaction.Commit()
+}
+
+// ReleaseLock releases the lock named by key if it is held by holder.
+func (s *SQL) ReleaseLock(key, holder string) error {
+	db := s.statementBuilder.
+		Delete(sqlLockTableName).
+		Where(sq.Eq{s.dialect.quote(sqlLockTableKeyColumn): key}).
+		Where(sq.Eq{sqlLockTableNamespaceColumn: s.lockNamespace()})
+	if holder != "" {
+		db = db.Where(sq.Eq{sqlLockTableHolderColumn: holder})
+	}
+	query, args, err := db.ToSql()
+	if err != nil {
+		s.Log("failed to build delete query: %v", err)
+		return err
+	}
+	if _, err := s.db.Exec(query, args...); err != nil {
+		s.Log("failed to release lock %s: %v", key, err)
+		return err
+	}
+	return nil
+}
+
+// GetLock returns the holder of the lock named by key or ErrLockNotFound.
+func (s *SQL) GetLock(key string) (*LockInfo, error) {
+	query, args, err := s.statementBuilder.
+		Select(
+			sqlLockTableHolderColumn,
+			sqlLockTableAcquiredAtColumn,
+			sqlLockTableRenewedAtColumn,
+			sqlLockTableTTLColumn,
+		).
+		From(sqlLockTableName).
+		Where(sq.Eq{s.dialect.quote(sqlLockTableKeyColumn): key}).
+		Where(sq.Eq{sqlLockTableNamespaceColumn: s.lockNamespace()}).
+		ToSql()
+	if err != nil {
+		s.Log("failed to build query: %v", err)
+		return nil, err
+	}
+
+	var record SQLLockWrapper
+	if err := s.db.Get(&record, query, args...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLockNotFound
+		}
+		s.Log("failed to get lock %s: %v", key, err)
+		return nil, err
+	}
+	return record.info(), nil
+}
+
+// lockNamespace returns the namespace locks are kept in.
+func (s *SQL) lockNamespace() string {
+	if s.namespace == "" {
+		return defaultNamespace
+	}
+	return s.namespace
+}
+
+// Watch streams the events of the releases by polling the database every
+// sqlWatchInterval, comparing its records with the previous ones. The polls
+// only read the timestamps of the records, and the bodies of those that
+// changed.
+func (s *SQL) Watch(ctx context.Context) (<-chan Event, error) {
+	namespace := s.namespace
+	since := time.Now().Unix()
+	previous, err := s.watchRecords(namespace, nil, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "watch: failed to list")
+	}
+	events := newEventStream(ctx)
+	go func() {
+		ticker := time.NewTicker(sqlWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			now := time.Now().Unix()
+			current, err := s.watchRecords(namespace, previous, since)
+			if err != nil {
+				s.Log("watch: failed to list: %v", err)
+				continue
+			}
+			s.diff(previous, current, events)
+			previous, since = current, now
+		}
+	}()
+	return events.out, nil
+}
+
+// sqlWatchRecord is a record of a release seen by a watch.
+type sqlWatchRecord struct {
+	createdAt  int
+	modifiedAt int
+	body       string
+}
+
+// watchRecords returns the records of the releases of a namespace, or of all
+// namespaces, by namespace and key. The bodies of the previous records are
+// kept unless their timestamps changed. As the timestamps are in seconds, the
+// bodies of the records written since the second of the previous poll are
+// read again, since they may have been written again within that second.
+func (s *SQL) watchRecords(namespace string, previous map[string]sqlWatchRecord, since int64) (map[string]sqlWatchRecord, error) {
+	sb := s.statementBuilder.
+		Select(s.dialect.quote(sqlReleaseTableKeyColumn), sqlReleaseTableNamespaceColumn, sqlReleaseTableCreatedAtColumn, sqlReleaseTableModifiedAtColumn).
+		From(sqlReleaseTableName).
+		Where(sq.Eq{sqlReleaseTableOwnerColumn: sqlReleaseDefaultOwner})
+	if namespace != "" {
+		sb = sb.Where(sq.Eq{sqlReleaseTableNamespaceColumn: namespace})
+	}
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var stamps []SQLReleaseWrapper
+	if err := s.db.Select(&stamps, query, args...); err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]sqlWatchRecord, len(stamps))
+	var changed []SQLReleaseWrapper
+	for _, stamp := range stamps {
+		key := stamp.Namespace + "/" + stamp.Key
+		record, ok := previous[key]
+		if ok && record.createdAt == stamp.CreatedAt && record.modifiedAt == stamp.ModifiedAt &&
+			int64(stamp.CreatedAt) < since && int64(stamp.ModifiedAt) < since {
+			current[key] = record
+			continue
+		}
+		changed = append(changed, stamp)
+	}
+	if len(changed) == 0 {
+		return current, nil
+	}
+
+	sb = s.statementBuilder.
+		Select(s.dialect.quote(sqlReleaseTableKeyColumn), sqlReleaseTableNamespaceColumn, sqlReleaseTableCreatedAtColumn, sqlReleaseTableModifiedAtColumn, sqlReleaseTableBodyColumn).
+		From(sqlReleaseTableName).
+		Where(sq.Eq{sqlReleaseTableOwnerColumn: sqlReleaseDefaultOwner})
+	if namespace != "" {
+		sb = sb.Where(sq.Eq{sqlReleaseTableNamespaceColumn: namespace})
+	}
+	// all the bodies are read at once when every record changed, as when
+	// the watch starts
+	if len(changed) < len(stamps) {
+		keys := make(sq.Or, 0, len(changed))
+		for _, stamp := range changed {
+			keys = append(keys, sq.And{
+				sq.Eq{s.dialect.quote(sqlReleaseTableKeyColumn): stamp.Key},
+				sq.Eq{sqlReleaseTableNamespaceColumn: stamp.Namespace},
+			})
+		}
+		sb = sb.Where(keys)
+	}
+	query, args, err = sb.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var records []SQLReleaseWrapper
+	if err := s.db.Select(&records, query, args...); err != nil {
+		return nil, err
+	}
+	// the records deleted since their timestamps were read are left out
+	for _, record := range records {
+		current[record.Namespace+"/"+record.Key] = sqlWatchRecord{
+			createdAt:  record.CreatedAt,
+			modifiedAt: record.ModifiedAt,
+			body:       record.Body,
+		}
+	}
+	return current, nil
+}
+
+// diff pushes the events turning the previous records into the current ones.
+func (s *SQL) diff(previous, current map[string]sqlWatchRecord, events *eventStream) {
+	keys := make([]string, 0, len(previous)+len(current))
+	for key := range current {
+		keys = append(keys, key)
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		before, existed := previous[key]
+		after, exists := current[key]
+		var typ EventType
+		switch {
+		case !existed:
+			typ = EventCreated
+		case !exists:
+			typ, after = EventDeleted, before
+		case before.body != after.body:
+			typ = EventUpdated
+		default:
+			continue
+		}
+		rls, err := s.decodeRelease(after.body)
+		if err != nil {
+			s.Log("watch: failed to decode release %q: %v", key, err)
+			continue
+		}
+		events.push(typ, rls)
+	}
+}
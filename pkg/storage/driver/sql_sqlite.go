@@ -0,0 +1,32 @@
+// Copyright The Helm Authors.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package driver
+
+import (
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// sqliteSupported reports whether the SQLite dialect is supported.
+const sqliteSupported = true
+
+// isSQLiteUniqueViolation reports whether err is the violation of a unique
+// constraint or primary key.
+func isSQLiteUniqueViolation(err error) bool {
+	var liteErr sqlite3.Error
+	return errors.As(err, &liteErr) &&
+		(liteErr.ExtendedCode == sqlite3.ErrConstraintUnique || liteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
@@ -37,6 +37,11 @@ func encodeRelease(rls *rspb.Release) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return compress(b)
+}
+
+// compress returns the base64 encoded gzipped string of b.
+func compress(b []byte) (string, error) {
 	var buf bytes.Buffer
 	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
 	if err != nil {
@@ -54,6 +59,22 @@ func encodeRelease(rls *rspb.Release) (string, error) {
 // type. Data must contain a base64 encoded gzipped string of a
 // valid release, otherwise an error is returned.
 func decodeRelease(data string) (*rspb.Release, error) {
+	b, err := decompress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rls rspb.Release
+	// unmarshal release object bytes
+	if err := json.Unmarshal(b, &rls); err != nil {
+		return nil, err
+	}
+	return &rls, nil
+}
+
+// decompress decodes a base64 encoded string, gunzipping it if it is
+// compressed.
+func decompress(data string) ([]byte, error) {
 	// base64 decode string
 	b, err := b64.DecodeString(data)
 	if err != nil {
@@ -63,23 +84,13 @@ func decodeRelease(data string) (*rspb.Release, error) {
 	// For backwards compatibility with releases that were stored before
 	// compression was introduced we skip decompression if the
 	// gzip magic header is not found
-	if bytes.Equal(b[0:3], magicGzip) {
+	if len(b) >= len(magicGzip) && bytes.Equal(b[0:3], magicGzip) {
 		r, err := gzip.NewReader(bytes.NewReader(b))
 		if err != nil {
 			return nil, err
 		}
 		defer r.Close()
-		b2, err := ioutil.ReadAll(r)
-		if err != nil {
-			return nil, err
-		}
-		b = b2
-	}
-
-	var rls rspb.Release
-	// unmarshal release object bytes
-	if err := json.Unmarshal(b, &rls); err != nil {
-		return nil, err
+		return ioutil.ReadAll(r)
 	}
-	return &rls, nil
+	return b, nil
 }
@@ -0,0 +1,238 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver // import "helm.sh/helm/v3/pkg/storage/driver"
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+// EventType is the type of a release Event.
+type EventType string
+
+const (
+	// EventCreated is sent when a release is created.
+	EventCreated EventType = "CREATED"
+	// EventUpdated is sent when a release is updated.
+	EventUpdated EventType = "UPDATED"
+	// EventDeleted is sent when a release is deleted.
+	EventDeleted EventType = "DELETED"
+)
+
+// Event is a change of a release stored by a driver.
+type Event struct {
+	Type EventType
+	// Release is the release created or updated, or the last known state of
+	// the release deleted.
+	Release *rspb.Release
+}
+
+// Watcher is the interface of the drivers able to stream the changes of the
+// releases they store.
+//
+// Watch streams the events of the releases of the namespace of the driver,
+// or of all namespaces, that happen after it returns. The channel is closed
+// once ctx is done.
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan Event, error)
+}
+
+// eventStream delivers events to a channel in order, without blocking the
+// goroutine producing them, which is typically holding a lock of the driver
+// or running an informer.
+type eventStream struct {
+	ctx   context.Context
+	out   chan Event
+	ready chan struct{}
+
+	mu    sync.Mutex
+	queue []Event
+}
+
+// newEventStream starts delivering the events pushed to the stream, until
+// ctx is done.
+func newEventStream(ctx context.Context) *eventStream {
+	s := &eventStream{
+		ctx:   ctx,
+		out:   make(chan Event),
+		ready: make(chan struct{}, 1),
+	}
+	go s.run()
+	return s
+}
+
+// push queues an event.
+func (s *eventStream) push(typ EventType, rls *rspb.Release) {
+	s.mu.Lock()
+	s.queue = append(s.queue, Event{Type: typ, Release: rls})
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *eventStream) run() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, ev := range queue {
+			select {
+			case s.out <- ev:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-s.ready:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// watchObjects streams the events of the release objects of the Kubernetes
+// drivers, listed and watched by lw, with an informer. decode decodes the
+// release held by an object.
+func watchObjects(ctx context.Context, lw *cache.ListWatch, objType runtime.Object, decode func(obj interface{}) (*rspb.Release, error), log func(string, ...interface{})) (<-chan Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	events := newEventStream(ctx)
+
+	// The informer adds the objects of its first list before it watches the
+	// objects: initial holds their resource versions, as they are not events.
+	var (
+		mu      sync.Mutex
+		initial map[string]string
+		listed  = make(chan error, 1)
+	)
+	list := lw.ListFunc
+	lw.ListFunc = func(opts metav1.ListOptions) (runtime.Object, error) {
+		obj, err := list(opts)
+		mu.Lock()
+		defer mu.Unlock()
+		if initial != nil {
+			return obj, err
+		}
+		if err == nil {
+			initial = map[string]string{}
+			var items []runtime.Object
+			if items, err = meta.ExtractList(obj); err == nil {
+				for _, item := range items {
+					if m, err := meta.Accessor(item); err == nil {
+						initial[m.GetName()] = m.GetResourceVersion()
+					}
+				}
+			}
+		}
+		select {
+		case listed <- err:
+		default:
+		}
+		return obj, err
+	}
+
+	handle := func(typ EventType, obj interface{}) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil || m.GetLabels()["owner"] != "helm" {
+			return
+		}
+		mu.Lock()
+		rv, ok := initial[m.GetName()]
+		delete(initial, m.GetName())
+		mu.Unlock()
+		if typ == EventCreated && ok && rv == m.GetResourceVersion() {
+			return
+		}
+
+		rls, err := decode(obj)
+		if err != nil {
+			// the chart or the chunks of a deleted release may be deleted
+			// too, its last known state is then its labels
+			if typ != EventDeleted {
+				log("watch: failed to decode release %q: %s", m.GetName(), err)
+				return
+			}
+			if rls == nil {
+				rls = releaseFromLabels(m)
+			}
+		}
+		events.push(typ, rls)
+	}
+	_, controller := cache.NewInformer(lw, objType, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handle(EventCreated, obj)
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			// relisting the objects updates them without changing them
+			o, err1 := meta.Accessor(old)
+			n, err2 := meta.Accessor(obj)
+			if err1 == nil && err2 == nil && o.GetResourceVersion() != "" && o.GetResourceVersion() == n.GetResourceVersion() {
+				return
+			}
+			handle(EventUpdated, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			handle(EventDeleted, obj)
+		},
+	})
+	go controller.Run(ctx.Done())
+
+	select {
+	case err := <-listed:
+		if err != nil {
+			cancel()
+			return nil, errors.Wrap(err, "watch: failed to list")
+		}
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
+	}
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	return events.out, nil
+}
+
+// releaseFromLabels returns the release described by the labels of a
+// Kubernetes object.
+func releaseFromLabels(m metav1.Object) *rspb.Release {
+	lbs := m.GetLabels()
+	version, _ := strconv.Atoi(lbs["version"])
+	return &rspb.Release{
+		Name:      lbs["name"],
+		Namespace: m.GetNamespace(),
+		Version:   version,
+		Info:      &rspb.Info{Status: rspb.Status(lbs["status"])},
+		Labels:    lbs,
+	}
+}
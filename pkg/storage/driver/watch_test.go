@@ -0,0 +1,134 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+)
+
+type watchableDriver interface {
+	Driver
+	Watcher
+}
+
+// newWatchedClientset returns a fake clientset and a function returning once a
+// watch starts, as the fake watches do not replay the events since the
+// resource version they start from.
+func newWatchedClientset() (*fake.Clientset, func()) {
+	cs := fake.NewSimpleClientset()
+	watching := make(chan struct{}, 1)
+	cs.PrependWatchReactor("*", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := cs.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		watching <- struct{}{}
+		return true, w, err
+	})
+	return cs, func() { <-watching }
+}
+
+func TestMemoryWatch(t *testing.T) {
+	testWatcher(t, NewMemory(), func() {})
+}
+
+func TestSecretsWatch(t *testing.T) {
+	cs, wait := newWatchedClientset()
+	testWatcher(t, NewSecrets(cs.CoreV1().Secrets("default")), wait)
+}
+
+func TestConfigMapsWatch(t *testing.T) {
+	cs, wait := newWatchedClientset()
+	testWatcher(t, NewConfigMaps(cs.CoreV1().ConfigMaps("default")), wait)
+}
+
+func TestSQLWatch(t *testing.T) {
+	if !sqliteSupported {
+		t.Skip("SQLite requires cgo")
+	}
+	defer func(interval time.Duration) { sqlWatchInterval = interval }(sqlWatchInterval)
+	sqlWatchInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "helm-sql-watch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testWatcher(t, newSQLConformanceFixture(t, "sqlite://"+filepath.Join(dir, "helm.db")), func() {})
+}
+
+// testWatcher tests a watchable driver, wait returning once the driver
+// watches the releases.
+func testWatcher(t *testing.T, d watchableDriver, wait func()) {
+	// the releases existing before the watch are not events
+	if err := d.Create(testKey("rls-a", 1), releaseStub("rls-a", 1, "default", rspb.StatusDeployed)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.Watch(ctx)
+	if err != nil {
+		t.Fatalf("failed to watch: %s", err)
+	}
+	wait()
+
+	expect := func(typ EventType, name string, version int, status rspb.Status) {
+		t.Helper()
+		select {
+		case ev := <-events:
+			if ev.Type != typ || ev.Release.Name != name || ev.Release.Version != version || ev.Release.Info.Status != status {
+				t.Errorf("expected %s %s.v%d %s, got %s %s.v%d %s", typ, name, version, status, ev.Type, ev.Release.Name, ev.Release.Version, ev.Release.Info.Status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s %s.v%d", typ, name, version)
+		}
+	}
+
+	if err := d.Update(testKey("rls-a", 1), releaseStub("rls-a", 1, "default", rspb.StatusSuperseded)); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventUpdated, "rls-a", 1, rspb.StatusSuperseded)
+
+	if err := d.Create(testKey("rls-a", 2), releaseStub("rls-a", 2, "default", rspb.StatusDeployed)); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventCreated, "rls-a", 2, rspb.StatusDeployed)
+
+	if _, err := d.Delete(testKey("rls-a", 1)); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventDeleted, "rls-a", 1, rspb.StatusSuperseded)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected no more events")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the events to be closed once the context is done")
+	}
+}
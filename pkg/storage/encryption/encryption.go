@@ -0,0 +1,159 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package encryption encrypts the release records of the storage drivers at rest.
+
+Records are encrypted with envelope encryption: each Envelope encrypts the
+records with AES-256-GCM under a random data key, and a KeyProvider wraps the
+data key with a key encryption key that never leaves the provider. The
+encrypted record holds the ID of the key encryption key along with the wrapped
+data key, so that records encrypted before a key rotation are still decrypted
+as long as the provider knows the previous key.
+*/
+package encryption // import "helm.sh/helm/v3/pkg/storage/encryption"
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// KeyProvider wraps and unwraps data keys with key encryption keys.
+type KeyProvider interface {
+	// WrapKey encrypts a data key with the current key encryption key and
+	// returns the ID of that key along with the wrapped data key.
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped with the key encryption key
+	// keyID.
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// envelope is an encrypted record.
+type envelope struct {
+	// KeyID is the ID of the key encryption key that wrapped Key.
+	KeyID string `json:"kid"`
+	// Key is the wrapped data key.
+	Key   []byte `json:"key"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// Envelope encrypts records with data keys wrapped by a KeyProvider.
+//
+// An Envelope generates a single data key, wrapped once, for the records it
+// encrypts, and caches the data keys it unwraps, so that the provider is not
+// called for every record.
+type Envelope struct {
+	provider KeyProvider
+
+	mu        sync.Mutex
+	dataKey   *envelope
+	aead      cipher.AEAD
+	unwrapped map[string]cipher.AEAD
+}
+
+// NewEnvelope creates a new Envelope wrapping its data keys with provider.
+func NewEnvelope(provider KeyProvider) *Envelope {
+	return &Envelope{
+		provider:  provider,
+		unwrapped: map[string]cipher.AEAD{},
+	}
+}
+
+// Encrypt encrypts a record.
+func (e *Envelope) Encrypt(plaintext []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.dataKey == nil {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, errors.Wrap(err, "failed to generate a data key")
+		}
+		keyID, wrapped, err := e.provider.WrapKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to wrap the data key")
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		e.dataKey = &envelope{KeyID: keyID, Key: wrapped}
+		e.aead = aead
+	}
+
+	env := *e.dataKey
+	env.Nonce = make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, env.Nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate a nonce")
+	}
+	env.Data = e.aead.Seal(nil, env.Nonce, plaintext, []byte(env.KeyID))
+	return json.Marshal(env)
+}
+
+// Decrypt decrypts a record encrypted by Encrypt, with the current or a
+// previous key encryption key of the provider.
+func (e *Envelope) Decrypt(ciphertext []byte) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(ciphertext, &env); err != nil {
+		return nil, errors.Wrap(err, "invalid encrypted record")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cacheKey := env.KeyID + "/" + string(env.Key)
+	aead, ok := e.unwrapped[cacheKey]
+	if !ok {
+		key, err := e.provider.UnwrapKey(env.KeyID, env.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to unwrap the data key with key %q", env.KeyID)
+		}
+		if aead, err = newAEAD(key); err != nil {
+			return nil, err
+		}
+		e.unwrapped[cacheKey] = aead
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid encrypted record: bad nonce")
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Data, []byte(env.KeyID))
+	return plaintext, errors.Wrap(err, "failed to decrypt record")
+}
+
+// KeyID returns the ID of the key encryption key of a record encrypted by an
+// Envelope.
+func KeyID(ciphertext []byte) (string, error) {
+	var env envelope
+	if err := json.Unmarshal(ciphertext, &env); err != nil {
+		return "", errors.Wrap(err, "invalid encrypted record")
+	}
+	return env.KeyID, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
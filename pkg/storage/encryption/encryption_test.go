@@ -0,0 +1,214 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "helm-encryption-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// writeKeyfile writes a keyfile with a key per ID, the keys being derived
+// from the IDs.
+func writeKeyfile(t *testing.T, ids ...string) string {
+	var b strings.Builder
+	b.WriteString("keys:\n")
+	for _, id := range ids {
+		key := bytes.Repeat([]byte(id), 32)[:32]
+		fmt.Fprintf(&b, "  - id: %s\n    secret: %s\n", id, base64.StdEncoding.EncodeToString(key))
+	}
+	path := filepath.Join(tempDir(t), "keys.yaml")
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func mustLoadKeyfile(t *testing.T, ids ...string) *Keyfile {
+	f, err := LoadKeyfile(writeKeyfile(t, ids...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// countingProvider counts the calls to a provider.
+type countingProvider struct {
+	KeyProvider
+	wraps, unwraps int
+}
+
+func (p *countingProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	p.wraps++
+	return p.KeyProvider.WrapKey(dataKey)
+}
+
+func (p *countingProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	p.unwraps++
+	return p.KeyProvider.UnwrapKey(keyID, wrapped)
+}
+
+func TestEnvelope(t *testing.T) {
+	provider := &countingProvider{KeyProvider: mustLoadKeyfile(t, "a")}
+	env := NewEnvelope(provider)
+
+	plaintext := []byte("the manifest of a release")
+	var sealed [][]byte
+	for i := 0; i < 3; i++ {
+		ciphertext, err := env.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(ciphertext, plaintext) {
+			t.Fatal("expected the plaintext to be encrypted")
+		}
+		sealed = append(sealed, ciphertext)
+	}
+	if bytes.Equal(sealed[0], sealed[1]) {
+		t.Error("expected distinct ciphertexts for the same plaintext")
+	}
+	if kid, err := KeyID(sealed[0]); err != nil || kid != "a" {
+		t.Errorf("expected key ID %q, got %q (%v)", "a", kid, err)
+	}
+
+	for _, ciphertext := range sealed {
+		got, err := NewEnvelope(provider).Decrypt(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("expected %q, got %q", plaintext, got)
+		}
+	}
+	if provider.wraps != 1 {
+		t.Errorf("expected the data key to be wrapped once, got %d", provider.wraps)
+	}
+
+	provider.unwraps = 0
+	for _, ciphertext := range sealed {
+		if _, err := env.Decrypt(ciphertext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if provider.unwraps != 1 {
+		t.Errorf("expected the data key to be unwrapped once, got %d", provider.unwraps)
+	}
+
+	tampered := bytes.Replace(sealed[0], []byte(`"kid":"a"`), []byte(`"kid":"b"`), 1)
+	if _, err := NewEnvelope(mustLoadKeyfile(t, "a", "b")).Decrypt(tampered); err == nil {
+		t.Error("expected a tampered record to fail to decrypt")
+	}
+}
+
+func TestKeyfileRotation(t *testing.T) {
+	old := NewEnvelope(mustLoadKeyfile(t, "2020"))
+	ciphertext, err := old.Encrypt([]byte("values"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := NewEnvelope(mustLoadKeyfile(t, "2021", "2020"))
+	if got, err := rotated.Decrypt(ciphertext); err != nil || string(got) != "values" {
+		t.Fatalf("expected the previous key to decrypt the record, got %q (%v)", got, err)
+	}
+	reencrypted, err := rotated.Encrypt([]byte("values"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid, _ := KeyID(reencrypted); kid != "2021" {
+		t.Errorf("expected the new key to encrypt, got %q", kid)
+	}
+
+	if _, err := NewEnvelope(mustLoadKeyfile(t, "2021")).Decrypt(ciphertext); err == nil {
+		t.Error("expected a removed key to fail to decrypt")
+	}
+}
+
+func TestLoadKeyfileInvalid(t *testing.T) {
+	dir := tempDir(t)
+	for name, content := range map[string]string{
+		"empty":     "keys: []\n",
+		"no id":     "keys:\n  - secret: " + base64.StdEncoding.EncodeToString(make([]byte, 32)) + "\n",
+		"duplicate": "keys:\n  - id: a\n    secret: " + base64.StdEncoding.EncodeToString(make([]byte, 32)) + "\n  - id: a\n    secret: " + base64.StdEncoding.EncodeToString(make([]byte, 32)) + "\n",
+		"short key": "keys:\n  - id: a\n    secret: " + base64.StdEncoding.EncodeToString(make([]byte, 7)) + "\n",
+		"unknown":   "key: a\n",
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadKeyfile(path); err == nil {
+			t.Errorf("expected keyfile %q to be invalid", name)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test provider is a shell script")
+	}
+	// the provider returns the keys it is given as is
+	script := filepath.Join(tempDir(t), "kms")
+	if err := ioutil.WriteFile(script, []byte(`#!/bin/sh
+set -e
+[ "$1" = "--region=test" ] || { echo "missing argument" >&2; exit 1; }
+in=$(cat)
+key=$(echo "$in" | sed 's/.*"key":"\([^"]*\)".*/\1/')
+case "$2" in
+wrap) echo "{\"kid\":\"kms-1\",\"key\":\"$key\"}" ;;
+unwrap) echo "{\"key\":\"$key\"}" ;;
+*) echo "unknown operation $2" >&2; exit 1 ;;
+esac
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	env := NewEnvelope(NewExec(script, "--region=test"))
+	ciphertext, err := env.Encrypt([]byte("hooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid, _ := KeyID(ciphertext); kid != "kms-1" {
+		t.Errorf("expected key ID %q, got %q", "kms-1", kid)
+	}
+	if got, err := NewEnvelope(NewExec(script, "--region=test")).Decrypt(ciphertext); err != nil || string(got) != "hooks" {
+		t.Errorf("expected %q, got %q (%v)", "hooks", got, err)
+	}
+
+	_, err = NewEnvelope(NewExec(script)).Encrypt([]byte("hooks"))
+	if err == nil || !strings.Contains(err.Error(), "missing argument") {
+		t.Errorf("expected the error of the command to be reported, got %v", err)
+	}
+	if _, err := NewEnvelope(NewExec(filepath.Join(os.TempDir(), "no-such-kms"))).Encrypt(nil); err == nil {
+		t.Error("expected a missing command to fail")
+	}
+}
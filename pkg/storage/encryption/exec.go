@@ -0,0 +1,101 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption // import "helm.sh/helm/v3/pkg/storage/encryption"
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var _ KeyProvider = (*Exec)(nil)
+
+// Exec is the KeyProvider delegating the wrapping of data keys to a command,
+// typically a plugin calling an external key management service.
+//
+// The command is run with the extra argument "wrap" or "unwrap", reads a JSON
+// object from its standard input and writes one to its standard output. Keys
+// are base64-encoded:
+//
+//	wrap      in:  {"key": "<data key>"}
+//	          out: {"kid": "<key ID>", "key": "<wrapped data key>"}
+//	unwrap    in:  {"kid": "<key ID>", "key": "<wrapped data key>"}
+//	          out: {"key": "<data key>"}
+//
+// The command must exit with a non-zero status on failure, its standard error
+// being reported.
+type Exec struct {
+	Command string
+	Args    []string
+}
+
+type execMessage struct {
+	KeyID string `json:"kid,omitempty"`
+	Key   []byte `json:"key"`
+}
+
+// NewExec creates a new Exec provider running command with args.
+func NewExec(command string, args ...string) *Exec {
+	return &Exec{Command: command, Args: args}
+}
+
+// WrapKey wraps a data key with the command.
+func (e *Exec) WrapKey(dataKey []byte) (string, []byte, error) {
+	out, err := e.run("wrap", execMessage{Key: dataKey})
+	if err != nil {
+		return "", nil, err
+	}
+	if out.KeyID == "" || len(out.Key) == 0 {
+		return "", nil, errors.Errorf("%s wrap: no key ID or wrapped key returned", e.Command)
+	}
+	return out.KeyID, out.Key, nil
+}
+
+// UnwrapKey unwraps a data key with the command.
+func (e *Exec) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	out, err := e.run("unwrap", execMessage{KeyID: keyID, Key: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	return out.Key, nil
+}
+
+func (e *Exec) run(operation string, in execMessage) (*execMessage, error) {
+	input, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(e.Command, append(append([]string{}, e.Args...), operation)...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.Errorf("%s %s: %s: %s", e.Command, operation, err, msg)
+		}
+		return nil, errors.Wrapf(err, "%s %s", e.Command, operation)
+	}
+	var out execMessage
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, errors.Wrapf(err, "%s %s: invalid output", e.Command, operation)
+	}
+	return &out, nil
+}
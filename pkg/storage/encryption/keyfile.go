@@ -0,0 +1,114 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption // import "helm.sh/helm/v3/pkg/storage/encryption"
+
+import (
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+var _ KeyProvider = (*Keyfile)(nil)
+
+// Keyfile is the KeyProvider wrapping data keys with AES-GCM keys read from a
+// local file, for instance:
+//
+//	keys:
+//	  - id: "2021-03"
+//	    secret: 9Gr7Rvq+l5WmYt3i0DUn0J3yBYnSl4uE7XSQuVy7vxg=
+//	  - id: "2020-11"
+//	    secret: 1b1cZ3uFdqZbxH5yPmAn4c0i3l7S5qAaD3tYJr0sWnk=
+//
+// The secrets are base64-encoded 16, 24 or 32 byte keys. The first key wraps
+// the new data keys, and the others only unwrap the data keys of existing
+// records: to rotate the key, prepend a new key, re-encrypt the history with
+// 'helm storage rekey', then remove the previous key.
+type Keyfile struct {
+	keys []keyfileKey
+}
+
+type keyfileKey struct {
+	ID     string `json:"id"`
+	Secret []byte `json:"secret"`
+}
+
+// LoadKeyfile reads a Keyfile from path.
+func LoadKeyfile(path string) (*Keyfile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read keyfile")
+	}
+	var f struct {
+		Keys []keyfileKey `json:"keys"`
+	}
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse keyfile %s", path)
+	}
+	if len(f.Keys) == 0 {
+		return nil, errors.Errorf("keyfile %s has no keys", path)
+	}
+	seen := map[string]bool{}
+	for _, k := range f.Keys {
+		switch {
+		case k.ID == "":
+			return nil, errors.Errorf("keyfile %s has a key without id", path)
+		case seen[k.ID]:
+			return nil, errors.Errorf("keyfile %s has several keys with id %q", path, k.ID)
+		}
+		if _, err := newAEAD(k.Secret); err != nil {
+			return nil, errors.Wrapf(err, "keyfile %s: invalid key %q", path, k.ID)
+		}
+		seen[k.ID] = true
+	}
+	return &Keyfile{keys: f.Keys}, nil
+}
+
+// WrapKey wraps a data key with the first key of the file.
+func (f *Keyfile) WrapKey(dataKey []byte) (string, []byte, error) {
+	key := f.keys[0]
+	aead, err := newAEAD(key.Secret)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return key.ID, aead.Seal(nonce, nonce, dataKey, []byte(key.ID)), nil
+}
+
+// UnwrapKey unwraps a data key with the key keyID of the file.
+func (f *Keyfile) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	for _, key := range f.keys {
+		if key.ID != keyID {
+			continue
+		}
+		aead, err := newAEAD(key.Secret)
+		if err != nil {
+			return nil, err
+		}
+		if len(wrapped) < aead.NonceSize() {
+			return nil, errors.New("invalid wrapped key")
+		}
+		nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+		return aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	}
+	return nil, errors.Errorf("key %q not found in keyfile", keyID)
+}
@@ -0,0 +1,222 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage // import "helm.sh/helm/v3/pkg/storage"
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// DefaultLockTTL is how long a release lock stays valid without being renewed.
+const DefaultLockTTL = 60 * time.Second
+
+// Lock is a lock on a release held by this process. It is renewed in the
+// background until it is unlocked.
+type Lock struct {
+	s        *Storage
+	name     string
+	key      string
+	holder   string
+	unlocked bool
+	lost     error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// LockRelease acquires the lock on the named release, failing with an error
+// wrapping driver.ErrLocked if another holder owns it, or if the release is
+// already locked through this Storage: an operation running another one on the
+// release it locked does not lock it again.
+//
+// Each lock is held as <LockHolder>/<random suffix>, so that the Storages of a
+// process sharing a LockHolder do not take each other's locks for their own.
+//
+// The lock is lost when its renewal fails because another holder owns it, or
+// when it could not be renewed before it expired. The releases whose lock was
+// lost can no longer be written through this Storage.
+//
+// If the driver does not support locking, the returned Lock only excludes the
+// other operations using this Storage.
+func (s *Storage) LockRelease(name string) (*Lock, error) {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+
+	if _, ok := s.locks[name]; ok {
+		return nil, errors.Wrapf(driver.ErrLocked, "unable to lock release %q: it is locked by another operation of this process", name)
+	}
+
+	l := &Lock{s: s, name: name, key: makeLockKey(name)}
+	if s.Locker != nil {
+		holder, err := uniqueLockHolder(s.LockHolder)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to lock release %q", name)
+		}
+		l.holder = holder
+		s.Log("locking release %q as %q", name, l.holder)
+		if err := s.Locker.AcquireLock(l.key, l.holder, s.lockTTL()); err != nil {
+			return nil, errors.Wrapf(err, "unable to lock release %q", name)
+		}
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.renew()
+	}
+	if s.locks == nil {
+		s.locks = map[string]*Lock{}
+	}
+	s.locks[name] = l
+	return l, nil
+}
+
+// Err returns the error of the renewal that lost the lock, or nil if the lock
+// is still held.
+func (l *Lock) Err() error {
+	l.s.lockMu.Lock()
+	defer l.s.lockMu.Unlock()
+	return l.lost
+}
+
+// Unlock releases the lock, returning the error of the renewal that lost it if
+// it was lost. Unlocking it again does nothing.
+func (l *Lock) Unlock() error {
+	s := l.s
+	s.lockMu.Lock()
+	if l.unlocked {
+		s.lockMu.Unlock()
+		return nil
+	}
+	l.unlocked = true
+	s.lockMu.Unlock()
+
+	// the release stays locked for the other operations of this Storage
+	// until the lock is released, without blocking their own locks
+	var err error
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		s.Log("unlocking release %q", l.name)
+		err = s.Locker.ReleaseLock(l.key, l.holder)
+	}
+
+	s.lockMu.Lock()
+	delete(s.locks, l.name)
+	s.lockMu.Unlock()
+	if lost := l.Err(); lost != nil {
+		return lost
+	}
+	return err
+}
+
+// renew extends the lock periodically until it is unlocked.
+func (l *Lock) renew() {
+	defer close(l.done)
+
+	ttl := l.s.lockTTL()
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			err := l.s.Locker.AcquireLock(l.key, l.holder, ttl)
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+			l.s.Log("failed to renew lock on release %q: %s", l.name, err)
+			if errors.Is(err, driver.ErrLocked) || time.Since(renewed) >= ttl {
+				l.s.lockMu.Lock()
+				l.lost = errors.Wrapf(err, "lost the lock on release %q", l.name)
+				l.s.lockMu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// lockErr returns the error of the lock on the named release held through
+// this Storage, if it was lost.
+func (s *Storage) lockErr(name string) error {
+	s.lockMu.Lock()
+	l, ok := s.locks[name]
+	s.lockMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return l.Err()
+}
+
+// GetReleaseLock returns the current holder of the lock on the named release,
+// or driver.ErrLockNotFound if the release is not locked.
+func (s *Storage) GetReleaseLock(name string) (*driver.LockInfo, error) {
+	if s.Locker == nil {
+		return nil, errors.Errorf("storage driver %s does not support locking releases", s.Name())
+	}
+	return s.Locker.GetLock(makeLockKey(name))
+}
+
+// ForceUnlockRelease releases the lock on the named release regardless of who
+// holds it. It is meant for recovering from locks left behind by processes
+// that were killed.
+func (s *Storage) ForceUnlockRelease(name string) error {
+	if s.Locker == nil {
+		return errors.Errorf("storage driver %s does not support locking releases", s.Name())
+	}
+	s.Log("force unlocking release %q", name)
+	return s.Locker.ReleaseLock(makeLockKey(name), "")
+}
+
+func (s *Storage) lockTTL() time.Duration {
+	if s.LockTTL <= 0 {
+		return DefaultLockTTL
+	}
+	return s.LockTTL
+}
+
+// makeLockKey returns the name of the storage object holding the lock on a
+// release, with format:```<helm_storage_type>.<release_name>.lock```.
+func makeLockKey(rlsname string) string {
+	return fmt.Sprintf("%s.%s.lock", HelmStorageType, rlsname)
+}
+
+// uniqueLockHolder returns the holder of a single lock, adding a random suffix
+// to the holder identifying the process.
+func uniqueLockHolder(holder string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s", holder, hex.EncodeToString(suffix)), nil
+}
+
+// defaultLockHolder identifies this process as <hostname>/<pid>.
+func defaultLockHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
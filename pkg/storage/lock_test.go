@@ -0,0 +1,193 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage // import "helm.sh/helm/v3/pkg/storage"
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestStorageLockRelease(t *testing.T) {
+	mem := driver.NewMemory()
+	storage := Init(mem)
+	storage.LockHolder = "ci/1"
+
+	lock, err := storage.LockRelease("angry-beaver")
+	assertErrNil(t.Fatal, err, "LockRelease")
+
+	info, err := storage.GetReleaseLock("angry-beaver")
+	assertErrNil(t.Fatal, err, "GetReleaseLock")
+	if !strings.HasPrefix(info.Holder, "ci/1/") {
+		t.Errorf("Expected lock to be held by %q, got %q", "ci/1/...", info.Holder)
+	}
+
+	// Another process cannot lock the release.
+	other := Init(mem)
+	other.LockHolder = "ci/2"
+	if _, err := other.LockRelease("angry-beaver"); !errors.Is(err, driver.ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+
+	// Another operation using the same storage cannot lock the release either.
+	if _, err := storage.LockRelease("angry-beaver"); !errors.Is(err, driver.ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+	if _, err := storage.GetReleaseLock("angry-beaver"); err != nil {
+		t.Fatalf("Expected release to still be locked, got %v", err)
+	}
+
+	assertErrNil(t.Fatal, lock.Unlock(), "Unlock")
+	if _, err := storage.GetReleaseLock("angry-beaver"); err != driver.ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+
+	// Unlocking twice is harmless.
+	assertErrNil(t.Fatal, lock.Unlock(), "Unlock")
+}
+
+func TestStorageLockReleaseSameHolder(t *testing.T) {
+	mem := driver.NewMemory()
+	first, second := Init(mem), Init(mem)
+
+	// The Storages of a process share their LockHolder, but not their locks.
+	lock, err := first.LockRelease("angry-beaver")
+	assertErrNil(t.Fatal, err, "LockRelease")
+	if _, err := second.LockRelease("angry-beaver"); !errors.Is(err, driver.ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+	assertErrNil(t.Fatal, lock.Unlock(), "Unlock")
+
+	lock, err = second.LockRelease("angry-beaver")
+	assertErrNil(t.Fatal, err, "LockRelease")
+	defer lock.Unlock()
+}
+
+// blockingLocker blocks the releases of its locks until unblock is closed.
+type blockingLocker struct {
+	driver.Locker
+	releasing chan struct{}
+	unblock   chan struct{}
+}
+
+func (l *blockingLocker) ReleaseLock(key, holder string) error {
+	l.releasing <- struct{}{}
+	<-l.unblock
+	return l.Locker.ReleaseLock(key, holder)
+}
+
+func TestStorageUnlockDoesNotBlockLocks(t *testing.T) {
+	storage := Init(driver.NewMemory())
+	locker := &blockingLocker{Locker: storage.Locker, releasing: make(chan struct{}, 2), unblock: make(chan struct{})}
+	storage.Locker = locker
+
+	lock, err := storage.LockRelease("angry-beaver")
+	assertErrNil(t.Fatal, err, "LockRelease")
+	unlocked := make(chan error)
+	go func() { unlocked <- lock.Unlock() }()
+	<-locker.releasing
+
+	// the other releases can be locked while the lock is released
+	other, err := storage.LockRelease("happy-panda")
+	assertErrNil(t.Fatal, err, "LockRelease")
+	if _, err := storage.LockRelease("angry-beaver"); !errors.Is(err, driver.ErrLocked) {
+		t.Errorf("Expected ErrLocked until the lock is released, got %v", err)
+	}
+
+	close(locker.unblock)
+	assertErrNil(t.Fatal, <-unlocked, "Unlock")
+	assertErrNil(t.Fatal, other.Unlock(), "Unlock")
+	lock, err = storage.LockRelease("angry-beaver")
+	assertErrNil(t.Fatal, err, "LockRelease")
+	assertErrNil(t.Fatal, lock.Unlock(), "Unlock")
+}
+
+func TestStorageLockReleaseRenews(t *testing.T) {
+	storage := Init(driver.NewMemory())
+	storage.LockTTL = 30 * time.Millisecond
+
+	lock, err := storage.LockRelease("angry-beaver")
+	assertErrNil(t.Fatal, err, "LockRelease")
+	defer lock.Unlock()
+
+	first, err := storage.GetReleaseLock("angry-beaver")
+	assertErrNil(t.Fatal, err, "GetReleaseLock")
+
+	time.Sleep(100 * time.Millisecond)
+
+	renewed, err := storage.GetReleaseLock("angry-beaver")
+	assertErrNil(t.Fatal, err, "GetReleaseLock")
+	if !renewed.RenewedAt.After(first.RenewedAt) {
+		t.Errorf("Expected lock to be renewed after %s, got %s", first.RenewedAt, renewed.RenewedAt)
+	}
+	if renewed.Expired(time.Now()) {
+		t.Error("Expected renewed lock not to be expired")
+	}
+}
+
+func TestStorageLockReleaseLost(t *testing.T) {
+	mem := driver.NewMemory()
+	storage := Init(mem)
+	storage.LockTTL = 30 * time.Millisecond
+	rls := ReleaseTestData{Name: "angry-beaver", Version: 1}.ToRelease()
+
+	lock, err := storage.LockRelease(rls.Name)
+	assertErrNil(t.Fatal, err, "LockRelease")
+	assertErrNil(t.Fatal, lock.Err(), "Err")
+
+	// another holder takes the lock over
+	key := makeLockKey(rls.Name)
+	assertErrNil(t.Fatal, mem.ReleaseLock(key, ""), "ReleaseLock")
+	assertErrNil(t.Fatal, mem.AcquireLock(key, "ci/2", time.Minute), "AcquireLock")
+	time.Sleep(100 * time.Millisecond)
+
+	if err := lock.Err(); !errors.Is(err, driver.ErrLocked) {
+		t.Fatalf("Expected the lock to be lost, got %v", err)
+	}
+	if err := storage.Create(rls); !errors.Is(err, driver.ErrLocked) {
+		t.Errorf("Expected the release not to be written, got %v", err)
+	}
+	if err := lock.Unlock(); !errors.Is(err, driver.ErrLocked) {
+		t.Errorf("Expected Unlock to report the lost lock, got %v", err)
+	}
+	if info, err := storage.GetReleaseLock(rls.Name); err != nil || info.Holder != "ci/2" {
+		t.Errorf("Expected the lock to stay held by %q, got %v (%v)", "ci/2", info, err)
+	}
+	assertErrNil(t.Fatal, storage.Create(rls), "Create")
+}
+
+func TestStorageForceUnlockRelease(t *testing.T) {
+	mem := driver.NewMemory()
+	storage := Init(mem)
+
+	assertErrNil(t.Fatal, mem.AcquireLock(makeLockKey("angry-beaver"), "ci/1", time.Minute), "AcquireLock")
+	assertErrNil(t.Fatal, storage.ForceUnlockRelease("angry-beaver"), "ForceUnlockRelease")
+	if _, err := storage.GetReleaseLock("angry-beaver"); err != driver.ErrLockNotFound {
+		t.Fatalf("Expected ErrLockNotFound, got %v", err)
+	}
+
+	storage.Locker = nil
+	if err := storage.ForceUnlockRelease("angry-beaver"); err == nil {
+		t.Fatal("Expected an error for a driver without locking support")
+	}
+	lock, err := storage.LockRelease("angry-beaver")
+	assertErrNil(t.Fatal, err, "LockRelease")
+	assertErrNil(t.Fatal, lock.Unlock(), "Unlock")
+}
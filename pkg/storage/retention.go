@@ -0,0 +1,284 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage // import "helm.sh/helm/v3/pkg/storage"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+	relutil "helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// The labels of a release overriding the retention policy of its history, with
+// the same syntax as the fields of a policy string. Unlike the other labels
+// prefixed with helm.sh/, they are not reserved by the drivers.
+const (
+	RetentionMaxRevisionsLabel   = "helm.sh/history-max-revisions"
+	RetentionMaxAgeLabel         = "helm.sh/history-max-age"
+	RetentionKeepSuccessfulLabel = "helm.sh/history-keep-successful"
+	RetentionFailedTTLLabel      = "helm.sh/history-failed-ttl"
+)
+
+// RetentionPolicy describes the revisions of a release kept in storage. The
+// last revision and the deployed revision of a release are always kept, and
+// the zero value keeps every revision.
+type RetentionPolicy struct {
+	// MaxRevisions is the maximum number of revisions kept, 0 for no limit.
+	MaxRevisions int
+	// MaxAge removes the revisions deployed longer than MaxAge ago, 0 for
+	// no limit.
+	MaxAge time.Duration
+	// KeepSuccessful is the number of last successfully deployed revisions
+	// always kept, whatever the other limits.
+	KeepSuccessful int
+	// FailedTTL removes the failed revisions deployed longer than FailedTTL
+	// ago, 0 for no limit.
+	FailedTTL time.Duration
+}
+
+// ParseRetentionPolicy parses a comma-separated list of the fields of a
+// retention policy, for instance:
+//
+//    max-revisions=10,max-age=30d,keep-successful=3,failed-ttl=24h
+//
+// Durations are Go durations, or a number of days suffixed with "d".
+func ParseRetentionPolicy(s string) (RetentionPolicy, error) {
+	var p RetentionPolicy
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return p, errors.Errorf("invalid retention policy field %q: expected key=value", field)
+		}
+		if err := p.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// WithLabels returns the policy overridden by the retention labels of a
+// release.
+func (p RetentionPolicy) WithLabels(labels map[string]string) (RetentionPolicy, error) {
+	for label, key := range map[string]string{
+		RetentionMaxRevisionsLabel:   "max-revisions",
+		RetentionMaxAgeLabel:         "max-age",
+		RetentionKeepSuccessfulLabel: "keep-successful",
+		RetentionFailedTTLLabel:      "failed-ttl",
+	} {
+		if v, ok := labels[label]; ok {
+			if err := p.Set(key, v); err != nil {
+				return p, errors.Wrapf(err, "label %s", label)
+			}
+		}
+	}
+	return p, nil
+}
+
+// IsZero reports whether the policy keeps every revision.
+func (p RetentionPolicy) IsZero() bool {
+	return p.MaxRevisions <= 0 && p.MaxAge <= 0 && p.FailedTTL <= 0
+}
+
+// String returns the policy in the format read by ParseRetentionPolicy.
+func (p RetentionPolicy) String() string {
+	var fields []string
+	if p.MaxRevisions > 0 {
+		fields = append(fields, fmt.Sprintf("max-revisions=%d", p.MaxRevisions))
+	}
+	if p.MaxAge > 0 {
+		fields = append(fields, "max-age="+p.MaxAge.String())
+	}
+	if p.KeepSuccessful > 0 {
+		fields = append(fields, fmt.Sprintf("keep-successful=%d", p.KeepSuccessful))
+	}
+	if p.FailedTTL > 0 {
+		fields = append(fields, "failed-ttl="+p.FailedTTL.String())
+	}
+	return strings.Join(fields, ",")
+}
+
+// Set sets the field of the policy named by key, one of max-revisions,
+// max-age, keep-successful and failed-ttl.
+func (p *RetentionPolicy) Set(key, value string) error {
+	var err error
+	switch key {
+	case "max-revisions":
+		p.MaxRevisions, err = strconv.Atoi(value)
+	case "max-age":
+		p.MaxAge, err = parseRetentionDuration(value)
+	case "keep-successful":
+		p.KeepSuccessful, err = strconv.Atoi(value)
+	case "failed-ttl":
+		p.FailedTTL, err = parseRetentionDuration(value)
+	default:
+		return errors.Errorf("unknown retention policy field %q", key)
+	}
+	return errors.Wrapf(err, "invalid %s %q", key, value)
+}
+
+func parseRetentionDuration(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Prune returns the revisions of a release history that the policy does not
+// keep at time now, oldest first. The history must hold the revisions of a
+// single release.
+func (p RetentionPolicy) Prune(history []*rspb.Release, now time.Time) []*rspb.Release {
+	if p.IsZero() || len(history) == 0 {
+		return nil
+	}
+	h := make([]*rspb.Release, len(history))
+	copy(h, history)
+	relutil.SortByRevision(h)
+
+	// keep the last revision, the deployed one and the last successful ones
+	keep := map[int]bool{h[len(h)-1].Version: true}
+	var deployed, successful int
+	for i := len(h) - 1; i >= 0; i-- {
+		switch h[i].Info.Status {
+		case rspb.StatusDeployed:
+			if deployed == 0 {
+				keep[h[i].Version] = true
+			}
+			deployed++
+			fallthrough
+		case rspb.StatusSuperseded:
+			if successful < p.KeepSuccessful {
+				keep[h[i].Version] = true
+			}
+			successful++
+		}
+	}
+
+	remove := map[int]bool{}
+	for _, rls := range h {
+		if keep[rls.Version] {
+			continue
+		}
+		age := now.Sub(revisionTime(rls))
+		if p.MaxAge > 0 && age > p.MaxAge || p.FailedTTL > 0 && rls.Info.Status == rspb.StatusFailed && age > p.FailedTTL {
+			remove[rls.Version] = true
+		}
+	}
+	if p.MaxRevisions > 0 {
+		left := len(h) - len(remove)
+		for _, rls := range h {
+			if left <= p.MaxRevisions {
+				break
+			}
+			if !keep[rls.Version] && !remove[rls.Version] {
+				remove[rls.Version] = true
+				left--
+			}
+		}
+	}
+
+	var pruned []*rspb.Release
+	for _, rls := range h {
+		if remove[rls.Version] {
+			pruned = append(pruned, rls)
+		}
+	}
+	return pruned
+}
+
+// revisionTime returns when a revision was deployed.
+func revisionTime(rls *rspb.Release) time.Time {
+	if !rls.Info.LastDeployed.IsZero() {
+		return rls.Info.LastDeployed.Time
+	}
+	return rls.Info.FirstDeployed.Time
+}
+
+// PruneHistory removes the revisions of the named release that the policy,
+// overridden by the retention labels of its last revision, does not keep. The
+// removed revisions are returned, oldest first. With dryRun, the revisions
+// are only returned.
+func (s *Storage) PruneHistory(name string, policy RetentionPolicy, dryRun bool) ([]*rspb.Release, error) {
+	h, err := s.History(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(h) == 0 {
+		return nil, nil
+	}
+	relutil.SortByRevision(h)
+	if policy, err = policy.WithLabels(h[len(h)-1].Labels); err != nil {
+		return nil, errors.Wrapf(err, "invalid retention policy for release %q", name)
+	}
+
+	pruned := policy.Prune(h, time.Now())
+	if dryRun {
+		return pruned, nil
+	}
+	return pruned, s.deleteRevisions(name, pruned)
+}
+
+// applyRetention removes the revisions of a release that the retention policy
+// of the storage, overridden by the labels of the release, does not keep once
+// the release is created.
+func (s *Storage) applyRetention(rls *rspb.Release) error {
+	policy, err := s.Retention.WithLabels(rls.Labels)
+	if err != nil {
+		return err
+	}
+	if policy.IsZero() {
+		return nil
+	}
+	h, err := s.History(rls.Name)
+	if err != nil && errors.Cause(err) != driver.ErrReleaseNotFound {
+		return err
+	}
+	return s.deleteRevisions(rls.Name, policy.Prune(append(h, rls), time.Now()))
+}
+
+// deleteRevisions deletes revisions of a release, returning the first error.
+func (s *Storage) deleteRevisions(name string, revisions []*rspb.Release) error {
+	var errs []error
+	for _, rls := range revisions {
+		if err := s.deleteReleaseVersion(name, rls.Version); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	s.Log("Pruned %d record(s) from %s with %d error(s)", len(revisions)-len(errs), name, len(errs))
+	switch c := len(errs); c {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errors.Errorf("encountered %d deletion errors. First is: %s", c, errs[0])
+	}
+}
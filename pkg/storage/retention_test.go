@@ -0,0 +1,202 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage // import "helm.sh/helm/v3/pkg/storage"
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+var retentionNow = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// retentionHistory returns revisions deployed days ago, one per status.
+func retentionHistory(name string, statuses ...rspb.Status) []*rspb.Release {
+	var h []*rspb.Release
+	for i, status := range statuses {
+		rls := ReleaseTestData{Name: name, Version: i + 1, Status: status}.ToRelease()
+		rls.Info.LastDeployed = helmtime.Time{Time: retentionNow.AddDate(0, 0, i-len(statuses))}
+		h = append(h, rls)
+	}
+	return h
+}
+
+func revisions(rls []*rspb.Release) []int {
+	versions := []int{}
+	for _, r := range rls {
+		versions = append(versions, r.Version)
+	}
+	return versions
+}
+
+func TestParseRetentionPolicy(t *testing.T) {
+	p, err := ParseRetentionPolicy("max-revisions=10, max-age=30d,keep-successful=3,failed-ttl=12h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RetentionPolicy{MaxRevisions: 10, MaxAge: 30 * 24 * time.Hour, KeepSuccessful: 3, FailedTTL: 12 * time.Hour}
+	if p != expected {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+	if again, err := ParseRetentionPolicy(p.String()); err != nil || again != p {
+		t.Errorf("expected %q to be parsed back, got %+v (%v)", p, again, err)
+	}
+
+	if p, err := ParseRetentionPolicy(""); err != nil || !p.IsZero() {
+		t.Errorf("expected an empty policy, got %+v (%v)", p, err)
+	}
+	for _, invalid := range []string{"max-revisions", "max-revisions=ten", "max-age=1y", "keep=1"} {
+		if _, err := ParseRetentionPolicy(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestRetentionPolicyWithLabels(t *testing.T) {
+	p, err := RetentionPolicy{MaxRevisions: 10, KeepSuccessful: 2}.WithLabels(map[string]string{
+		"name":                     "angry-bird",
+		RetentionMaxRevisionsLabel: "3",
+		RetentionFailedTTLLabel:    "1d",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RetentionPolicy{MaxRevisions: 3, KeepSuccessful: 2, FailedTTL: 24 * time.Hour}
+	if p != expected {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+	if _, err := (RetentionPolicy{}).WithLabels(map[string]string{RetentionMaxAgeLabel: "soon"}); err == nil {
+		t.Error("expected an invalid label to be rejected")
+	}
+}
+
+func TestRetentionPolicyPrune(t *testing.T) {
+	const (
+		deployed   = rspb.StatusDeployed
+		superseded = rspb.StatusSuperseded
+		failed     = rspb.StatusFailed
+	)
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		history  []rspb.Status
+		expected []int
+	}{{
+		name:     "no policy",
+		history:  []rspb.Status{superseded, superseded, deployed},
+		expected: nil,
+	}, {
+		name:     "max revisions",
+		policy:   RetentionPolicy{MaxRevisions: 2},
+		history:  []rspb.Status{superseded, superseded, superseded, deployed},
+		expected: []int{1, 2},
+	}, {
+		name:     "max revisions keep the deployed revision",
+		policy:   RetentionPolicy{MaxRevisions: 2},
+		history:  []rspb.Status{superseded, deployed, failed, failed},
+		expected: []int{1, 3},
+	}, {
+		name:     "max age",
+		policy:   RetentionPolicy{MaxAge: 60 * time.Hour},
+		history:  []rspb.Status{superseded, superseded, superseded, deployed},
+		expected: []int{1, 2},
+	}, {
+		name:     "max age keep the last revision",
+		policy:   RetentionPolicy{MaxAge: time.Hour},
+		history:  []rspb.Status{superseded, deployed, failed},
+		expected: []int{1},
+	}, {
+		name:     "keep successful",
+		policy:   RetentionPolicy{MaxAge: time.Hour, KeepSuccessful: 2},
+		history:  []rspb.Status{superseded, superseded, failed, superseded, deployed},
+		expected: []int{1, 2, 3},
+	}, {
+		name:     "failed TTL",
+		policy:   RetentionPolicy{FailedTTL: 48 * time.Hour},
+		history:  []rspb.Status{failed, superseded, failed, failed, deployed},
+		expected: []int{1, 3},
+	}, {
+		name:     "combined",
+		policy:   RetentionPolicy{MaxRevisions: 3, FailedTTL: 48 * time.Hour, KeepSuccessful: 1},
+		history:  []rspb.Status{superseded, failed, superseded, superseded, failed, deployed},
+		expected: []int{1, 2, 3},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pruned := tt.policy.Prune(retentionHistory("angry-bird", tt.history...), retentionNow)
+			if got := revisions(pruned); len(got) != len(tt.expected) || len(got) > 0 && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected revisions %v to be pruned, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStorageRetentionOnCreate(t *testing.T) {
+	storage := Init(driver.NewMemory())
+	storage.Retention = RetentionPolicy{MaxRevisions: 2}
+
+	h := retentionHistory("angry-bird", rspb.StatusSuperseded, rspb.StatusSuperseded, rspb.StatusSuperseded, rspb.StatusDeployed)
+	for _, rls := range h {
+		assertErrNil(t.Fatal, storage.Create(rls), "Storing release")
+	}
+	stored, err := storage.History("angry-bird")
+	assertErrNil(t.Fatal, err, "Querying history")
+	if len(stored) != 2 {
+		t.Errorf("expected 2 revisions, got %v", revisions(stored))
+	}
+
+	// the labels of the new revision override the policy
+	rls := retentionHistory("angry-bird", make([]rspb.Status, 5)...)[4]
+	rls.Info.Status = rspb.StatusDeployed
+	rls.Labels = map[string]string{RetentionMaxRevisionsLabel: "0"}
+	assertErrNil(t.Fatal, storage.Create(rls), "Storing release")
+	stored, err = storage.History("angry-bird")
+	assertErrNil(t.Fatal, err, "Querying history")
+	if len(stored) != 3 {
+		t.Errorf("expected 3 revisions, got %v", revisions(stored))
+	}
+}
+
+func TestStoragePruneHistory(t *testing.T) {
+	storage := Init(driver.NewMemory())
+	for _, rls := range retentionHistory("angry-bird", rspb.StatusSuperseded, rspb.StatusFailed, rspb.StatusSuperseded, rspb.StatusDeployed) {
+		assertErrNil(t.Fatal, storage.Create(rls), "Storing release")
+	}
+	policy := RetentionPolicy{MaxRevisions: 2}
+
+	pruned, err := storage.PruneHistory("angry-bird", policy, true)
+	assertErrNil(t.Fatal, err, "Pruning history")
+	if got := revisions(pruned); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("expected revisions [1 2] to be pruned, got %v", got)
+	}
+	stored, _ := storage.History("angry-bird")
+	if len(stored) != 4 {
+		t.Errorf("expected a dry run to keep the history, got %v", revisions(stored))
+	}
+
+	pruned, err = storage.PruneHistory("angry-bird", policy, false)
+	assertErrNil(t.Fatal, err, "Pruning history")
+	stored, _ = storage.History("angry-bird")
+	if len(pruned) != 2 || len(stored) != 2 {
+		t.Errorf("expected 2 revisions to be pruned, got %v and %v kept", revisions(pruned), revisions(stored))
+	}
+}
@@ -19,6 +19,8 @@ package storage // import "helm.sh/helm/v3/pkg/storage"
 import (
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -43,7 +45,27 @@ type Storage struct {
 	// ignored (meaning no limits are imposed).
 	MaxHistory int
 
+	// Retention is the retention policy applied to the history of a release
+	// when a revision is created, in addition to MaxHistory. The labels of the
+	// revision may override it.
+	Retention RetentionPolicy
+
+	// Locker serializes operations on a release across Helm processes. Init
+	// sets it when the driver implements driver.Locker. A nil Locker
+	// disables release locking.
+	Locker driver.Locker
+	// LockHolder identifies this process as the holder of release locks,
+	// each lock being held as <LockHolder>/<random suffix>. Init sets it to
+	// <hostname>/<pid>.
+	LockHolder string
+	// LockTTL is how long a release lock stays valid without being renewed.
+	// Values of 0 or less mean DefaultLockTTL.
+	LockTTL time.Duration
+
 	Log func(string, ...interface{})
+
+	lockMu sync.Mutex
+	locks  map[string]*Lock
 }
 
 // Get retrieves the release from storage. An error is returned
@@ -56,29 +78,44 @@ func (s *Storage) Get(name string, version int) (*rspb.Release, error) {
 
 // Create creates a new storage entry holding the release. An
 // error is returned if the storage driver failed to store the
-// release, or a release with identical an key already exists.
+// release, a release with identical an key already exists, or
+// the lock on the release held through this Storage was lost.
 func (s *Storage) Create(rls *rspb.Release) error {
 	s.Log("creating release %q", makeKey(rls.Name, rls.Version))
+	if err := s.lockErr(rls.Name); err != nil {
+		return err
+	}
 	if s.MaxHistory > 0 {
 		// Want to make space for one more release.
 		s.removeLeastRecent(rls.Name, s.MaxHistory-1)
 	}
+	if err := s.applyRetention(rls); err != nil {
+		s.Log("failed to apply the retention policy of %q: %s", rls.Name, err)
+	}
 	return s.Driver.Create(makeKey(rls.Name, rls.Version), rls)
 }
 
 // Update updates the release in storage. An error is returned if the
-// storage backend fails to update the release or if the release
-// does not exist.
+// storage backend fails to update the release, if the release
+// does not exist, or if the lock on the release held through this
+// Storage was lost.
 func (s *Storage) Update(rls *rspb.Release) error {
 	s.Log("updating release %q", makeKey(rls.Name, rls.Version))
+	if err := s.lockErr(rls.Name); err != nil {
+		return err
+	}
 	return s.Driver.Update(makeKey(rls.Name, rls.Version), rls)
 }
 
 // Delete deletes the release from storage. An error is returned if
-// the storage backend fails to delete the release or if the release
-// does not exist.
+// the storage backend fails to delete the release, if the release
+// does not exist, or if the lock on the release held through this
+// Storage was lost.
 func (s *Storage) Delete(name string, version int) (*rspb.Release, error) {
 	s.Log("deleting release %q", makeKey(name, version))
+	if err := s.lockErr(name); err != nil {
+		return nil, err
+	}
 	return s.Driver.Delete(makeKey(name, version))
 }
 
@@ -256,8 +293,13 @@ func Init(d driver.Driver) *Storage {
 	if d == nil {
 		d = driver.NewMemory()
 	}
-	return &Storage{
-		Driver: d,
-		Log:    func(_ string, _ ...interface{}) {},
+	s := &Storage{
+		Driver:     d,
+		LockHolder: defaultLockHolder(),
+		Log:        func(_ string, _ ...interface{}) {},
+	}
+	if l, ok := d.(driver.Locker); ok {
+		s.Locker = l
 	}
+	return s
 }
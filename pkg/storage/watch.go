@@ -0,0 +1,60 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage // import "helm.sh/helm/v3/pkg/storage"
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Watch streams the events of the releases such that filter(release) == true,
+// until ctx is done. A nil filter selects every release.
+//
+// Only the changes made after Watch returns are streamed: to follow the state
+// of the releases, list them after starting to watch them. Watch fails if the
+// driver does not implement driver.Watcher.
+func (s *Storage) Watch(ctx context.Context, filter func(*rspb.Release) bool) (<-chan driver.Event, error) {
+	w, ok := s.Driver.(driver.Watcher)
+	if !ok {
+		return nil, errors.Errorf("the %s driver does not support watching releases", s.Name())
+	}
+	s.Log("watching releases")
+	events, err := w.Watch(ctx)
+	if err != nil || filter == nil {
+		return events, err
+	}
+
+	filtered := make(chan driver.Event)
+	go func() {
+		defer close(filtered)
+		for ev := range events {
+			if !filter(ev.Release) {
+				continue
+			}
+			select {
+			case filtered <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return filtered, nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage // import "helm.sh/helm/v3/pkg/storage"
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestStorageWatch(t *testing.T) {
+	storage := Init(driver.NewMemory())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := storage.Watch(ctx, func(rls *rspb.Release) bool {
+		return rls.Name == "angry-beaver"
+	})
+	assertErrNil(t.Fatal, err, "Watching releases")
+
+	for _, rls := range []*rspb.Release{
+		ReleaseTestData{Name: "happy-catdog", Version: 1, Status: rspb.StatusDeployed}.ToRelease(),
+		ReleaseTestData{Name: "angry-beaver", Version: 1, Status: rspb.StatusDeployed}.ToRelease(),
+	} {
+		assertErrNil(t.Fatal, storage.Create(rls), "Storing release")
+	}
+	_, err = storage.Delete("angry-beaver", 1)
+	assertErrNil(t.Fatal, err, "Deleting release")
+
+	for _, expected := range []driver.EventType{driver.EventCreated, driver.EventDeleted} {
+		select {
+		case ev := <-events:
+			if ev.Type != expected || ev.Release.Name != "angry-beaver" {
+				t.Errorf("expected %s angry-beaver, got %s %s", expected, ev.Type, ev.Release.Name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", expected)
+		}
+	}
+
+	cancel()
+	for range events {
+		t.Error("expected no more events")
+	}
+}
+
+func TestStorageWatchUnsupported(t *testing.T) {
+	storage := Init(struct{ driver.Driver }{driver.NewMemory()})
+	if _, err := storage.Watch(context.Background(), nil); err == nil {
+		t.Error("expected watching to fail without a driver.Watcher")
+	}
+}
@@ -0,0 +1,340 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package unittest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Assertion is an assertion on the documents rendered by a test. Exactly one
+// kind of assertion is set.
+//
+// Paths are JSONPath expressions evaluated against each document, such as
+// ".spec.template.spec.containers[0].image". The braces around them may be
+// omitted.
+type Assertion struct {
+	// DocumentIndex restricts the assertion to the document at this index,
+	// counted from 0 across the templates of the test. By default, the
+	// assertion must hold for every document.
+	DocumentIndex *int `json:"documentIndex,omitempty"`
+
+	// HasDocuments asserts on the number of documents rendered.
+	HasDocuments *HasDocuments `json:"hasDocuments,omitempty"`
+	// Equal asserts that the value at a path equals a value.
+	Equal *Equal `json:"equal,omitempty"`
+	// NotEqual asserts that the value at a path does not equal a value.
+	NotEqual *Equal `json:"notEqual,omitempty"`
+	// MatchRegex asserts that the string at a path matches a pattern.
+	MatchRegex *MatchRegex `json:"matchRegex,omitempty"`
+	// NotMatchRegex asserts that the string at a path does not match a
+	// pattern.
+	NotMatchRegex *MatchRegex `json:"notMatchRegex,omitempty"`
+	// MatchSnapshot asserts that the value at a path has not changed since
+	// its snapshot was written.
+	MatchSnapshot *MatchSnapshot `json:"matchSnapshot,omitempty"`
+	// FailedTemplate asserts that the templates fail to render.
+	FailedTemplate *FailedTemplate `json:"failedTemplate,omitempty"`
+}
+
+// HasDocuments asserts on the number of documents rendered.
+type HasDocuments struct {
+	Count int `json:"count"`
+}
+
+// Equal asserts on the value at a path.
+type Equal struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// MatchRegex asserts on the string at a path.
+type MatchRegex struct {
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
+}
+
+// MatchSnapshot asserts that the value at a path, or the whole document if
+// the path is empty, has not changed since its snapshot was written.
+type MatchSnapshot struct {
+	Path string `json:"path,omitempty"`
+}
+
+// FailedTemplate asserts that the templates fail to render, with an error
+// containing ErrorMessage or matching ErrorPattern if they are set.
+type FailedTemplate struct {
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	ErrorPattern string `json:"errorPattern,omitempty"`
+}
+
+// kind returns the name of the kind of the assertion, and the number of kinds
+// set.
+func (a *Assertion) kind() (string, int) {
+	kinds := []struct {
+		name string
+		set  bool
+	}{
+		{"hasDocuments", a.HasDocuments != nil},
+		{"equal", a.Equal != nil},
+		{"notEqual", a.NotEqual != nil},
+		{"matchRegex", a.MatchRegex != nil},
+		{"notMatchRegex", a.NotMatchRegex != nil},
+		{"matchSnapshot", a.MatchSnapshot != nil},
+		{"failedTemplate", a.FailedTemplate != nil},
+	}
+	name, n := "", 0
+	for _, k := range kinds {
+		if k.set {
+			name = k.name
+			n++
+		}
+	}
+	return name, n
+}
+
+func (a *Assertion) validate() error {
+	_, n := a.kind()
+	if n != 1 {
+		return errors.Errorf("expected exactly one kind of assertion, got %d", n)
+	}
+	if a.DocumentIndex != nil && *a.DocumentIndex < 0 {
+		return errors.Errorf("invalid document index %d", *a.DocumentIndex)
+	}
+	var paths []string
+	switch {
+	case a.Equal != nil:
+		paths = append(paths, a.Equal.Path)
+	case a.NotEqual != nil:
+		paths = append(paths, a.NotEqual.Path)
+	case a.MatchSnapshot != nil:
+		paths = append(paths, a.MatchSnapshot.Path)
+	}
+	for _, r := range []*MatchRegex{a.MatchRegex, a.NotMatchRegex} {
+		if r == nil {
+			continue
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return errors.Wrapf(err, "invalid pattern %q", r.Pattern)
+		}
+		paths = append(paths, r.Path)
+	}
+	if a.FailedTemplate != nil && a.FailedTemplate.ErrorPattern != "" {
+		if _, err := regexp.Compile(a.FailedTemplate.ErrorPattern); err != nil {
+			return errors.Wrapf(err, "invalid error pattern %q", a.FailedTemplate.ErrorPattern)
+		}
+	}
+	for _, p := range paths {
+		if _, err := parsePath(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// document is a document rendered by a template.
+type document struct {
+	// template is the name of the template, relative to the chart.
+	template string
+	object   map[string]interface{}
+}
+
+// assertContext is what the assertions of a test assert on.
+type assertContext struct {
+	test      *Test
+	documents []document
+	snapshots *snapshots
+	// snapshotCount counts the snapshots of the test, which are named
+	// after the test and their position.
+	snapshotCount int
+}
+
+// assert returns the failures of the assertion, if any.
+func (a *Assertion) assert(ctx *assertContext) []string {
+	if a.HasDocuments != nil {
+		if n := len(ctx.documents); n != a.HasDocuments.Count {
+			return []string{fmt.Sprintf("hasDocuments: expected %d documents, got %d", a.HasDocuments.Count, n)}
+		}
+		return nil
+	}
+
+	docs := ctx.documents
+	first := 0
+	if a.DocumentIndex != nil {
+		first = *a.DocumentIndex
+		if first >= len(docs) {
+			name, _ := a.kind()
+			return []string{fmt.Sprintf("%s: document %d not found, got %d documents", name, first, len(docs))}
+		}
+		docs = docs[first : first+1]
+	} else if len(docs) == 0 {
+		name, _ := a.kind()
+		return []string{fmt.Sprintf("%s: no documents rendered", name)}
+	}
+
+	var failures []string
+	for i, doc := range docs {
+		if failure := a.assertDocument(ctx, doc); failure != "" {
+			failures = append(failures, fmt.Sprintf("document %d (%s): %s", first+i, doc.template, failure))
+		}
+	}
+	return failures
+}
+
+// assertDocument returns why the assertion does not hold for a document, or
+// "" if it does.
+func (a *Assertion) assertDocument(ctx *assertContext, doc document) string {
+	switch {
+	case a.Equal != nil, a.NotEqual != nil:
+		e, equal := a.Equal, true
+		if e == nil {
+			e, equal = a.NotEqual, false
+		}
+		got, found, err := lookup(doc.object, e.Path)
+		if err != nil {
+			return err.Error()
+		}
+		expected := e.Value
+		if equal && !found {
+			return fmt.Sprintf("equal %s: expected %s, not found", e.Path, format(expected))
+		}
+		if equal && !reflect.DeepEqual(got, expected) {
+			return fmt.Sprintf("equal %s: expected %s, got %s", e.Path, format(expected), format(got))
+		}
+		if !equal && found && reflect.DeepEqual(got, expected) {
+			return fmt.Sprintf("notEqual %s: expected a value other than %s", e.Path, format(expected))
+		}
+	case a.MatchRegex != nil, a.NotMatchRegex != nil:
+		r, match, name := a.MatchRegex, true, "matchRegex"
+		if r == nil {
+			r, match, name = a.NotMatchRegex, false, "notMatchRegex"
+		}
+		got, found, err := lookup(doc.object, r.Path)
+		if err != nil {
+			return err.Error()
+		}
+		if !found {
+			return fmt.Sprintf("%s %s: not found", name, r.Path)
+		}
+		s, ok := got.(string)
+		if !ok {
+			return fmt.Sprintf("%s %s: expected a string, got %s", name, r.Path, format(got))
+		}
+		if regexp.MustCompile(r.Pattern).MatchString(s) != match {
+			if match {
+				return fmt.Sprintf("matchRegex %s: %q does not match %q", r.Path, s, r.Pattern)
+			}
+			return fmt.Sprintf("notMatchRegex %s: %q matches %q", r.Path, s, r.Pattern)
+		}
+	case a.MatchSnapshot != nil:
+		got, found, err := lookup(doc.object, a.MatchSnapshot.Path)
+		if err != nil {
+			return err.Error()
+		}
+		if !found {
+			return fmt.Sprintf("matchSnapshot %s: not found", a.MatchSnapshot.Path)
+		}
+		ctx.snapshotCount++
+		key := fmt.Sprintf("%s %d", ctx.test.It, ctx.snapshotCount)
+		failure, err := ctx.snapshots.match(key, got)
+		if err != nil {
+			return err.Error()
+		}
+		if failure != "" {
+			return "matchSnapshot: " + failure
+		}
+	}
+	return ""
+}
+
+// assertRenderError returns the failures of a failedTemplate assertion given
+// the error rendering the templates, or nil if they rendered.
+func (a *Assertion) assertRenderError(err error) []string {
+	ft := a.FailedTemplate
+	if err == nil {
+		return []string{"failedTemplate: expected the templates to fail to render"}
+	}
+	msg := err.Error()
+	if ft.ErrorMessage != "" && !strings.Contains(msg, ft.ErrorMessage) {
+		return []string{fmt.Sprintf("failedTemplate: expected an error containing %q, got %q", ft.ErrorMessage, msg)}
+	}
+	if ft.ErrorPattern != "" && !regexp.MustCompile(ft.ErrorPattern).MatchString(msg) {
+		return []string{fmt.Sprintf("failedTemplate: expected an error matching %q, got %q", ft.ErrorPattern, msg)}
+	}
+	return nil
+}
+
+// parsePath parses a JSONPath expression, adding the braces around it if they
+// are omitted.
+func parsePath(path string) (*jsonpath.JSONPath, error) {
+	if path == "" {
+		return nil, nil
+	}
+	expr := path
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+	jp := jsonpath.New("assertion").AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return nil, errors.Wrapf(err, "invalid path %q", path)
+	}
+	return jp, nil
+}
+
+// lookup returns the value at a path in a document, or a list of the values
+// if the path selects several of them. The empty path selects the document.
+func lookup(obj map[string]interface{}, path string) (interface{}, bool, error) {
+	jp, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if jp == nil {
+		return obj, true, nil
+	}
+	results, err := jp.FindResults(obj)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to evaluate path %q", path)
+	}
+	var values []interface{}
+	for _, result := range results {
+		for _, r := range result {
+			values = append(values, r.Interface())
+		}
+	}
+	switch len(values) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return values[0], true, nil
+	default:
+		return values, true, nil
+	}
+}
+
+// format formats a value of a document for a failure.
+func format(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
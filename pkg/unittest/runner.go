@@ -0,0 +1,317 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package unittest
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// defaultReleaseName is the name of the release the templates are rendered
+// for by default, like with 'helm template'.
+const defaultReleaseName = "RELEASE-NAME"
+
+// Runner runs the test suites of a chart.
+type Runner struct {
+	// ChartPath is the directory of the chart.
+	ChartPath string
+	// UpdateSnapshots rewrites the snapshots that do not match, and removes
+	// the ones no longer used, rather than failing.
+	UpdateSnapshots bool
+}
+
+// SuiteResult is the result of a test suite.
+type SuiteResult struct {
+	Suite *TestSuite
+	Tests []*TestResult
+	// Err is set if the suite could not run.
+	Err error
+	// SnapshotsWritten counts the snapshots written or updated.
+	SnapshotsWritten int
+}
+
+// TestResult is the result of a test.
+type TestResult struct {
+	Name     string
+	Failures []string
+}
+
+// NewRunner creates a new Runner for the chart in the given directory.
+func NewRunner(chartPath string) *Runner {
+	return &Runner{ChartPath: chartPath}
+}
+
+// Passed returns whether the test passed.
+func (r *TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Passed returns whether all of the tests of the suite passed.
+func (r *SuiteResult) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, t := range r.Tests {
+		if !t.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Run runs the tests of a suite.
+func (r *Runner) Run(suite *TestSuite) *SuiteResult {
+	result := &SuiteResult{Suite: suite}
+	snaps, err := loadSnapshots(suite.snapshotFile(), r.UpdateSnapshots)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	for _, test := range suite.Tests {
+		result.Tests = append(result.Tests, &TestResult{
+			Name:     test.It,
+			Failures: r.runTest(suite, test, snaps),
+		})
+	}
+	if err := snaps.save(); err != nil {
+		result.Err = errors.Wrap(err, "unable to write the snapshots")
+	}
+	result.SnapshotsWritten = snaps.written
+	return result
+}
+
+// runTest runs a test and returns its failures.
+func (r *Runner) runTest(suite *TestSuite, test *Test, snaps *snapshots) []string {
+	vals, err := testValues(suite, test)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	// the chart is loaded for each test, as processing its dependencies
+	// removes the disabled ones
+	chrt, err := loader.Load(r.ChartPath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if err := chartutil.ProcessDependencies(chrt, vals); err != nil {
+		return []string{err.Error()}
+	}
+	caps, err := suite.capabilities()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	options := chartutil.ReleaseOptions{
+		Name:      suite.Release.Name,
+		Namespace: suite.Release.Namespace,
+		Revision:  suite.Release.Revision,
+		IsUpgrade: suite.Release.Upgrade,
+		IsInstall: !suite.Release.Upgrade,
+	}
+	if options.Name == "" {
+		options.Name = defaultReleaseName
+	}
+	if options.Namespace == "" {
+		options.Namespace = "default"
+	}
+	if options.Revision == 0 {
+		options.Revision = 1
+	}
+	renderVals, err := chartutil.ToRenderValues(chrt, vals, options, caps)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	rendered, renderErr := engine.Render(chrt, renderVals)
+
+	ctx := &assertContext{test: test, snapshots: snaps}
+	var failures []string
+	if renderErr == nil {
+		templates := test.Templates
+		if len(templates) == 0 {
+			templates = suite.Templates
+		}
+		ctx.documents, failures = documents(chrt, rendered, templates)
+		if len(failures) > 0 {
+			return failures
+		}
+	}
+
+	for _, a := range test.Asserts {
+		switch {
+		case a.FailedTemplate != nil:
+			failures = append(failures, a.assertRenderError(renderErr)...)
+		case renderErr != nil:
+			// the other assertions need the templates to render
+			return append(failures, fmt.Sprintf("unable to render the templates: %s", renderErr))
+		default:
+			failures = append(failures, a.assert(ctx)...)
+		}
+	}
+	return failures
+}
+
+// documents returns the documents rendered by the templates matching the
+// given patterns, or by all of the templates if there are none. The partials
+// and NOTES.txt are never selected.
+func documents(chrt *chart.Chart, rendered map[string]string, patterns []string) ([]document, []string) {
+	var names []string
+	matched := make([]bool, len(patterns))
+	for name := range rendered {
+		rel := strings.TrimPrefix(name, chrt.Name()+"/")
+		base := path.Base(rel)
+		if strings.HasPrefix(base, "_") || base == "NOTES.txt" {
+			continue
+		}
+		selected := len(patterns) == 0
+		for i, p := range patterns {
+			if ok, _ := path.Match(p, rel); ok {
+				matched[i] = true
+				selected = true
+			}
+		}
+		if selected {
+			names = append(names, name)
+		}
+	}
+	var failures []string
+	for i, p := range patterns {
+		if !matched[i] {
+			failures = append(failures, fmt.Sprintf("template %q not found", p))
+		}
+	}
+	if len(failures) > 0 {
+		return nil, failures
+	}
+	sort.Strings(names)
+
+	var docs []document
+	for _, name := range names {
+		manifests := releaseutil.SplitManifests(rendered[name])
+		keys := make([]string, 0, len(manifests))
+		for k := range manifests {
+			keys = append(keys, k)
+		}
+		sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+		rel := strings.TrimPrefix(name, chrt.Name()+"/")
+		for _, k := range keys {
+			var obj map[string]interface{}
+			if err := yaml.Unmarshal([]byte(manifests[k]), &obj); err != nil {
+				failures = append(failures, fmt.Sprintf("unable to parse a document of %s: %s", rel, err))
+				continue
+			}
+			// skip the documents left empty by conditionals
+			if obj == nil {
+				continue
+			}
+			docs = append(docs, document{template: rel, object: obj})
+		}
+	}
+	return docs, failures
+}
+
+// testValues returns the values of a test: the values files and the set values
+// of the suite, then those of the test.
+func testValues(suite *TestSuite, test *Test) (chartutil.Values, error) {
+	vals := map[string]interface{}{}
+	layers := []struct {
+		files []string
+		set   map[string]interface{}
+	}{
+		{suite.Values, suite.Set},
+		{test.Values, test.Set},
+	}
+	for _, l := range layers {
+		for _, f := range l.files {
+			fileVals, err := chartutil.ReadValuesFile(suite.valuesFile(f))
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to read the values file %s", f)
+			}
+			vals = mergeMaps(vals, fileVals)
+		}
+		vals = mergeMaps(vals, expandSet(l.set))
+	}
+	return vals, nil
+}
+
+// expandSet turns values set by their dotted path into nested maps.
+func expandSet(set map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for key, v := range set {
+		parts := strings.Split(key, ".")
+		m := out
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := m[p].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				m[p] = next
+			}
+			m = next
+		}
+		m[parts[len(parts)-1]] = v
+	}
+	return out
+}
+
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = mergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// capabilities returns the capabilities of the cluster the templates are
+// rendered for.
+func (s *TestSuite) capabilities() (*chartutil.Capabilities, error) {
+	caps := *chartutil.DefaultCapabilities
+	caps.APIVersions = append(chartutil.VersionSet{}, caps.APIVersions...)
+	caps.APIVersions = append(caps.APIVersions, s.Capabilities.APIVersions...)
+	if s.Capabilities.KubeVersion != "" {
+		v, err := semver.NewVersion(s.Capabilities.KubeVersion)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid kubeVersion %q", s.Capabilities.KubeVersion)
+		}
+		caps.KubeVersion = chartutil.KubeVersion{
+			Version: "v" + v.String(),
+			Major:   fmt.Sprint(v.Major()),
+			Minor:   fmt.Sprint(v.Minor()),
+		}
+	}
+	return &caps, nil
+}
@@ -0,0 +1,272 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package unittest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testChart is the chart tested by the tests of the helm unittest command.
+const testChart = "../../cmd/helm/testdata/testcharts/chart-with-unittests"
+
+// copyChart copies the test chart without its snapshots to a temporary
+// directory, for its snapshots to be written.
+func copyChart(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "helm-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	src := testChart
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "__snapshot__" {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(src, path)
+		dst := filepath.Join(dir, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func runSuites(t *testing.T, r *Runner) []*SuiteResult {
+	t.Helper()
+	suites, err := LoadSuites(r.ChartPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []*SuiteResult
+	for _, s := range suites {
+		results = append(results, r.Run(s))
+	}
+	return results
+}
+
+func TestLoadSuites(t *testing.T) {
+	suites, err := LoadSuites(testChart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range suites {
+		names = append(names, s.Name)
+	}
+	if expected := []string{"deployment", "service"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected suites %v, got %v", expected, names)
+	}
+	if n := len(suites[0].Tests); n != 3 {
+		t.Errorf("expected 3 tests, got %d", n)
+	}
+	if suites[1].Release.Name != "web" {
+		t.Errorf("expected the release name web, got %q", suites[1].Release.Name)
+	}
+}
+
+func TestLoadSuite_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		suite  string
+		errMsg string
+	}{
+		{
+			name:   "no tests",
+			suite:  "suite: empty\n",
+			errMsg: "no tests",
+		},
+		{
+			name:   "unknown field",
+			suite:  "tests:\n  - it: works\n    assert: []\n",
+			errMsg: `unknown field "assert"`,
+		},
+		{
+			name:   "two kinds of assertion",
+			suite:  "tests:\n  - it: works\n    asserts:\n      - hasDocuments: {count: 1}\n        equal: {path: .kind, value: Pod}\n",
+			errMsg: "expected exactly one kind of assertion, got 2",
+		},
+		{
+			name:   "invalid pattern",
+			suite:  "tests:\n  - it: works\n    asserts:\n      - matchRegex: {path: .kind, pattern: '('}\n",
+			errMsg: `invalid pattern "("`,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "helm-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, "invalid_test.yaml")
+			if err := ioutil.WriteFile(file, []byte(tt.suite), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadSuite(file)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected an error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestRunner(t *testing.T) {
+	r := NewRunner(copyChart(t))
+
+	for _, result := range runSuites(t, r) {
+		if !result.Passed() {
+			t.Fatalf("expected the suite %s to pass, got %v %+v", result.Suite.Name, result.Err, result.Tests[0])
+		}
+		if result.Suite.Name == "deployment" && result.SnapshotsWritten != 1 {
+			t.Errorf("expected 1 snapshot written, got %d", result.SnapshotsWritten)
+		}
+	}
+	snapFile := filepath.Join(r.ChartPath, "tests", "__snapshot__", "deployment_test.yaml.snap")
+	snap, err := ioutil.ReadFile(snapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(snap), "renders a deployment 1:") || !strings.Contains(string(snap), "image: nginx:stable") {
+		t.Errorf("unexpected snapshot:\n%s", snap)
+	}
+
+	// the snapshots are only compared from now on
+	for _, result := range runSuites(t, r) {
+		if !result.Passed() || result.SnapshotsWritten != 0 {
+			t.Fatalf("expected the suite %s to pass without writing snapshots", result.Suite.Name)
+		}
+	}
+
+	changed := strings.Replace(string(snap), "replicas: 1", "replicas: 2", 1)
+	if err := ioutil.WriteFile(snapFile, []byte(changed+"obsolete 1: |\n  foo: bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result := runSuites(t, r)[0]
+	if result.Passed() {
+		t.Fatal("expected the deployment suite to fail")
+	}
+	failures := result.Tests[0].Failures
+	if len(failures) != 1 ||
+		!strings.Contains(failures[0], `document 0 (templates/deployment.yaml): matchSnapshot: does not match the snapshot "renders a deployment 1"`) ||
+		!strings.Contains(failures[0], "-replicas: 2\n+replicas: 1\n") {
+		t.Errorf("unexpected failures %q", failures)
+	}
+
+	r.UpdateSnapshots = true
+	result = runSuites(t, r)[0]
+	if !result.Passed() || result.SnapshotsWritten != 1 {
+		t.Fatalf("expected the snapshot to be updated, got %+v", result)
+	}
+	updated, err := ioutil.ReadFile(snapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(updated) != string(snap) {
+		t.Errorf("expected the obsolete snapshot to be removed, got\n%s", updated)
+	}
+}
+
+func TestRunner_Failures(t *testing.T) {
+	dir := copyChart(t)
+	suite := `templates:
+  - templates/*.yaml
+tests:
+  - it: fails
+    set:
+      replicaCount: 2
+    asserts:
+      - hasDocuments:
+          count: 1
+      - equal:
+          path: .spec.replicas
+          value: 3
+        documentIndex: 0
+      - matchRegex:
+          path: .metadata.name
+          pattern: ^web-
+      - equal:
+          path: .spec.missing
+          value: true
+        documentIndex: 5
+      - failedTemplate: {}
+  - it: fails to render
+    set:
+      image.repository: null
+    asserts:
+      - hasDocuments:
+          count: 1
+  - it: selects a missing template
+    templates:
+      - templates/ingress.yaml
+    asserts:
+      - hasDocuments:
+          count: 1
+`
+	file := filepath.Join(dir, "tests", "failures_test.yaml")
+	if err := ioutil.WriteFile(file, []byte(suite), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSuite(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := NewRunner(dir).Run(s)
+	if result.Passed() {
+		t.Fatal("expected the suite to fail")
+	}
+
+	expected := [][]string{
+		{
+			"hasDocuments: expected 1 documents, got 2",
+			"document 0 (templates/deployment.yaml): equal .spec.replicas: expected 3, got 2",
+			`document 0 (templates/deployment.yaml): matchRegex .metadata.name: "RELEASE-NAME-chart-with-unittests" does not match "^web-"`,
+			`document 1 (templates/service.yaml): matchRegex .metadata.name: "RELEASE-NAME-chart-with-unittests" does not match "^web-"`,
+			"equal: document 5 not found, got 2 documents",
+			"failedTemplate: expected the templates to fail to render",
+		},
+		{
+			"unable to render the templates: execution error at (chart-with-unittests/templates/deployment.yaml:12:21): image.repository is required",
+		},
+		{
+			`template "templates/ingress.yaml" not found`,
+		},
+	}
+	for i, test := range result.Tests {
+		if !reflect.DeepEqual(test.Failures, expected[i]) {
+			t.Errorf("test %q: expected failures\n%q\ngot\n%q", test.Name, expected[i], test.Failures)
+		}
+	}
+}
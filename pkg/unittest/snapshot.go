@@ -0,0 +1,127 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package unittest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+// snapshots are the snapshots of a test suite, stored as a YAML map from the
+// names of the snapshots to their content.
+type snapshots struct {
+	file   string
+	update bool
+
+	entries map[string]string
+	// seen records the snapshots matched, for the obsolete ones to be removed
+	// when the snapshots are updated.
+	seen map[string]bool
+	// written counts the snapshots written or updated.
+	written int
+	dirty   bool
+}
+
+func loadSnapshots(file string, update bool) (*snapshots, error) {
+	s := &snapshots{
+		file:    file,
+		update:  update,
+		entries: map[string]string{},
+		seen:    map[string]bool{},
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &s.entries); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse the snapshots %s", file)
+	}
+	if s.entries == nil {
+		s.entries = map[string]string{}
+	}
+	return s, nil
+}
+
+// match compares a value with its snapshot, writing the snapshot if there is
+// none or if the snapshots are updated. It returns why the value does not match
+// its snapshot, or "" if it does.
+func (s *snapshots) match(name string, v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to marshal the snapshot %q", name)
+	}
+	content := string(b)
+	s.seen[name] = true
+
+	expected, ok := s.entries[name]
+	if ok && expected == content {
+		return "", nil
+	}
+	if ok && !s.update {
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(expected),
+			B:        difflib.SplitLines(content),
+			FromFile: "snapshot",
+			ToFile:   "rendered",
+			Context:  3,
+		})
+		return fmt.Sprintf("does not match the snapshot %q\n%s", name, diff), nil
+	}
+	s.entries[name] = content
+	s.written++
+	s.dirty = true
+	return "", nil
+}
+
+// save writes the snapshots if they changed. When the snapshots are updated,
+// the ones no longer matched are removed.
+func (s *snapshots) save() error {
+	if s.update {
+		for name := range s.entries {
+			if !s.seen[name] {
+				delete(s.entries, name)
+				s.dirty = true
+			}
+		}
+	}
+	if !s.dirty {
+		return nil
+	}
+	if len(s.entries) == 0 {
+		if err := os.Remove(s.file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.file, data, 0644)
+}
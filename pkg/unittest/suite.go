@@ -0,0 +1,196 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package unittest tests the templates of a chart without a cluster.
+
+A chart ships test suites as YAML files matching tests/*_test.yaml. Each test
+of a suite sets values, renders the templates of the chart with the engine,
+and asserts on the documents rendered by some of them:
+
+	suite: deployment
+	templates:
+	  - templates/deployment.yaml
+	tests:
+	  - it: sets the replicas
+	    set:
+	      replicaCount: 3
+	    asserts:
+	      - hasDocuments:
+	          count: 1
+	      - equal:
+	          path: .spec.replicas
+	          value: 3
+*/
+package unittest // import "helm.sh/helm/v3/pkg/unittest"
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// SuitesGlob matches the files of the test suites of a chart, relative to
+// the directory of the chart.
+const SuitesGlob = "tests/*_test.yaml"
+
+// suiteFileSuffix is the suffix of the files of the test suites.
+const suiteFileSuffix = "_test.yaml"
+
+// TestSuite is a file of tests of the templates of a chart.
+type TestSuite struct {
+	// Name describes the suite. It defaults to the name of its file.
+	Name string `json:"suite,omitempty"`
+	// Templates are the templates the tests are about, relative to the
+	// directory of the chart, such as "templates/deployment.yaml". They may
+	// be globs. By default, the tests are about all of the templates.
+	Templates []string `json:"templates,omitempty"`
+	// Release describes the release the templates are rendered for.
+	Release Release `json:"release,omitempty"`
+	// Capabilities describes the cluster the templates are rendered for.
+	Capabilities Capabilities `json:"capabilities,omitempty"`
+	// Values are values files, relative to the file of the suite, merged in
+	// order over the values of the chart.
+	Values []string `json:"values,omitempty"`
+	// Set sets values by their dotted path, such as "image.tag", over the
+	// values files.
+	Set map[string]interface{} `json:"set,omitempty"`
+	// Tests are the tests of the suite.
+	Tests []*Test `json:"tests"`
+
+	file string
+}
+
+// Release describes the release the templates of a chart are rendered for.
+type Release struct {
+	// Name defaults to "RELEASE-NAME".
+	Name string `json:"name,omitempty"`
+	// Namespace defaults to "default".
+	Namespace string `json:"namespace,omitempty"`
+	// Revision defaults to 1.
+	Revision int `json:"revision,omitempty"`
+	// Upgrade sets .Release.IsUpgrade rather than .Release.IsInstall.
+	Upgrade bool `json:"upgrade,omitempty"`
+}
+
+// Capabilities describes the cluster the templates of a chart are rendered
+// for.
+type Capabilities struct {
+	// KubeVersion is the version of Kubernetes, such as "v1.20.0".
+	KubeVersion string `json:"kubeVersion,omitempty"`
+	// APIVersions are API versions available in addition to the default
+	// ones, such as "monitoring.coreos.com/v1".
+	APIVersions []string `json:"apiVersions,omitempty"`
+}
+
+// Test sets values, renders the templates of a chart, and asserts on the
+// documents rendered.
+type Test struct {
+	// It describes what is tested.
+	It string `json:"it"`
+	// Templates override the templates of the suite.
+	Templates []string `json:"templates,omitempty"`
+	// Values are values files, relative to the file of the suite, merged in
+	// order over the values of the suite.
+	Values []string `json:"values,omitempty"`
+	// Set sets values by their dotted path over the values of the suite and
+	// the values files of the test.
+	Set map[string]interface{} `json:"set,omitempty"`
+	// Asserts are the assertions of the test.
+	Asserts []*Assertion `json:"asserts"`
+}
+
+// File returns the path of the file of the suite.
+func (s *TestSuite) File() string {
+	return s.file
+}
+
+// LoadSuites loads the test suites of the chart in the given directory.
+func LoadSuites(chartDir string) ([]*TestSuite, error) {
+	files, err := filepath.Glob(filepath.Join(chartDir, filepath.FromSlash(SuitesGlob)))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	suites := make([]*TestSuite, 0, len(files))
+	for _, file := range files {
+		suite, err := LoadSuite(file)
+		if err != nil {
+			return nil, err
+		}
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
+
+// LoadSuite loads a test suite from a file.
+func LoadSuite(filename string) (*TestSuite, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	suite := &TestSuite{}
+	if err := yaml.UnmarshalStrict(data, suite); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse the test suite %s", filename)
+	}
+	suite.file = filename
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(filename), suiteFileSuffix)
+	}
+	if err := suite.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid test suite %s", filename)
+	}
+	return suite, nil
+}
+
+func (s *TestSuite) validate() error {
+	if len(s.Tests) == 0 {
+		return errors.New("no tests")
+	}
+	for i, test := range s.Tests {
+		if test.It == "" {
+			return errors.Errorf("test %d: 'it' is required", i+1)
+		}
+		if len(test.Asserts) == 0 {
+			return errors.Errorf("test %q: no asserts", test.It)
+		}
+		for j, a := range test.Asserts {
+			if err := a.validate(); err != nil {
+				return errors.Wrapf(err, "test %q: assertion %d", test.It, j+1)
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotFile returns the path of the file of the snapshots of the suite:
+// tests/__snapshot__/NAME_test.yaml.snap for the suite tests/NAME_test.yaml.
+func (s *TestSuite) snapshotFile() string {
+	return filepath.Join(filepath.Dir(s.file), "__snapshot__", filepath.Base(s.file)+".snap")
+}
+
+// valuesFile returns the path of a values file of the suite.
+func (s *TestSuite) valuesFile(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(s.file), filepath.FromSlash(name))
+}